@@ -0,0 +1,99 @@
+package wiiudownloader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Status of a title folder of an archive
+const (
+	ARCHIVE_STATUS_COMPLETE   = "complete"
+	ARCHIVE_STATUS_INCOMPLETE = "incomplete" // contents are missing, or the download didn't finish
+	ARCHIVE_STATUS_SLIMMED    = "slimmed"    // only the metadata was kept, see SlimTitle
+	ARCHIVE_STATUS_UNREADABLE = "unreadable" // its title.tmd can't be read
+)
+
+// ArchiveTitle is what ScanArchive found out about a title folder.
+type ArchiveTitle struct {
+	Path           string     `json:"path"` // relative to the scanned folder
+	TitleID        string     `json:"titleID,omitempty"`
+	Name           string     `json:"name,omitempty"`
+	Version        uint16     `json:"version"`
+	Status         string     `json:"status"` // one of the ARCHIVE_STATUS_* values
+	Decrypted      bool       `json:"decrypted"`
+	Verified       bool       `json:"verified"` // the last verification of the contents passed
+	LastVerifiedAt *time.Time `json:"lastVerifiedAt,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// ScanArchive finds the title folders below root, the folders with a
+// title.tmd, and reports whether they are complete and when their contents
+// were last verified, from their manifest. It only reads, nothing is hashed:
+// VerifyTitle records its result in the manifest for the next scan.
+func ScanArchive(root string) ([]ArchiveTitle, error) {
+	titles := make([]ArchiveTitle, 0)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// An unreadable folder doesn't hide the rest of the archive
+			if path != root && entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, "title.tmd")); err != nil {
+			return nil
+		}
+		titles = append(titles, scanArchiveTitle(root, path))
+		// Decrypted files in the title folder are not titles of their own
+		return fs.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(titles, func(i, j int) bool {
+		return titles[i].Path < titles[j].Path
+	})
+	return titles, nil
+}
+
+func scanArchiveTitle(root, path string) ArchiveTitle {
+	title := ArchiveTitle{Path: path}
+	if relativePath, err := filepath.Rel(root, path); err == nil {
+		title.Path = filepath.ToSlash(relativePath)
+	}
+	tmd, err := readTMDFromDir(path)
+	if err != nil {
+		title.Status = ARCHIVE_STATUS_UNREADABLE
+		title.Error = err.Error()
+		return title
+	}
+	title.TitleID = fmt.Sprintf("%016x", tmd.TitleID)
+	title.Name = GetTitleEntryFromTid(tmd.TitleID).Name
+	title.Version = tmd.TitleVersion
+	title.Status = ARCHIVE_STATUS_INCOMPLETE
+	if IsTitleDownloaded(path, tmd.TitleID, tmd.TitleVersion) {
+		title.Status = ARCHIVE_STATUS_COMPLETE
+	}
+
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		return title
+	}
+	if manifest.Name != "" {
+		title.Name = manifest.Name
+	}
+	if manifest.Slimmed {
+		title.Status = ARCHIVE_STATUS_SLIMMED
+	}
+	title.Decrypted = manifest.Decrypted
+	title.LastVerifiedAt = manifest.LastVerifiedAt
+	title.Verified = manifest.LastVerifiedAt != nil && !manifest.LastVerificationFailed
+	return title
+}
@@ -0,0 +1,53 @@
+package wiiudownloader
+
+import (
+	"sync"
+	"time"
+)
+
+// BandwidthLimiter throttles writers to a speed that is polled on every write,
+// so changes apply live. Every title is limited to the BandwidthLimit of its
+// ProgressReporter, a limiter passed to WithSharedBandwidthLimiter also limits
+// all the titles downloaded at the same time with it together.
+type BandwidthLimiter struct {
+	limit    func() int64
+	mutex    sync.Mutex
+	current  int64
+	start    time.Time
+	consumed int64
+}
+
+// NewBandwidthLimiter returns a limiter to the speed returned by limit, in
+// bytes per second, 0 means unlimited.
+func NewBandwidthLimiter(limit func() int64) *BandwidthLimiter {
+	return &BandwidthLimiter{limit: limit}
+}
+
+func newBandwidthLimiter(progressReporter ProgressReporter) *BandwidthLimiter {
+	return NewBandwidthLimiter(progressReporter.BandwidthLimit)
+}
+
+func (bl *BandwidthLimiter) wait(n int) {
+	if bl == nil {
+		return
+	}
+
+	bl.mutex.Lock()
+	limit := bl.limit()
+	if limit != bl.current {
+		bl.current = limit
+		bl.start = time.Now()
+		bl.consumed = 0
+	}
+	if limit <= 0 {
+		bl.mutex.Unlock()
+		return
+	}
+	bl.consumed += int64(n)
+	sleep := time.Duration(float64(bl.consumed)/float64(limit)*float64(time.Second)) - time.Since(bl.start)
+	bl.mutex.Unlock()
+
+	if sleep > 0 {
+		time.Sleep(sleep)
+	}
+}
@@ -0,0 +1,87 @@
+package wiiudownloader
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// defaultBufferMemoryBudget is the memory the buffers of the high performance
+// writes may take at once, enough for a dozen transfers.
+const defaultBufferMemoryBudget = 64 * 1024 * 1024
+
+var (
+	copyBufferPool = sync.Pool{New: func() interface{} {
+		buffer := make([]byte, largeCopyBufferSize)
+		return &buffer
+	}}
+	writeBufferPool = sync.Pool{New: func() interface{} {
+		return bufio.NewWriterSize(nil, largeWriteBufferSize)
+	}}
+
+	bufferMemoryMutex  sync.Mutex
+	bufferMemoryBudget int64 = defaultBufferMemoryBudget
+	bufferMemoryUsed   int64
+)
+
+// SetBufferMemoryBudget limits the memory taken at once by the large buffers
+// of the high performance writes, shared by every download of the process.
+// The transfers that start once it is used up go without them, so running
+// many downloads in parallel doesn't make the memory usage balloon. 0 goes
+// back to the default of 64 MiB.
+func SetBufferMemoryBudget(bytes int64) {
+	bufferMemoryMutex.Lock()
+	defer bufferMemoryMutex.Unlock()
+	if bytes <= 0 {
+		bytes = defaultBufferMemoryBudget
+	}
+	bufferMemoryBudget = bytes
+}
+
+// transferBuffers are the pooled buffers a transfer with high performance
+// writes copies and writes with.
+type transferBuffers struct {
+	writer     *bufio.Writer // nil unless a buffered writer was asked for
+	copyBuffer *[]byte
+	size       int64 // taken from the memory budget
+}
+
+// getTransferBuffers returns the buffers for a transfer, with a buffered
+// writer to w when buffered is set, or nil when the memory budget is used up.
+// They must be given back with release once the transfer is flushed.
+func getTransferBuffers(w io.Writer, buffered bool) *transferBuffers {
+	size := int64(largeCopyBufferSize)
+	if buffered {
+		size += largeWriteBufferSize
+	}
+	bufferMemoryMutex.Lock()
+	if bufferMemoryUsed+size > bufferMemoryBudget {
+		bufferMemoryMutex.Unlock()
+		return nil
+	}
+	bufferMemoryUsed += size
+	bufferMemoryMutex.Unlock()
+
+	buffers := &transferBuffers{copyBuffer: copyBufferPool.Get().(*[]byte), size: size}
+	if buffered {
+		buffers.writer = writeBufferPool.Get().(*bufio.Writer)
+		buffers.writer.Reset(w)
+	}
+	return buffers
+}
+
+// release gives the buffers back to the pools, it does nothing on nil.
+func (b *transferBuffers) release() {
+	if b == nil {
+		return
+	}
+	copyBufferPool.Put(b.copyBuffer)
+	if b.writer != nil {
+		// Don't keep the file alive from the pool
+		b.writer.Reset(nil)
+		writeBufferPool.Put(b.writer)
+	}
+	bufferMemoryMutex.Lock()
+	bufferMemoryUsed -= b.size
+	bufferMemoryMutex.Unlock()
+}
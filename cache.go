@@ -0,0 +1,36 @@
+package wiiudownloader
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	cacheDirectory      string
+	cacheDirectoryMutex sync.Mutex
+)
+
+// SetCacheDirectory keeps the caches of the library, like the XS certificate
+// and what is known of the titles, in path instead of the WiiUDownloader
+// folder of the user cache folder. It is meant for portable installs and must
+// be called before anything is cached, an empty path goes back to the default.
+func SetCacheDirectory(path string) {
+	cacheDirectoryMutex.Lock()
+	defer cacheDirectoryMutex.Unlock()
+	cacheDirectory = path
+}
+
+// GetCacheDirectory returns the folder the caches are kept in.
+func GetCacheDirectory() (string, error) {
+	cacheDirectoryMutex.Lock()
+	defer cacheDirectoryMutex.Unlock()
+	if cacheDirectory != "" {
+		return cacheDirectory, nil
+	}
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userCacheDir, "WiiUDownloader"), nil
+}
@@ -0,0 +1,64 @@
+package wiiudownloader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// cemuTitleFolders are the folders of a decrypted title that Cemu loads.
+var cemuTitleFolders = []string{"code", "content", "meta"}
+
+// CemuTitlePath returns the folder of a title in the mlc01 folder of Cemu:
+// usr/title/<high>/<low> for games, updates and DLC, each in their own folder
+// as on the console, and sys/title/<high>/<low> for system titles.
+func CemuTitlePath(mlcPath string, titleID uint64) string {
+	root := "usr"
+	if IsSystemTitle(titleID) {
+		root = "sys"
+	}
+	return filepath.Join(mlcPath, root, "title", fmt.Sprintf("%08x", TIDHigh(titleID)), fmt.Sprintf("%08x", TIDLow(titleID)))
+}
+
+// InstallToCemu puts the decrypted title at decryptedPath in the mlc01 folder
+// of Cemu, so it shows up in its game list with its update and DLC. Files are
+// hard linked when both folders are on the same drive and copied otherwise. A
+// version of the title already installed is replaced.
+func InstallToCemu(decryptedPath string, mlcPath string, titleID uint64) error {
+	if info, err := os.Stat(mlcPath); err != nil || !info.IsDir() {
+		return fmt.Errorf(Localize("the Cemu mlc01 folder %s doesn't exist"), mlcPath)
+	}
+	if _, err := os.Stat(filepath.Join(decryptedPath, "code")); err != nil {
+		return fmt.Errorf(Localize("%s isn't a decrypted title, it has no code folder"), decryptedPath)
+	}
+
+	titlePath := CemuTitlePath(mlcPath, titleID)
+	if err := os.RemoveAll(titlePath); err != nil {
+		return err
+	}
+	for _, folder := range cemuTitleFolders {
+		src := filepath.Join(decryptedPath, folder)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relativePath, err := filepath.Rel(decryptedPath, path)
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(titlePath, relativePath)
+			if entry.IsDir() {
+				return os.MkdirAll(dst, os.ModePerm)
+			}
+			return linkOrCopyFile(path, dst)
+		})
+		if err != nil {
+			return checkDiskFull(err)
+		}
+	}
+	return nil
+}
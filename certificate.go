@@ -1,60 +1,168 @@
 package wiiudownloader
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
-	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Xpl0itU/WiiUDownloader/tmd"
+)
+
+const (
+	// xsCertificateURL is a ticket of the CDN, its certificate chain has the XS
+	// certificate that signs every ticket
+	xsCertificateURL      = "http://ccs.cdn.c.shop.nintendowifi.net/ccs/download/000500101000400a/cetk"
+	xsCertificateFilename = "xs.cert"
 )
 
-var cetkData []byte
+var (
+	xsCertificate      []byte
+	xsCertificateMutex sync.Mutex
+)
 
-func getDefaultCert(progressReporter ProgressReporter, client *http.Client) ([]byte, error) {
-	if len(cetkData) >= 0x350+0x300 {
-		return cetkData[0x350 : 0x350+0x300], nil
+// findXSCertificate returns the XS certificate of a certificate chain, nil when
+// it has none.
+func findXSCertificate(data []byte) []byte {
+	certificates, err := tmd.UnmarshalCertificates(data)
+	if err != nil {
+		return nil
 	}
-	cetkDir := path.Join(os.TempDir(), "cetk")
-	if err := downloadFile(progressReporter, client, "http://ccs.cdn.c.shop.nintendowifi.net/ccs/download/000500101000400a/cetk", cetkDir, true); err != nil {
-		return nil, err
+	for _, certificate := range certificates {
+		if strings.HasPrefix(certificate.Name(), "XS") {
+			encoded, err := certificate.Marshal()
+			if err != nil {
+				return nil
+			}
+			return encoded
+		}
 	}
-	cetkData, err := os.ReadFile(cetkDir)
+	return nil
+}
+
+func getXSCertificateCachePath() (string, error) {
+	cacheDirectory, err := GetCacheDirectory()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return filepath.Join(cacheDirectory, xsCertificateFilename), nil
+}
 
-	if err := os.Remove(cetkDir); err != nil {
-		return nil, err
+// getXSCertificate returns the XS certificate from the certificate chain of a
+// CDN ticket, the cache, or downloads it once and caches it. Without a client
+// it is never downloaded, ctx and requestTimeout abort the download.
+func getXSCertificate(ctx context.Context, ticketData []byte, client *http.Client, requestTimeout time.Duration, paused func() bool) ([]byte, error) {
+	xsCertificateMutex.Lock()
+	defer xsCertificateMutex.Unlock()
+	if ticket, err := tmd.UnmarshalTicket(ticketData); err == nil {
+		if certificate := findXSCertificate(ticket.Certificates); certificate != nil {
+			if xsCertificate == nil {
+				cacheXSCertificate(certificate)
+			}
+			return certificate, nil
+		}
 	}
 
-	if len(cetkData) >= 0x350+0x300 {
-		return cetkData[0x350 : 0x350+0x300], nil
+	if xsCertificate != nil {
+		return xsCertificate, nil
+	}
+	if cachePath, err := getXSCertificateCachePath(); err == nil {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			if certificate := findXSCertificate(data); certificate != nil {
+				xsCertificate = certificate
+				return xsCertificate, nil
+			}
+		}
+	}
+	if client == nil {
+		return nil, wrapKind(ErrTicketUnavailable, fmt.Errorf(Localize("the XS certificate isn't cached yet, build a title.cert once with network access")))
 	}
-	return nil, fmt.Errorf("failed to download OSv10 cetk, length: %d", len(cetkData))
-}
 
-func GenerateCert(tmd *TMD, outputPath string, progressReporter ProgressReporter, client *http.Client) error {
-	cert, err := os.Create(outputPath)
+	requestCtx, watchdog := newRequestWatchdog(ctx, requestTimeout, 0, paused)
+	defer watchdog.stop()
+	req, err := http.NewRequestWithContext(requestCtx, "GET", xsCertificateURL, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer cert.Close()
-
-	if err := binary.Write(cert, binary.BigEndian, tmd.Certificate1); err != nil {
-		return err
+	req.Header.Set("User-Agent", "WiiUDownloader")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, wrapKind(ErrTicketUnavailable, watchdog.err(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, wrapKind(ErrCDNStatus, fmt.Errorf(Localize("cetk download error, status code: %d"), resp.StatusCode))
+	}
+	cetkData, err := io.ReadAll(watchdog.watch(resp.Body))
+	if err != nil {
+		return nil, wrapKind(ErrTicketUnavailable, watchdog.err(err))
+	}
+	ticket, err := tmd.UnmarshalTicket(cetkData)
+	if err != nil {
+		return nil, wrapKind(ErrTicketUnavailable, fmt.Errorf(Localize("failed to download OSv10 cetk, length: %d"), len(cetkData)))
+	}
+	certificate := findXSCertificate(ticket.Certificates)
+	if certificate == nil {
+		return nil, wrapKind(ErrTicketUnavailable, fmt.Errorf(Localize("failed to download OSv10 cetk, length: %d"), len(cetkData)))
 	}
 
-	if err := binary.Write(cert, binary.BigEndian, tmd.Certificate2); err != nil {
-		return err
+	cacheXSCertificate(certificate)
+	return xsCertificate, nil
+}
+
+// cacheXSCertificate keeps the XS certificate for the titles built offline, it
+// is downloaded again if it can't be written.
+func cacheXSCertificate(certificate []byte) {
+	xsCertificate = certificate
+	cachePath, err := getXSCertificateCachePath()
+	if err != nil {
+		return
 	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		os.WriteFile(cachePath, certificate, 0644)
+	}
+}
 
-	defaultCert, err := getDefaultCert(progressReporter, client)
+// BuildCertChain returns the title.cert of a title: the CA and CP certificates
+// the CDN appends to its TMD, followed by the XS certificate that signs
+// tickets. The XS certificate is taken from ticketData when it is a ticket of
+// the CDN, from the cache otherwise, and is only downloaded the first time.
+// With a nil client nothing is downloaded.
+func BuildCertChain(tmd *TMD, ticketData []byte, client *http.Client) ([]byte, error) {
+	return buildCertChain(context.Background(), tmd, ticketData, client, 0, nil)
+}
+
+func buildCertChain(ctx context.Context, tmd *TMD, ticketData []byte, client *http.Client, requestTimeout time.Duration, paused func() bool) ([]byte, error) {
+	xsCertificate, err := getXSCertificate(ctx, ticketData, client, requestTimeout, paused)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	chain := bytes.Buffer{}
+	chain.Write(tmd.Certificate1)
+	chain.Write(tmd.Certificate2)
+	chain.Write(xsCertificate)
+	return chain.Bytes(), nil
+}
 
-	if err := binary.Write(cert, binary.BigEndian, defaultCert); err != nil {
+// GenerateCert writes the title.cert of a title to outputPath, see
+// BuildCertChain. The title.tik next to it is used when there is one.
+func GenerateCert(tmd *TMD, outputPath string, progressReporter ProgressReporter, client *http.Client) error {
+	return generateCert(context.Background(), tmd, outputPath, client, 0, nil)
+}
+
+// generateCert is GenerateCert for downloadTitle, ctx and requestTimeout abort
+// the download of the XS certificate like the files of the title.
+func generateCert(ctx context.Context, tmd *TMD, outputPath string, client *http.Client, requestTimeout time.Duration, paused func() bool) error {
+	ticketData, _ := os.ReadFile(filepath.Join(filepath.Dir(outputPath), "title.tik"))
+	chain, err := buildCertChain(ctx, tmd, ticketData, client, requestTimeout, paused)
+	if err != nil {
 		return err
 	}
-	return nil
+	return os.WriteFile(outputPath, chain, 0644)
 }
@@ -0,0 +1,138 @@
+package wiiudownloader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	IP_VERSION_AUTO = ""     // happy eyeballs: IPv6 and IPv4 are raced, the first to connect wins
+	IP_VERSION_4    = "ipv4" // only connect over IPv4
+	IP_VERSION_6    = "ipv6" // only connect over IPv6
+)
+
+// happyEyeballsFallbackDelay is how long a connection attempt over the preferred
+// address family gets before the other family is tried too.
+const happyEyeballsFallbackDelay = 300 * time.Millisecond
+
+// ClientOptions customizes the requests made by the HTTP client returned by
+// NewHTTPClient, for users going through caching proxies or mirrors.
+type ClientOptions struct {
+	UserAgent    string            // replaces the User-Agent of every request when not empty
+	ExtraHeaders map[string]string // added to every request
+	IPVersion    string            // one of IP_VERSION_AUTO, IP_VERSION_4 or IP_VERSION_6
+	// HostOverrides maps hostnames, like the one of the CDN, to the IP address or
+	// hostname to connect to instead, like a hosts file would.
+	HostOverrides map[string]string
+}
+
+// headerTransport injects the headers of the ClientOptions into every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	options ClientOptions
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.options.UserAgent == "" && len(t.options.ExtraHeaders) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	if t.options.UserAgent != "" {
+		req.Header.Set("User-Agent", t.options.UserAgent)
+	}
+	for name, value := range t.options.ExtraHeaders {
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newDialContext returns a dial function restricted to the address family of
+// ipVersion. Some networks resolve the CDN to IPv6 addresses that can't be
+// reached, which the happy eyeballs fallback of the dialer works around.
+// Hosts in hostOverrides are dialed at their override, the requests keep their
+// original Host header.
+func newDialContext(ipVersion string, hostOverrides map[string]string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:       30 * time.Second,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: happyEyeballsFallbackDelay,
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			if override, ok := hostOverrides[strings.ToLower(host)]; ok {
+				address = net.JoinHostPort(override, port)
+			}
+		}
+		if network == "tcp" {
+			switch ipVersion {
+			case IP_VERSION_4:
+				network = "tcp4"
+			case IP_VERSION_6:
+				network = "tcp6"
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
+
+func NewHTTPClient(options ClientOptions) *http.Client {
+	return &http.Client{
+		Transport: &headerTransport{
+			base: &http.Transport{
+				DialContext:           newDialContext(options.IPVersion, options.HostOverrides),
+				MaxIdleConns:          100,
+				MaxIdleConnsPerHost:   100,
+				MaxConnsPerHost:       100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+			options: options,
+		},
+	}
+}
+
+// ParseHeaders parses headers written as "Name: value", one per entry.
+func ParseHeaders(lines []string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf(Localize("invalid header, expected \"Name: value\": %q"), line)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// ParseHostOverrides parses host overrides written in the hosts file format, an
+// address followed by the hostnames that resolve to it. Everything after a # is
+// a comment.
+func ParseHostOverrides(lines []string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, line := range lines {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf(Localize("invalid host override, expected \"address hostname\": %q"), strings.TrimSpace(line))
+		}
+		for _, hostname := range fields[1:] {
+			overrides[strings.ToLower(hostname)] = fields[0]
+		}
+	}
+	return overrides, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+// #cgo pkg-config: gtk+-3.0
+// #include <stdlib.h>
+// #include <gtk/gtk.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// gotk3 has no bindings for ATK, the accessibility toolkit screen readers talk
+// to through GTK, the few calls needed are made directly.
+
+func getAccessible(widget gtk.IWidget) *C.AtkObject {
+	return C.gtk_widget_get_accessible((*C.GtkWidget)(unsafe.Pointer(widget.ToWidget().Native())))
+}
+
+// setAccessibleName sets what screen readers announce for widgets without a
+// label of their own, like entries, lists and progress bars.
+func setAccessibleName(widget gtk.IWidget, name string) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	C.atk_object_set_name(getAccessible(widget), cName)
+}
+
+// setAccessibleDescription sets what screen readers announce after the name
+// of a widget, the same as its tooltip for most of them.
+func setAccessibleDescription(widget gtk.IWidget, description string) {
+	cDescription := C.CString(description)
+	defer C.free(unsafe.Pointer(cDescription))
+	C.atk_object_set_description(getAccessible(widget), cDescription)
+}
+
+// labelWidget makes screen readers announce label as the name of widget, which
+// is what the label describes in the layout.
+func labelWidget(label *gtk.Label, widget gtk.IWidget) {
+	label.SetMnemonicWidget(widget)
+}
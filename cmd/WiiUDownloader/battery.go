@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const batteryPollInterval = 30 * time.Second
+
+type batteryStatus struct {
+	onBattery bool
+	percent   int
+}
+
+var batteryPercentRegexp = regexp.MustCompile(`(\d+)%`)
+
+// getBatteryStatus reports whether the machine is running on battery, ok is false
+// when the OS does not expose it or there is no battery at all.
+func getBatteryStatus() (status batteryStatus, ok bool) {
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := exec.Command("pmset", "-g", "batt").Output()
+		if err != nil {
+			return status, false
+		}
+		match := batteryPercentRegexp.FindStringSubmatch(string(output))
+		if match == nil {
+			return status, false
+		}
+		status.percent, _ = strconv.Atoi(match[1])
+		status.onBattery = strings.Contains(string(output), "'Battery Power'")
+		return status, true
+
+	case "windows":
+		output, err := exec.Command("WMIC", "Path", "Win32_Battery", "Get", "BatteryStatus,EstimatedChargeRemaining", "/value").Output()
+		if err != nil {
+			return status, false
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+			if !found {
+				continue
+			}
+			switch key {
+			case "BatteryStatus":
+				status.onBattery = value == "1" // Discharging
+				ok = true
+			case "EstimatedChargeRemaining":
+				status.percent, _ = strconv.Atoi(value)
+			}
+		}
+		return status, ok
+
+	case "linux":
+		supplies, err := filepath.Glob("/sys/class/power_supply/*")
+		if err != nil {
+			return status, false
+		}
+		for _, supply := range supplies {
+			supplyType, err := os.ReadFile(filepath.Join(supply, "type"))
+			if err != nil || strings.TrimSpace(string(supplyType)) != "Battery" {
+				continue
+			}
+			capacity, err := os.ReadFile(filepath.Join(supply, "capacity"))
+			if err != nil {
+				continue
+			}
+			state, err := os.ReadFile(filepath.Join(supply, "status"))
+			if err != nil {
+				continue
+			}
+			status.percent, _ = strconv.Atoi(strings.TrimSpace(string(capacity)))
+			status.onBattery = strings.TrimSpace(string(state)) == "Discharging"
+			return status, true
+		}
+	}
+
+	return status, false
+}
+
+func shouldPauseForBattery(config *Config) bool {
+	if !config.PauseOnBattery {
+		return false
+	}
+	status, ok := getBatteryStatus()
+	return ok && status.onBattery && status.percent < int(config.BatteryPauseThreshold)
+}
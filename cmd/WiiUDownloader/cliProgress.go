@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/dustin/go-humanize"
+)
+
+// cliProgressReporter is the ProgressReporter used by the headless commands, it
+// prints a line for every finished file instead of drawing a progress bar.
+type cliProgressReporter struct {
+	out             io.Writer
+	mutex           sync.Mutex
+	cancelled       bool
+	totalToDownload int64
+	totalDownloaded int64
+	progressPerFile map[string]int64
+}
+
+func newCLIProgressReporter(out io.Writer) *cliProgressReporter {
+	return &cliProgressReporter{out: out, progressPerFile: make(map[string]int64)}
+}
+
+func (cp *cliProgressReporter) SetGameTitle(title string) {
+	fmt.Fprintln(cp.out, title)
+}
+
+func (cp *cliProgressReporter) UpdateDownloadProgress(downloaded int64, filename string) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	cp.progressPerFile[filename] += downloaded
+}
+
+func (cp *cliProgressReporter) UpdateDecryptionProgress(progress float64) {}
+
+func (cp *cliProgressReporter) Cancelled() bool {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	return cp.cancelled
+}
+
+func (cp *cliProgressReporter) SetCancelled() {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	cp.cancelled = true
+}
+
+func (cp *cliProgressReporter) Paused() bool {
+	return false
+}
+
+func (cp *cliProgressReporter) BandwidthLimit() int64 {
+	return 0
+}
+
+func (cp *cliProgressReporter) SetDownloadSize(size int64) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	cp.totalToDownload = size
+}
+
+func (cp *cliProgressReporter) ResetTotals() {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	cp.totalToDownload = 0
+	cp.totalDownloaded = 0
+	cp.progressPerFile = make(map[string]int64)
+}
+
+func (cp *cliProgressReporter) MarkFileAsDone(filename string) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	cp.totalDownloaded += cp.progressPerFile[filename]
+	delete(cp.progressPerFile, filename)
+	fmt.Fprintf(cp.out, "  "+wiiudownloader.Localize("%s done (%s / %s)")+"\n", filename, humanize.Bytes(uint64(cp.totalDownloaded)), humanize.Bytes(uint64(cp.totalToDownload)))
+}
+
+func (cp *cliProgressReporter) SetTotalDownloadedForFile(filename string, downloaded int64) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	cp.progressPerFile[filename] = downloaded
+}
+
+func (cp *cliProgressReporter) SetStartTime(startTime time.Time) {}
+
+func (cp *cliProgressReporter) SetPhase(phase wiiudownloader.ProgressPhase) {
+	switch phase {
+	case wiiudownloader.PROGRESS_PHASE_METADATA:
+		fmt.Fprintln(cp.out, "  "+wiiudownloader.Localize("Fetching metadata..."))
+	case wiiudownloader.PROGRESS_PHASE_DOWNLOADING:
+		fmt.Fprintln(cp.out, "  "+wiiudownloader.Localize("Downloading contents..."))
+	case wiiudownloader.PROGRESS_PHASE_DECRYPTING:
+		fmt.Fprintln(cp.out, "  "+wiiudownloader.Localize("Decrypting..."))
+	case wiiudownloader.PROGRESS_PHASE_ARCHIVING:
+		fmt.Fprintln(cp.out, "  "+wiiudownloader.Localize("Packing into an archive..."))
+	}
+}
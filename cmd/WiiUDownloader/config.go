@@ -4,7 +4,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"time"
 
 	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
 	"github.com/knadh/koanf/parsers/json"
@@ -14,11 +17,66 @@ import (
 )
 
 type Config struct {
-	DarkMode                bool  `koanf:"darkMode"`
-	DecryptContents         bool  `koanf:"decryptContents"`
-	DeleteEncryptedContents bool  `koanf:"deleteEncryptedContents"`
-	SelectedRegion          uint8 `koanf:"selectedRegion"`
-	DidInitialSetup         bool  `koanf:"didInitialSetup"`
+	Theme                   string   `koanf:"theme"` // one of the THEME_* values
+	DecryptContents         bool     `koanf:"decryptContents"`
+	DeleteEncryptedContents bool     `koanf:"deleteEncryptedContents"`
+	EncryptedContentsPolicy string   `koanf:"encryptedContentsPolicy"` // one of the wiiudownloader.ENCRYPTED_CONTENTS_* values, empty follows DeleteEncryptedContents
+	SelectedRegion          uint8    `koanf:"selectedRegion"`
+	SelectedCategory        uint8    `koanf:"selectedCategory"`
+	GameSubcategory         uint8    `koanf:"gameSubcategory"` // one of the GAME_SUBCATEGORY_* values
+	MaxOSVersion            uint8    `koanf:"maxOSVersion"`    // only list the titles this OS version can install, 0 lists them all
+	Genre                   string   `koanf:"genre"`           // only list the titles of this genre, empty lists them all
+	MinPlayers              uint8    `koanf:"minPlayers"`      // only list the titles for at least this many players, 0 lists them all
+	Language                uint16   `koanf:"language"`        // only list the titles in this wiiudownloader.LANGUAGE_* language, 0 lists them all
+	LastDownloadDirectory   string   `koanf:"lastDownloadDirectory"`
+	LastDecryptedDirectory  string   `koanf:"lastDecryptedDirectory"`
+	FavoriteTitles          []string `koanf:"favoriteTitles"` // title IDs shown in the Favorites category
+	HiddenTitles            []string `koanf:"hiddenTitles"`   // title IDs never shown in the list
+	WindowWidth             int      `koanf:"windowWidth"`    // sizes are at 100% scale
+	WindowHeight            int      `koanf:"windowHeight"`
+	WindowX                 int      `koanf:"windowX"` // -1 lets the window manager place the window
+	WindowY                 int      `koanf:"windowY"`
+	WindowMaximized         bool     `koanf:"windowMaximized"`
+	TitleColumnWidths       []int    `koanf:"titleColumnWidths"` // at 100% scale
+	DidInitialSetup         bool     `koanf:"didInitialSetup"`
+	PauseOnBattery          bool     `koanf:"pauseOnBattery"`
+	BatteryPauseThreshold   uint8    `koanf:"batteryPauseThreshold"`
+	ScheduleEnabled         bool     `koanf:"scheduleEnabled"` // only download between ScheduleStart and ScheduleEnd
+	ScheduleStart           string   `koanf:"scheduleStart"`   // HH:MM
+	ScheduleEnd             string   `koanf:"scheduleEnd"`     // HH:MM
+	ShowSystemTitles        bool     `koanf:"showSystemTitles"`
+	ShowTitleDetails        bool     `koanf:"showTitleDetails"` // genre, players and languages columns and filters
+	VerifyAfterWrite        bool     `koanf:"verifyAfterWrite"`
+	Locale                  string   `koanf:"locale"` // empty means the locale of the environment
+	TitleDirTemplate        string   `koanf:"titleDirTemplate"`
+	HighPerformanceWrites   bool     `koanf:"highPerformanceWrites"`
+	IncrementalUpdates      bool     `koanf:"incrementalUpdates"`
+	ContinueOnFailure       bool     `koanf:"continueOnFailure"`
+	SyncWrites              bool     `koanf:"syncWrites"`
+	ContentStorePath        string   `koanf:"contentStorePath"`
+	PostDownloadHook        string   `koanf:"postDownloadHook"`
+	CemuMLCPath             string   `koanf:"cemuMLCPath"`
+	LibraryPath             string   `koanf:"libraryPath"`
+	ArchiveFormat           string   `koanf:"archiveFormat"` // one of the wiiudownloader.ARCHIVE_FORMAT_* values
+	MaxParallelTitles       int      `koanf:"maxParallelTitles"`
+	BandwidthLimitMiB       int      `koanf:"bandwidthLimitMiB"`
+	RequestTimeoutSeconds   int      `koanf:"requestTimeoutSeconds"`
+	TitleTimeoutMinutes     int      `koanf:"titleTimeoutMinutes"`
+	StallTimeoutSeconds     int      `koanf:"stallTimeoutSeconds"`
+	SegmentsPerContent      int      `koanf:"segmentsPerContent"`
+	BufferMemoryMiB         int      `koanf:"bufferMemoryMiB"`
+	MonitorClipboard        bool     `koanf:"monitorClipboard"` // jump to title IDs copied to the clipboard
+	CheckForUpdates         bool     `koanf:"checkForUpdates"`  // ask GitHub for a newer release at startup
+	SkippedVersion          string   `koanf:"skippedVersion"`   // release the user doesn't want to be told about
+	AfterQueue              string   `koanf:"afterQueue"`       // one of the AFTER_QUEUE_* actions
+	WatchedTitles           []string `koanf:"watchedTitles"`    // title IDs checked by the watch command
+	WebhookURL              string   `koanf:"webhookURL"`       // notified when downloads start, complete or fail
+	UserAgent               string   `koanf:"userAgent"`
+	ExtraHeaders            []string `koanf:"extraHeaders"` // "Name: value"
+	IPVersion               string   `koanf:"ipVersion"`
+	HostOverrides           []string `koanf:"hostOverrides"` // hosts file lines, "address hostname"
+	KeysPath                string   `koanf:"keysPath"`      // keys.txt or console dump with the Wii U common key
+	TitleKeysPath           string   `koanf:"titleKeysPath"` // JSON or CSV file with the title keys of titles
 	saveConfigCallback      func()
 	saveMutex               *sync.Mutex
 }
@@ -29,33 +87,151 @@ const (
 )
 
 var globalConfig *Config
+
 var k = koanf.NewWithConf(koanf.Conf{
 	Delim: ".",
 })
 
+// portableDirectory is the folder of the executable in portable mode, or of
+// the AppImage or the .app bundle it is in, where the settings, history and
+// caches are kept instead of the folders of the user. It is empty otherwise.
+var portableDirectory string
+
+const portableCacheDir = "cache"
+
+// portableBaseDirectory returns the folder the user sees WiiUDownloader in:
+// the one of the AppImage, which runs from a read-only mount, the one of the
+// .app bundle on macOS, or the one of the executable.
+func portableBaseDirectory(execPath string) string {
+	if appImage := os.Getenv("APPIMAGE"); appImage != "" {
+		return filepath.Dir(appImage)
+	}
+	directory := filepath.Dir(execPath)
+	if runtime.GOOS == "darwin" {
+		// WiiUDownloader.app/Contents/MacOS/WiiUDownloader
+		contents := filepath.Dir(directory)
+		bundle := filepath.Dir(contents)
+		if filepath.Base(directory) == "MacOS" && filepath.Base(contents) == "Contents" && strings.EqualFold(filepath.Ext(bundle), ".app") {
+			return filepath.Dir(bundle)
+		}
+	}
+	return directory
+}
+
+// setupPortableMode turns portable mode on when enable is set or when there is
+// a config.json next to the executable, its AppImage or its .app bundle, as on
+// a USB stick WiiUDownloader was used portable on before. It must be called
+// before anything is loaded.
+func setupPortableMode(enable bool) error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(execPath); err == nil {
+		execPath = resolved
+	}
+	directory := portableBaseDirectory(execPath)
+	if !enable {
+		if _, err := os.Stat(filepath.Join(directory, configFilename)); err != nil {
+			return nil
+		}
+	}
+	portableDirectory = directory
+	wiiudownloader.SetCacheDirectory(filepath.Join(directory, portableCacheDir))
+	return nil
+}
+
+// getConfigDir returns the folder of the settings and other files kept
+// between runs.
+func getConfigDir() (string, error) {
+	if portableDirectory != "" {
+		return portableDirectory, nil
+	}
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userConfigDir, wiiudownloaderConfigDir), nil
+}
+
 func getDefaultConfig() *Config {
 	return &Config{
-		DarkMode:                isDarkMode(),
+		Theme:                   THEME_SYSTEM,
 		DecryptContents:         false,
 		DeleteEncryptedContents: false,
+		EncryptedContentsPolicy: "",
 		SelectedRegion:          wiiudownloader.MCP_REGION_EUROPE | wiiudownloader.MCP_REGION_USA | wiiudownloader.MCP_REGION_JAPAN,
+		SelectedCategory:        wiiudownloader.TITLE_CATEGORY_GAME,
+		GameSubcategory:         wiiudownloader.GAME_SUBCATEGORY_ALL,
+		MaxOSVersion:            0,
+		Genre:                   "",
+		MinPlayers:              0,
+		Language:                0,
+		LastDownloadDirectory:   "",
+		LastDecryptedDirectory:  "",
+		FavoriteTitles:          []string{},
+		HiddenTitles:            []string{},
+		WindowWidth:             870,
+		WindowHeight:            400,
+		WindowX:                 -1,
+		WindowY:                 -1,
+		WindowMaximized:         false,
+		TitleColumnWidths:       []int{},
 		DidInitialSetup:         false,
+		PauseOnBattery:          false,
+		BatteryPauseThreshold:   20,
+		ScheduleEnabled:         false,
+		ScheduleStart:           "01:00",
+		ScheduleEnd:             "07:00",
+		ShowSystemTitles:        false,
+		ShowTitleDetails:        false,
+		VerifyAfterWrite:        false,
+		Locale:                  "",
+		TitleDirTemplate:        wiiudownloader.DEFAULT_TITLE_DIR_TEMPLATE,
+		HighPerformanceWrites:   false,
+		IncrementalUpdates:      true,
+		ContinueOnFailure:       false,
+		SyncWrites:              false,
+		ContentStorePath:        "",
+		PostDownloadHook:        "",
+		CemuMLCPath:             "",
+		LibraryPath:             "",
+		ArchiveFormat:           wiiudownloader.ARCHIVE_FORMAT_NONE,
+		MaxParallelTitles:       1,
+		BandwidthLimitMiB:       0,
+		RequestTimeoutSeconds:   60,
+		TitleTimeoutMinutes:     0,
+		StallTimeoutSeconds:     20,
+		SegmentsPerContent:      1,
+		BufferMemoryMiB:         64,
+		MonitorClipboard:        false,
+		CheckForUpdates:         false,
+		SkippedVersion:          "",
+		AfterQueue:              AFTER_QUEUE_NOTHING,
+		WatchedTitles:           []string{},
+		WebhookURL:              "",
+		UserAgent:               "",
+		ExtraHeaders:            []string{},
+		IPVersion:               wiiudownloader.IP_VERSION_AUTO,
+		HostOverrides:           []string{},
+		KeysPath:                "",
+		TitleKeysPath:           "",
 		saveConfigCallback:      nil,
 		saveMutex:               &sync.Mutex{},
 	}
 }
 
 func createDefaultConfigFile() error {
-	userConfigDir, err := os.UserConfigDir()
+	configDir, err := getConfigDir()
 	if err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(filepath.Join(userConfigDir, wiiudownloaderConfigDir), 0755); err != nil {
+	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return err
 	}
 
-	configFile, err := os.Create(filepath.Join(userConfigDir, wiiudownloaderConfigDir, configFilename))
+	configFile, err := os.Create(filepath.Join(configDir, configFilename))
 	if err != nil {
 		return err
 	}
@@ -75,22 +251,26 @@ func loadConfig() (*Config, error) {
 
 	globalConfig = getDefaultConfig()
 
-	userConfigDir, err := os.UserConfigDir()
+	configDir, err := getConfigDir()
 	if err != nil {
 		log.Fatalf("error getting user config dir: %v", err)
 	}
 
-	if err := k.Load(file.Provider(filepath.Join(userConfigDir, wiiudownloaderConfigDir, configFilename)), json.Parser()); err != nil {
+	if err := k.Load(file.Provider(filepath.Join(configDir, configFilename)), json.Parser()); err != nil {
 		log.Printf("error loading config file: %v, writing defaults...\n", err)
 		if err := createDefaultConfigFile(); err != nil {
 			log.Fatalf("error creating default config file: %v", err)
 		}
-		if err := k.Load(file.Provider(filepath.Join(userConfigDir, wiiudownloaderConfigDir, configFilename)), json.Parser()); err != nil {
+		if err := k.Load(file.Provider(filepath.Join(configDir, configFilename)), json.Parser()); err != nil {
 			log.Fatalf("error loading config file: %v", err)
 		}
 	}
 
 	globalConfig.SetValuesFromConfig(k)
+	// Older versions only had a dark mode switch
+	if !k.Exists("theme") && k.Bool("darkMode") {
+		globalConfig.Theme = THEME_DARK
+	}
 
 	return globalConfig, nil
 }
@@ -107,7 +287,7 @@ func (c *Config) Save() error {
 	}
 
 	// write the config to the file
-	userConfigDir, err := os.UserConfigDir()
+	configDir, err := getConfigDir()
 	if err != nil {
 		return err
 	}
@@ -115,7 +295,70 @@ func (c *Config) Save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(userConfigDir, wiiudownloaderConfigDir, configFilename), confBytes, 0644)
+	return os.WriteFile(filepath.Join(configDir, configFilename), confBytes, 0644)
+}
+
+// getTimeoutsOption returns the download option with the configured timeouts.
+func (c *Config) getTimeoutsOption() wiiudownloader.DownloadTitleOption {
+	return wiiudownloader.WithTimeouts(time.Duration(c.RequestTimeoutSeconds)*time.Second, time.Duration(c.TitleTimeoutMinutes)*time.Minute)
+}
+
+// getStallDetectionOption returns the download option that reconnects the
+// stalled transfers.
+func (c *Config) getStallDetectionOption() wiiudownloader.DownloadTitleOption {
+	return wiiudownloader.WithStallDetection(time.Duration(c.StallTimeoutSeconds) * time.Second)
+}
+
+// getEncryptedContentsPolicy returns what is done to the encrypted contents of
+// the decrypted titles, the configurations from before the policies only have
+// DeleteEncryptedContents.
+func (c *Config) getEncryptedContentsPolicy() string {
+	if c.EncryptedContentsPolicy != "" {
+		if policy, err := wiiudownloader.ParseEncryptedContentsPolicy(c.EncryptedContentsPolicy); err == nil {
+			return policy
+		}
+	}
+	if c.DeleteEncryptedContents {
+		return wiiudownloader.ENCRYPTED_CONTENTS_DELETE
+	}
+	return wiiudownloader.ENCRYPTED_CONTENTS_KEEP
+}
+
+func (c *Config) getClientOptions() wiiudownloader.ClientOptions {
+	extraHeaders, err := wiiudownloader.ParseHeaders(c.ExtraHeaders)
+	if err != nil {
+		log.Println(err)
+	}
+	hostOverrides, err := wiiudownloader.ParseHostOverrides(c.HostOverrides)
+	if err != nil {
+		log.Println(err)
+	}
+	return wiiudownloader.ClientOptions{
+		UserAgent:     c.UserAgent,
+		ExtraHeaders:  extraHeaders,
+		IPVersion:     c.IPVersion,
+		HostOverrides: hostOverrides,
+	}
+}
+
+// loadKeys makes the library use the common key of the keys file and the title
+// keys of the title keys file set in the settings, if any.
+func (c *Config) loadKeys() error {
+	if c.KeysPath != "" {
+		if err := wiiudownloader.LoadKeys(c.KeysPath); err != nil {
+			return err
+		}
+	}
+	if c.TitleKeysPath != "" {
+		imported, err := wiiudownloader.LoadTitleKeys(c.TitleKeysPath)
+		if err != nil {
+			return err
+		}
+		if len(imported.Invalid) > 0 {
+			log.Printf("%d entries of %s are not valid title keys and were left out", len(imported.Invalid), c.TitleKeysPath)
+		}
+	}
+	return nil
 }
 
 func (c *Config) SetValuesFromConfig(newK *koanf.Koanf) {
@@ -2,7 +2,13 @@ package main
 
 import (
 	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
 
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/Xpl0itU/dialog"
 	"github.com/gotk3/gotk3/gtk"
 )
 
@@ -11,6 +17,44 @@ type ConfigWindow struct {
 	Config *Config
 }
 
+// newLinesView creates a small editable text view for settings holding a line per value.
+// label is what the setting is called next to it.
+func newLinesView(lines []string, label *gtk.Label) (*gtk.ScrolledWindow, *gtk.TextBuffer, error) {
+	textView, err := gtk.TextViewNew()
+	if err != nil {
+		return nil, nil, err
+	}
+	labelWidget(label, textView)
+	textView.SetMonospace(true)
+	buffer, err := textView.GetBuffer()
+	if err != nil {
+		return nil, nil, err
+	}
+	buffer.SetText(strings.Join(lines, "\n"))
+	scrolledWindow, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	scrolledWindow.SetSizeRequest(-1, scaled(60))
+	scrolledWindow.Add(textView)
+	return scrolledWindow, buffer, nil
+}
+
+// getBufferLines returns the non-empty lines of a text buffer.
+func getBufferLines(buffer *gtk.TextBuffer) ([]string, error) {
+	text, err := buffer.GetText(buffer.GetStartIter(), buffer.GetEndIter(), false)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
 func NewConfigWindow(config *Config) (*ConfigWindow, error) {
 	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
 	if err != nil {
@@ -26,27 +70,754 @@ func NewConfigWindow(config *Config) (*ConfigWindow, error) {
 	grid.SetHAlign(gtk.ALIGN_CENTER)
 	win.Add(grid)
 
-	darkModeCheck, err := gtk.CheckButtonNewWithLabel("Dark Mode")
+	themeLabel, err := gtk.LabelNew("Theme")
+	if err != nil {
+		return nil, err
+	}
+	grid.Attach(themeLabel, 0, 0, 1, 1)
+
+	themeCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	for _, theme := range []string{THEME_SYSTEM, THEME_DARK, THEME_LIGHT} {
+		themeCombo.Append(theme, themeNames[theme])
+	}
+	if !themeCombo.SetActiveID(config.Theme) {
+		themeCombo.SetActiveID(THEME_SYSTEM)
+	}
+	grid.AttachNextTo(themeCombo, themeLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(themeLabel, themeCombo)
+
+	pauseOnBatteryCheck, err := gtk.CheckButtonNewWithLabel("Pause downloads on battery below (%)")
+	if err != nil {
+		return nil, err
+	}
+	pauseOnBatteryCheck.SetActive(config.PauseOnBattery)
+	grid.AttachNextTo(pauseOnBatteryCheck, themeLabel, gtk.POS_BOTTOM, 1, 1)
+
+	batteryThresholdSpin, err := gtk.SpinButtonNewWithRange(1, 100, 1)
+	if err != nil {
+		return nil, err
+	}
+	setAccessibleName(batteryThresholdSpin, "Battery level to pause downloads below (%)")
+	batteryThresholdSpin.SetValue(float64(config.BatteryPauseThreshold))
+	batteryThresholdSpin.SetSensitive(config.PauseOnBattery)
+	grid.AttachNextTo(batteryThresholdSpin, pauseOnBatteryCheck, gtk.POS_RIGHT, 1, 1)
+	pauseOnBatteryCheck.Connect("toggled", func() {
+		batteryThresholdSpin.SetSensitive(pauseOnBatteryCheck.GetActive())
+	})
+
+	scheduleCheck, err := gtk.CheckButtonNewWithLabel("Only download between (HH:MM)")
+	if err != nil {
+		return nil, err
+	}
+	scheduleCheck.SetActive(config.ScheduleEnabled)
+	grid.AttachNextTo(scheduleCheck, pauseOnBatteryCheck, gtk.POS_BOTTOM, 1, 1)
+
+	scheduleBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return nil, err
+	}
+	scheduleStartEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	setAccessibleName(scheduleStartEntry, "Start of the download hours (HH:MM)")
+	scheduleStartEntry.SetText(config.ScheduleStart)
+	scheduleStartEntry.SetWidthChars(5)
+	scheduleBox.PackStart(scheduleStartEntry, false, false, 0)
+	scheduleAndLabel, err := gtk.LabelNew("and")
+	if err != nil {
+		return nil, err
+	}
+	scheduleBox.PackStart(scheduleAndLabel, false, false, 0)
+	scheduleEndEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	setAccessibleName(scheduleEndEntry, "End of the download hours (HH:MM)")
+	scheduleEndEntry.SetText(config.ScheduleEnd)
+	scheduleEndEntry.SetWidthChars(5)
+	scheduleBox.PackStart(scheduleEndEntry, false, false, 0)
+	scheduleBox.SetSensitive(config.ScheduleEnabled)
+	scheduleBox.SetTooltipText("Downloads are paused outside of these hours and resume on their own")
+	grid.AttachNextTo(scheduleBox, scheduleCheck, gtk.POS_RIGHT, 1, 1)
+	scheduleCheck.Connect("toggled", func() {
+		scheduleBox.SetSensitive(scheduleCheck.GetActive())
+	})
+
+	verifyAfterWriteCheck, err := gtk.CheckButtonNewWithLabel("Verify contents after writing them to disk")
+	if err != nil {
+		return nil, err
+	}
+	verifyAfterWriteCheck.SetActive(config.VerifyAfterWrite)
+	grid.AttachNextTo(verifyAfterWriteCheck, scheduleCheck, gtk.POS_BOTTOM, 1, 1)
+
+	highPerformanceWritesCheck, err := gtk.CheckButtonNewWithLabel("Write contents in large chunks (faster on hard drives)")
+	if err != nil {
+		return nil, err
+	}
+	highPerformanceWritesCheck.SetActive(config.HighPerformanceWrites)
+	grid.AttachNextTo(highPerformanceWritesCheck, verifyAfterWriteCheck, gtk.POS_BOTTOM, 1, 1)
+
+	incrementalUpdatesCheck, err := gtk.CheckButtonNewWithLabel("Only download the contents that changed since an older version on disk")
+	if err != nil {
+		return nil, err
+	}
+	incrementalUpdatesCheck.SetActive(config.IncrementalUpdates)
+	grid.AttachNextTo(incrementalUpdatesCheck, highPerformanceWritesCheck, gtk.POS_BOTTOM, 1, 1)
+
+	continueOnFailureCheck, err := gtk.CheckButtonNewWithLabel("Keep downloading the other contents of a title when one fails")
+	if err != nil {
+		return nil, err
+	}
+	continueOnFailureCheck.SetActive(config.ContinueOnFailure)
+	continueOnFailureCheck.SetTooltipText("The failed contents are listed at the end, downloading the title again only downloads them")
+	grid.AttachNextTo(continueOnFailureCheck, incrementalUpdatesCheck, gtk.POS_BOTTOM, 1, 1)
+
+	syncWritesCheck, err := gtk.CheckButtonNewWithLabel("Flush every completed file to the disk (safer on external drives)")
+	if err != nil {
+		return nil, err
+	}
+	syncWritesCheck.SetActive(config.SyncWrites)
+	syncWritesCheck.SetTooltipText("Also flushes the folders, the metadata and the decrypted files, so a power loss can't damage a title that was reported as complete")
+	grid.AttachNextTo(syncWritesCheck, continueOnFailureCheck, gtk.POS_BOTTOM, 1, 1)
+
+	monitorClipboardCheck, err := gtk.CheckButtonNewWithLabel("Jump to title IDs copied to the clipboard")
+	if err != nil {
+		return nil, err
+	}
+	monitorClipboardCheck.SetActive(config.MonitorClipboard)
+	grid.AttachNextTo(monitorClipboardCheck, syncWritesCheck, gtk.POS_BOTTOM, 1, 1)
+
+	checkForUpdatesCheck, err := gtk.CheckButtonNewWithLabel("Check for new versions at startup")
+	if err != nil {
+		return nil, err
+	}
+	checkForUpdatesCheck.SetActive(config.CheckForUpdates)
+	checkForUpdatesCheck.SetTooltipText("Asks GitHub for the latest release and offers to download it")
+	grid.AttachNextTo(checkForUpdatesCheck, monitorClipboardCheck, gtk.POS_BOTTOM, 1, 1)
+
+	afterQueueLabel, err := gtk.LabelNew("When the queue is done")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(afterQueueLabel, checkForUpdatesCheck, gtk.POS_BOTTOM, 1, 1)
+
+	afterQueueCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	for _, action := range []string{AFTER_QUEUE_NOTHING, AFTER_QUEUE_EXIT, AFTER_QUEUE_SUSPEND, AFTER_QUEUE_HIBERNATE, AFTER_QUEUE_SHUTDOWN} {
+		afterQueueCombo.Append(action, afterQueueActionNames[action])
+	}
+	if !afterQueueCombo.SetActiveID(config.AfterQueue) {
+		afterQueueCombo.SetActiveID(AFTER_QUEUE_NOTHING)
+	}
+	grid.AttachNextTo(afterQueueCombo, afterQueueLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(afterQueueLabel, afterQueueCombo)
+
+	localeLabel, err := gtk.LabelNew("Language of messages")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(localeLabel, afterQueueLabel, gtk.POS_BOTTOM, 1, 1)
+
+	localeCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	localeCombo.Append("", "Automatic")
+	localeNames := wiiudownloader.GetLocaleNames()
+	locales := make([]string, 0, len(localeNames))
+	for locale := range localeNames {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	for _, locale := range locales {
+		localeCombo.Append(locale, localeNames[locale])
+	}
+	if !localeCombo.SetActiveID(config.Locale) {
+		localeCombo.SetActiveID("")
+	}
+	grid.AttachNextTo(localeCombo, localeLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(localeLabel, localeCombo)
+
+	titleDirTemplateLabel, err := gtk.LabelNew("Folder name of downloaded titles")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(titleDirTemplateLabel, localeLabel, gtk.POS_BOTTOM, 1, 1)
+
+	titleDirTemplateEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	titleDirTemplateEntry.SetText(config.TitleDirTemplate)
+	titleDirTemplateEntry.SetTooltipText("Available placeholders: {" + strings.Join(wiiudownloader.GetTitleDirPlaceholders(), "}, {") + "}. Use / to create subfolders.")
+	grid.AttachNextTo(titleDirTemplateEntry, titleDirTemplateLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(titleDirTemplateLabel, titleDirTemplateEntry)
+
+	userAgentLabel, err := gtk.LabelNew("User-Agent")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(userAgentLabel, titleDirTemplateLabel, gtk.POS_BOTTOM, 1, 1)
+
+	userAgentEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	userAgentEntry.SetText(config.UserAgent)
+	userAgentEntry.SetPlaceholderText("Default")
+	grid.AttachNextTo(userAgentEntry, userAgentLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(userAgentLabel, userAgentEntry)
+
+	extraHeadersLabel, err := gtk.LabelNew("Extra request headers\n(Name: value, one per line)")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(extraHeadersLabel, userAgentLabel, gtk.POS_BOTTOM, 1, 1)
+
+	extraHeadersWindow, extraHeadersBuffer, err := newLinesView(config.ExtraHeaders, extraHeadersLabel)
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(extraHeadersWindow, extraHeadersLabel, gtk.POS_RIGHT, 1, 1)
+
+	hostOverridesLabel, err := gtk.LabelNew("Host overrides\n(address hostname, one per line)")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(hostOverridesLabel, extraHeadersLabel, gtk.POS_BOTTOM, 1, 1)
+
+	hostOverridesWindow, hostOverridesBuffer, err := newLinesView(config.HostOverrides, hostOverridesLabel)
+	if err != nil {
+		return nil, err
+	}
+	hostOverridesWindow.SetTooltipText("Connect to another address for a hostname, like the CDN (ccs.cdn.c.shop.nintendowifi.net), without editing the hosts file of the system")
+	grid.AttachNextTo(hostOverridesWindow, hostOverridesLabel, gtk.POS_RIGHT, 1, 1)
+
+	webhookLabel, err := gtk.LabelNew("Webhook URL")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(webhookLabel, hostOverridesLabel, gtk.POS_BOTTOM, 1, 1)
+
+	webhookEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	webhookEntry.SetText(config.WebhookURL)
+	webhookEntry.SetPlaceholderText("https://discord.com/api/webhooks/...")
+	webhookEntry.SetTooltipText("Receives a message when a download starts, completes or fails. Discord and Slack webhooks get a chat message, any other URL a JSON payload.")
+	grid.AttachNextTo(webhookEntry, webhookLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(webhookLabel, webhookEntry)
+
+	postDownloadHookLabel, err := gtk.LabelNew("After each title, run")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(postDownloadHookLabel, webhookLabel, gtk.POS_BOTTOM, 1, 1)
+
+	postDownloadHookEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	postDownloadHookEntry.SetText(config.PostDownloadHook)
+	postDownloadHookEntry.SetPlaceholderText("Nothing")
+	postDownloadHookEntry.SetTooltipText("Shell command run in the title folder once a title is downloaded. It gets WIIUDOWNLOADER_PATH, WIIUDOWNLOADER_DECRYPTED_PATH, WIIUDOWNLOADER_TITLE_ID, WIIUDOWNLOADER_NAME, WIIUDOWNLOADER_VERSION, WIIUDOWNLOADER_REGION and WIIUDOWNLOADER_KIND in its environment.")
+	grid.AttachNextTo(postDownloadHookEntry, postDownloadHookLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(postDownloadHookLabel, postDownloadHookEntry)
+
+	ipVersionLabel, err := gtk.LabelNew("Connect over")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(ipVersionLabel, postDownloadHookLabel, gtk.POS_BOTTOM, 1, 1)
+
+	ipVersionCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	ipVersionCombo.Append(wiiudownloader.IP_VERSION_AUTO, "IPv4 and IPv6 (automatic)")
+	ipVersionCombo.Append(wiiudownloader.IP_VERSION_4, "IPv4 only")
+	ipVersionCombo.Append(wiiudownloader.IP_VERSION_6, "IPv6 only")
+	if !ipVersionCombo.SetActiveID(config.IPVersion) {
+		ipVersionCombo.SetActiveID(wiiudownloader.IP_VERSION_AUTO)
+	}
+	grid.AttachNextTo(ipVersionCombo, ipVersionLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(ipVersionLabel, ipVersionCombo)
+
+	keysLabel, err := gtk.LabelNew("Keys file")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(keysLabel, ipVersionLabel, gtk.POS_BOTTOM, 1, 1)
+
+	keysBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return nil, err
+	}
+	keysEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	keysEntry.SetText(config.KeysPath)
+	keysEntry.SetPlaceholderText("Built-in")
+	keysEntry.SetTooltipText("keys.txt with a \"wiiu_common_key = <key>\" line, or the otp.bin or the folder of the OTP and SEEPROM dumps of your console, used instead of the built-in common key")
+	keysBox.PackStart(keysEntry, true, true, 0)
+	keysBrowseButton, err := gtk.ButtonNewWithLabel("Browse...")
+	if err != nil {
+		return nil, err
+	}
+	setAccessibleName(keysBrowseButton, "Browse for the keys file")
+	keysBrowseButton.Connect("clicked", func() {
+		selectedPath, err := dialog.File().Title("Select your keys.txt, otp.bin or seeprom.bin").Filter("Keys", "txt", "bin").Load()
+		if err != nil {
+			return
+		}
+		keysEntry.SetText(selectedPath)
+	})
+	keysBox.PackStart(keysBrowseButton, false, false, 0)
+	grid.AttachNextTo(keysBox, keysLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(keysLabel, keysEntry)
+
+	titleKeysLabel, err := gtk.LabelNew("Title keys file")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(titleKeysLabel, keysLabel, gtk.POS_BOTTOM, 1, 1)
+
+	titleKeysBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return nil, err
+	}
+	titleKeysEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	titleKeysEntry.SetText(config.TitleKeysPath)
+	titleKeysEntry.SetPlaceholderText("Disabled")
+	titleKeysEntry.SetTooltipText("JSON or CSV file with the title IDs and title keys of the titles you own, the tickets of those titles are generated with them instead of fake keys")
+	titleKeysBox.PackStart(titleKeysEntry, true, true, 0)
+	titleKeysBrowseButton, err := gtk.ButtonNewWithLabel("Browse...")
+	if err != nil {
+		return nil, err
+	}
+	setAccessibleName(titleKeysBrowseButton, "Browse for the title keys file")
+	titleKeysBrowseButton.Connect("clicked", func() {
+		selectedPath, err := dialog.File().Title("Select a file of title keys").Filter("Title keys", "json", "csv").Load()
+		if err != nil {
+			return
+		}
+		titleKeysEntry.SetText(selectedPath)
+	})
+	titleKeysBox.PackStart(titleKeysBrowseButton, false, false, 0)
+	grid.AttachNextTo(titleKeysBox, titleKeysLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(titleKeysLabel, titleKeysEntry)
+
+	contentStoreLabel, err := gtk.LabelNew("Content store")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(contentStoreLabel, titleKeysLabel, gtk.POS_BOTTOM, 1, 1)
+
+	contentStoreBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return nil, err
+	}
+	contentStoreEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	contentStoreEntry.SetText(config.ContentStorePath)
+	contentStoreEntry.SetPlaceholderText("Disabled")
+	contentStoreEntry.SetTooltipText("Folder where every downloaded content is kept by its hash, contents that are the same in several titles are then only downloaded once")
+	contentStoreBox.PackStart(contentStoreEntry, true, true, 0)
+	contentStoreBrowseButton, err := gtk.ButtonNewWithLabel("Browse...")
+	if err != nil {
+		return nil, err
+	}
+	setAccessibleName(contentStoreBrowseButton, "Browse for the content store folder")
+	contentStoreBrowseButton.Connect("clicked", func() {
+		selectedPath, err := dialog.Directory().Title("Select a folder for the content store").Browse()
+		if err != nil {
+			return
+		}
+		contentStoreEntry.SetText(selectedPath)
+	})
+	contentStoreBox.PackStart(contentStoreBrowseButton, false, false, 0)
+	grid.AttachNextTo(contentStoreBox, contentStoreLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(contentStoreLabel, contentStoreEntry)
+
+	cemuLabel, err := gtk.LabelNew("Cemu mlc01 folder")
 	if err != nil {
 		return nil, err
 	}
-	darkModeCheck.SetActive(config.DarkMode)
-	grid.Attach(darkModeCheck, 0, 0, 1, 1)
+	grid.AttachNextTo(cemuLabel, contentStoreLabel, gtk.POS_BOTTOM, 1, 1)
+
+	cemuBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return nil, err
+	}
+	cemuEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	cemuEntry.SetText(config.CemuMLCPath)
+	cemuEntry.SetPlaceholderText("Disabled")
+	cemuEntry.SetTooltipText("Decrypted titles are installed to this mlc01 folder of Cemu, so games, updates and DLC show up in Cemu right away")
+	cemuBox.PackStart(cemuEntry, true, true, 0)
+	cemuBrowseButton, err := gtk.ButtonNewWithLabel("Browse...")
+	if err != nil {
+		return nil, err
+	}
+	setAccessibleName(cemuBrowseButton, "Browse for the Cemu mlc01 folder")
+	cemuBrowseButton.Connect("clicked", func() {
+		selectedPath, err := dialog.Directory().Title("Select the mlc01 folder of Cemu").Browse()
+		if err != nil {
+			return
+		}
+		cemuEntry.SetText(selectedPath)
+	})
+	cemuBox.PackStart(cemuBrowseButton, false, false, 0)
+	grid.AttachNextTo(cemuBox, cemuLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(cemuLabel, cemuEntry)
+
+	libraryLabel, err := gtk.LabelNew("Games library")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(libraryLabel, cemuLabel, gtk.POS_BOTTOM, 1, 1)
+
+	libraryBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return nil, err
+	}
+	libraryEntry, err := gtk.EntryNew()
+	if err != nil {
+		return nil, err
+	}
+	libraryEntry.SetText(config.LibraryPath)
+	libraryEntry.SetPlaceholderText("Disabled")
+	libraryEntry.SetTooltipText("Folder with the titles you already downloaded, they are marked in the list along with whether a newer version is available")
+	libraryBox.PackStart(libraryEntry, true, true, 0)
+	libraryBrowseButton, err := gtk.ButtonNewWithLabel("Browse...")
+	if err != nil {
+		return nil, err
+	}
+	setAccessibleName(libraryBrowseButton, "Browse for the games library folder")
+	libraryBrowseButton.Connect("clicked", func() {
+		selectedPath, err := dialog.Directory().Title("Select the folder of your games library").Browse()
+		if err != nil {
+			return
+		}
+		libraryEntry.SetText(selectedPath)
+	})
+	libraryBox.PackStart(libraryBrowseButton, false, false, 0)
+	grid.AttachNextTo(libraryBox, libraryLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(libraryLabel, libraryEntry)
+
+	archiveFormatLabel, err := gtk.LabelNew("Completed titles")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(archiveFormatLabel, libraryLabel, gtk.POS_BOTTOM, 1, 1)
+
+	archiveFormatCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	archiveFormatCombo.Append(wiiudownloader.ARCHIVE_FORMAT_NONE, "Keep the title folders")
+	archiveFormatCombo.Append(wiiudownloader.ARCHIVE_FORMAT_ZIP, "Pack into a .zip archive")
+	archiveFormatCombo.Append(wiiudownloader.ARCHIVE_FORMAT_7Z, "Pack into a .7z archive (not compressed)")
+	if !archiveFormatCombo.SetActiveID(config.ArchiveFormat) {
+		archiveFormatCombo.SetActiveID(wiiudownloader.ARCHIVE_FORMAT_NONE)
+	}
+	archiveFormatCombo.SetTooltipText("The title folders are replaced with an archive once complete, named after the title and with its manifest")
+	grid.AttachNextTo(archiveFormatCombo, archiveFormatLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(archiveFormatLabel, archiveFormatCombo)
+
+	maxParallelTitlesLabel, err := gtk.LabelNew("Titles downloaded at once")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(maxParallelTitlesLabel, archiveFormatLabel, gtk.POS_BOTTOM, 1, 1)
+
+	maxParallelTitlesSpin, err := gtk.SpinButtonNewWithRange(1, maxQueueParallelTitles, 1)
+	if err != nil {
+		return nil, err
+	}
+	maxParallelTitlesSpin.SetValue(float64(config.MaxParallelTitles))
+	grid.AttachNextTo(maxParallelTitlesSpin, maxParallelTitlesLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(maxParallelTitlesLabel, maxParallelTitlesSpin)
+
+	bandwidthLimitLabel, err := gtk.LabelNew("Bandwidth of the queue (MiB/s, 0 = unlimited)")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(bandwidthLimitLabel, maxParallelTitlesLabel, gtk.POS_BOTTOM, 1, 1)
+
+	bandwidthLimitSpin, err := gtk.SpinButtonNewWithRange(0, 1000, 1)
+	if err != nil {
+		return nil, err
+	}
+	bandwidthLimitSpin.SetValue(float64(config.BandwidthLimitMiB))
+	bandwidthLimitSpin.SetTooltipText("Shared by every title downloaded at once, on top of the bandwidth set for each title in the queue")
+	grid.AttachNextTo(bandwidthLimitSpin, bandwidthLimitLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(bandwidthLimitLabel, bandwidthLimitSpin)
+
+	requestTimeoutLabel, err := gtk.LabelNew("Request timeout (seconds, 0 = never)")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(requestTimeoutLabel, bandwidthLimitLabel, gtk.POS_BOTTOM, 1, 1)
+
+	requestTimeoutSpin, err := gtk.SpinButtonNewWithRange(0, 3600, 1)
+	if err != nil {
+		return nil, err
+	}
+	requestTimeoutSpin.SetValue(float64(config.RequestTimeoutSeconds))
+	requestTimeoutSpin.SetTooltipText("A request that receives nothing from the CDN for that long is retried")
+	grid.AttachNextTo(requestTimeoutSpin, requestTimeoutLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(requestTimeoutLabel, requestTimeoutSpin)
+
+	titleTimeoutLabel, err := gtk.LabelNew("Title timeout (minutes, 0 = never)")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(titleTimeoutLabel, requestTimeoutLabel, gtk.POS_BOTTOM, 1, 1)
+
+	titleTimeoutSpin, err := gtk.SpinButtonNewWithRange(0, 1440, 1)
+	if err != nil {
+		return nil, err
+	}
+	titleTimeoutSpin.SetValue(float64(config.TitleTimeoutMinutes))
+	titleTimeoutSpin.SetTooltipText("A title that isn't downloaded after that long fails, so the queue goes on with the next one")
+	grid.AttachNextTo(titleTimeoutSpin, titleTimeoutLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(titleTimeoutLabel, titleTimeoutSpin)
+
+	stallTimeoutLabel, err := gtk.LabelNew("Reconnect stalled downloads after (seconds, 0 = never)")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(stallTimeoutLabel, titleTimeoutLabel, gtk.POS_BOTTOM, 1, 1)
+
+	stallTimeoutSpin, err := gtk.SpinButtonNewWithRange(0, 3600, 1)
+	if err != nil {
+		return nil, err
+	}
+	stallTimeoutSpin.SetValue(float64(config.StallTimeoutSeconds))
+	stallTimeoutSpin.SetTooltipText("A content whose data stops arriving for that long is resumed on a new connection, without counting as a failed attempt")
+	grid.AttachNextTo(stallTimeoutSpin, stallTimeoutLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(stallTimeoutLabel, stallTimeoutSpin)
+
+	segmentsLabel, err := gtk.LabelNew("Connections per large content")
+	if err != nil {
+		return nil, err
+	}
+	grid.AttachNextTo(segmentsLabel, stallTimeoutLabel, gtk.POS_BOTTOM, 1, 1)
+
+	segmentsSpin, err := gtk.SpinButtonNewWithRange(1, 16, 1)
+	if err != nil {
+		return nil, err
+	}
+	segmentsSpin.SetValue(float64(config.SegmentsPerContent))
+	segmentsSpin.SetTooltipText("Contents of 64 MiB or more are downloaded in that many parts at once, which can be faster on connections with a high latency")
+	grid.AttachNextTo(segmentsSpin, segmentsLabel, gtk.POS_RIGHT, 1, 1)
+	labelWidget(segmentsLabel, segmentsSpin)
 
 	saveButton, err := gtk.ButtonNewWithLabel("Save and Apply")
 	if err != nil {
 		return nil, err
 	}
-	grid.AttachNextTo(saveButton, darkModeCheck, gtk.POS_BOTTOM, 1, 1)
+	grid.AttachNextTo(saveButton, segmentsLabel, gtk.POS_BOTTOM, 1, 1)
 
 	saveButton.Connect("clicked", func() {
-		config.DarkMode = darkModeCheck.GetActive()
+		titleDirTemplate, err := titleDirTemplateEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if err := wiiudownloader.ValidateTitleDirTemplate(titleDirTemplate); err != nil {
+			errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+			errorDialog.Run()
+			errorDialog.Destroy()
+			return
+		}
+		userAgent, err := userAgentEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		extraHeaders, err := getBufferLines(extraHeadersBuffer)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if _, err := wiiudownloader.ParseHeaders(extraHeaders); err != nil {
+			errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+			errorDialog.Run()
+			errorDialog.Destroy()
+			return
+		}
+		hostOverrides, err := getBufferLines(hostOverridesBuffer)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if _, err := wiiudownloader.ParseHostOverrides(hostOverrides); err != nil {
+			errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+			errorDialog.Run()
+			errorDialog.Destroy()
+			return
+		}
+		scheduleStart, err := scheduleStartEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		scheduleEnd, err := scheduleEndEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		for _, value := range []string{scheduleStart, scheduleEnd} {
+			if _, err := parseTimeOfDay(value); err != nil {
+				errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+				errorDialog.Run()
+				errorDialog.Destroy()
+				return
+			}
+		}
+		webhookURL, err := webhookEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		webhookURL = strings.TrimSpace(webhookURL)
+		if parsedURL, err := url.Parse(webhookURL); webhookURL != "" && (err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https")) {
+			errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", "The webhook URL must start with http:// or https://")
+			errorDialog.Run()
+			errorDialog.Destroy()
+			return
+		}
+		keysPath, err := keysEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		keysPath = strings.TrimSpace(keysPath)
+		if keysPath != "" {
+			if err := wiiudownloader.LoadKeys(keysPath); err != nil {
+				errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+				errorDialog.Run()
+				errorDialog.Destroy()
+				return
+			}
+		}
+		titleKeysPath, err := titleKeysEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		titleKeysPath = strings.TrimSpace(titleKeysPath)
+		if titleKeysPath == "" {
+			wiiudownloader.SetTitleKeys(nil)
+		} else {
+			imported, err := wiiudownloader.LoadTitleKeys(titleKeysPath)
+			if err != nil {
+				errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+				errorDialog.Run()
+				errorDialog.Destroy()
+				return
+			}
+			if len(imported.Invalid) > 0 {
+				invalid := imported.Invalid
+				if len(invalid) > 10 {
+					invalid = append(invalid[:10:10], "...")
+				}
+				warningDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_WARNING, gtk.BUTTONS_OK, "%d title keys were imported. %d entries are not a valid title ID and title key and were left out:\n%s", len(imported.Keys), len(imported.Invalid), strings.Join(invalid, "\n"))
+				warningDialog.Run()
+				warningDialog.Destroy()
+			}
+		}
+		postDownloadHook, err := postDownloadHookEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		contentStorePath, err := contentStoreEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		cemuMLCPath, err := cemuEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		cemuMLCPath = strings.TrimSpace(cemuMLCPath)
+		if info, err := os.Stat(cemuMLCPath); cemuMLCPath != "" && (err != nil || !info.IsDir()) {
+			errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", "The Cemu mlc01 folder doesn't exist")
+			errorDialog.Run()
+			errorDialog.Destroy()
+			return
+		}
+		libraryPath, err := libraryEntry.GetText()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		libraryPath = strings.TrimSpace(libraryPath)
+		if info, err := os.Stat(libraryPath); libraryPath != "" && (err != nil || !info.IsDir()) {
+			errorDialog := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", "The games library folder doesn't exist")
+			errorDialog.Run()
+			errorDialog.Destroy()
+			return
+		}
+		config.TitleDirTemplate = titleDirTemplate
+		config.UserAgent = strings.TrimSpace(userAgent)
+		config.ExtraHeaders = extraHeaders
+		config.HostOverrides = hostOverrides
+		config.WebhookURL = webhookURL
+		config.PostDownloadHook = strings.TrimSpace(postDownloadHook)
+		config.IPVersion = ipVersionCombo.GetActiveID()
+		config.KeysPath = keysPath
+		config.TitleKeysPath = titleKeysPath
+		config.ContentStorePath = strings.TrimSpace(contentStorePath)
+		config.CemuMLCPath = cemuMLCPath
+		config.LibraryPath = libraryPath
+		config.ArchiveFormat = archiveFormatCombo.GetActiveID()
+		config.MaxParallelTitles = maxParallelTitlesSpin.GetValueAsInt()
+		config.BandwidthLimitMiB = bandwidthLimitSpin.GetValueAsInt()
+		config.RequestTimeoutSeconds = requestTimeoutSpin.GetValueAsInt()
+		config.TitleTimeoutMinutes = titleTimeoutSpin.GetValueAsInt()
+		config.StallTimeoutSeconds = stallTimeoutSpin.GetValueAsInt()
+		config.SegmentsPerContent = segmentsSpin.GetValueAsInt()
+		config.Theme = themeCombo.GetActiveID()
+		config.PauseOnBattery = pauseOnBatteryCheck.GetActive()
+		config.BatteryPauseThreshold = uint8(batteryThresholdSpin.GetValueAsInt())
+		config.ScheduleEnabled = scheduleCheck.GetActive()
+		config.ScheduleStart = scheduleStart
+		config.ScheduleEnd = scheduleEnd
+		config.VerifyAfterWrite = verifyAfterWriteCheck.GetActive()
+		config.HighPerformanceWrites = highPerformanceWritesCheck.GetActive()
+		config.IncrementalUpdates = incrementalUpdatesCheck.GetActive()
+		config.ContinueOnFailure = continueOnFailureCheck.GetActive()
+		config.SyncWrites = syncWritesCheck.GetActive()
+		config.MonitorClipboard = monitorClipboardCheck.GetActive()
+		config.CheckForUpdates = checkForUpdatesCheck.GetActive()
+		config.AfterQueue = afterQueueCombo.GetActiveID()
+		config.Locale = localeCombo.GetActiveID()
 		if err := config.Save(); err != nil {
 			log.Println(err)
 		}
 	})
 
-	win.SetDefaultSize(grid.GetAllocatedWidth()+125, grid.GetAllocatedHeight()+70)
+	win.SetDefaultSize(grid.GetAllocatedWidth()+scaled(125), grid.GetAllocatedHeight()+scaled(70))
 
 	configWindow := ConfigWindow{
 		Window: win,
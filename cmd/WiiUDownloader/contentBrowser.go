@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/Xpl0itU/dialog"
+	"github.com/dustin/go-humanize"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	CONTENT_SELECTED_COLUMN = iota
+	CONTENT_ID_COLUMN
+	CONTENT_INDEX_COLUMN
+	CONTENT_TYPE_COLUMN
+	CONTENT_SIZE_COLUMN
+	CONTENT_HASH_COLUMN
+)
+
+// contentBrowser shows the contents of the TMD of any title and version, and
+// downloads the ones picked by the user.
+type contentBrowser struct {
+	mw           *MainWindow
+	dialog       *gtk.Dialog
+	titleIDEntry *gtk.Entry
+	versionEntry *gtk.Entry
+	store        *gtk.ListStore
+	summaryLabel *gtk.Label
+	tmd          *wiiudownloader.TMD
+}
+
+func formatContentType(contentType uint16) string {
+	flags := make([]string, 0, 2)
+	if contentType&0x1 != 0 {
+		flags = append(flags, "encrypted")
+	}
+	if contentType&0x2 != 0 {
+		flags = append(flags, "hashed")
+	}
+	if contentType&0x4000 != 0 {
+		flags = append(flags, "optional")
+	}
+	return fmt.Sprintf("0x%04X %s", contentType, strings.Join(flags, ", "))
+}
+
+func (mw *MainWindow) showContentBrowser() {
+	browserDialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Fatalln("Unable to create dialog:", err)
+	}
+	defer browserDialog.Destroy()
+	browserDialog.SetTitle("Content browser")
+	browserDialog.SetTransientFor(mw.window)
+	browserDialog.SetModal(true)
+	browserDialog.SetDefaultSize(scaled(860), scaled(440))
+	browserDialog.AddButton("Close", gtk.RESPONSE_CLOSE)
+	browserDialog.AddButton("Download selected...", gtk.RESPONSE_OK)
+
+	browser := &contentBrowser{mw: mw, dialog: browserDialog}
+	contentArea, err := browserDialog.GetContentArea()
+	if err != nil {
+		log.Fatalln("Unable to get content area:", err)
+	}
+
+	topBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		log.Fatalln("Unable to create box:", err)
+	}
+	titleIDLabel, err := gtk.LabelNew("Title ID")
+	if err != nil {
+		log.Fatalln("Unable to create label:", err)
+	}
+	topBox.PackStart(titleIDLabel, false, false, 0)
+	browser.titleIDEntry, err = gtk.EntryNew()
+	if err != nil {
+		log.Fatalln("Unable to create entry:", err)
+	}
+	browser.titleIDEntry.SetWidthChars(17)
+	if _, selected := mw.listTitles(); len(selected) > 0 {
+		browser.titleIDEntry.SetText(fmt.Sprintf("%016x", selected[0].TitleID))
+	}
+	topBox.PackStart(browser.titleIDEntry, false, false, 0)
+	versionLabel, err := gtk.LabelNew("Version")
+	if err != nil {
+		log.Fatalln("Unable to create label:", err)
+	}
+	topBox.PackStart(versionLabel, false, false, 0)
+	browser.versionEntry, err = gtk.EntryNew()
+	if err != nil {
+		log.Fatalln("Unable to create entry:", err)
+	}
+	browser.versionEntry.SetPlaceholderText("Latest")
+	browser.versionEntry.SetWidthChars(8)
+	topBox.PackStart(browser.versionEntry, false, false, 0)
+	loadButton, err := gtk.ButtonNewWithLabel("Load TMD")
+	if err != nil {
+		log.Fatalln("Unable to create button:", err)
+	}
+	loadButton.Connect("clicked", browser.load)
+	browser.titleIDEntry.Connect("activate", browser.load)
+	browser.versionEntry.Connect("activate", browser.load)
+	topBox.PackStart(loadButton, false, false, 0)
+	contentArea.PackStart(topBox, false, false, 5)
+
+	browser.store, err = gtk.ListStoreNew(glib.TYPE_BOOLEAN, glib.TYPE_STRING, glib.TYPE_INT, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	if err != nil {
+		log.Fatalln("Unable to create list store:", err)
+	}
+	treeView, err := gtk.TreeViewNewWithModel(browser.store)
+	if err != nil {
+		log.Fatalln("Unable to create tree view:", err)
+	}
+	toggleRenderer, err := gtk.CellRendererToggleNew()
+	if err != nil {
+		log.Fatalln("Unable to create cell renderer toggle:", err)
+	}
+	toggleRenderer.Connect("toggled", func(renderer *gtk.CellRendererToggle, path string) {
+		iter, err := browser.store.GetIterFromString(path)
+		if err != nil {
+			return
+		}
+		if err := browser.store.SetValue(iter, CONTENT_SELECTED_COLUMN, !renderer.GetActive()); err != nil {
+			log.Println(err)
+		}
+		browser.updateSummary()
+	})
+	column, err := gtk.TreeViewColumnNewWithAttribute("", toggleRenderer, "active", CONTENT_SELECTED_COLUMN)
+	if err != nil {
+		log.Fatalln("Unable to create tree view column:", err)
+	}
+	treeView.AppendColumn(column)
+	renderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		log.Fatalln("Unable to create cell renderer:", err)
+	}
+	for i, title := range []string{"Content ID", "Index", "Type", "Size", "SHA-1"} {
+		column, err := gtk.TreeViewColumnNewWithAttribute(title, renderer, "text", CONTENT_ID_COLUMN+i)
+		if err != nil {
+			log.Fatalln("Unable to create tree view column:", err)
+		}
+		column.SetResizable(true)
+		treeView.AppendColumn(column)
+	}
+	scrolledWindow, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		log.Fatalln("Unable to create scrolled window:", err)
+	}
+	scrolledWindow.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scrolledWindow.Add(treeView)
+	contentArea.PackStart(scrolledWindow, true, true, 5)
+
+	browser.summaryLabel, err = gtk.LabelNew("Enter a title ID and load its TMD to see its contents.")
+	if err != nil {
+		log.Fatalln("Unable to create label:", err)
+	}
+	browser.summaryLabel.SetXAlign(0)
+	contentArea.PackStart(browser.summaryLabel, false, false, 5)
+
+	browserDialog.SetResponseSensitive(gtk.RESPONSE_OK, false)
+	browserDialog.ShowAll()
+	if browserDialog.Run() != gtk.RESPONSE_OK {
+		return
+	}
+	contentIDs := browser.selectedContentIDs()
+	tmd := browser.tmd
+	browserDialog.Hide()
+	mw.downloadContents(tmd, contentIDs)
+}
+
+// load downloads the TMD of the title and version entered and lists its contents.
+func (browser *contentBrowser) load() {
+	titleIDText, err := browser.titleIDEntry.GetText()
+	if err != nil {
+		return
+	}
+	titleID, err := strconv.ParseUint(strings.TrimSpace(titleIDText), 16, 64)
+	if err != nil {
+		browser.mw.showError(fmt.Errorf("%q is not a title ID", titleIDText))
+		return
+	}
+	versionText, err := browser.versionEntry.GetText()
+	if err != nil {
+		return
+	}
+	version := -1
+	if versionText = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(versionText), "v")); versionText != "" {
+		parsedVersion, err := strconv.ParseUint(versionText, 10, 16)
+		if err != nil {
+			browser.mw.showError(fmt.Errorf("%q is not a title version", versionText))
+			return
+		}
+		version = int(parsedVersion)
+	}
+
+	browser.summaryLabel.SetText("Downloading the TMD...")
+	browser.dialog.SetResponseSensitive(gtk.RESPONSE_OK, false)
+	goWithCrashReport(func() {
+		tmd, err := wiiudownloader.FetchTMD(browser.mw.client, titleID, version)
+		glib.IdleAdd(func() {
+			if err != nil {
+				browser.summaryLabel.SetText("")
+				browser.mw.showError(err)
+				return
+			}
+			browser.setTMD(tmd)
+		})
+	})
+}
+
+func (browser *contentBrowser) setTMD(tmd *wiiudownloader.TMD) {
+	browser.tmd = tmd
+	browser.store.Clear()
+	for _, content := range tmd.Contents {
+		index := int(content.Index[0])<<8 | int(content.Index[1])
+		values := []interface{}{true, fmt.Sprintf("%08X", content.ID), index, formatContentType(content.Type), humanize.Bytes(content.Size), hex.EncodeToString(content.Hash[:20])}
+		if err := browser.store.Set(browser.store.Append(), []int{CONTENT_SELECTED_COLUMN, CONTENT_ID_COLUMN, CONTENT_INDEX_COLUMN, CONTENT_TYPE_COLUMN, CONTENT_SIZE_COLUMN, CONTENT_HASH_COLUMN}, values); err != nil {
+			log.Fatalln("Unable to set values:", err)
+		}
+	}
+	browser.updateSummary()
+}
+
+func (browser *contentBrowser) selectedContentIDs() []uint32 {
+	contentIDs := make([]uint32, 0)
+	if browser.tmd == nil {
+		return contentIDs
+	}
+	i := 0
+	browser.store.ForEach(func(model *gtk.TreeModel, path *gtk.TreePath, iter *gtk.TreeIter) bool {
+		value, err := model.GetValue(iter, CONTENT_SELECTED_COLUMN)
+		if err == nil {
+			if selected, err := value.GoValue(); err == nil && selected.(bool) {
+				contentIDs = append(contentIDs, browser.tmd.Contents[i].ID)
+			}
+		}
+		i++
+		return false
+	})
+	return contentIDs
+}
+
+func (browser *contentBrowser) updateSummary() {
+	tmd := browser.tmd
+	contentIDs := browser.selectedContentIDs()
+	var totalSize, selectedSize uint64
+	for _, content := range tmd.Contents {
+		totalSize += content.Size
+		for _, contentID := range contentIDs {
+			if contentID == content.ID {
+				selectedSize += content.Size
+			}
+		}
+	}
+	browser.summaryLabel.SetText(fmt.Sprintf("%s v%d: %d contents, %s. %d selected, %s.",
+		wiiudownloader.GetTitleEntryFromTid(tmd.TitleID).Name, tmd.TitleVersion, len(tmd.Contents), humanize.Bytes(totalSize), len(contentIDs), humanize.Bytes(selectedSize)))
+	browser.dialog.SetResponseSensitive(gtk.RESPONSE_OK, len(contentIDs) > 0)
+}
+
+// downloadContents downloads some contents of a version of a title, the whole
+// version when every content is selected.
+func (mw *MainWindow) downloadContents(tmd *wiiudownloader.TMD, contentIDs []uint32) {
+	selectedPath, err := dialog.Directory().Title("Select a path to save the contents to").Browse()
+	if err != nil {
+		return
+	}
+	title := wiiudownloader.GetTitleEntryFromTid(tmd.TitleID)
+	titlePath := filepath.Join(selectedPath, wiiudownloader.FormatTitleDir(mw.titleDirTemplate, title, tmd.TitleVersion))
+
+	mw.progressWindow, err = createProgressWindow(mw.window)
+	if err != nil {
+		return
+	}
+	mw.progressWindow.Window.ShowAll()
+
+	downloadOptions := []wiiudownloader.DownloadTitleOption{
+		wiiudownloader.WithHTTPClient(mw.client),
+		wiiudownloader.WithVersion(tmd.TitleVersion),
+		wiiudownloader.WithVerifyAfterWrite(mw.verifyAfterWrite),
+		wiiudownloader.WithHighPerformanceWrites(mw.highPerformanceWrites),
+	}
+	if len(contentIDs) != len(tmd.Contents) {
+		downloadOptions = append(downloadOptions, wiiudownloader.WithContents(contentIDs))
+	}
+	goWithCrashReport(func() {
+		err := wiiudownloader.DownloadTitleWithOptions(fmt.Sprintf("%016x", tmd.TitleID), titlePath, mw.progressWindow, downloadOptions...)
+		glib.IdleAdd(func() {
+			mw.progressWindow.Window.Hide()
+			if err != nil {
+				mw.showError(err)
+			}
+		})
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	crashReportsDir  = "crashes"
+	crashLogTailSize = 100 // lines of the log kept for the crash reports
+)
+
+// logTail keeps the last lines written to the log, for the crash reports.
+type logTail struct {
+	lines   []string
+	partial []byte // the end of the last write, until its newline
+	mutex   sync.Mutex
+}
+
+var crashLogTail = &logTail{}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.partial = append(t.partial, p...)
+	for {
+		end := bytes.IndexByte(t.partial, '\n')
+		if end < 0 {
+			break
+		}
+		t.lines = append(t.lines, string(t.partial[:end]))
+		t.partial = t.partial[end+1:]
+	}
+	if len(t.lines) > crashLogTailSize {
+		t.lines = t.lines[len(t.lines)-crashLogTailSize:]
+	}
+	return len(p), nil
+}
+
+func (t *logTail) String() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return strings.Join(append(t.lines, string(t.partial)), "\n")
+}
+
+var (
+	// crashMutex is never unlocked, the first crash exits while the others wait
+	crashMutex sync.Mutex
+	// guiStarted is set once GTK is initialized and a dialog can be shown
+	guiStarted bool
+)
+
+// setupCrashReporting keeps the end of the log for the crash reports.
+func setupCrashReporting() {
+	log.SetOutput(io.MultiWriter(os.Stderr, crashLogTail))
+}
+
+// writeCrashReport writes what is known of a crash to a new file of the
+// crashes folder and returns its path.
+func writeCrashReport(recovered interface{}, stack []byte) (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	reportsDir := filepath.Join(configDir, crashReportsDir)
+	if err := os.MkdirAll(reportsDir, 0755); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	report := &strings.Builder{}
+	fmt.Fprintf(report, "WiiUDownloader %s crashed at %s\n", appVersion, now.Format(time.RFC3339))
+	fmt.Fprintf(report, "%s %s/%s\n\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(report, "panic: %v\n\n%s\n", recovered, stack)
+	fmt.Fprintf(report, "Last lines of the log:\n%s\n", crashLogTail.String())
+	path := filepath.Join(reportsDir, fmt.Sprintf("crash-%s.txt", now.Format("20060102-150405")))
+	return path, os.WriteFile(path, []byte(report.String()), 0644)
+}
+
+// reportCrash is deferred by the goroutines of the GUI, so a panic writes a
+// crash report and tells where it is instead of closing the window silently.
+func reportCrash() {
+	if recovered := recover(); recovered != nil {
+		handleCrash(recovered, debug.Stack(), false)
+	}
+}
+
+// goWithCrashReport runs f in a new goroutine that reports its crashes.
+func goWithCrashReport(f func()) {
+	go func() {
+		defer reportCrash()
+		f()
+	}()
+}
+
+// handleCrash writes the crash report, shows it and exits. The GTK main loop
+// is gone when the main thread crashed, onMainThread shows the dialog without it.
+func handleCrash(recovered interface{}, stack []byte, onMainThread bool) {
+	crashMutex.Lock()
+	fmt.Fprintf(os.Stderr, "panic: %v\n\n%s\n", recovered, stack)
+	path, err := writeCrashReport(recovered, stack)
+	var message string
+	if err != nil {
+		message = fmt.Sprintf("WiiUDownloader crashed: %v\n\nThe crash report could not be written: %v", recovered, err)
+	} else {
+		message = fmt.Sprintf("WiiUDownloader crashed: %v\n\nA crash report was written to %s, please attach it when reporting the problem.", recovered, path)
+	}
+	fmt.Fprintln(os.Stderr, message)
+
+	if guiStarted {
+		showCrashDialog := func() {
+			dialog := gtk.MessageDialogNew(nil, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_CLOSE, "%s", message)
+			if err == nil {
+				dialog.AddButton("Open folder", gtk.RESPONSE_ACCEPT)
+			}
+			if dialog.Run() == gtk.RESPONSE_ACCEPT {
+				openInFileManager(filepath.Dir(path))
+			}
+			dialog.Destroy()
+		}
+		if onMainThread {
+			showCrashDialog()
+		} else {
+			shown := make(chan struct{})
+			glib.IdleAdd(func() {
+				showCrashDialog()
+				close(shown)
+			})
+			<-shown
+		}
+	}
+	os.Exit(2)
+}
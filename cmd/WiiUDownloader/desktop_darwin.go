@@ -0,0 +1,94 @@
+//go:build darwin
+
+package main
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Cocoa
+#import <Cocoa/Cocoa.h>
+
+static NSProgressIndicator *dockProgress = nil;
+
+// The dock draws the icon of the app unless its tile has a view, the bar is
+// drawn over a view with the icon.
+static void showDockProgress(double fraction) {
+	NSDockTile *dockTile = [NSApp dockTile];
+	if (dockProgress == nil) {
+		NSImageView *iconView = [[NSImageView alloc] init];
+		[iconView setImage:[NSApp applicationIconImage]];
+		[dockTile setContentView:iconView];
+		dockProgress = [[NSProgressIndicator alloc] initWithFrame:NSMakeRect(0, 0, [dockTile size].width, 16)];
+		[dockProgress setStyle:NSProgressIndicatorStyleBar];
+		[dockProgress setIndeterminate:NO];
+		[dockProgress setMinValue:0];
+		[dockProgress setMaxValue:1];
+		[iconView addSubview:dockProgress];
+	}
+	[dockProgress setDoubleValue:fraction];
+	[dockProgress setHidden:NO];
+	[dockTile display];
+}
+
+static void hideDockProgress(void) {
+	if (dockProgress == nil) {
+		return;
+	}
+	[dockProgress setHidden:YES];
+	[[NSApp dockTile] display];
+}
+*/
+import "C"
+
+import (
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// Shortcuts use Cmd on macOS, the menu of the app has them for quitting and
+// the preferences.
+const (
+	primaryModifier  = gdk.META_MASK
+	hasNativeAppMenu = true
+)
+
+// setupAppMenu fills the menu named after the app in the menu bar of macOS,
+// with the preferences and quitting where every app has them.
+func setupAppMenu(app *gtk.Application, mw *MainWindow) {
+	preferencesAction := glib.SimpleActionNew("preferences", nil)
+	preferencesAction.Connect("activate", mw.showConfigWindow)
+	app.AddAction(preferencesAction)
+	app.SetAccelsForAction("app.preferences", []string{"<Meta>comma"})
+
+	// Closing the window saves its state, as it would with the close button
+	quitAction := glib.SimpleActionNew("quit", nil)
+	quitAction.Connect("activate", func() {
+		mw.window.Close()
+	})
+	app.AddAction(quitAction)
+	app.SetAccelsForAction("app.quit", []string{"<Meta>q"})
+
+	preferencesSection := glib.MenuNew()
+	preferencesSection.Append("Preferences…", "app.preferences")
+	quitSection := glib.MenuNew()
+	quitSection.Append("Quit WiiUDownloader", "app.quit")
+	appMenu := glib.MenuNew()
+	appMenu.AppendSectionWithoutLabel(&preferencesSection.MenuModel)
+	appMenu.AppendSectionWithoutLabel(&quitSection.MenuModel)
+	app.SetAppMenu(&appMenu.MenuModel)
+}
+
+// showAppProgress shows the progress of the download, from 0 to 1, as a bar
+// over the icon in the dock, the app has a single one for all its windows. It
+// must be called from the main thread.
+func showAppProgress(window *gtk.Window, fraction float64) {
+	C.showDockProgress(C.double(fraction))
+}
+
+// hideAppProgress removes the bar of showAppProgress.
+func hideAppProgress(window *gtk.Window) {
+	C.hideDockProgress()
+}
+
+// setDownloadFolderTask does nothing, the dock menu only lists the windows.
+func setDownloadFolderTask(folder string) {}
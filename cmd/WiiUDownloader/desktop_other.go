@@ -0,0 +1,28 @@
+//go:build !darwin && !windows
+
+package main
+
+import (
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	primaryModifier  = gdk.CONTROL_MASK
+	hasNativeAppMenu = false
+)
+
+// setupAppMenu does nothing, the window has the only menu.
+func setupAppMenu(app *gtk.Application, mw *MainWindow) {}
+
+// handleURLEvents does nothing, links are opened with WiiUDownloader as an
+// argument.
+func handleURLEvents(handle func(arguments []string)) {}
+
+// showAppProgress does nothing, the progress window has the only progress.
+func showAppProgress(window *gtk.Window, fraction float64) {}
+
+func hideAppProgress(window *gtk.Window) {}
+
+// setDownloadFolderTask does nothing, there is no list of tasks to add it to.
+func setDownloadFolderTask(folder string) {}
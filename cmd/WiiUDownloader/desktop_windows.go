@@ -0,0 +1,178 @@
+//go:build windows
+
+package main
+
+/*
+#cgo pkg-config: gdk-3.0
+#cgo LDFLAGS: -lole32 -luuid
+#define COBJMACROS
+#include <windows.h>
+#include <shobjidl.h>
+#include <gdk/gdkwin32.h>
+
+// PKEY_Title, the name of a task in the jump list
+static const PROPERTYKEY titleKey = {{0xF29F85E0, 0x4FF9, 0x1068, {0xAB, 0x91, 0x08, 0x00, 0x2B, 0x27, 0xB3, 0xD9}}, 2};
+
+static ITaskbarList3 *taskbarList = NULL;
+
+// The taskbar is only ever used from the main thread, whose COM apartment the
+// list is kept in.
+static ITaskbarList3 *getTaskbarList(void) {
+	if (taskbarList != NULL) {
+		return taskbarList;
+	}
+	CoInitializeEx(NULL, COINIT_APARTMENTTHREADED);
+	if (FAILED(CoCreateInstance(&CLSID_TaskbarList, NULL, CLSCTX_INPROC_SERVER, &IID_ITaskbarList3, (void **)&taskbarList))) {
+		taskbarList = NULL;
+		return NULL;
+	}
+	if (FAILED(ITaskbarList3_HrInit(taskbarList))) {
+		ITaskbarList3_Release(taskbarList);
+		taskbarList = NULL;
+	}
+	return taskbarList;
+}
+
+static void showTaskbarProgress(HWND window, ULONGLONG completed, ULONGLONG total) {
+	ITaskbarList3 *list = getTaskbarList();
+	if (list == NULL) {
+		return;
+	}
+	ITaskbarList3_SetProgressState(list, window, TBPF_NORMAL);
+	ITaskbarList3_SetProgressValue(list, window, completed, total);
+}
+
+static void hideTaskbarProgress(HWND window) {
+	ITaskbarList3 *list = getTaskbarList();
+	if (list == NULL) {
+		return;
+	}
+	ITaskbarList3_SetProgressState(list, window, TBPF_NOPROGRESS);
+}
+
+// addFolderTask adds a task that opens folder in the Explorer to tasks.
+static void addFolderTask(IObjectCollection *tasks, const wchar_t *folder, const wchar_t *title) {
+	wchar_t explorer[MAX_PATH];
+	if (ExpandEnvironmentStringsW(L"%SystemRoot%\\explorer.exe", explorer, MAX_PATH) == 0) {
+		return;
+	}
+	IShellLinkW *link = NULL;
+	if (FAILED(CoCreateInstance(&CLSID_ShellLink, NULL, CLSCTX_INPROC_SERVER, &IID_IShellLinkW, (void **)&link))) {
+		return;
+	}
+	IShellLinkW_SetPath(link, explorer);
+	IShellLinkW_SetArguments(link, folder);
+	IShellLinkW_SetIconLocation(link, explorer, 0);
+	IPropertyStore *properties = NULL;
+	if (SUCCEEDED(IShellLinkW_QueryInterface(link, &IID_IPropertyStore, (void **)&properties))) {
+		PROPVARIANT value;
+		PropVariantInit(&value);
+		value.vt = VT_LPWSTR;
+		value.pwszVal = (LPWSTR)title;
+		if (SUCCEEDED(IPropertyStore_SetValue(properties, &titleKey, &value)) && SUCCEEDED(IPropertyStore_Commit(properties))) {
+			IObjectCollection_AddObject(tasks, (IUnknown *)link);
+		}
+		IPropertyStore_Release(properties);
+	}
+	IShellLinkW_Release(link);
+}
+
+// setJumpListFolder replaces the tasks of the jump list with one that opens
+// folder, or removes them when folder is empty.
+static void setJumpListFolder(const wchar_t *folder, const wchar_t *title) {
+	HRESULT initialized = CoInitializeEx(NULL, COINIT_APARTMENTTHREADED);
+	ICustomDestinationList *list = NULL;
+	if (SUCCEEDED(CoCreateInstance(&CLSID_DestinationList, NULL, CLSCTX_INPROC_SERVER, &IID_ICustomDestinationList, (void **)&list))) {
+		UINT slots;
+		IObjectArray *removed = NULL;
+		if (SUCCEEDED(ICustomDestinationList_BeginList(list, &slots, &IID_IObjectArray, (void **)&removed))) {
+			IObjectArray_Release(removed);
+			IObjectCollection *tasks = NULL;
+			if (folder[0] != 0 && SUCCEEDED(CoCreateInstance(&CLSID_EnumerableObjectCollection, NULL, CLSCTX_INPROC_SERVER, &IID_IObjectCollection, (void **)&tasks))) {
+				addFolderTask(tasks, folder, title);
+				IObjectArray *taskArray = NULL;
+				if (SUCCEEDED(IObjectCollection_QueryInterface(tasks, &IID_IObjectArray, (void **)&taskArray))) {
+					ICustomDestinationList_AddUserTasks(list, taskArray);
+					IObjectArray_Release(taskArray);
+				}
+				IObjectCollection_Release(tasks);
+			}
+			ICustomDestinationList_CommitList(list);
+		}
+		ICustomDestinationList_Release(list);
+	}
+	if (SUCCEEDED(initialized)) {
+		CoUninitialize();
+	}
+}
+*/
+import "C"
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	primaryModifier  = gdk.CONTROL_MASK
+	hasNativeAppMenu = false
+)
+
+// taskbarProgressTotal is what the progress is out of in the taskbar.
+const taskbarProgressTotal = 1000
+
+// setupAppMenu does nothing, the window has the only menu.
+func setupAppMenu(app *gtk.Application, mw *MainWindow) {}
+
+// handleURLEvents does nothing, links are opened with WiiUDownloader as an
+// argument.
+func handleURLEvents(handle func(arguments []string)) {}
+
+func getWindowHandle(window *gtk.Window) (C.HWND, bool) {
+	if window == nil {
+		return nil, false
+	}
+	gdkWindow, err := window.GetWindow()
+	if err != nil || gdkWindow == nil {
+		return nil, false
+	}
+	return C.gdk_win32_window_get_handle((*C.GdkWindow)(unsafe.Pointer(gdkWindow.Native()))), true
+}
+
+// showAppProgress shows the progress of the download, from 0 to 1, in the
+// taskbar button of window. It must be called from the main thread.
+func showAppProgress(window *gtk.Window, fraction float64) {
+	if handle, ok := getWindowHandle(window); ok {
+		C.showTaskbarProgress(handle, C.ULONGLONG(fraction*taskbarProgressTotal), taskbarProgressTotal)
+	}
+}
+
+// hideAppProgress removes the progress of showAppProgress.
+func hideAppProgress(window *gtk.Window) {
+	if handle, ok := getWindowHandle(window); ok {
+		C.hideTaskbarProgress(handle)
+	}
+}
+
+// setDownloadFolderTask adds a task that opens folder to the jump list of the
+// taskbar button, right-clicking the button opens it even while WiiUDownloader
+// isn't running. An empty folder removes the task.
+func setDownloadFolderTask(folder string) {
+	// The Explorer takes the folder as a single argument
+	argument := ""
+	if folder != "" {
+		argument = syscall.EscapeArg(folder)
+	}
+	cFolder, err := syscall.UTF16FromString(argument)
+	if err != nil {
+		return
+	}
+	cTitle, err := syscall.UTF16FromString("Open download folder")
+	if err != nil {
+		return
+	}
+	C.setJumpListFolder((*C.wchar_t)(unsafe.Pointer(&cFolder[0])), (*C.wchar_t)(unsafe.Pointer(&cTitle[0])))
+}
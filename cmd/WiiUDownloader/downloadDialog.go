@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/Xpl0itU/dialog"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	DOWNLOAD_NAME_COLUMN = iota
+	DOWNLOAD_TITLE_ID_COLUMN
+	DOWNLOAD_PATH_COLUMN
+)
+
+var encryptedContentsPolicyNames = map[string]string{
+	wiiudownloader.ENCRYPTED_CONTENTS_KEEP:   "Keep encrypted contents after decryption",
+	wiiudownloader.ENCRYPTED_CONTENTS_DELETE: "Delete encrypted contents after decryption",
+	wiiudownloader.ENCRYPTED_CONTENTS_FOLDER: "Move encrypted contents to a subfolder after decryption",
+	wiiudownloader.ENCRYPTED_CONTENTS_ZIP:    "Move encrypted contents to a zip after decryption",
+}
+
+// newEncryptedContentsCombo returns a combo box with the encrypted contents
+// policies, policy being the selected one.
+func newEncryptedContentsCombo(policy string) (*gtk.ComboBoxText, error) {
+	combo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	for _, option := range wiiudownloader.EncryptedContentsPolicies {
+		combo.Append(option, encryptedContentsPolicyNames[option])
+	}
+	if !combo.SetActiveID(policy) {
+		combo.SetActiveID(wiiudownloader.ENCRYPTED_CONTENTS_KEEP)
+	}
+	return combo, nil
+}
+
+type downloadSettings struct {
+	folder                  string
+	decrypt                 bool
+	encryptedContentsPolicy string // one of the wiiudownloader.ENCRYPTED_CONTENTS_* values
+	decryptedFolder         string // empty decrypts next to the encrypted contents
+}
+
+// decryptedTitlePath returns where the title downloaded to titlePath is decrypted to.
+func (s downloadSettings) decryptedTitlePath(titlePath string) string {
+	if s.decryptedFolder == "" {
+		return titlePath
+	}
+	return filepath.Join(s.decryptedFolder, filepath.Base(titlePath))
+}
+
+// chooseDownloadSettings shows where every queued title is going to be saved,
+// computed from the folder name template, and lets the user change it and
+// whether this download is decrypted. The chosen paths are stored in the queue.
+func (mw *MainWindow) chooseDownloadSettings() (downloadSettings, bool) {
+	settings := downloadSettings{
+		decrypt:                 mw.decryptContents,
+		encryptedContentsPolicy: mw.getEncryptedContentsPolicy(),
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return settings, false
+	}
+	settings.folder = config.LastDownloadDirectory
+	settings.decryptedFolder = config.LastDecryptedDirectory
+
+	downloadDialog, err := gtk.DialogNew()
+	if err != nil {
+		return settings, false
+	}
+	defer downloadDialog.Destroy()
+	downloadDialog.SetTitle("Download queue")
+	downloadDialog.SetTransientFor(mw.window)
+	downloadDialog.SetModal(true)
+	downloadDialog.SetDefaultSize(scaled(700), scaled(350))
+	downloadDialog.AddButton("Cancel", gtk.RESPONSE_CANCEL)
+	downloadDialog.AddButton("Download", gtk.RESPONSE_OK)
+
+	contentArea, err := downloadDialog.GetContentArea()
+	if err != nil {
+		return settings, false
+	}
+
+	folderBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return settings, false
+	}
+	folderLabel, err := gtk.LabelNew("Save to")
+	if err != nil {
+		return settings, false
+	}
+	folderBox.PackStart(folderLabel, false, false, 0)
+	folderEntry, err := gtk.EntryNew()
+	if err != nil {
+		return settings, false
+	}
+	folderEntry.SetText(settings.folder)
+	folderBox.PackStart(folderEntry, true, true, 0)
+	browseButton, err := gtk.ButtonNewWithLabel("Browse...")
+	if err != nil {
+		return settings, false
+	}
+	browseButton.Connect("clicked", func() {
+		selectedPath, err := dialog.Directory().Title("Select a path to save the games to").Browse()
+		if err != nil {
+			return
+		}
+		folderEntry.SetText(selectedPath)
+	})
+	folderBox.PackStart(browseButton, false, false, 0)
+	contentArea.PackStart(folderBox, false, false, 5)
+
+	store, err := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	if err != nil {
+		return settings, false
+	}
+	titles := mw.queuePane.GetTitleQueue()
+	for _, title := range titles {
+		iter := store.Append()
+		if err := store.Set(iter,
+			[]int{DOWNLOAD_NAME_COLUMN, DOWNLOAD_TITLE_ID_COLUMN, DOWNLOAD_PATH_COLUMN},
+			[]interface{}{title.Name, fmt.Sprintf("%016x", title.TitleID), ""},
+		); err != nil {
+			return settings, false
+		}
+	}
+	// Paths edited by hand are kept when the folder changes
+	editedPaths := make(map[string]bool)
+	updatePaths := func() {
+		folder, err := folderEntry.GetText()
+		if err != nil {
+			return
+		}
+		treeModel := store.ToTreeModel()
+		iter, ok := treeModel.GetIterFirst()
+		for i := 0; ok && i < len(titles); i++ {
+			tidStr := fmt.Sprintf("%016x", titles[i].TitleID)
+			if !editedPaths[tidStr] {
+				store.SetValue(iter, DOWNLOAD_PATH_COLUMN, filepath.Join(folder, wiiudownloader.PreviewTitleDir(mw.titleDirTemplate, titles[i])))
+			}
+			ok = treeModel.IterNext(iter)
+		}
+	}
+	updatePaths()
+	folderEntry.Connect("changed", updatePaths)
+
+	treeView, err := gtk.TreeViewNewWithModel(store)
+	if err != nil {
+		return settings, false
+	}
+	nameRenderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		return settings, false
+	}
+	nameColumn, err := gtk.TreeViewColumnNewWithAttribute("Name", nameRenderer, "text", DOWNLOAD_NAME_COLUMN)
+	if err != nil {
+		return settings, false
+	}
+	nameColumn.SetResizable(true)
+	treeView.AppendColumn(nameColumn)
+	pathRenderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		return settings, false
+	}
+	pathRenderer.SetProperty("editable", true)
+	pathRenderer.Connect("edited", func(renderer *gtk.CellRendererText, path string, newText string) {
+		iter, err := store.GetIterFromString(path)
+		if err != nil {
+			return
+		}
+		tid, err := store.GetValue(iter, DOWNLOAD_TITLE_ID_COLUMN)
+		if err != nil {
+			return
+		}
+		defer tid.Unset()
+		tidStr, err := tid.GetString()
+		if err != nil {
+			return
+		}
+		editedPaths[tidStr] = true
+		store.SetValue(iter, DOWNLOAD_PATH_COLUMN, strings.TrimSpace(newText))
+	})
+	pathColumn, err := gtk.TreeViewColumnNewWithAttribute("Destination ({version} is filled in once downloading)", pathRenderer, "text", DOWNLOAD_PATH_COLUMN)
+	if err != nil {
+		return settings, false
+	}
+	treeView.AppendColumn(pathColumn)
+
+	scrolledWindow, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return settings, false
+	}
+	scrolledWindow.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scrolledWindow.Add(treeView)
+	contentArea.PackStart(scrolledWindow, true, true, 5)
+
+	decryptCheck, err := gtk.CheckButtonNewWithLabel("Decrypt contents")
+	if err != nil {
+		return settings, false
+	}
+	decryptCheck.SetActive(settings.decrypt)
+	contentArea.PackStart(decryptCheck, false, false, 0)
+	encryptedContentsCombo, err := newEncryptedContentsCombo(settings.encryptedContentsPolicy)
+	if err != nil {
+		return settings, false
+	}
+	contentArea.PackStart(encryptedContentsCombo, false, false, 0)
+
+	decryptedFolderBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return settings, false
+	}
+	decryptedFolderLabel, err := gtk.LabelNew("Decrypt to")
+	if err != nil {
+		return settings, false
+	}
+	decryptedFolderBox.PackStart(decryptedFolderLabel, false, false, 0)
+	decryptedFolderEntry, err := gtk.EntryNew()
+	if err != nil {
+		return settings, false
+	}
+	decryptedFolderEntry.SetText(settings.decryptedFolder)
+	decryptedFolderEntry.SetPlaceholderText("Next to the encrypted contents")
+	decryptedFolderBox.PackStart(decryptedFolderEntry, true, true, 0)
+	decryptedBrowseButton, err := gtk.ButtonNewWithLabel("Browse...")
+	if err != nil {
+		return settings, false
+	}
+	decryptedBrowseButton.Connect("clicked", func() {
+		selectedPath, err := dialog.Directory().Title("Select a path to save the decrypted games to").Browse()
+		if err != nil {
+			return
+		}
+		decryptedFolderEntry.SetText(selectedPath)
+	})
+	decryptedFolderBox.PackStart(decryptedBrowseButton, false, false, 0)
+	contentArea.PackStart(decryptedFolderBox, false, false, 5)
+
+	encryptedContentsCombo.SetSensitive(settings.decrypt)
+	decryptedFolderBox.SetSensitive(settings.decrypt)
+	decryptCheck.Connect("toggled", func() {
+		encryptedContentsCombo.SetSensitive(decryptCheck.GetActive())
+		decryptedFolderBox.SetSensitive(decryptCheck.GetActive())
+	})
+	downloadDialog.ShowAll()
+
+	for {
+		if downloadDialog.Run() != gtk.RESPONSE_OK {
+			return settings, false
+		}
+		folder, err := folderEntry.GetText()
+		if err != nil {
+			return settings, false
+		}
+		settings.folder = strings.TrimSpace(folder)
+		paths, err := getDownloadPaths(store, titles, settings.folder)
+		if err != nil {
+			mw.showError(err)
+			continue
+		}
+		for tid, path := range paths {
+			mw.queuePane.SetOutputPath(tid, path)
+		}
+		break
+	}
+	settings.decrypt = decryptCheck.GetActive()
+	settings.encryptedContentsPolicy = wiiudownloader.ENCRYPTED_CONTENTS_KEEP
+	if settings.decrypt {
+		settings.encryptedContentsPolicy = encryptedContentsCombo.GetActiveID()
+	}
+	if decryptedFolder, err := decryptedFolderEntry.GetText(); err == nil {
+		settings.decryptedFolder = strings.TrimSpace(decryptedFolder)
+	}
+
+	config.LastDownloadDirectory = settings.folder
+	config.LastDecryptedDirectory = settings.decryptedFolder
+	if err := config.Save(); err != nil {
+		log.Println(err)
+	}
+	return settings, true
+}
+
+// getDownloadPaths returns the destination of every title of the download
+// dialog by title ID, relative paths are kept inside the chosen folder.
+func getDownloadPaths(store *gtk.ListStore, titles []wiiudownloader.TitleEntry, folder string) (map[uint64]string, error) {
+	if folder == "" {
+		return nil, errors.New("Select a folder to save the titles to")
+	}
+	paths := make(map[uint64]string, len(titles))
+	treeModel := store.ToTreeModel()
+	iter, ok := treeModel.GetIterFirst()
+	for i := 0; ok && i < len(titles); i++ {
+		pathValue, err := treeModel.GetValue(iter, DOWNLOAD_PATH_COLUMN)
+		if err != nil {
+			return nil, err
+		}
+		path, err := pathValue.GetString()
+		pathValue.Unset()
+		if err != nil {
+			return nil, err
+		}
+		if path == "" {
+			return nil, fmt.Errorf("The destination of %s is empty", titles[i].Name)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(folder, path)
+		}
+		paths[titles[i].TitleID] = path
+		ok = treeModel.IterNext(iter)
+	}
+	return paths, nil
+}
@@ -24,7 +24,7 @@ func NewInitialSetupAssistantWindow(config *Config) (*InitialSetupAssistantWindo
 		os.Exit(0) // Hacky way to close the program
 	})
 	assistant.SetTitle("WiiUDownloader - Initial Setup")
-	assistant.SetDefaultSize(500, 400)
+	assistant.SetDefaultSize(scaled(500), scaled(400))
 
 	page1, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
 	if err != nil {
@@ -194,6 +194,10 @@ func NewInitialSetupAssistantWindow(config *Config) (*InitialSetupAssistantWindo
 		config.SelectedRegion = selectedRegions
 		config.DecryptContents = cemuCheck.GetActive()
 		config.DeleteEncryptedContents = !wiiUCheck.GetActive()
+		config.EncryptedContentsPolicy = wiiudownloader.ENCRYPTED_CONTENTS_KEEP
+		if config.DeleteEncryptedContents {
+			config.EncryptedContentsPolicy = wiiudownloader.ENCRYPTED_CONTENTS_DELETE
+		}
 		if err := config.Save(); err != nil {
 			log.Fatalf("Failed to save config: %v", err)
 		}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/gotk3/gotk3/glib"
+)
+
+const instanceSocketFilename = "instance.sock"
+
+// instanceRequest is what an instance started while another one is running
+// sends it instead of opening a second window.
+type instanceRequest struct {
+	Arguments []string `json:"arguments"` // title IDs, links and title ID files
+}
+
+func getInstanceSocketPath() (string, error) {
+	// A portable copy has a cache of its own, and is another instance
+	cacheDirectory, err := wiiudownloader.GetCacheDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDirectory, instanceSocketFilename), nil
+}
+
+// absoluteArguments returns arguments with the files made absolute, the
+// running instance can have another working directory.
+func absoluteArguments(arguments []string) []string {
+	absolute := make([]string, 0, len(arguments))
+	for _, argument := range arguments {
+		if _, err := os.Stat(argument); err == nil {
+			if path, err := filepath.Abs(argument); err == nil {
+				argument = path
+			}
+		}
+		absolute = append(absolute, argument)
+	}
+	return absolute
+}
+
+// forwardToRunningInstance sends arguments to the instance that is already
+// running and reports whether there is one.
+func forwardToRunningInstance(arguments []string) bool {
+	socketPath, err := getInstanceSocketPath()
+	if err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(instanceRequest{Arguments: absoluteArguments(arguments)}); err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+// listenForInstances passes the arguments of the instances started later to
+// handle, on the main thread.
+func listenForInstances(handle func(arguments []string)) error {
+	socketPath, err := getInstanceSocketPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		return err
+	}
+	// Nothing answered on the socket, it was left behind by a previous run
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	goWithCrashReport(func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			goWithCrashReport(func() {
+				defer conn.Close()
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				request := instanceRequest{}
+				if err := json.NewDecoder(conn).Decode(&request); err != nil {
+					log.Println(err)
+					return
+				}
+				glib.IdleAdd(func() {
+					handle(request.Arguments)
+				})
+			})
+		}
+	})
+	return nil
+}
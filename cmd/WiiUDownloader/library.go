@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxLibraryVersionChecks is the number of latest versions fetched at once
+// after a library scan.
+const maxLibraryVersionChecks = 4
+
+// libraryTitle is a title found in the games library folder.
+type libraryTitle struct {
+	version       uint16
+	status        string // one of the wiiudownloader.ARCHIVE_STATUS_* values
+	latestVersion uint16
+	latestKnown   bool // the latest version was fetched from the CDN
+}
+
+// scanLibrary finds the titles downloaded below path by their title.tmd. A
+// title found in several folders is the most complete and newest of them.
+func scanLibrary(path string) (map[uint64]libraryTitle, error) {
+	archiveTitles, err := wiiudownloader.ScanArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	titles := make(map[uint64]libraryTitle, len(archiveTitles))
+	for _, archiveTitle := range archiveTitles {
+		if archiveTitle.Status == wiiudownloader.ARCHIVE_STATUS_UNREADABLE {
+			continue
+		}
+		tid, err := strconv.ParseUint(archiveTitle.TitleID, 16, 64)
+		if err != nil {
+			continue
+		}
+		title := libraryTitle{version: archiveTitle.Version, status: archiveTitle.Status}
+		if previous, ok := titles[tid]; ok && !title.replaces(previous) {
+			continue
+		}
+		titles[tid] = title
+	}
+	return titles, nil
+}
+
+// replaces reports whether t is a better copy of a title than other.
+func (t libraryTitle) replaces(other libraryTitle) bool {
+	complete := t.status == wiiudownloader.ARCHIVE_STATUS_COMPLETE
+	otherComplete := other.status == wiiudownloader.ARCHIVE_STATUS_COMPLETE
+	if complete != otherComplete {
+		return complete
+	}
+	return t.version > other.version
+}
+
+// fetchLatestVersions returns titles with the latest version of every title
+// on the CDN. Titles whose version can't be fetched are left without one.
+func fetchLatestVersions(client *http.Client, titles map[uint64]libraryTitle) map[uint64]libraryTitle {
+	var mutex sync.Mutex
+	latest := make(map[uint64]libraryTitle, len(titles))
+	var g errgroup.Group
+	g.SetLimit(maxLibraryVersionChecks)
+	for tid, title := range titles {
+		tid, title := tid, title
+		g.Go(func() error {
+			version, err := wiiudownloader.FetchTitleVersion(client, tid)
+			if err == nil {
+				title.latestVersion, title.latestKnown = version, true
+			} else if !errors.Is(err, wiiudownloader.ErrNoUpdateAvailable) {
+				log.Printf("Unable to fetch the latest version of %016x: %v", tid, err)
+			}
+			mutex.Lock()
+			latest[tid] = title
+			mutex.Unlock()
+			return nil
+		})
+	}
+	g.Wait()
+	return latest
+}
+
+// getLibraryStatus returns what the Library column shows for a title, empty
+// when it isn't in the games library.
+func (mw *MainWindow) getLibraryStatus(titleID uint64) string {
+	title, ok := mw.libraryTitles[titleID]
+	if !ok {
+		return ""
+	}
+	switch {
+	case title.status == wiiudownloader.ARCHIVE_STATUS_INCOMPLETE:
+		return fmt.Sprintf("Incomplete (v%d)", title.version)
+	case title.latestKnown && title.latestVersion > title.version:
+		return fmt.Sprintf("Update available (v%d → v%d)", title.version, title.latestVersion)
+	case title.status == wiiudownloader.ARCHIVE_STATUS_SLIMMED:
+		return fmt.Sprintf("Metadata only (v%d)", title.version)
+	default:
+		return fmt.Sprintf("Downloaded (v%d)", title.version)
+	}
+}
+
+// rescanLibrary scans the games library folder in the background and marks
+// its titles in the list, first with their downloaded version, then with
+// whether a newer one is available. A scan started later replaces it.
+func (mw *MainWindow) rescanLibrary() {
+	mw.libraryScan++
+	scan := mw.libraryScan
+	path := mw.libraryPath
+	if path == "" {
+		mw.setLibraryTitles(nil)
+		return
+	}
+	client := mw.client
+	goWithCrashReport(func() {
+		titles, err := scanLibrary(path)
+		if err != nil {
+			log.Println("Unable to scan the games library:", err)
+			return
+		}
+		glib.IdleAdd(func() {
+			if scan == mw.libraryScan {
+				mw.setLibraryTitles(titles)
+			}
+		})
+		titles = fetchLatestVersions(client, titles)
+		glib.IdleAdd(func() {
+			if scan == mw.libraryScan {
+				mw.setLibraryTitles(titles)
+			}
+		})
+	})
+}
+
+// setLibraryTitles updates the Library column with the titles of the games
+// library.
+func (mw *MainWindow) setLibraryTitles(titles map[uint64]libraryTitle) {
+	mw.libraryTitles = titles
+	store := mw.titleStore
+	if store == nil {
+		return
+	}
+	iter, ok := store.GetIterFirst()
+	for ok {
+		if tid, err := getTitleIDFromIter(store.ToTreeModel(), iter); err == nil {
+			store.SetValue(iter, LIBRARY_COLUMN, mw.getLibraryStatus(tid))
+		}
+		ok = store.IterNext(iter)
+	}
+}
+
+// missingTitle is an update or DLC of a game of the library that the library
+// doesn't have, or not in its latest version.
+type missingTitle struct {
+	entry    wiiudownloader.TitleEntry
+	gameName string
+	reason   string
+}
+
+// getMissingLibraryTitles returns the updates and DLC of the games of the
+// library that are missing from it or outdated, by game.
+func (mw *MainWindow) getMissingLibraryTitles() []missingTitle {
+	missing := make([]missingTitle, 0)
+	for tid := range mw.libraryTitles {
+		if !wiiudownloader.IsGame(tid) {
+			continue
+		}
+		related := wiiudownloader.GetRelatedTitles(tid)
+		gameName := related.Base.Name
+		for _, entry := range []wiiudownloader.TitleEntry{related.Update, related.DLC} {
+			if entry.TitleID == 0 {
+				continue
+			}
+			title, ok := mw.libraryTitles[entry.TitleID]
+			switch {
+			case !ok:
+				missing = append(missing, missingTitle{entry: entry, gameName: gameName, reason: "Not downloaded"})
+			case title.status == wiiudownloader.ARCHIVE_STATUS_INCOMPLETE:
+				missing = append(missing, missingTitle{entry: entry, gameName: gameName, reason: fmt.Sprintf("Incomplete (v%d)", title.version)})
+			case title.latestKnown && title.latestVersion > title.version:
+				missing = append(missing, missingTitle{entry: entry, gameName: gameName, reason: fmt.Sprintf("Outdated (v%d → v%d)", title.version, title.latestVersion)})
+			}
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if missing[i].gameName != missing[j].gameName {
+			return missing[i].gameName < missing[j].gameName
+		}
+		return missing[i].entry.TitleID < missing[j].entry.TitleID
+	})
+	return missing
+}
+
+// showMissingLibraryTitles lists the updates and DLC the games of the library
+// are missing, and offers to add all of them to the queue.
+func (mw *MainWindow) showMissingLibraryTitles() {
+	if mw.libraryPath == "" {
+		mw.showInfo("Choose the folder of your games library in the settings first.")
+		return
+	}
+	missing := mw.getMissingLibraryTitles()
+	if len(missing) == 0 {
+		mw.showInfo("The games of your library have all their updates and DLC.")
+		return
+	}
+
+	missingDialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Fatalln("Unable to create dialog:", err)
+	}
+	defer missingDialog.Destroy()
+	missingDialog.SetTitle("Missing updates and DLC")
+	missingDialog.SetTransientFor(mw.window)
+	missingDialog.SetModal(true)
+	missingDialog.SetDefaultSize(scaled(640), scaled(400))
+	missingDialog.AddButton("Close", gtk.RESPONSE_CLOSE)
+	missingDialog.AddButton(fmt.Sprintf("Add all %d to the queue", len(missing)), gtk.RESPONSE_ACCEPT)
+
+	contentArea, err := missingDialog.GetContentArea()
+	if err != nil {
+		log.Fatalln("Unable to get content area:", err)
+	}
+	summaryLabel, err := gtk.LabelNew(fmt.Sprintf("%d updates and DLC of the games of your library are missing or outdated.", len(missing)))
+	if err != nil {
+		log.Fatalln("Unable to create label:", err)
+	}
+	contentArea.PackStart(summaryLabel, false, false, 5)
+
+	store, err := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	if err != nil {
+		log.Fatalln("Unable to create list store:", err)
+	}
+	for _, title := range missing {
+		if err := store.Set(store.Append(), []int{0, 1, 2, 3}, []interface{}{title.gameName, wiiudownloader.GetFormattedKind(title.entry.TitleID), fmt.Sprintf("%016x", title.entry.TitleID), title.reason}); err != nil {
+			log.Fatalln("Unable to set values:", err)
+		}
+	}
+	treeView, err := gtk.TreeViewNewWithModel(store)
+	if err != nil {
+		log.Fatalln("Unable to create tree view:", err)
+	}
+	renderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		log.Fatalln("Unable to create cell renderer:", err)
+	}
+	for i, title := range []string{"Game", "Kind", "Title ID", "Missing"} {
+		column, err := gtk.TreeViewColumnNewWithAttribute(title, renderer, "text", i)
+		if err != nil {
+			log.Fatalln("Unable to create tree view column:", err)
+		}
+		treeView.AppendColumn(column)
+	}
+	scrolledWindow, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		log.Fatalln("Unable to create scrolled window:", err)
+	}
+	scrolledWindow.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scrolledWindow.Add(treeView)
+	contentArea.PackStart(scrolledWindow, true, true, 5)
+
+	missingDialog.ShowAll()
+	if missingDialog.Run() != gtk.RESPONSE_ACCEPT {
+		return
+	}
+	for _, title := range missing {
+		if !mw.queuePane.IsTitleInQueue(title.entry) {
+			mw.queuePane.AddTitle(title.entry)
+		}
+	}
+	mw.updateTitlesInQueue()
+}
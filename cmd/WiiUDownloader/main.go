@@ -1,13 +1,13 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
-	"net"
-	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
-	"time"
+	"runtime/debug"
 
 	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
 	"github.com/gotk3/gotk3/glib"
@@ -15,6 +15,57 @@ import (
 )
 
 func main() {
+	setupCrashReporting()
+	// Panics in the callbacks of GTK end up here, once the main loop is gone
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			handleCrash(recovered, debug.Stack(), true)
+		}
+	}()
+
+	// Every command keeps its files next to the executable in portable mode
+	if err := setupPortableMode(false); err != nil {
+		log.Println(err)
+	}
+	// The title database refreshed on an earlier run replaces the embedded one
+	if err := wiiudownloader.LoadCachedTitleDatabase(); err != nil {
+		log.Println(err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerifyCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "watch" {
+		os.Exit(runWatchCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "offline" {
+		os.Exit(runOfflineCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		os.Exit(runRestoreCommand(os.Args[2:]))
+	}
+
+	tidFile := flag.String("tid-file", "", "text, JSON or CSV file with title IDs to add to the queue")
+	portable := flag.Bool("portable", false, "keep the settings, history and caches next to the executable, from now on")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [title ID, link or title ID file]...\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *portable {
+		if err := setupPortableMode(true); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	arguments := flag.Args()
+	if *tidFile != "" {
+		arguments = append([]string{*tidFile}, arguments...)
+	}
+	// A second window would fight over the queue with the first one
+	if forwardToRunningInstance(arguments) {
+		return
+	}
+
 	// Check if user is running macOS
 	if runtime.GOOS == "darwin" {
 		execPath, err := os.Executable()
@@ -32,39 +83,38 @@ func main() {
 	}
 
 	gtk.Init(nil)
+	guiStarted = true
 
 	app, err := gtk.ApplicationNew("io.github.xpl0itu.wiiudownloader", glib.APPLICATION_FLAGS_NONE)
 	if err != nil {
 		log.Fatal("Error creating application.")
 	}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).Dial,
-			MaxIdleConns:          100,
-			MaxIdleConnsPerHost:   100,
-			MaxConnsPerHost:       100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-	}
-
 	config, err := loadConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	win := NewMainWindow(wiiudownloader.GetTitleEntries(wiiudownloader.TITLE_CATEGORY_GAME), client, config)
+	win := NewMainWindow(config)
 	config.saveConfigCallback = func() {
 		win.applyConfig(config)
 	}
 
+	openFromOutside := func(arguments []string) {
+		// The window isn't shown before the initial setup is done
+		if !config.DidInitialSetup {
+			return
+		}
+		win.window.Present()
+		win.openArguments(arguments)
+	}
+	if err := listenForInstances(openFromOutside); err != nil {
+		log.Println(err)
+	}
+	registerURIScheme(openFromOutside)
+
 	app.Connect("activate", func(app *gtk.Application) {
+		setupAppMenu(app, win)
 		if !config.DidInitialSetup {
 			// Open the initial setup assistant
 			assistant, err := NewInitialSetupAssistantWindow(config)
@@ -77,6 +127,13 @@ func main() {
 					win.ShowAll()
 					app.AddWindow(win.window)
 					app.GetActiveWindow().Show()
+					if err := config.loadKeys(); err != nil {
+						win.showError(err)
+					}
+					win.openArguments(arguments)
+					if config.CheckForUpdates {
+						win.checkForUpdates(config, false)
+					}
 				})
 			})
 			glib.IdleAddPriority(glib.PRIORITY_HIGH, func() {
@@ -91,11 +148,19 @@ func main() {
 				win.ShowAll()
 				app.AddWindow(win.window)
 				app.GetActiveWindow().Show()
+				if err := config.loadKeys(); err != nil {
+					win.showError(err)
+				}
+				win.openArguments(arguments)
+				if config.CheckForUpdates {
+					win.checkForUpdates(config, false)
+				}
 			})
 		}
 	})
 	app.ConnectAfter("activate", func(app *gtk.Application) {
 		gtk.Main()
 	})
-	glib.ApplicationGetDefault().Run(os.Args)
+	// Our own flags are already parsed, GApplication would reject them
+	glib.ApplicationGetDefault().Run(os.Args[:1])
 }
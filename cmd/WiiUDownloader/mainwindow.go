@@ -2,27 +2,46 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
 	"github.com/Xpl0itU/dialog"
+	"github.com/dustin/go-humanize"
+	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
-	"golang.org/x/sync/errgroup"
 )
 
+// searchDelay is how long, in milliseconds, the search waits for the next key
+// before filtering the list.
+const searchDelay = 150
+
+// CATEGORY_FAVORITES is the category of the Favorites button, it is not a
+// category of the title database.
+const CATEGORY_FAVORITES uint8 = 0xFF
+
 const (
 	IN_QUEUE_COLUMN = iota
 	KIND_COLUMN
 	TITLE_ID_COLUMN
 	REGION_COLUMN
 	NAME_COLUMN
+	OS_VERSION_COLUMN
+	LIBRARY_COLUMN
+	GENRE_COLUMN
+	PLAYERS_COLUMN
+	LANGUAGES_COLUMN
 )
 
 type MainWindow struct {
@@ -30,26 +49,74 @@ type MainWindow struct {
 	queuePane                       *QueuePane
 	treeView                        *gtk.TreeView
 	searchEntry                     *gtk.Entry
-	deleteEncryptedContentsCheckbox *gtk.CheckButton
-	deleteEncryptedContents         bool
+	encryptedContentsPolicyComboBox *gtk.ComboBoxText
+	encryptedContentsPolicy         string // one of the wiiudownloader.ENCRYPTED_CONTENTS_* values
 	progressWindow                  *ProgressWindow
 	configWindow                    *ConfigWindow
 	lastSearchText                  string
+	searchTimeout                   glib.SourceHandle // pending filtering of the list, 0 when there is none
+	downloadFolderTask              string            // folder the jump list opens
 	categoryButtons                 []*gtk.ToggleButton
+	titleStore                      *gtk.ListStore // every title of the category
+	titleFilter                     *gtk.TreeModelFilter
+	gameSubcategoryCombo            *gtk.ComboBoxText
+	titleColumns                    []*gtk.TreeViewColumn
+	titleDetailFilters              *gtk.Box // genre, players and language filters
 	titles                          []wiiudownloader.TitleEntry
+	favoriteTitles                  map[uint64]bool
+	hiddenTitles                    map[uint64]bool
+	currentCategory                 uint8
+	gameSubcategory                 uint8 // only listed in TITLE_CATEGORY_GAME
+	showSystemTitles                bool
+	showTitleDetails                bool // shows the genre, players and languages columns and filters
+	verifyAfterWrite                bool
+	titleDirTemplate                string
+	highPerformanceWrites           bool
+	incrementalUpdates              bool
+	continueOnFailure               bool
+	syncWrites                      bool
+	contentStorePath                string
+	postDownloadHook                string
+	cemuMLCPath                     string
+	archiveFormat                   string                  // one of the wiiudownloader.ARCHIVE_FORMAT_* values
+	libraryPath                     string                  // games library folder, empty when there is none
+	libraryTitles                   map[uint64]libraryTitle // titles found in libraryPath
+	libraryScan                     uint                    // bumped by every scan of the library, so an older scan is dropped
+	maxParallelTitles               int
+	bandwidthLimit                  int64 // bytes per second shared by the titles of the queue, 0 means unlimited
+	timeoutsOption                  wiiudownloader.DownloadTitleOption
+	stallDetectionOption            wiiudownloader.DownloadTitleOption
+	segmentsPerContent              int
+	monitorClipboard                bool
+	lastClipboardTitleID            uint64
+	afterQueue                      string
+	webhookURL                      string
 	decryptContents                 bool
 	currentRegion                   uint8
+	maxOSVersion                    uint8  // 0 lists the titles of every OS version
+	genre                           string // empty lists the titles of every genre
+	minPlayers                      uint8  // 0 lists the titles for any number of players
+	language                        uint16 // 0 lists the titles in every language
 	client                          *http.Client
 }
 
-func NewMainWindow(entries []wiiudownloader.TitleEntry, client *http.Client, config *Config) *MainWindow {
+func NewMainWindow(config *Config) *MainWindow {
 	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
 	if err != nil {
 		log.Fatalln("Unable to create window:", err)
 	}
 
 	win.SetTitle("WiiUDownloader")
-	win.SetDefaultSize(870, 400)
+	// The scalable icon installed with the AppImage, drawn sharp at any size
+	win.SetIconName("WiiUDownloader")
+	// The sizes are saved at 100% scale
+	win.SetDefaultSize(scaled(config.WindowWidth), scaled(config.WindowHeight))
+	if config.WindowX >= 0 && config.WindowY >= 0 {
+		win.Move(config.WindowX, config.WindowY)
+	}
+	if config.WindowMaximized {
+		win.Maximize()
+	}
 	win.Connect("destroy", func() {
 		os.Exit(0) // Hacky way to close the program
 	})
@@ -59,6 +126,8 @@ func NewMainWindow(entries []wiiudownloader.TitleEntry, client *http.Client, con
 		log.Fatalln("Unable to create entry:", err)
 	}
 	searchEntry.SetPlaceholderText("Search...")
+	setAccessibleName(searchEntry, "Search titles")
+	setAccessibleDescription(searchEntry, "Lists the titles whose name, title ID or product code contains the text")
 	searchEntry.SetHExpand(false)
 
 	queuePane, err := NewQueuePane()
@@ -66,21 +135,28 @@ func NewMainWindow(entries []wiiudownloader.TitleEntry, client *http.Client, con
 		log.Fatalln("Unable to create queue pane:", err)
 	}
 
+	// The disc and system categories have no button unless system titles are shown
+	category := config.SelectedCategory
+	if category > wiiudownloader.TITLE_CATEGORY_ALL && category != CATEGORY_FAVORITES && (category == wiiudownloader.TITLE_CATEGORY_DISC || !config.ShowSystemTitles) {
+		category = wiiudownloader.TITLE_CATEGORY_GAME
+	}
+
 	mainWindow := MainWindow{
-		window:         win,
-		queuePane:      queuePane,
-		titles:         entries,
-		searchEntry:    searchEntry,
-		currentRegion:  wiiudownloader.MCP_REGION_EUROPE | wiiudownloader.MCP_REGION_JAPAN | wiiudownloader.MCP_REGION_USA,
-		lastSearchText: "",
-		client:         client,
+		window:          win,
+		queuePane:       queuePane,
+		currentCategory: category,
+		searchEntry:     searchEntry,
+		currentRegion:   wiiudownloader.MCP_REGION_EUROPE | wiiudownloader.MCP_REGION_JAPAN | wiiudownloader.MCP_REGION_USA,
+		lastSearchText:  "",
 	}
 
 	queuePane.updateFunc = mainWindow.updateTitlesInQueue
 
 	mainWindow.applyConfig(config)
+	mainWindow.titles = mainWindow.getCategoryTitles(category)
 
 	searchEntry.Connect("changed", mainWindow.onSearchEntryChanged)
+	win.Connect("delete-event", mainWindow.saveWindowState)
 
 	return &mainWindow
 }
@@ -89,25 +165,77 @@ func (mw *MainWindow) SetApplicationForGTKWindow(app *gtk.Application) {
 	mw.window.SetApplication(app)
 }
 
-func (mw *MainWindow) updateTitles(titles []wiiudownloader.TitleEntry) {
-	store, err := gtk.ListStoreNew(glib.TYPE_BOOLEAN, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+func (mw *MainWindow) showConfigWindow() {
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	if err := mw.createConfigWindow(config); err != nil {
+		return
+	}
+	mw.configWindow.Window.ShowAll()
+}
+
+func newTitleListStore() *gtk.ListStore {
+	store, err := gtk.ListStoreNew(glib.TYPE_BOOLEAN, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
 	if err != nil {
 		log.Fatalln("Unable to create list store:", err)
 	}
+	return store
+}
+
+// isTitleListed reports whether a title passes the region, hidden, game
+// subcategory and OS version filters of the title list, and the genre, players
+// and language filters while they are shown.
+func (mw *MainWindow) isTitleListed(entry wiiudownloader.TitleEntry) bool {
+	if mw.currentRegion&entry.Region == 0 || mw.hiddenTitles[entry.TitleID] {
+		return false
+	}
+	if mw.currentCategory == wiiudownloader.TITLE_CATEGORY_GAME && !wiiudownloader.IsInGameSubcategory(entry.TitleID, mw.gameSubcategory) {
+		return false
+	}
+	if mw.showTitleDetails && (!wiiudownloader.TitleHasGenre(entry.TitleID, mw.genre) || !wiiudownloader.TitleSupportsPlayers(entry.TitleID, mw.minPlayers) || !wiiudownloader.TitleSupportsLanguage(entry.TitleID, mw.language)) {
+		return false
+	}
+	return mw.maxOSVersion == 0 || wiiudownloader.TitleRunsOnOSVersion(entry.TitleID, mw.maxOSVersion)
+}
+
+func (mw *MainWindow) appendTitleRow(store *gtk.ListStore, entry wiiudownloader.TitleEntry) {
+	info, _ := wiiudownloader.GetTitleInfo(entry.TitleID)
+	iter := store.Append()
+	if err := store.Set(iter,
+		[]int{IN_QUEUE_COLUMN, KIND_COLUMN, TITLE_ID_COLUMN, REGION_COLUMN, NAME_COLUMN, OS_VERSION_COLUMN, LIBRARY_COLUMN, GENRE_COLUMN, PLAYERS_COLUMN, LANGUAGES_COLUMN},
+		[]interface{}{mw.queuePane.IsTitleInQueue(entry), wiiudownloader.GetFormattedKind(entry.TitleID), fmt.Sprintf("%016x", entry.TitleID), wiiudownloader.GetFormattedRegion(entry.Region), entry.Name, wiiudownloader.GetFormattedRequiredOSVersion(entry.TitleID), mw.getLibraryStatus(entry.TitleID), info.Genre, wiiudownloader.GetFormattedPlayers(info.Players), wiiudownloader.GetFormattedLanguages(info.Languages)},
+	); err != nil {
+		log.Fatalln("Unable to set values:", err)
+	}
+}
 
+// updateTitles fills the title list with titles. Every title gets a row, the
+// filter model over them only shows the ones that pass the filters, so
+// searching doesn't fill the list again.
+func (mw *MainWindow) updateTitles(titles []wiiudownloader.TitleEntry) {
+	store := newTitleListStore()
+	titlesByTID := make(map[uint64]wiiudownloader.TitleEntry, len(titles))
 	for _, entry := range titles {
-		if (mw.currentRegion & entry.Region) == 0 {
-			continue
-		}
-		iter := store.Append()
-		if err := store.Set(iter,
-			[]int{IN_QUEUE_COLUMN, KIND_COLUMN, TITLE_ID_COLUMN, REGION_COLUMN, NAME_COLUMN},
-			[]interface{}{mw.queuePane.IsTitleInQueue(entry), wiiudownloader.GetFormattedKind(entry.TitleID), fmt.Sprintf("%016x", entry.TitleID), wiiudownloader.GetFormattedRegion(entry.Region), entry.Name},
-		); err != nil {
-			log.Fatalln("Unable to set values:", err)
-		}
+		mw.appendTitleRow(store, entry)
+		titlesByTID[entry.TitleID] = entry
 	}
-	mw.treeView.SetModel(store)
+	filter, err := store.FilterNew(nil)
+	if err != nil {
+		log.Fatalln("Unable to create tree model filter:", err)
+	}
+	filter.SetVisibleFunc(func(model *gtk.TreeModel, iter *gtk.TreeIter) bool {
+		tid, err := getTitleIDFromIter(model, iter)
+		if err != nil {
+			return false
+		}
+		entry, ok := titlesByTID[tid]
+		return ok && wiiudownloader.TitleMatchesQuery(entry, mw.lastSearchText) && mw.isTitleListed(entry)
+	})
+	mw.titleStore = store
+	mw.titleFilter = filter
+	mw.treeView.SetModel(filter)
 }
 
 func (mw *MainWindow) createConfigWindow(config *Config) error {
@@ -123,32 +251,55 @@ func (mw *MainWindow) createConfigWindow(config *Config) error {
 }
 
 func (mw *MainWindow) applyConfig(config *Config) {
-	setDarkTheme(config.DarkMode)
+	setTheme(config.Theme)
 	mw.decryptContents = config.DecryptContents
-	mw.deleteEncryptedContents = config.DeleteEncryptedContents
+	mw.encryptedContentsPolicy = config.getEncryptedContentsPolicy()
 	mw.currentRegion = config.SelectedRegion
-}
-
-func (mw *MainWindow) ShowAll() {
-	store, err := gtk.ListStoreNew(glib.TYPE_BOOLEAN, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
-	if err != nil {
-		log.Fatalln("Unable to create list store:", err)
+	mw.gameSubcategory = config.GameSubcategory
+	mw.maxOSVersion = config.MaxOSVersion
+	mw.genre = config.Genre
+	mw.minPlayers = config.MinPlayers
+	mw.language = config.Language
+	mw.showSystemTitles = config.ShowSystemTitles
+	mw.showTitleDetails = config.ShowTitleDetails
+	mw.verifyAfterWrite = config.VerifyAfterWrite
+	wiiudownloader.SetLocale(config.Locale)
+	wiiudownloader.SetBufferMemoryBudget(int64(config.BufferMemoryMiB) * 1024 * 1024)
+	mw.titleDirTemplate = config.TitleDirTemplate
+	if config.LastDownloadDirectory != mw.downloadFolderTask {
+		mw.downloadFolderTask = config.LastDownloadDirectory
+		setDownloadFolderTask(mw.downloadFolderTask)
 	}
-
-	for _, entry := range mw.titles {
-		if (mw.currentRegion & entry.Region) == 0 {
-			continue
-		}
-		iter := store.Append()
-		err = store.Set(iter,
-			[]int{IN_QUEUE_COLUMN, KIND_COLUMN, TITLE_ID_COLUMN, REGION_COLUMN, NAME_COLUMN},
-			[]interface{}{mw.queuePane.IsTitleInQueue(entry), wiiudownloader.GetFormattedKind(entry.TitleID), fmt.Sprintf("%016x", entry.TitleID), wiiudownloader.GetFormattedRegion(entry.Region), entry.Name},
-		)
-		if err != nil {
-			log.Fatalln("Unable to set values:", err)
-		}
+	mw.highPerformanceWrites = config.HighPerformanceWrites
+	mw.incrementalUpdates = config.IncrementalUpdates
+	mw.continueOnFailure = config.ContinueOnFailure
+	mw.syncWrites = config.SyncWrites
+	mw.contentStorePath = config.ContentStorePath
+	mw.postDownloadHook = config.PostDownloadHook
+	mw.cemuMLCPath = config.CemuMLCPath
+	mw.archiveFormat = config.ArchiveFormat
+	mw.maxParallelTitles = min(max(config.MaxParallelTitles, 1), maxQueueParallelTitles)
+	mw.bandwidthLimit = int64(config.BandwidthLimitMiB) * 1024 * 1024
+	mw.timeoutsOption = config.getTimeoutsOption()
+	mw.stallDetectionOption = config.getStallDetectionOption()
+	mw.segmentsPerContent = config.SegmentsPerContent
+	mw.monitorClipboard = config.MonitorClipboard
+	mw.afterQueue = config.AfterQueue
+	mw.webhookURL = config.WebhookURL
+	mw.favoriteTitles = parseTitleIDSet(config.FavoriteTitles)
+	mw.hiddenTitles = parseTitleIDSet(config.HiddenTitles)
+	mw.client = wiiudownloader.NewHTTPClient(config.getClientOptions())
+	if config.LibraryPath != mw.libraryPath {
+		mw.libraryPath = config.LibraryPath
+		mw.rescanLibrary()
 	}
+	if err := config.loadKeys(); err != nil {
+		log.Println(err)
+	}
+}
 
+func (mw *MainWindow) ShowAll() {
+	var err error
 	mw.treeView, err = gtk.TreeViewNew()
 	if err != nil {
 		log.Fatalln("Unable to create tree view:", err)
@@ -159,8 +310,9 @@ func (mw *MainWindow) ShowAll() {
 		log.Fatalln("Unable to get selection:", err)
 	}
 	selection.SetMode(gtk.SELECTION_MULTIPLE)
+	setAccessibleName(mw.treeView, "Titles")
 
-	mw.treeView.SetModel(store)
+	mw.updateTitles(mw.titles)
 
 	toggleRenderer, err := gtk.CellRendererToggleNew()
 	if err != nil {
@@ -241,6 +393,53 @@ func (mw *MainWindow) ShowAll() {
 	}
 	mw.treeView.AppendColumn(column)
 
+	column, err = gtk.TreeViewColumnNewWithAttribute("System", renderer, "text", OS_VERSION_COLUMN)
+	if err != nil {
+		log.Fatalln("Unable to create tree view column:", err)
+	}
+	mw.treeView.AppendColumn(column)
+
+	column, err = gtk.TreeViewColumnNewWithAttribute("Library", renderer, "text", LIBRARY_COLUMN)
+	if err != nil {
+		log.Fatalln("Unable to create tree view column:", err)
+	}
+	mw.treeView.AppendColumn(column)
+
+	column, err = gtk.TreeViewColumnNewWithAttribute("Genre", renderer, "text", GENRE_COLUMN)
+	if err != nil {
+		log.Fatalln("Unable to create tree view column:", err)
+	}
+	mw.treeView.AppendColumn(column)
+
+	column, err = gtk.TreeViewColumnNewWithAttribute("Players", renderer, "text", PLAYERS_COLUMN)
+	if err != nil {
+		log.Fatalln("Unable to create tree view column:", err)
+	}
+	mw.treeView.AppendColumn(column)
+
+	column, err = gtk.TreeViewColumnNewWithAttribute("Languages", renderer, "text", LANGUAGES_COLUMN)
+	if err != nil {
+		log.Fatalln("Unable to create tree view column:", err)
+	}
+	mw.treeView.AppendColumn(column)
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalln("Unable to load config:", err)
+	}
+	mw.titleColumns = make([]*gtk.TreeViewColumn, 0, mw.treeView.GetNColumns())
+	for i := 0; i < int(mw.treeView.GetNColumns()); i++ {
+		column := mw.treeView.GetColumn(i)
+		column.SetResizable(true)
+		if i < len(config.TitleColumnWidths) && config.TitleColumnWidths[i] > 0 {
+			column.SetFixedWidth(scaled(config.TitleColumnWidths[i]))
+		}
+		mw.titleColumns = append(mw.titleColumns, column)
+	}
+	for _, column := range mw.titleColumns[GENRE_COLUMN:] {
+		column.SetVisible(mw.showTitleDetails)
+	}
+
 	mainvBox, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
 	if err != nil {
 		log.Fatalln("Unable to create box:", err)
@@ -276,13 +475,13 @@ func (mw *MainWindow) ShowAll() {
 		}
 
 		mw.progressWindow.Window.ShowAll()
-		go func() {
+		goWithCrashReport(func() {
 			if err := mw.onDecryptContentsMenuItemClicked(selectedPath); err != nil {
 				glib.IdleAdd(func() {
 					mw.showError(err)
 				})
 			}
-		}()
+		})
 	})
 	toolsSubMenu.Append(decryptContentsMenuItem)
 
@@ -306,7 +505,7 @@ func (mw *MainWindow) ShowAll() {
 			return
 		}
 
-		titleKey, err := wiiudownloader.GenerateKey(fmt.Sprintf("%016x", tmd.TitleID))
+		titleKey, err := wiiudownloader.GetTicketTitleKey(tmd.TitleID)
 		if err != nil {
 			return
 		}
@@ -319,6 +518,172 @@ func (mw *MainWindow) ShowAll() {
 	})
 	toolsSubMenu.Append(generateFakeTicketCert)
 
+	refreshTitleDatabaseMenuItem, err := gtk.MenuItemNewWithLabel("Refresh title database")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	refreshTitleDatabaseMenuItem.Connect("activate", func() {
+		// A window of its own, the one of the queue may be in use
+		progressWindow, err := createProgressWindow(mw.window)
+		if err != nil {
+			return
+		}
+		progressWindow.SetGameTitle("Refreshing title database...")
+		progressWindow.Window.ShowAll()
+		goWithCrashReport(func() {
+			mw.refreshTitleDatabase(progressWindow)
+		})
+	})
+	toolsSubMenu.Append(refreshTitleDatabaseMenuItem)
+
+	importQueueMenuItem, err := gtk.MenuItemNewWithLabel("Import queue...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	importQueueMenuItem.Connect("activate", func() {
+		importPath, err := dialog.File().Title("Import queue").Filter("Title ID lists", "txt", "json", "csv").Load()
+		if err != nil {
+			return
+		}
+		mw.importQueue(importPath)
+	})
+	toolsSubMenu.Append(importQueueMenuItem)
+
+	exportListMenuItem, err := gtk.MenuItemNewWithLabel("Export list...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	exportListMenuItem.Connect("activate", mw.onExportListMenuItemClicked)
+	toolsSubMenu.Append(exportListMenuItem)
+
+	verifyTitleMenuItem, err := gtk.MenuItemNewWithLabel("Verify title...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	verifyTitleMenuItem.Connect("activate", func() {
+		mw.onVerifyTitleMenuItemClicked(false)
+	})
+	toolsSubMenu.Append(verifyTitleMenuItem)
+
+	quickVerifyTitleMenuItem, err := gtk.MenuItemNewWithLabel("Quick verify title (sizes only)...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	quickVerifyTitleMenuItem.Connect("activate", func() {
+		mw.onVerifyTitleMenuItemClicked(true)
+	})
+	toolsSubMenu.Append(quickVerifyTitleMenuItem)
+
+	slimTitleMenuItem, err := gtk.MenuItemNewWithLabel("Keep metadata only...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	slimTitleMenuItem.Connect("activate", func() {
+		selectedPath, err := dialog.Directory().Title("Select the title folder to slim down").Browse()
+		if err != nil {
+			return
+		}
+		if !mw.confirm("This deletes every content of the title, keeping only title.tmd, title.tik and title.cert. Continue?") {
+			return
+		}
+		if err := wiiudownloader.SlimTitle(selectedPath); err != nil {
+			mw.showError(err)
+		}
+	})
+	toolsSubMenu.Append(slimTitleMenuItem)
+
+	restoreMetadataMenuItem, err := gtk.MenuItemNewWithLabel("Restore missing metadata...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	restoreMetadataMenuItem.Connect("activate", mw.onRestoreMetadataMenuItemClicked)
+	toolsSubMenu.Append(restoreMetadataMenuItem)
+
+	pasteTitleIDMenuItem, err := gtk.MenuItemNewWithLabel("Paste title ID")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	pasteTitleIDMenuItem.Connect("activate", mw.onPasteTitleIDMenuItemClicked)
+	toolsSubMenu.Append(pasteTitleIDMenuItem)
+
+	showHiddenTitlesMenuItem, err := gtk.MenuItemNewWithLabel("Show hidden titles again")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	showHiddenTitlesMenuItem.Connect("activate", func() {
+		if len(mw.hiddenTitles) == 0 {
+			mw.showInfo("No title is hidden.")
+			return
+		}
+		if !mw.confirm(fmt.Sprintf("Show the %d hidden titles in the list again?", len(mw.hiddenTitles))) {
+			return
+		}
+		mw.setTitlesHidden(mw.getHiddenTitleEntries(), false)
+	})
+	toolsSubMenu.Append(showHiddenTitlesMenuItem)
+
+	rescanLibraryMenuItem, err := gtk.MenuItemNewWithLabel("Rescan games library")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	rescanLibraryMenuItem.Connect("activate", func() {
+		if mw.libraryPath == "" {
+			mw.showInfo("Choose the folder of your games library in the settings first.")
+			return
+		}
+		mw.rescanLibrary()
+	})
+	toolsSubMenu.Append(rescanLibraryMenuItem)
+
+	missingLibraryTitlesMenuItem, err := gtk.MenuItemNewWithLabel("Missing updates and DLC...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	missingLibraryTitlesMenuItem.Connect("activate", mw.showMissingLibraryTitles)
+	toolsSubMenu.Append(missingLibraryTitlesMenuItem)
+
+	checkForUpdatesMenuItem, err := gtk.MenuItemNewWithLabel("Check for updates...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	checkForUpdatesMenuItem.Connect("activate", func() {
+		config, err := loadConfig()
+		if err != nil {
+			mw.showError(err)
+			return
+		}
+		mw.checkForUpdates(config, true)
+	})
+	toolsSubMenu.Append(checkForUpdatesMenuItem)
+
+	statsMenuItem, err := gtk.MenuItemNewWithLabel("Download statistics...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	statsMenuItem.Connect("activate", mw.showDownloadStats)
+	toolsSubMenu.Append(statsMenuItem)
+
+	contentBrowserMenuItem, err := gtk.MenuItemNewWithLabel("Content browser...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	contentBrowserMenuItem.Connect("activate", mw.showContentBrowser)
+	toolsSubMenu.Append(contentBrowserMenuItem)
+
+	downloadFirmwareMenuItem, err := gtk.MenuItemNewWithLabel("Download system firmware...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	downloadFirmwareMenuItem.Connect("activate", mw.onDownloadFirmwareMenuItemClicked)
+	toolsSubMenu.Append(downloadFirmwareMenuItem)
+
+	downloadToSDCardMenuItem, err := gtk.MenuItemNewWithLabel("Download queue to SD card...")
+	if err != nil {
+		log.Fatalln("Unable to create menu item:", err)
+	}
+	downloadToSDCardMenuItem.Connect("activate", mw.onDownloadToSDCardMenuItemClicked)
+	toolsSubMenu.Append(downloadToSDCardMenuItem)
+
 	toolsMenu.SetSubmenu(toolsSubMenu)
 	menuBar.Append(toolsMenu)
 	configSubMenu, err := gtk.MenuNew()
@@ -334,16 +699,7 @@ func (mw *MainWindow) ShowAll() {
 	if err != nil {
 		log.Fatalln("Unable to create menu item:", err)
 	}
-	configOption.Connect("activate", func() {
-		config, err := loadConfig()
-		if err != nil {
-			return
-		}
-		if err := mw.createConfigWindow(config); err != nil {
-			return
-		}
-		mw.configWindow.Window.ShowAll()
-	})
+	configOption.Connect("activate", mw.showConfigWindow)
 	configSubMenu.Append(configOption)
 	menuBar.Append(configMenuOption)
 	mainvBox.PackStart(menuBar, false, false, 0)
@@ -353,24 +709,89 @@ func (mw *MainWindow) ShowAll() {
 	}
 
 	mw.categoryButtons = make([]*gtk.ToggleButton, 0)
-	for _, cat := range []string{"Game", "Update", "DLC", "Demo", "All"} {
+	systemCategoryButtons := make([]*gtk.ToggleButton, 0)
+	for _, cat := range []string{"Game", "Update", "DLC", "Demo", "All", "Favorites", "System App", "System Data", "System Applet"} {
 		button, err := gtk.ToggleButtonNewWithLabel(cat)
 		if err != nil {
 			log.Fatalln("Unable to create toggle button:", err)
 		}
 		tophBox.PackStart(button, false, false, 0)
+		if strings.HasPrefix(cat, "System") {
+			button.SetNoShowAll(!mw.showSystemTitles)
+			systemCategoryButtons = append(systemCategoryButtons, button)
+		}
 		button.Connect("pressed", mw.onCategoryToggled)
+		button.Connect("key-press-event", mw.onCategoryKeyPressed)
 		buttonLabel, err := button.GetLabel()
 		if err != nil {
 			log.Fatalln("Unable to get label:", err)
 		}
-		if buttonLabel == "Game" {
+		if getCategoryFromLabel(buttonLabel) == mw.currentCategory {
 			button.SetActive(true)
 		}
 		mw.categoryButtons = append(mw.categoryButtons, button)
 	}
+
+	// Games are told apart by their product code, from the embedded title data
+	mw.gameSubcategoryCombo, err = gtk.ComboBoxTextNew()
+	if err != nil {
+		log.Fatalln("Unable to create combo box:", err)
+	}
+	gameSubcategories := wiiudownloader.GetGameSubcategories()
+	for _, subcategory := range gameSubcategories {
+		mw.gameSubcategoryCombo.AppendText(wiiudownloader.GetFormattedGameSubcategory(subcategory))
+	}
+	mw.gameSubcategoryCombo.SetActive(slices.Index(gameSubcategories, mw.gameSubcategory))
+	mw.gameSubcategoryCombo.SetSensitive(mw.currentCategory == wiiudownloader.TITLE_CATEGORY_GAME)
+	setAccessibleName(mw.gameSubcategoryCombo, "Kind of games")
+	mw.gameSubcategoryCombo.SetTooltipText("Only list the retail, eShop only or Virtual Console games. Games whose product code isn't known are only listed in All games.")
+	mw.gameSubcategoryCombo.Connect("changed", func() {
+		if active := mw.gameSubcategoryCombo.GetActive(); active >= 0 {
+			mw.onGameSubcategoryChanged(gameSubcategories[active])
+		}
+	})
+	tophBox.PackStart(mw.gameSubcategoryCombo, false, false, 0)
 	tophBox.PackEnd(mw.searchEntry, false, false, 0)
 
+	// System titles are firmware pieces, keep them out of the way unless explicitly asked for
+	advancedCheckbox, err := gtk.CheckButtonNewWithLabel("Advanced")
+	if err != nil {
+		log.Fatalln("Unable to create button:", err)
+	}
+	advancedCheckbox.SetActive(mw.showSystemTitles)
+	advancedCheckbox.Connect("toggled", func() {
+		mw.showSystemTitles = advancedCheckbox.GetActive()
+		for _, button := range systemCategoryButtons {
+			button.SetNoShowAll(!mw.showSystemTitles)
+			button.SetVisible(mw.showSystemTitles)
+		}
+		if !mw.showSystemTitles && mw.currentCategory >= wiiudownloader.TITLE_CATEGORY_SYSTEM_APP {
+			mw.onCategoryToggled(mw.categoryButtons[0])
+		}
+		config, err := loadConfig()
+		if err != nil {
+			return
+		}
+		config.ShowSystemTitles = mw.showSystemTitles
+		if err := config.Save(); err != nil {
+			return
+		}
+	})
+	tophBox.PackEnd(advancedCheckbox, false, false, 0)
+
+	// The genre, number of players and languages come from GameTDB, only the
+	// games it knows have them
+	detailsCheckbox, err := gtk.CheckButtonNewWithLabel("Details")
+	if err != nil {
+		log.Fatalln("Unable to create button:", err)
+	}
+	detailsCheckbox.SetActive(mw.showTitleDetails)
+	detailsCheckbox.SetTooltipText("Show the genre, number of players and languages of the titles, and filter the list by them. They come from GameTDB, titles it doesn't know have none.")
+	detailsCheckbox.Connect("toggled", func() {
+		mw.onShowTitleDetailsToggled(detailsCheckbox.GetActive())
+	})
+	tophBox.PackEnd(detailsCheckbox, false, false, 0)
+
 	mainvBox.PackStart(tophBox, false, false, 0)
 
 	scrollable, err := gtk.ScrolledWindowNew(nil, nil)
@@ -398,48 +819,25 @@ func (mw *MainWindow) ShowAll() {
 	}
 	decryptContentsCheckbox.SetActive(mw.decryptContents)
 
-	mw.deleteEncryptedContentsCheckbox, err = gtk.CheckButtonNewWithLabel("Delete encrypted contents after decryption")
+	mw.encryptedContentsPolicyComboBox, err = newEncryptedContentsCombo(mw.encryptedContentsPolicy)
 	if err != nil {
-		log.Fatalln("Unable to create button:", err)
+		log.Fatalln("Unable to create combo box:", err)
 	}
-	mw.deleteEncryptedContentsCheckbox.SetSensitive(mw.decryptContents)
-	mw.deleteEncryptedContentsCheckbox.SetActive(mw.deleteEncryptedContents)
-	mw.deleteEncryptedContentsCheckbox.Connect("clicked", func() {
+	mw.encryptedContentsPolicyComboBox.SetSensitive(mw.decryptContents)
+	mw.encryptedContentsPolicyComboBox.Connect("changed", func() {
 		config, err := loadConfig()
 		if err != nil {
 			return
 		}
-		config.DeleteEncryptedContents = mw.getDeleteEncryptedContents()
+		mw.encryptedContentsPolicy = mw.encryptedContentsPolicyComboBox.GetActiveID()
+		config.EncryptedContentsPolicy = mw.encryptedContentsPolicy
+		config.DeleteEncryptedContents = mw.encryptedContentsPolicy == wiiudownloader.ENCRYPTED_CONTENTS_DELETE
 		if err := config.Save(); err != nil {
 			return
 		}
 	})
 
-	downloadQueueButton.Connect("clicked", func() {
-		if mw.queuePane.IsQueueEmpty() {
-			return
-		}
-		mw.progressWindow, err = createProgressWindow(mw.window)
-		if err != nil {
-			return
-		}
-		selectedPath, err := dialog.Directory().Title("Select a path to save the games to").Browse()
-		if err != nil {
-			glib.IdleAdd(func() {
-				mw.progressWindow.Window.Hide()
-			})
-			return
-		}
-		mw.progressWindow.Window.ShowAll()
-
-		go func() {
-			if err := mw.onDownloadQueueClicked(selectedPath); err != nil {
-				glib.IdleAdd(func() {
-					mw.showError(err)
-				})
-			}
-		}()
-	})
+	downloadQueueButton.Connect("clicked", mw.startQueueDownload)
 	decryptContentsCheckbox.Connect("clicked", mw.onDecryptContentsClicked)
 	bottomhBox.PackStart(downloadQueueButton, false, false, 0)
 
@@ -448,7 +846,7 @@ func (mw *MainWindow) ShowAll() {
 		log.Fatalln("Unable to create box:", err)
 	}
 	checkboxvBox.PackStart(decryptContentsCheckbox, false, false, 0)
-	checkboxvBox.PackEnd(mw.deleteEncryptedContentsCheckbox, false, false, 0)
+	checkboxvBox.PackEnd(mw.encryptedContentsPolicyComboBox, false, false, 0)
 
 	bottomhBox.PackStart(checkboxvBox, false, false, 0)
 
@@ -482,6 +880,41 @@ func (mw *MainWindow) ShowAll() {
 	})
 	bottomhBox.PackEnd(europeButton, false, false, 0)
 
+	// Only the OS versions of the titles downloaded so far are known
+	osVersions := wiiudownloader.GetKnownOSVersions()
+	if mw.maxOSVersion != 0 && !slices.Contains(osVersions, mw.maxOSVersion) {
+		osVersions = append(osVersions, mw.maxOSVersion)
+		slices.Sort(osVersions)
+	}
+	osVersions = append([]uint8{0}, osVersions...)
+	osVersionCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		log.Fatalln("Unable to create combo box:", err)
+	}
+	for _, number := range osVersions {
+		if number == 0 {
+			osVersionCombo.AppendText("Any system")
+		} else {
+			osVersionCombo.AppendText("Up to " + wiiudownloader.FormatOSVersion(number))
+		}
+	}
+	osVersionCombo.SetActive(slices.Index(osVersions, mw.maxOSVersion))
+	setAccessibleName(osVersionCombo, "System version of the console")
+	osVersionCombo.SetTooltipText("Only list the titles a console with this system version can install. The system a title needs is known once it was downloaded, the others are always listed.")
+	osVersionCombo.Connect("changed", func() {
+		if active := osVersionCombo.GetActive(); active >= 0 {
+			mw.onMaxOSVersionChanged(osVersions[active])
+		}
+	})
+	bottomhBox.PackEnd(osVersionCombo, false, false, 0)
+
+	mw.titleDetailFilters, err = mw.newTitleDetailFilters()
+	if err != nil {
+		log.Fatalln("Unable to create combo box:", err)
+	}
+	mw.titleDetailFilters.SetNoShowAll(!mw.showTitleDetails)
+	bottomhBox.PackEnd(mw.titleDetailFilters, false, false, 0)
+
 	mainvBox.PackEnd(bottomhBox, false, false, 0)
 
 	splitPane, err := gtk.PanedNew(gtk.ORIENTATION_HORIZONTAL)
@@ -498,20 +931,62 @@ func (mw *MainWindow) ShowAll() {
 
 	mw.window.Add(splitPane)
 
-	splitPane.ShowAll()
-}
-
-func (mw *MainWindow) onRegionChange(button *gtk.CheckButton, region uint8) {
-	if button.GetActive() {
-		mw.currentRegion = region | mw.currentRegion
-	} else {
-		mw.currentRegion = region ^ mw.currentRegion
+	dropTargets := make([]gtk.TargetEntry, 0)
+	for _, target := range []string{"text/uri-list", "text/plain;charset=utf-8", "UTF8_STRING", "text/plain"} {
+		dropTarget, err := gtk.TargetEntryNew(target, gtk.TARGET_OTHER_APP, 0)
+		if err != nil {
+			log.Fatalln("Unable to create target entry:", err)
+		}
+		dropTargets = append(dropTargets, *dropTarget)
 	}
-	mw.updateTitles(mw.titles)
-	mw.filterTitles(mw.lastSearchText)
-	config, err := loadConfig()
+	mw.window.DragDestSet(gtk.DEST_DEFAULT_ALL, dropTargets, gdk.ACTION_COPY)
+
+	clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
 	if err != nil {
-		return
+		log.Fatalln("Unable to get clipboard:", err)
+	}
+	clipboard.Connect("owner-change", mw.onClipboardChanged)
+
+	accelGroup, err := gtk.AccelGroupNew()
+	if err != nil {
+		log.Fatalln("Unable to create accel group:", err)
+	}
+	accelGroup.Connect(gdk.KEY_f, primaryModifier, gtk.ACCEL_VISIBLE, func() {
+		mw.searchEntry.GrabFocus()
+	})
+	if !hasNativeAppMenu {
+		// Quit of the app menu has the shortcut where there is one
+		accelGroup.Connect(gdk.KEY_q, primaryModifier, gtk.ACCEL_VISIBLE, func() {
+			mw.window.Close()
+		})
+	}
+	mw.window.AddAccelGroup(accelGroup)
+	mw.treeView.Connect("key-press-event", mw.onTitleListKeyPressed)
+	mw.treeView.Connect("button-press-event", mw.onTitleListButtonPressed)
+	mw.window.Connect("drag-data-received", func(window *gtk.Window, context *gdk.DragContext, x, y int, data *gtk.SelectionData) {
+		text := data.GetText()
+		if uris := data.GetURIs(); len(uris) > 0 {
+			text = strings.Join(uris, "\n")
+		}
+		if text == "" {
+			text = string(data.GetData())
+		}
+		mw.onTextDropped(text)
+	})
+
+	splitPane.ShowAll()
+}
+
+func (mw *MainWindow) onRegionChange(button *gtk.CheckButton, region uint8) {
+	if button.GetActive() {
+		mw.currentRegion = region | mw.currentRegion
+	} else {
+		mw.currentRegion = region ^ mw.currentRegion
+	}
+	mw.filterTitles(mw.lastSearchText)
+	config, err := loadConfig()
+	if err != nil {
+		return
 	}
 	config.SelectedRegion = mw.currentRegion
 	if err := config.Save(); err != nil {
@@ -519,67 +994,1152 @@ func (mw *MainWindow) onRegionChange(button *gtk.CheckButton, region uint8) {
 	}
 }
 
-func (mw *MainWindow) onSearchEntryChanged() {
-	text, err := mw.searchEntry.GetText()
+func (mw *MainWindow) onGameSubcategoryChanged(subcategory uint8) {
+	mw.gameSubcategory = subcategory
+	mw.filterTitles(mw.lastSearchText)
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	config.GameSubcategory = mw.gameSubcategory
+	if err := config.Save(); err != nil {
+		return
+	}
+}
+
+func (mw *MainWindow) onMaxOSVersionChanged(number uint8) {
+	mw.maxOSVersion = number
+	mw.filterTitles(mw.lastSearchText)
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	config.MaxOSVersion = mw.maxOSVersion
+	if err := config.Save(); err != nil {
+		return
+	}
+}
+
+// newTitleDetailFilters returns the genre, players and language filters of the
+// title list. They list the values of the known titles, and the one selected
+// if no known title has it anymore.
+func (mw *MainWindow) newTitleDetailFilters() (*gtk.Box, error) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	genres := wiiudownloader.GetKnownGenres()
+	if mw.genre != "" && !slices.Contains(genres, mw.genre) {
+		genres = append(genres, mw.genre)
+		slices.Sort(genres)
+	}
+	genres = append([]string{""}, genres...)
+	genreCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	for _, genre := range genres {
+		if genre == "" {
+			genreCombo.AppendText("Any genre")
+		} else {
+			genreCombo.AppendText(genre)
+		}
+	}
+	genreCombo.SetActive(slices.Index(genres, mw.genre))
+	setAccessibleName(genreCombo, "Genre")
+	genreCombo.SetTooltipText("Only list the titles of this genre. Titles whose genre isn't known are only listed with any genre.")
+	genreCombo.Connect("changed", func() {
+		if active := genreCombo.GetActive(); active >= 0 {
+			mw.genre = genres[active]
+			mw.onTitleDetailFiltersChanged()
+		}
+	})
+	box.PackStart(genreCombo, false, false, 0)
+
+	players := wiiudownloader.GetKnownPlayers()
+	if mw.minPlayers != 0 && !slices.Contains(players, mw.minPlayers) {
+		players = append(players, mw.minPlayers)
+		slices.Sort(players)
+	}
+	players = append([]uint8{0}, players...)
+	playersCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	for _, number := range players {
+		switch number {
+		case 0:
+			playersCombo.AppendText("Any players")
+		case 1:
+			playersCombo.AppendText("1 player")
+		default:
+			playersCombo.AppendText(fmt.Sprintf("%d+ players", number))
+		}
+	}
+	playersCombo.SetActive(slices.Index(players, mw.minPlayers))
+	setAccessibleName(playersCombo, "Number of players")
+	playersCombo.SetTooltipText("Only list the titles that can be played by at least this many players at once. Titles whose number of players isn't known are only listed with any players.")
+	playersCombo.Connect("changed", func() {
+		if active := playersCombo.GetActive(); active >= 0 {
+			mw.minPlayers = players[active]
+			mw.onTitleDetailFiltersChanged()
+		}
+	})
+	box.PackStart(playersCombo, false, false, 0)
+
+	languages := wiiudownloader.GetKnownLanguages()
+	if mw.language != 0 && !slices.Contains(languages, mw.language) {
+		languages = append(languages, mw.language)
+	}
+	languages = append([]uint16{0}, languages...)
+	languageCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	for _, language := range languages {
+		if language == 0 {
+			languageCombo.AppendText("Any language")
+		} else {
+			languageCombo.AppendText(wiiudownloader.GetFormattedLanguage(language))
+		}
+	}
+	languageCombo.SetActive(slices.Index(languages, mw.language))
+	setAccessibleName(languageCombo, "Language")
+	languageCombo.SetTooltipText("Only list the titles that can be played in this language. Titles whose languages aren't known are only listed with any language.")
+	languageCombo.Connect("changed", func() {
+		if active := languageCombo.GetActive(); active >= 0 {
+			mw.language = languages[active]
+			mw.onTitleDetailFiltersChanged()
+		}
+	})
+	box.PackStart(languageCombo, false, false, 0)
+	return box, nil
+}
+
+func (mw *MainWindow) onTitleDetailFiltersChanged() {
+	mw.filterTitles(mw.lastSearchText)
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	config.Genre = mw.genre
+	config.MinPlayers = mw.minPlayers
+	config.Language = mw.language
+	if err := config.Save(); err != nil {
+		return
+	}
+}
+
+// onShowTitleDetailsToggled shows or hides the genre, players and languages
+// columns and filters, the filters only apply while they are shown.
+func (mw *MainWindow) onShowTitleDetailsToggled(show bool) {
+	mw.showTitleDetails = show
+	for _, column := range mw.titleColumns[GENRE_COLUMN:] {
+		column.SetVisible(show)
+	}
+	mw.titleDetailFilters.SetNoShowAll(!show)
+	if show {
+		mw.titleDetailFilters.ShowAll()
+	} else {
+		mw.titleDetailFilters.Hide()
+	}
+	mw.filterTitles(mw.lastSearchText)
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	config.ShowTitleDetails = mw.showTitleDetails
+	if err := config.Save(); err != nil {
+		return
+	}
+}
+
+// saveWindowState remembers the size and position of the window and the width
+// of the title list columns for the next start.
+func (mw *MainWindow) saveWindowState() bool {
+	config, err := loadConfig()
+	if err != nil {
+		return false
+	}
+	config.WindowMaximized = mw.window.IsMaximized()
+	if !config.WindowMaximized {
+		width, height := mw.window.GetSize()
+		config.WindowWidth, config.WindowHeight = unscaled(width), unscaled(height)
+		config.WindowX, config.WindowY = mw.window.GetPosition()
+	}
+	config.TitleColumnWidths = make([]int, 0, len(mw.titleColumns))
+	for _, column := range mw.titleColumns {
+		config.TitleColumnWidths = append(config.TitleColumnWidths, unscaled(column.GetWidth()))
+	}
+	if err := config.Save(); err != nil {
+		log.Println(err)
+	}
+	return false
+}
+
+// startQueueDownload asks where to save the queue and downloads it.
+func (mw *MainWindow) startQueueDownload() {
+	if mw.queuePane.IsQueueEmpty() {
+		return
+	}
+	settings, ok := mw.chooseDownloadSettings()
+	if !ok {
+		return
+	}
+	progressWindow, err := createProgressWindow(mw.window)
+	if err != nil {
+		return
+	}
+	mw.progressWindow = progressWindow
+	progressWindow.Window.ShowAll()
+
+	goWithCrashReport(func() {
+		if err := mw.onDownloadQueueClicked(settings, progressWindow); err != nil {
+			glib.IdleAdd(func() {
+				mw.showError(err)
+			})
+			return
+		}
+		if !progressWindow.Cancelled() {
+			glib.IdleAdd(func() {
+				progressWindow.ShowCompleted(settings.folder)
+				if mw.libraryPath != "" {
+					mw.rescanLibrary()
+				}
+			})
+			mw.runAfterQueueAction()
+		}
+	})
+}
+
+// selectTitle shows a title in the list and selects it, switching to the "All"
+// category when the current one does not hold it.
+func (mw *MainWindow) selectTitle(entry wiiudownloader.TitleEntry) {
+	listed := false
+	for _, title := range mw.titles {
+		if title.TitleID == entry.TitleID {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		for _, button := range mw.categoryButtons {
+			if label, err := button.GetLabel(); err == nil && label == "All" {
+				mw.onCategoryToggled(button)
+				break
+			}
+		}
+	}
+	mw.searchEntry.SetText(fmt.Sprintf("%016x", entry.TitleID))
+	// The title has to be listed right away to select it
+	mw.filterTitles(fmt.Sprintf("%016x", entry.TitleID))
+
+	model, err := mw.treeView.GetModel()
+	if err != nil {
+		log.Fatalln("Unable to get tree view model:", err)
+	}
+	treeModel := model.ToTreeModel()
+	iter, ok := treeModel.GetIterFirst()
+	if !ok {
+		return
+	}
+	selection, err := mw.treeView.GetSelection()
+	if err != nil {
+		log.Fatalln("Unable to get selection:", err)
+	}
+	selection.UnselectAll()
+	selection.SelectIter(iter)
+	if path, err := treeModel.GetPath(iter); err == nil {
+		mw.treeView.ScrollToCell(path, nil, false, 0, 0)
+	}
+}
+
+// findTitleInText returns the title whose ID appears in text, like a title ID
+// or a URL that contains one, or the game of a Nintendo eShop page URL.
+func findTitleInText(text string) (wiiudownloader.TitleEntry, error) {
+	tid, ok := wiiudownloader.FindTitleID(text)
+	if !ok {
+		return wiiudownloader.TitleEntry{}, fmt.Errorf("No title ID or eShop page of a known game found in %q", strings.TrimSpace(text))
+	}
+	entry := wiiudownloader.GetTitleEntryFromTid(tid)
+	if entry.TitleID != tid {
+		return wiiudownloader.TitleEntry{}, fmt.Errorf("Title %016x is not in the title database", tid)
+	}
+	return entry, nil
+}
+
+// openArguments adds the titles given on the command line to the queue: title
+// IDs, links that contain one and files with title IDs. The titles of
+// wiiudownloader:// links are only selected, websites can't queue downloads.
+func (mw *MainWindow) openArguments(arguments []string) {
+	for _, argument := range arguments {
+		if isTitleURI(argument) {
+			mw.openTitleURI(argument)
+			continue
+		}
+		if info, err := os.Stat(argument); err == nil && !info.IsDir() {
+			mw.importQueue(argument)
+			continue
+		}
+		entry, err := findTitleInText(argument)
+		if err != nil {
+			mw.showError(err)
+			continue
+		}
+		mw.selectTitle(entry)
+		if !mw.queuePane.IsTitleInQueue(entry) {
+			mw.queuePane.AddTitle(entry)
+		}
+	}
+	mw.updateTitlesInQueue()
+}
+
+// openTitleURI selects the title of a wiiudownloader://tid/<title ID> link.
+func (mw *MainWindow) openTitleURI(uri string) {
+	tid, err := parseTitleURI(uri)
+	if err != nil {
+		mw.showError(err)
+		return
+	}
+	entry := wiiudownloader.GetTitleEntryFromTid(tid)
+	if entry.TitleID != tid {
+		mw.showError(fmt.Errorf("Title %016x is not in the title database", tid))
+		return
+	}
+	mw.selectTitle(entry)
+}
+
+func (mw *MainWindow) onPasteTitleIDMenuItemClicked() {
+	clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		mw.showError(err)
+		return
+	}
+	text, err := clipboard.WaitForText()
+	if err != nil {
+		mw.showError(errors.New("The clipboard does not hold any text"))
+		return
+	}
+	entry, err := findTitleInText(text)
+	if err != nil {
+		mw.showError(err)
+		return
+	}
+	mw.selectTitle(entry)
+}
+
+// onClipboardChanged selects the titles whose ID gets copied while clipboard
+// monitoring is enabled. Anything else on the clipboard is ignored silently.
+func (mw *MainWindow) onClipboardChanged(clipboard *gtk.Clipboard) {
+	if !mw.monitorClipboard || !clipboard.WaitIsTextAvailable() {
+		return
+	}
+	text, err := clipboard.WaitForText()
+	if err != nil {
+		return
+	}
+	tid, err := wiiudownloader.ParseTitleID(text)
+	if err != nil || tid == mw.lastClipboardTitleID {
+		return
+	}
+	mw.lastClipboardTitleID = tid
+	if entry := wiiudownloader.GetTitleEntryFromTid(tid); entry.TitleID == tid {
+		mw.selectTitle(entry)
+	}
+}
+
+// onTextDropped looks up the title ID found in text dropped onto the window,
+// like a title ID or a URL, and offers to download it right away.
+func (mw *MainWindow) onTextDropped(text string) {
+	entry, err := findTitleInText(text)
+	if err != nil {
+		mw.showError(err)
+		return
+	}
+	mw.selectTitle(entry)
+	if !mw.confirm(fmt.Sprintf("Download %s (%016x)?", entry.Name, entry.TitleID)) {
+		return
+	}
+	if !mw.queuePane.IsTitleInQueue(entry) {
+		mw.queuePane.AddTitle(entry)
+		mw.updateTitlesInQueue()
+	}
+	mw.startQueueDownload()
+}
+
+// onSearchEntryChanged filters the list once typing pauses for searchDelay, not
+// for every letter of a name.
+func (mw *MainWindow) onSearchEntryChanged() {
+	if mw.searchTimeout != 0 {
+		glib.SourceRemove(mw.searchTimeout)
+	}
+	mw.searchTimeout = glib.TimeoutAdd(searchDelay, func() bool {
+		mw.searchTimeout = 0
+		text, err := mw.searchEntry.GetText()
+		if err != nil {
+			log.Fatalln("Unable to get text:", err)
+		}
+		mw.filterTitles(text)
+		return false
+	})
+}
+
+// filterTitles shows the titles of the list that match filterText and pass the
+// filters.
+func (mw *MainWindow) filterTitles(filterText string) {
+	mw.lastSearchText = filterText
+	mw.titleFilter.Refilter()
+}
+
+func (mw *MainWindow) onCategoryToggled(button *gtk.ToggleButton) {
+	category, err := button.GetLabel()
+	if err != nil {
+		log.Fatalln("Unable to get label:", err)
+	}
+	mw.currentCategory = getCategoryFromLabel(category)
+	mw.gameSubcategoryCombo.SetSensitive(mw.currentCategory == wiiudownloader.TITLE_CATEGORY_GAME)
+	mw.titles = mw.getCategoryTitles(mw.currentCategory)
+	mw.updateTitles(mw.titles)
+	for _, catButton := range mw.categoryButtons {
+		catButton.SetActive(false)
+	}
+	button.Activate()
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	config.SelectedCategory = mw.currentCategory
+	if err := config.Save(); err != nil {
+		return
+	}
+}
+
+func parseTitleIDSet(titleIDs []string) map[uint64]bool {
+	titleIDSet := make(map[uint64]bool, len(titleIDs))
+	for _, titleID := range titleIDs {
+		if tid, err := wiiudownloader.ParseTitleID(titleID); err == nil {
+			titleIDSet[tid] = true
+		}
+	}
+	return titleIDSet
+}
+
+func formatTitleIDSet(titleIDSet map[uint64]bool) []string {
+	titleIDs := make([]string, 0, len(titleIDSet))
+	for tid := range titleIDSet {
+		titleIDs = append(titleIDs, fmt.Sprintf("%016x", tid))
+	}
+	sort.Strings(titleIDs)
+	return titleIDs
+}
+
+func getCategoryFromLabel(label string) uint8 {
+	if label == "Favorites" {
+		return CATEGORY_FAVORITES
+	}
+	return wiiudownloader.GetCategoryFromFormattedCategory(label)
+}
+
+// getCategoryTitles returns the titles of a category of the title database, or
+// the favorite titles for CATEGORY_FAVORITES.
+func (mw *MainWindow) getCategoryTitles(category uint8) []wiiudownloader.TitleEntry {
+	if category != CATEGORY_FAVORITES {
+		return wiiudownloader.GetTitleEntries(category)
+	}
+	favorites := make([]wiiudownloader.TitleEntry, 0, len(mw.favoriteTitles))
+	for tid := range mw.favoriteTitles {
+		if entry := wiiudownloader.GetTitleEntryFromTid(tid); entry.TitleID == tid {
+			favorites = append(favorites, entry)
+		}
+	}
+	sort.Slice(favorites, func(i, j int) bool {
+		return favorites[i].Name < favorites[j].Name
+	})
+	return favorites
+}
+
+func (mw *MainWindow) getHiddenTitleEntries() []wiiudownloader.TitleEntry {
+	hidden := make([]wiiudownloader.TitleEntry, 0, len(mw.hiddenTitles))
+	for tid := range mw.hiddenTitles {
+		hidden = append(hidden, wiiudownloader.TitleEntry{TitleID: tid})
+	}
+	return hidden
+}
+
+// refreshTitles lists the titles of the current category again, after the
+// favorite or hidden titles changed.
+func (mw *MainWindow) refreshTitles() {
+	mw.titles = mw.getCategoryTitles(mw.currentCategory)
+	mw.updateTitles(mw.titles)
+}
+
+func (mw *MainWindow) setTitlesFavorite(titles []wiiudownloader.TitleEntry, favorite bool) {
+	for _, title := range titles {
+		if favorite {
+			mw.favoriteTitles[title.TitleID] = true
+		} else {
+			delete(mw.favoriteTitles, title.TitleID)
+		}
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	config.FavoriteTitles = formatTitleIDSet(mw.favoriteTitles)
+	if err := config.Save(); err != nil {
+		log.Println(err)
+	}
+	if mw.currentCategory == CATEGORY_FAVORITES {
+		mw.refreshTitles()
+	}
+}
+
+func (mw *MainWindow) setTitlesHidden(titles []wiiudownloader.TitleEntry, hidden bool) {
+	for _, title := range titles {
+		if hidden {
+			mw.hiddenTitles[title.TitleID] = true
+		} else {
+			delete(mw.hiddenTitles, title.TitleID)
+		}
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	config.HiddenTitles = formatTitleIDSet(mw.hiddenTitles)
+	if err := config.Save(); err != nil {
+		log.Println(err)
+	}
+	mw.refreshTitles()
+}
+
+// onTitleListButtonPressed shows the favorite and hide actions on right click,
+// for the selected titles or the one under the pointer.
+func (mw *MainWindow) onTitleListButtonPressed(treeView *gtk.TreeView, event *gdk.Event) bool {
+	buttonEvent := gdk.EventButtonNewFromEvent(event)
+	if buttonEvent.Type() != gdk.EVENT_BUTTON_PRESS || buttonEvent.Button() != gdk.BUTTON_SECONDARY {
+		return false
+	}
+	selection, err := mw.treeView.GetSelection()
+	if err != nil {
+		return false
+	}
+	if path, _, _, _, ok := mw.treeView.GetPathAtPos(int(buttonEvent.X()), int(buttonEvent.Y())); ok && !selection.PathIsSelected(path) {
+		selection.UnselectAll()
+		selection.SelectPath(path)
+	}
+	_, selected := mw.listTitles()
+	if len(selected) == 0 {
+		return false
+	}
+
+	allFavorites := true
+	for _, title := range selected {
+		allFavorites = allFavorites && mw.favoriteTitles[title.TitleID]
+	}
+
+	menu, err := gtk.MenuNew()
+	if err != nil {
+		return false
+	}
+	favoriteLabel := "Add to favorites"
+	if allFavorites {
+		favoriteLabel = "Remove from favorites"
+	}
+	favoriteMenuItem, err := gtk.MenuItemNewWithLabel(favoriteLabel)
+	if err != nil {
+		return false
+	}
+	favoriteMenuItem.Connect("activate", func() {
+		mw.setTitlesFavorite(selected, !allFavorites)
+	})
+	menu.Append(favoriteMenuItem)
+	hideMenuItem, err := gtk.MenuItemNewWithLabel("Hide from the list")
+	if err != nil {
+		return false
+	}
+	hideMenuItem.Connect("activate", func() {
+		mw.setTitlesHidden(selected, true)
+	})
+	menu.Append(hideMenuItem)
+	menu.ShowAll()
+	menu.PopupAtPointer(event)
+	return true
+}
+
+// onCategoryKeyPressed moves between the category filters with the left and
+// right arrow keys.
+func (mw *MainWindow) onCategoryKeyPressed(button *gtk.ToggleButton, event *gdk.Event) bool {
+	step := 0
+	switch gdk.EventKeyNewFromEvent(event).KeyVal() {
+	case gdk.KEY_Left:
+		step = -1
+	case gdk.KEY_Right:
+		step = 1
+	default:
+		return false
+	}
+
+	current := -1
+	for i, catButton := range mw.categoryButtons {
+		if catButton.Native() == button.Native() {
+			current = i
+			break
+		}
+	}
+	if current < 0 {
+		return false
+	}
+	for i := current + step; i >= 0 && i < len(mw.categoryButtons); i += step {
+		if next := mw.categoryButtons[i]; next.GetVisible() {
+			mw.onCategoryToggled(next)
+			next.GrabFocus()
+			break
+		}
+	}
+	return true
+}
+
+// onTitleListKeyPressed downloads the selected titles on Enter and removes
+// them from the queue on Delete.
+func (mw *MainWindow) onTitleListKeyPressed(treeView *gtk.TreeView, event *gdk.Event) bool {
+	keyVal := gdk.EventKeyNewFromEvent(event).KeyVal()
+	if keyVal != gdk.KEY_Return && keyVal != gdk.KEY_KP_Enter && keyVal != gdk.KEY_Delete {
+		return false
+	}
+	_, selected := mw.listTitles()
+	if len(selected) == 0 {
+		return false
+	}
+	for _, title := range selected {
+		if keyVal == gdk.KEY_Delete {
+			mw.queuePane.RemoveTitle(title)
+		} else if !mw.queuePane.IsTitleInQueue(title) {
+			mw.queuePane.AddTitle(title)
+		}
+	}
+	mw.updateTitlesInQueue()
+	if keyVal != gdk.KEY_Delete {
+		mw.startQueueDownload()
+	}
+	return true
+}
+
+func (mw *MainWindow) onDecryptContentsMenuItemClicked(selectedPath string) error {
+	err := wiiudownloader.DecryptContents(selectedPath, mw.progressWindow, false)
+	if shortPath, ok := mw.offerShortenTitlePath(selectedPath, err); ok {
+		err = wiiudownloader.DecryptContents(shortPath, mw.progressWindow, false)
+	}
+
+	glib.IdleAdd(func() {
+		mw.progressWindow.Window.Hide()
+	})
+	return err
+}
+
+// refreshTitleDatabase downloads the title database with its own progress
+// window, which it closes once done.
+func (mw *MainWindow) refreshTitleDatabase(progressWindow *ProgressWindow) {
+	result, err := wiiudownloader.UpdateTitleDatabase(progressWindow, mw.client)
+	glib.IdleAdd(func() {
+		progressWindow.Window.Destroy()
+		if err != nil {
+			if !progressWindow.Cancelled() {
+				mw.showError(err)
+			}
+			return
+		}
+		mw.titles = mw.getCategoryTitles(mw.currentCategory)
+		mw.updateTitles(mw.titles)
+		mw.showInfo(fmt.Sprintf("Title database refreshed: %d entries, %d added, %d changed.", result.Total, result.Added, result.Changed))
+	})
+}
+
+func getTitleIDFromIter(model *gtk.TreeModel, iter *gtk.TreeIter) (uint64, error) {
+	tid, err := model.GetValue(iter, TITLE_ID_COLUMN)
+	if err != nil {
+		return 0, err
+	}
+	defer tid.Unset()
+	tidStr, err := tid.GetString()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(tidStr, 16, 64)
+}
+
+// getListedTitles returns the selected titles, or every title currently shown when nothing is selected.
+func (mw *MainWindow) getListedTitles() []wiiudownloader.TitleEntry {
+	listed, selected := mw.listTitles()
+	if len(selected) > 0 {
+		return selected
+	}
+	return listed
+}
+
+// listTitles returns the titles currently shown and the selected ones.
+func (mw *MainWindow) listTitles() ([]wiiudownloader.TitleEntry, []wiiudownloader.TitleEntry) {
+	selection, err := mw.treeView.GetSelection()
+	if err != nil {
+		log.Fatalln("Unable to get selection:", err)
+	}
+	model, err := mw.treeView.GetModel()
+	if err != nil {
+		log.Fatalln("Unable to get tree view model:", err)
+	}
+	treeModel := model.ToTreeModel()
+
+	entriesByTid := make(map[uint64]wiiudownloader.TitleEntry, len(mw.titles))
+	for _, entry := range mw.titles {
+		entriesByTid[entry.TitleID] = entry
+	}
+
+	listed := make([]wiiudownloader.TitleEntry, 0)
+	selected := make([]wiiudownloader.TitleEntry, 0)
+	iter, ok := treeModel.GetIterFirst()
+	for ok {
+		if tid, err := getTitleIDFromIter(treeModel, iter); err == nil {
+			listed = append(listed, entriesByTid[tid])
+			if selection.IterIsSelected(iter) {
+				selected = append(selected, entriesByTid[tid])
+			}
+		}
+		ok = treeModel.IterNext(iter)
+	}
+	return listed, selected
+}
+
+func (mw *MainWindow) onExportListMenuItemClicked() {
+	titles := mw.getListedTitles()
+	if len(titles) == 0 {
+		return
+	}
+	exportPath, err := dialog.File().Title("Export list").Filter("JSON", "json").Filter("CSV", "csv").Save()
+	if err != nil {
+		return
+	}
+	if filepath.Ext(exportPath) == "" {
+		exportPath += ".json"
+	}
+
+	if !mw.confirm(fmt.Sprintf("Include the download size of the %d exported titles? This fetches the TMD of every title and may take a while.", len(titles))) {
+		if err := wiiudownloader.ExportTitlesToFile(exportPath, titles, nil); err != nil {
+			mw.showError(err)
+		}
+		return
+	}
+
+	mw.progressWindow, err = createProgressWindow(mw.window)
+	if err != nil {
+		return
+	}
+	mw.progressWindow.Window.ShowAll()
+	goWithCrashReport(func() {
+		sizes := make(map[uint64]uint64)
+		for i, title := range titles {
+			if mw.progressWindow.Cancelled() {
+				break
+			}
+			mw.progressWindow.SetGameTitle(fmt.Sprintf("Fetching title sizes (%d/%d)...", i+1, len(titles)))
+			size, err := wiiudownloader.FetchTitleSize(mw.client, title.TitleID)
+			if err != nil {
+				log.Printf("unable to fetch size of %016x: %v\n", title.TitleID, err)
+				continue
+			}
+			sizes[title.TitleID] = size
+		}
+		err := wiiudownloader.ExportTitlesToFile(exportPath, titles, sizes)
+		glib.IdleAdd(func() {
+			mw.progressWindow.Window.Hide()
+			if err != nil {
+				mw.showError(err)
+			}
+		})
+	})
+}
+
+// importQueue adds the titles listed in a file to the queue, telling the user
+// up front which entries are invalid or missing from the title database.
+func (mw *MainWindow) importQueue(importPath string) {
+	imported, err := wiiudownloader.ImportTitleIDsFromFile(importPath)
+	if err != nil {
+		mw.showError(err)
+		return
+	}
+
+	rejected := make([]string, 0, len(imported.Invalid)+len(imported.Unknown))
+	for _, value := range imported.Invalid {
+		rejected = append(rejected, fmt.Sprintf("%s (invalid title ID)", value))
+	}
+	for _, value := range imported.Unknown {
+		rejected = append(rejected, fmt.Sprintf("%s (not in the title database)", value))
+	}
+	if len(rejected) > 0 {
+		message := fmt.Sprintf("%d entries could not be imported:\n%s", len(rejected), strings.Join(rejected, "\n"))
+		if len(imported.Titles) == 0 {
+			mw.showError(errors.New(message))
+			return
+		}
+		if !mw.confirm(fmt.Sprintf("%s\n\nAdd the remaining %d titles to the queue?", message, len(imported.Titles))) {
+			return
+		}
+	}
+
+	for _, title := range imported.Titles {
+		if !mw.queuePane.IsTitleInQueue(title) {
+			mw.queuePane.AddTitle(title)
+		}
+	}
+	mw.updateTitlesInQueue()
+}
+
+// chooseFirmwareRegion asks for the region of the console, and for the list of
+// the titles of the system version to download, nil for the latest one.
+func (mw *MainWindow) chooseFirmwareRegion() (uint8, map[uint64]uint16, bool) {
+	regionDialog, err := gtk.DialogNew()
+	if err != nil {
+		return 0, nil, false
+	}
+	defer regionDialog.Destroy()
+	regionDialog.SetTitle("Download system firmware")
+	regionDialog.SetTransientFor(mw.window)
+	regionDialog.SetModal(true)
+	regionDialog.AddButton("Cancel", gtk.RESPONSE_CANCEL)
+	regionDialog.AddButton("Download", gtk.RESPONSE_OK)
+
+	contentArea, err := regionDialog.GetContentArea()
+	if err != nil {
+		return 0, nil, false
+	}
+	regionLabel, err := gtk.LabelNew("Select the region of the console. The latest version of every system title will be downloaded, unless a list of the titles of a system version is chosen.")
+	if err != nil {
+		return 0, nil, false
+	}
+	regionLabel.SetLineWrap(true)
+	contentArea.PackStart(regionLabel, false, false, 5)
+
+	regions := []uint8{wiiudownloader.MCP_REGION_EUROPE, wiiudownloader.MCP_REGION_USA, wiiudownloader.MCP_REGION_JAPAN}
+	regionCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return 0, nil, false
+	}
+	for _, region := range regions {
+		regionCombo.AppendText(wiiudownloader.GetFormattedRegion(region))
+	}
+	regionCombo.SetActive(0)
+	contentArea.PackStart(regionCombo, false, false, 5)
+
+	// The versions.txt of a firmware downloaded before downloads it again
+	var versions map[uint64]uint16
+	versionButton, err := gtk.ButtonNewWithLabel("System version: latest")
+	if err != nil {
+		return 0, nil, false
+	}
+	versionButton.SetTooltipText("Choose a list of the title IDs and versions of a system version, like the versions.txt of a firmware downloaded before, with a line like \"0005001010041000 v96\" per title.")
+	versionButton.Connect("clicked", func() {
+		versionsPath, err := dialog.File().Title("Select the titles of a system version").Filter("Text files", "txt").Load()
+		if err != nil {
+			return
+		}
+		if versions, err = wiiudownloader.ReadFirmwareVersions(versionsPath); err != nil {
+			mw.showError(err)
+			versionButton.SetLabel("System version: latest")
+			return
+		}
+		versionButton.SetLabel(fmt.Sprintf("System version: %s", filepath.Base(versionsPath)))
+	})
+	contentArea.PackStart(versionButton, false, false, 5)
+	regionDialog.ShowAll()
+
+	if regionDialog.Run() != gtk.RESPONSE_OK || regionCombo.GetActive() < 0 {
+		return 0, nil, false
+	}
+	return regions[regionCombo.GetActive()], versions, true
+}
+
+func (mw *MainWindow) onDownloadFirmwareMenuItemClicked() {
+	region, versions, ok := mw.chooseFirmwareRegion()
+	if !ok {
+		return
+	}
+	selectedPath, err := dialog.Directory().Title("Select a path to save the firmware to").Browse()
+	if err != nil {
+		return
+	}
+	mw.progressWindow, err = createProgressWindow(mw.window)
 	if err != nil {
-		log.Fatalln("Unable to get text:", err)
+		return
 	}
-	mw.lastSearchText = text
-	mw.filterTitles(text)
+	mw.progressWindow.Window.ShowAll()
+
+	goWithCrashReport(func() {
+		firmwarePath := filepath.Join(selectedPath, fmt.Sprintf("Firmware [%s]", wiiudownloader.GetFormattedRegion(region)))
+		options := make([]wiiudownloader.FirmwareOption, 0)
+		if versions != nil {
+			options = append(options, wiiudownloader.WithFirmwareVersions(versions))
+		}
+		err := wiiudownloader.DownloadFirmware(firmwarePath, region, mw.progressWindow, mw.client, options...)
+		glib.IdleAdd(func() {
+			mw.progressWindow.Window.Hide()
+			if err != nil {
+				mw.showError(err)
+			}
+		})
+	})
 }
 
-func (mw *MainWindow) filterTitles(filterText string) {
-	store, err := mw.treeView.GetModel()
+func (mw *MainWindow) chooseRemovableVolume(volumes []removableVolume) (removableVolume, bool) {
+	volumeDialog, err := gtk.DialogNew()
 	if err != nil {
-		log.Fatalln("Unable to get tree view model:", err)
+		return removableVolume{}, false
+	}
+	defer volumeDialog.Destroy()
+	volumeDialog.SetTitle("Download queue to SD card")
+	volumeDialog.SetTransientFor(mw.window)
+	volumeDialog.SetModal(true)
+	volumeDialog.AddButton("Cancel", gtk.RESPONSE_CANCEL)
+	volumeDialog.AddButton("Download", gtk.RESPONSE_OK)
+
+	contentArea, err := volumeDialog.GetContentArea()
+	if err != nil {
+		return removableVolume{}, false
+	}
+	volumeLabel, err := gtk.LabelNew("Select the SD card. The queue will be downloaded to its install folder, ready to be installed with a WUP installer.")
+	if err != nil {
+		return removableVolume{}, false
 	}
+	contentArea.PackStart(volumeLabel, false, false, 5)
 
-	storeRef := store.(*gtk.ListStore)
-	storeRef.Clear()
+	volumeCombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		return removableVolume{}, false
+	}
+	for _, volume := range volumes {
+		volumeCombo.AppendText(volume.String())
+	}
+	volumeCombo.SetActive(0)
+	contentArea.PackStart(volumeCombo, false, false, 5)
+	volumeDialog.ShowAll()
 
-	for _, entry := range mw.titles {
-		if strings.Contains(strings.ToLower(entry.Name), strings.ToLower(filterText)) ||
-			strings.Contains(strings.ToLower(fmt.Sprintf("%016x", entry.TitleID)), strings.ToLower(filterText)) {
-			if (mw.currentRegion & entry.Region) == 0 {
-				continue
-			}
-			iter := storeRef.Append()
-			if err := storeRef.Set(iter,
-				[]int{IN_QUEUE_COLUMN, KIND_COLUMN, TITLE_ID_COLUMN, REGION_COLUMN, NAME_COLUMN},
-				[]interface{}{mw.queuePane.IsTitleInQueue(entry), wiiudownloader.GetFormattedKind(entry.TitleID), fmt.Sprintf("%016x", entry.TitleID), wiiudownloader.GetFormattedRegion(entry.Region), entry.Name},
-			); err != nil {
-				log.Fatalln("Unable to set values:", err)
+	if volumeDialog.Run() != gtk.RESPONSE_OK || volumeCombo.GetActive() < 0 {
+		return removableVolume{}, false
+	}
+	return volumes[volumeCombo.GetActive()], true
+}
+
+// onDownloadToSDCardMenuItemClicked downloads the queue encrypted, the format
+// WUP installers expect, straight to the install folder of an SD card and
+// ejects the card once done.
+func (mw *MainWindow) onDownloadToSDCardMenuItemClicked() {
+	if mw.queuePane.IsQueueEmpty() {
+		mw.showInfo("Add some titles to the queue first.")
+		return
+	}
+	volumes, err := listRemovableVolumes()
+	if err != nil {
+		mw.showError(err)
+		return
+	}
+	if len(volumes) == 0 {
+		mw.showError(errors.New("no SD card was found, make sure it is inserted and mounted"))
+		return
+	}
+	volume, ok := mw.chooseRemovableVolume(volumes)
+	if !ok {
+		return
+	}
+	if !volume.isFAT32() && !mw.confirm(fmt.Sprintf("%s is formatted as %s, but the Wii U can only read FAT32 SD cards. Continue anyway?", volume.mountPoint, volume.filesystem)) {
+		return
+	}
+	if err := checkVolumeWritable(volume); err != nil {
+		mw.showError(err)
+		return
+	}
+
+	progressWindow, err := createProgressWindow(mw.window)
+	if err != nil {
+		return
+	}
+	mw.progressWindow = progressWindow
+	progressWindow.SetGameTitle("Checking free space...")
+	progressWindow.Window.ShowAll()
+
+	goWithCrashReport(func() {
+		var requiredSize uint64
+		for _, title := range mw.queuePane.GetTitleQueue() {
+			titleSize, err := wiiudownloader.FetchTitleSize(mw.client, title.TitleID)
+			if err != nil {
+				glib.IdleAdd(func() {
+					progressWindow.Window.Hide()
+					mw.showError(err)
+				})
+				return
 			}
+			requiredSize += titleSize
 		}
-	}
+		if requiredSize > volume.free {
+			glib.IdleAdd(func() {
+				progressWindow.Window.Hide()
+				mw.showError(fmt.Errorf("not enough free space on %s: %s are needed but only %s are free", volume.mountPoint, humanize.Bytes(requiredSize), humanize.Bytes(volume.free)))
+			})
+			return
+		}
+
+		if err := mw.onDownloadQueueClicked(downloadSettings{folder: filepath.Join(volume.mountPoint, sdInstallDir)}, progressWindow); err != nil {
+			glib.IdleAdd(func() {
+				mw.showError(err)
+			})
+			return
+		}
+		if progressWindow.Cancelled() {
+			return
+		}
+		err := ejectVolume(volume)
+		glib.IdleAdd(func() {
+			if err != nil {
+				mw.showError(err)
+				return
+			}
+			mw.showInfo(fmt.Sprintf("The queue was downloaded to %s, the SD card can be removed safely.", volume.mountPoint))
+		})
+		mw.runAfterQueueAction()
+	})
 }
 
-func (mw *MainWindow) onCategoryToggled(button *gtk.ToggleButton) {
-	category, err := button.GetLabel()
+// onVerifyTitleMenuItemClicked verifies a title folder, quick only checks the
+// presence and sizes of its contents.
+func (mw *MainWindow) onVerifyTitleMenuItemClicked(quick bool) {
+	selectedPath, err := dialog.Directory().Title("Select the title folder to verify").Browse()
 	if err != nil {
-		log.Fatalln("Unable to get label:", err)
+		return
 	}
-	mw.titles = wiiudownloader.GetTitleEntries(wiiudownloader.GetCategoryFromFormattedCategory(category))
-	mw.updateTitles(mw.titles)
-	mw.filterTitles(mw.lastSearchText)
-	for _, catButton := range mw.categoryButtons {
-		catButton.SetActive(false)
+	mw.progressWindow, err = createProgressWindow(mw.window)
+	if err != nil {
+		return
 	}
-	button.Activate()
+	mw.progressWindow.SetGameTitle("Verifying " + filepath.Base(selectedPath))
+	mw.progressWindow.Window.ShowAll()
+
+	goWithCrashReport(func() {
+		verify := wiiudownloader.VerifyTitle
+		if quick {
+			verify = wiiudownloader.QuickVerifyTitle
+		}
+		result, err := verify(selectedPath, mw.progressWindow)
+		glib.IdleAdd(func() {
+			mw.progressWindow.Window.Hide()
+			if err != nil {
+				mw.showError(err)
+				return
+			}
+			mw.showVerificationResult(result)
+			mw.offerRepairTitle(selectedPath, result)
+		})
+	})
 }
 
-func (mw *MainWindow) onDecryptContentsMenuItemClicked(selectedPath string) error {
-	err := wiiudownloader.DecryptContents(selectedPath, mw.progressWindow, false)
+// onRestoreMetadataMenuItemClicked writes the title.tmd, title.tik and
+// title.cert missing from a title folder the user picks.
+func (mw *MainWindow) onRestoreMetadataMenuItemClicked() {
+	selectedPath, err := dialog.Directory().Title("Select the title folder with the contents").Browse()
+	if err != nil {
+		return
+	}
+	client := mw.client
+	goWithCrashReport(func() {
+		restored, err := wiiudownloader.RestoreTitleMetadata(selectedPath, 0, -1, client)
+		glib.IdleAdd(func() {
+			if err != nil {
+				mw.showError(err)
+				return
+			}
+			mw.showInfo(formatRestoredMetadata(filepath.Base(selectedPath), restored))
+		})
+	})
+}
 
-	glib.IdleAdd(func() {
-		mw.progressWindow.Window.Hide()
+// offerRepairTitle asks to download again the contents that failed verification,
+// must be called from the main thread.
+func (mw *MainWindow) offerRepairTitle(titlePath string, result *wiiudownloader.TitleVerificationResult) {
+	failed := result.FailedContents()
+	if len(failed) == 0 || !mw.confirm(fmt.Sprintf("%d contents failed verification. Do you want to download them again?", len(failed))) {
+		return
+	}
+
+	var err error
+	mw.progressWindow, err = createProgressWindow(mw.window)
+	if err != nil {
+		return
+	}
+	mw.progressWindow.Window.ShowAll()
+
+	goWithCrashReport(func() {
+		repairedResult, err := wiiudownloader.RepairTitle(titlePath, result, mw.progressWindow, mw.client)
+		glib.IdleAdd(func() {
+			mw.progressWindow.Window.Hide()
+			if err != nil {
+				mw.showError(err)
+				return
+			}
+			if mw.progressWindow.Cancelled() {
+				return
+			}
+			mw.showVerificationResult(repairedResult)
+		})
 	})
-	return err
+}
+
+func (mw *MainWindow) showVerificationResult(result *wiiudownloader.TitleVerificationResult) {
+	resultDialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Fatalln("Unable to create dialog:", err)
+	}
+	defer resultDialog.Destroy()
+	resultDialog.SetTitle("Verification result")
+	resultDialog.SetTransientFor(mw.window)
+	resultDialog.SetModal(true)
+	resultDialog.SetDefaultSize(scaled(640), scaled(400))
+	resultDialog.AddButton("Close", gtk.RESPONSE_CLOSE)
+
+	textView, err := gtk.TextViewNew()
+	if err != nil {
+		log.Fatalln("Unable to create text view:", err)
+	}
+	textView.SetEditable(false)
+	textView.SetMonospace(true)
+	buffer, err := textView.GetBuffer()
+	if err != nil {
+		log.Fatalln("Unable to get text buffer:", err)
+	}
+	table := strings.Builder{}
+	writeVerificationTable(&table, result)
+	if result.Passed() {
+		table.WriteString("\nAll contents passed verification\n")
+	} else {
+		table.WriteString("\nSome contents failed verification\n")
+	}
+	buffer.SetText(table.String())
+
+	scrolledWindow, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		log.Fatalln("Unable to create scrolled window:", err)
+	}
+	scrolledWindow.Add(textView)
+	scrolledWindow.SetVExpand(true)
+
+	contentArea, err := resultDialog.GetContentArea()
+	if err != nil {
+		log.Fatalln("Unable to get dialog content area:", err)
+	}
+	contentArea.PackStart(scrolledWindow, true, true, 0)
+	resultDialog.ShowAll()
+	resultDialog.Run()
 }
 
 func (mw *MainWindow) onDecryptContentsClicked() {
 	mw.decryptContents = !mw.decryptContents
-	mw.deleteEncryptedContentsCheckbox.SetSensitive(mw.decryptContents)
+	mw.encryptedContentsPolicyComboBox.SetSensitive(mw.decryptContents)
 	config, err := loadConfig()
 	if err != nil {
 		return
@@ -590,24 +2150,22 @@ func (mw *MainWindow) onDecryptContentsClicked() {
 	}
 }
 
-func (mw *MainWindow) getDeleteEncryptedContents() bool {
-	if mw.deleteEncryptedContentsCheckbox.GetSensitive() {
-		return mw.deleteEncryptedContentsCheckbox.GetActive()
+// getEncryptedContentsPolicy returns what is done to the encrypted contents
+// once decrypted, they are kept when the contents aren't decrypted.
+func (mw *MainWindow) getEncryptedContentsPolicy() string {
+	if mw.encryptedContentsPolicyComboBox.GetSensitive() {
+		return mw.encryptedContentsPolicy
 	}
-	return false
+	return wiiudownloader.ENCRYPTED_CONTENTS_KEEP
 }
 
 func (mw *MainWindow) updateTitlesInQueue() {
-	store, err := mw.treeView.GetModel()
-	if err != nil {
-		log.Fatalln("Unable to get tree view model:", err)
-	}
-
-	storeRef := store.(*gtk.ListStore)
-
+	storeRef := mw.titleStore
 	iter, ok := storeRef.GetIterFirst()
 	if !ok {
-		log.Fatalln("Unable to get first iter:", err)
+		// Nothing is listed, like an empty Favorites category
+		mw.queuePane.Update(false)
+		return
 	}
 	for iter != nil {
 		tid, err := storeRef.GetValue(iter, TITLE_ID_COLUMN)
@@ -633,53 +2191,354 @@ func (mw *MainWindow) updateTitlesInQueue() {
 }
 
 func (mw *MainWindow) showError(err error) {
-	glib.IdleAdd(func() {
-		mw.progressWindow.Window.Hide()
-	})
-	errorDialog := gtk.MessageDialogNew(mw.window, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, err.Error())
+	if progressWindow := mw.progressWindow; progressWindow != nil {
+		glib.IdleAdd(func() {
+			progressWindow.Window.Hide()
+		})
+	}
+	errorDialog := gtk.MessageDialogNew(mw.window, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+	if hint := getErrorHint(err); hint != "" {
+		errorDialog.FormatSecondaryText("%s", hint)
+	}
 	errorDialog.Run()
 	errorDialog.Destroy()
 }
 
-func (mw *MainWindow) onDownloadQueueClicked(selectedPath string) error {
-	if mw.queuePane.IsQueueEmpty() {
-		return nil
+// getErrorHint returns what the user can do to recover from the known kinds of errors.
+func getErrorHint(err error) string {
+	switch {
+	case errors.Is(err, wiiudownloader.ErrDiskFull):
+		return "Free some space on the disk or choose another folder, then download again to resume where it stopped."
+	case errors.Is(err, wiiudownloader.ErrHashMismatch):
+		return "The data is corrupted. Use \"Verify title...\" from the Tools menu to download the damaged contents again."
+	case errors.Is(err, wiiudownloader.ErrTicketUnavailable):
+		return "The ticket of the title couldn't be obtained. Check your connection and try again later."
+	case errors.Is(err, wiiudownloader.ErrCDNStatus):
+		return "The CDN refused the download, the title may no longer be available. Try again later or refresh the title database."
+	case errors.Is(err, wiiudownloader.ErrTimeout):
+		return "The CDN stopped answering. Check your connection and download again to resume where it stopped, or raise the timeouts in the settings."
+	}
+	return ""
+}
+
+func (mw *MainWindow) confirm(message string) bool {
+	questionDialog := gtk.MessageDialogNew(mw.window, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_YES_NO, "%s", message)
+	defer questionDialog.Destroy()
+	return questionDialog.Run() == gtk.RESPONSE_YES
+}
+
+// askYesNo is the goroutine-safe variant of confirm, it blocks until the user answers.
+func (mw *MainWindow) askYesNo(message string) bool {
+	responseChan := make(chan bool, 1)
+	glib.IdleAdd(func() {
+		responseChan <- mw.confirm(message)
+	})
+	return <-responseChan
+}
+
+// sendWebhook notifies the configured webhook in the background, failures are
+// only logged as they must never stop the queue.
+func (mw *MainWindow) sendWebhook(event string, titleID uint64, err error) {
+	if mw.webhookURL == "" {
+		return
+	}
+	client, webhookURL := mw.client, mw.webhookURL
+	webhookEvent := wiiudownloader.NewWebhookEvent(event, titleID, err)
+	goWithCrashReport(func() {
+		if err := wiiudownloader.SendWebhook(client, webhookURL, webhookEvent); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// confirmAfterQueueAction counts down before the action runs, so a user still
+// at the computer can cancel it. It must be called from the main thread.
+func (mw *MainWindow) confirmAfterQueueAction(action string) bool {
+	countdownDialog := gtk.MessageDialogNew(mw.window, gtk.DIALOG_MODAL, gtk.MESSAGE_WARNING, gtk.BUTTONS_CANCEL, "%s", afterQueueActionNames[action])
+	defer countdownDialog.Destroy()
+	countdownDialog.AddButton("Now", gtk.RESPONSE_ACCEPT)
+	remaining := afterQueueCountdown
+	countdownDialog.FormatSecondaryText("The queue is done, this happens in %d seconds.", remaining)
+	countdown := glib.TimeoutAdd(1000, func() bool {
+		remaining--
+		if remaining <= 0 {
+			countdownDialog.Response(gtk.RESPONSE_ACCEPT)
+			return false
+		}
+		countdownDialog.FormatSecondaryText("The queue is done, this happens in %d seconds.", remaining)
+		return true
+	})
+	response := countdownDialog.Run()
+	if remaining > 0 {
+		glib.SourceRemove(countdown)
+	}
+	return response == gtk.RESPONSE_ACCEPT
+}
+
+// runAfterQueueAction exits or puts the machine to sleep once the queue is
+// done, when configured to.
+func (mw *MainWindow) runAfterQueueAction() {
+	action := mw.afterQueue
+	if action == AFTER_QUEUE_NOTHING {
+		return
 	}
+	glib.IdleAdd(func() {
+		if !mw.confirmAfterQueueAction(action) {
+			return
+		}
+		if action == AFTER_QUEUE_EXIT {
+			os.Exit(0)
+		}
+		if err := runPowerAction(action); err != nil {
+			mw.showError(err)
+		}
+	})
+}
 
-	var err error = nil
+// offerShortenTitlePath asks the user whether a title folder whose decrypted
+// contents would not fit the filesystem path limits should be renamed to its title ID.
+func (mw *MainWindow) offerShortenTitlePath(titlePath string, err error) (string, bool) {
+	var pathErr *wiiudownloader.PathTooLongError
+	if !errors.As(err, &pathErr) {
+		return "", false
+	}
+	if !mw.askYesNo(fmt.Sprintf("%s\n\nDo you want to shorten the title folder name to its title ID and try again?", pathErr.Error())) {
+		return "", false
+	}
+	shortPath, err := wiiudownloader.ShortenTitlePath(titlePath)
+	if err != nil {
+		log.Println(err)
+		return "", false
+	}
+	return shortPath, true
+}
 
-	queueStatusChan := make(chan bool, 1)
-	defer close(queueStatusChan)
-	errGroup := errgroup.Group{}
+func (mw *MainWindow) showInfo(message string) {
+	infoDialog := gtk.MessageDialogNew(mw.window, gtk.DIALOG_MODAL, gtk.MESSAGE_INFO, gtk.BUTTONS_OK, "%s", message)
+	infoDialog.Run()
+	infoDialog.Destroy()
+}
 
-	mw.queuePane.ForEachRemoving(func(title wiiudownloader.TitleEntry) {
-		errGroup.Go(func() error {
-			if mw.progressWindow.cancelled {
-				queueStatusChan <- true
-				return nil
+// Sources of the pauses of watchPauseConditions, each one is lifted on its own
+const (
+	PAUSE_SOURCE_BATTERY  = "battery"
+	PAUSE_SOURCE_SCHEDULE = "schedule"
+)
+
+// watchPauseConditions pauses the running downloads while the machine is on
+// battery below the configured threshold or outside of the scheduled hours, and
+// resumes them once neither applies anymore. The settings are read again on
+// every check, so changing them applies to the running downloads.
+func (mw *MainWindow) watchPauseConditions(progressWindow *ProgressWindow, stop chan struct{}) {
+	ticker := time.NewTicker(batteryPollInterval)
+	defer ticker.Stop()
+	for {
+		if config, err := loadConfig(); err == nil {
+			progressWindow.SetPaused(PAUSE_SOURCE_BATTERY, shouldPauseForBattery(config), "on battery")
+			progressWindow.SetPaused(PAUSE_SOURCE_SCHEDULE, shouldPauseForSchedule(config, time.Now()), fmt.Sprintf("waiting for %s", config.ScheduleStart))
+		}
+		select {
+		case <-stop:
+			progressWindow.SetPaused(PAUSE_SOURCE_BATTERY, false, "")
+			progressWindow.SetPaused(PAUSE_SOURCE_SCHEDULE, false, "")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Answers of the dialog shown when a title was already downloaded
+const (
+	EXISTING_DOWNLOAD_SKIP gtk.ResponseType = iota + 1
+	EXISTING_DOWNLOAD_VERIFY
+	EXISTING_DOWNLOAD_OVERWRITE
+)
+
+// askExistingDownloadAction is goroutine-safe, it blocks until the user answers.
+func (mw *MainWindow) askExistingDownloadAction(title wiiudownloader.TitleEntry, titlePath string) gtk.ResponseType {
+	responseChan := make(chan gtk.ResponseType, 1)
+	glib.IdleAdd(func() {
+		questionDialog := gtk.MessageDialogNew(mw.window, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_NONE, "%s is already downloaded", title.Name)
+		defer questionDialog.Destroy()
+		questionDialog.FormatSecondaryText("%s already holds a complete copy of this version. Skip it, verify the existing copy or delete it and download it again?", titlePath)
+		questionDialog.AddButton("Skip", EXISTING_DOWNLOAD_SKIP)
+		questionDialog.AddButton("Verify", EXISTING_DOWNLOAD_VERIFY)
+		questionDialog.AddButton("Overwrite", EXISTING_DOWNLOAD_OVERWRITE)
+		questionDialog.SetDefaultResponse(EXISTING_DOWNLOAD_SKIP)
+		responseChan <- questionDialog.Run()
+	})
+	return <-responseChan
+}
+
+// handleExistingDownload asks what to do with a title that is already in its
+// destination folder, and reports whether downloading it can be skipped.
+func (mw *MainWindow) handleExistingDownload(title wiiudownloader.TitleEntry, titlePath string, progress *titleProgress) (bool, error) {
+	switch mw.askExistingDownloadAction(title, titlePath) {
+	case EXISTING_DOWNLOAD_OVERWRITE:
+		return false, os.RemoveAll(titlePath)
+	case EXISTING_DOWNLOAD_VERIFY:
+		progress.SetGameTitle("Verifying " + title.Name)
+		result, err := wiiudownloader.VerifyTitle(titlePath, progress)
+		if err != nil {
+			return false, err
+		}
+		if !result.Passed() {
+			if _, err := wiiudownloader.RepairTitle(titlePath, result, progress, mw.client); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		return true, nil
+	}
+}
+
+// downloadQueuedTitle downloads a title of the queue, showing its progress in
+// progress. Titles already downloaded are handled as the user chooses.
+func (mw *MainWindow) downloadQueuedTitle(title wiiudownloader.TitleEntry, settings downloadSettings, progress *titleProgress, sharedLimiter *wiiudownloader.BandwidthLimiter) error {
+	queueItem := mw.queuePane.GetQueueItem(title.TitleID)
+	progress.SetBandwidthLimitFunc(func() int64 {
+		return mw.queuePane.GetBandwidthLimit(title.TitleID)
+	})
+	tidStr := fmt.Sprintf("%016x", title.TitleID)
+	titlePath := filepath.Join(settings.folder, wiiudownloader.PreviewTitleDir(mw.titleDirTemplate, title))
+	if queueItem != nil && queueItem.OutputPath != "" {
+		titlePath = queueItem.OutputPath
+	}
+	titleVersion := uint16(0)
+	versionKnown := false
+	if wiiudownloader.TitleDirTemplateUsesVersion(titlePath) {
+		version, err := wiiudownloader.FetchTitleVersion(mw.client, title.TitleID)
+		if err != nil {
+			return err
+		}
+		titleVersion, versionKnown = version, true
+		titlePath = wiiudownloader.ResolveTitleDirVersion(titlePath, version)
+	}
+	if _, err := os.Stat(filepath.Join(titlePath, "title.tmd")); err == nil {
+		if !versionKnown {
+			version, err := wiiudownloader.FetchTitleVersion(mw.client, title.TitleID)
+			if err != nil {
+				return err
 			}
-			tidStr := fmt.Sprintf("%016x", title.TitleID)
-			titlePath := filepath.Join(selectedPath, fmt.Sprintf("%s [%s] [%s]", normalizeFilename(title.Name), wiiudownloader.GetFormattedKind(title.TitleID), tidStr))
-			if err := wiiudownloader.DownloadTitle(tidStr, titlePath, mw.decryptContents, mw.progressWindow, mw.getDeleteEncryptedContents(), mw.client); err != nil && err != context.Canceled {
+			titleVersion = version
+		}
+		if wiiudownloader.IsTitleDownloaded(titlePath, title.TitleID, titleVersion) {
+			skip, err := mw.handleExistingDownload(title, titlePath, progress)
+			if err != nil {
 				return err
 			}
+			if skip {
+				return nil
+			}
+		}
+	}
+	downloadOptions := []wiiudownloader.DownloadTitleOption{
+		wiiudownloader.WithHTTPClient(mw.client),
+		wiiudownloader.WithVerifyAfterWrite(mw.verifyAfterWrite),
+		wiiudownloader.WithHighPerformanceWrites(mw.highPerformanceWrites),
+		wiiudownloader.WithIncrementalUpdates(mw.incrementalUpdates),
+		wiiudownloader.WithContinueOnContentFailure(mw.continueOnFailure),
+		wiiudownloader.WithSyncWrites(mw.syncWrites),
+		wiiudownloader.WithContentStore(mw.contentStorePath),
+		wiiudownloader.WithPostDownloadHook(mw.postDownloadHook),
+		wiiudownloader.WithCemuInstall(mw.cemuMLCPath),
+		wiiudownloader.WithSharedBandwidthLimiter(sharedLimiter),
+		mw.timeoutsOption,
+		mw.stallDetectionOption,
+		wiiudownloader.WithSegmentedDownloads(mw.segmentsPerContent),
+	}
+	// Titles that only keep their metadata are slimmed once downloaded
+	if queueItem == nil || !queueItem.MetadataOnly {
+		downloadOptions = append(downloadOptions, wiiudownloader.WithArchiveOutput(mw.archiveFormat))
+	}
+	if settings.decrypt {
+		downloadOptions = append(downloadOptions, wiiudownloader.WithEncryptedContentsPolicy(settings.encryptedContentsPolicy))
+		if settings.decryptedFolder != "" {
+			downloadOptions = append(downloadOptions, wiiudownloader.WithDecryptedOutputDirectory(settings.decryptedFolder))
+		}
+	}
+	mw.sendWebhook(wiiudownloader.WEBHOOK_EVENT_STARTED, title.TitleID, nil)
+	if err := wiiudownloader.DownloadTitleWithOptions(tidStr, titlePath, progress, downloadOptions...); err != nil && err != context.Canceled {
+		shortPath, ok := mw.offerShortenTitlePath(titlePath, err)
+		if !ok {
+			mw.sendWebhook(wiiudownloader.WEBHOOK_EVENT_FAILED, title.TitleID, err)
+			return err
+		}
+		if err := wiiudownloader.DecryptContentsWithPolicy(shortPath, settings.decryptedTitlePath(shortPath), progress, settings.encryptedContentsPolicy, wiiudownloader.WithStaleContentsRemoval(true)); err != nil {
+			mw.sendWebhook(wiiudownloader.WEBHOOK_EVENT_FAILED, title.TitleID, err)
+			return err
+		}
+		titlePath = shortPath
+	}
+	if !progress.Cancelled() {
+		mw.sendWebhook(wiiudownloader.WEBHOOK_EVENT_COMPLETED, title.TitleID, nil)
+		mw.recordDownloadStats(progress)
+	}
 
-			queueStatusChan <- true
-			return nil
-		})
-
-		if err = errGroup.Wait(); err != nil {
-			queueStatusChan <- false
+	if queueItem != nil && queueItem.MetadataOnly && !progress.Cancelled() {
+		if err := wiiudownloader.SlimTitle(titlePath); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if !<-queueStatusChan {
-			return
+// onDownloadQueueClicked downloads the queue, up to maxParallelTitles titles
+// at once sharing the bandwidth limit of the queue, each with its own row in
+// progressWindow. The window is read once on the main thread by the caller, as
+// the Tools menu may replace mw.progressWindow while the queue is running.
+func (mw *MainWindow) onDownloadQueueClicked(settings downloadSettings, progressWindow *ProgressWindow) error {
+	if mw.queuePane.IsQueueEmpty() {
+		return nil
+	}
+
+	stopPauseWatch := make(chan struct{})
+	defer close(stopPauseWatch)
+	goWithCrashReport(func() {
+		mw.watchPauseConditions(progressWindow, stopPauseWatch)
+	})
+
+	sharedLimiter := wiiudownloader.NewBandwidthLimiter(func() int64 {
+		return mw.bandwidthLimit
+	})
+	// Titles with some failed contents and updates that were never published
+	// don't stop the queue, they are listed once it is done
+	var partialErrors []error
+	var noUpdates []string
+	var skippedMutex sync.Mutex
+	err := mw.queuePane.ForEachRemoving(mw.maxParallelTitles, func(worker int, title wiiudownloader.TitleEntry) error {
+		if progressWindow.Cancelled() {
+			return nil
 		}
+		err := mw.downloadQueuedTitle(title, settings, progressWindow.titleRow(worker), sharedLimiter)
+		var partialErr *wiiudownloader.PartialDownloadError
+		switch {
+		case errors.As(err, &partialErr):
+			skippedMutex.Lock()
+			partialErrors = append(partialErrors, err)
+			skippedMutex.Unlock()
+			return nil
+		case errors.Is(err, wiiudownloader.ErrNoUpdateAvailable):
+			skippedMutex.Lock()
+			noUpdates = append(noUpdates, title.Name)
+			skippedMutex.Unlock()
+			return nil
+		}
+		return err
 	})
+	if err == nil {
+		err = errors.Join(partialErrors...)
+	}
+	if len(noUpdates) > 0 {
+		glib.IdleAdd(func() {
+			mw.showInfo(fmt.Sprintf("No update is available for these titles, they were skipped:\n\n%s", strings.Join(noUpdates, "\n")))
+		})
+	}
 
 	mw.queuePane.Clear()
 	glib.IdleAdd(func() {
-		mw.progressWindow.Window.Hide()
+		progressWindow.Window.Hide()
 	})
 	mw.updateTitlesInQueue()
 
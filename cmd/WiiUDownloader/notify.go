@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// showDesktopNotification shows a notification with the tools every OS ships with.
+func showDesktopNotification(title, body string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("notify-send", "--app-name=WiiUDownloader", title, body)
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", fmt.Sprintf("display notification %q with title %q", body, title))
+	case "windows":
+		quote := func(s string) string {
+			return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		}
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms; $notification = New-Object System.Windows.Forms.NotifyIcon; $notification.Icon = [System.Drawing.SystemIcons]::Information; $notification.Visible = $true; $notification.ShowBalloonTip(10000, %s, %s, 'Info'); Start-Sleep -Seconds 10; $notification.Dispose()`, quote(title), quote(body))
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to show a notification: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
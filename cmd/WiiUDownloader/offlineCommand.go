@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+// runOfflineCommand implements "WiiUDownloader offline <cert|verify|decrypt|package|pack> <dir>...",
+// which works on already downloaded title folders without any network access.
+// It returns the process exit code.
+func runOfflineCommand(args []string) int {
+	usage := wiiudownloader.Localize("usage: WiiUDownloader offline <cert|verify|decrypt|package|pack> [flags] <title folder>...")
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	action := args[0]
+	flagSet := flag.NewFlagSet("offline "+action, flag.ContinueOnError)
+	locale := flagSet.String("locale", "", "language of the output, defaults to the one of the environment")
+	keysPath := flagSet.String("keys", "", "keys.txt, otp.bin or folder of a console dump with the Wii U common key")
+	output := flagSet.String("output", "", "decrypt: folder to write the decrypted files to, a subfolder per title, instead of the title folder")
+	deleteEncrypted := flagSet.Bool("delete-encrypted", false, "decrypt: delete the encrypted contents once decrypted, same as --encrypted-contents delete")
+	encryptedContents := flagSet.String("encrypted-contents", "", "decrypt: what to do with the encrypted contents once decrypted: keep, delete, folder (move them to a subfolder) or zip")
+	format := flagSet.String("format", wiiudownloader.ARCHIVE_FORMAT_ZIP, "pack: format of the archive, zip or 7z")
+	removeFolder := flagSet.Bool("remove-folder", false, "pack: delete the title folder as it is packed")
+	quick := flagSet.Bool("quick", false, "verify: only check that the contents are there with the right size, without hashing them")
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return 2
+	}
+	wiiudownloader.SetLocale(*locale)
+	encryptedContentsPolicy, err := getEncryptedContentsPolicyFlag(*encryptedContents, *deleteEncrypted)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	switch action {
+	case "cert", "verify", "decrypt", "package", "pack":
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if flagSet.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if *keysPath != "" {
+		if err := wiiudownloader.LoadKeys(*keysPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	exitCode := 0
+	for _, path := range flagSet.Args() {
+		var err error
+		switch action {
+		case "cert":
+			err = regenerateCert(path)
+		case "verify":
+			verify := wiiudownloader.VerifyTitle
+			if *quick {
+				verify = wiiudownloader.QuickVerifyTitle
+			}
+			var result *wiiudownloader.TitleVerificationResult
+			if result, err = verify(path, nil); err == nil {
+				writeVerificationTable(os.Stdout, result)
+				if !result.Passed() {
+					exitCode = 1
+				}
+			}
+		case "decrypt":
+			decryptedPath := path
+			if *output != "" {
+				decryptedPath = filepath.Join(*output, filepath.Base(filepath.Clean(path)))
+			}
+			err = wiiudownloader.DecryptContentsWithPolicy(path, decryptedPath, newCLIProgressReporter(os.Stdout), encryptedContentsPolicy)
+		case "package":
+			err = wiiudownloader.PackageTitle(path)
+		case "pack":
+			var archivePath string
+			if archivePath, err = wiiudownloader.ArchiveTitleFolder(path, *format, *removeFolder); err == nil {
+				fmt.Fprintf(os.Stdout, "%s: %s\n", path, archivePath)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			exitCode = 1
+			continue
+		}
+		if action != "verify" && action != "pack" {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", path, wiiudownloader.Localize("done"))
+		}
+	}
+	return exitCode
+}
+
+// getEncryptedContentsPolicyFlag returns the policy of the --encrypted-contents
+// flag, --delete-encrypted being the older way to ask for deleting them.
+func getEncryptedContentsPolicyFlag(value string, deleteEncrypted bool) (string, error) {
+	if value == "" && deleteEncrypted {
+		return wiiudownloader.ENCRYPTED_CONTENTS_DELETE, nil
+	}
+	return wiiudownloader.ParseEncryptedContentsPolicy(value)
+}
+
+// regenerateCert writes the title.cert of a title folder again from the
+// certificates of its title.tmd, title.tik and the cache.
+func regenerateCert(path string) error {
+	tmdData, err := os.ReadFile(filepath.Join(path, "title.tmd"))
+	if err != nil {
+		return err
+	}
+	tmd, err := wiiudownloader.ParseTMD(tmdData)
+	if err != nil {
+		return err
+	}
+	return wiiudownloader.GenerateCert(tmd, filepath.Join(path, "title.cert"), nil, nil)
+}
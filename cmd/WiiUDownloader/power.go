@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// Actions that can be run once the whole queue was downloaded.
+const (
+	AFTER_QUEUE_NOTHING   = ""
+	AFTER_QUEUE_EXIT      = "exit"
+	AFTER_QUEUE_SUSPEND   = "suspend"
+	AFTER_QUEUE_HIBERNATE = "hibernate"
+	AFTER_QUEUE_SHUTDOWN  = "shutdown"
+)
+
+const afterQueueCountdown = 60 // seconds the user has to cancel the action
+
+var afterQueueActionNames = map[string]string{
+	AFTER_QUEUE_NOTHING:   "Do nothing",
+	AFTER_QUEUE_EXIT:      "Exit WiiUDownloader",
+	AFTER_QUEUE_SUSPEND:   "Suspend the computer",
+	AFTER_QUEUE_HIBERNATE: "Hibernate the computer",
+	AFTER_QUEUE_SHUTDOWN:  "Shut down the computer",
+}
+
+// powerCommand returns the command that suspends, hibernates or shuts down the
+// machine with the tools every OS ships with.
+func powerCommand(action string) (*exec.Cmd, error) {
+	switch runtime.GOOS {
+	case "linux":
+		switch action {
+		case AFTER_QUEUE_SUSPEND:
+			return exec.Command("systemctl", "suspend"), nil
+		case AFTER_QUEUE_HIBERNATE:
+			return exec.Command("systemctl", "hibernate"), nil
+		case AFTER_QUEUE_SHUTDOWN:
+			return exec.Command("systemctl", "poweroff"), nil
+		}
+	case "darwin":
+		switch action {
+		case AFTER_QUEUE_SUSPEND, AFTER_QUEUE_HIBERNATE:
+			// Whether sleeping hibernates is decided by the hibernatemode of pmset
+			return exec.Command("pmset", "sleepnow"), nil
+		case AFTER_QUEUE_SHUTDOWN:
+			return exec.Command("osascript", "-e", `tell application "System Events" to shut down`), nil
+		}
+	case "windows":
+		switch action {
+		case AFTER_QUEUE_SUSPEND:
+			return exec.Command("rundll32.exe", "powrprof.dll,SetSuspendState", "0,1,0"), nil
+		case AFTER_QUEUE_HIBERNATE:
+			return exec.Command("shutdown", "/h"), nil
+		case AFTER_QUEUE_SHUTDOWN:
+			return exec.Command("shutdown", "/s", "/t", "0"), nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not supported on %s", afterQueueActionNames[action], runtime.GOOS)
+}
+
+func runPowerAction(action string) error {
+	cmd, err := powerCommand(action)
+	if err != nil {
+		return err
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s", afterQueueActionNames[action], output)
+	}
+	return nil
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
 	"github.com/dustin/go-humanize"
+	"github.com/gotk3/gotk3/cairo"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 )
@@ -15,6 +19,20 @@ const (
 	SMOOTHING_FACTOR = 0.2
 )
 
+const (
+	progressWindowWidth = 420 // pixels at 100% scale
+	pieceMapHeight      = 10
+)
+
+// pieceColors are the colors of the pieces of the piece map, by state.
+var pieceColors = map[wiiudownloader.PieceState][3]float64{
+	wiiudownloader.PIECE_MISSING:     {0.82, 0.82, 0.82},
+	wiiudownloader.PIECE_DOWNLOADING: {0.62, 0.76, 0.95},
+	wiiudownloader.PIECE_DOWNLOADED:  {0.2, 0.45, 0.85},
+	wiiudownloader.PIECE_VERIFYING:   {0.95, 0.65, 0.1},
+	wiiudownloader.PIECE_COMPLETE:    {0.3, 0.7, 0.3},
+}
+
 type SpeedAverager struct {
 	speeds       []int64
 	averageSpeed int64
@@ -56,60 +74,108 @@ func (sa *SpeedAverager) GetAverageSpeed() float64 {
 	return SMOOTHING_FACTOR*float64(sa.speeds[len(sa.speeds)-1]) + (1-SMOOTHING_FACTOR)*float64(sa.averageSpeed)
 }
 
-type ProgressWindow struct {
-	Window          *gtk.Window
-	box             *gtk.Box
+// titleProgress shows the progress of a title in the progress window. The
+// window has one for the titles downloaded one after the other, and adds one
+// for every other title downloaded at the same time.
+type titleProgress struct {
+	window          *ProgressWindow
 	gameLabel       *gtk.Label
 	bar             *gtk.ProgressBar
-	cancelButton    *gtk.Button
-	cancelled       bool
+	bandwidthLimit  func() int64
 	totalToDownload int64
 	totalDownloaded int64
+	receivedBytes   int64            // downloaded since ResetTotals, what was resumed left out
 	progressPerFile map[string]int64 // map of filename to downloaded bytes
 	progressMutex   sync.Mutex
 	speedAverager   *SpeedAverager
 	startTime       time.Time
+	lastProgress    time.Time
+	phase           wiiudownloader.ProgressPhase
+	pieceArea       *gtk.DrawingArea
+	pieceMap        *wiiudownloader.PieceMap // of the content being downloaded, guarded by progressMutex
+}
+
+type ProgressWindow struct {
+	*titleProgress
+	Window       *gtk.Window
+	parent       *gtk.Window // shows the progress in the taskbar or dock
+	box          *gtk.Box
+	cancelButton *gtk.Button
+	bottomhBox   *gtk.Box
+	cancelled    bool
+	pauseReasons map[string]string // why the downloads are paused, by what paused them
+	pauseMutex   sync.Mutex
+	rows         []*titleProgress // the other titles downloaded at the same time
+	rowsMutex    sync.Mutex
 }
 
-func (pw *ProgressWindow) SetGameTitle(title string) {
+func (tp *titleProgress) SetGameTitle(title string) {
 	glib.IdleAdd(func() {
-		pw.gameLabel.SetText(title)
+		tp.gameLabel.SetText(title)
 	})
 	for gtk.EventsPending() {
 		gtk.MainIteration()
 	}
 }
 
-func (pw *ProgressWindow) UpdateDownloadProgress(downloaded int64, filename string) {
+func (tp *titleProgress) UpdateDownloadProgress(downloaded int64, filename string) {
+	tp.progressMutex.Lock()
+	tp.lastProgress = time.Now()
+	tp.receivedBytes += downloaded
+	tp.progressMutex.Unlock()
 	glib.IdleAdd(func() {
-		pw.cancelButton.SetSensitive(true)
-		pw.progressMutex.Lock()
-		pw.progressPerFile[filename] += downloaded
-		total := pw.totalDownloaded
-		for _, v := range pw.progressPerFile {
+		tp.window.cancelButton.SetSensitive(true)
+		tp.progressMutex.Lock()
+		tp.progressPerFile[filename] += downloaded
+		total := tp.totalDownloaded
+		for _, v := range tp.progressPerFile {
 			total += v
 		}
-		pw.progressMutex.Unlock()
-		pw.bar.SetFraction(float64(total) / float64(pw.totalToDownload))
-		pw.speedAverager.AddSpeed(calculateDownloadSpeed(total, pw.startTime, time.Now()))
-		pw.bar.SetText(fmt.Sprintf("Downloading... (%s/%s) (%s/s)", humanize.Bytes(uint64(total)), humanize.Bytes(uint64(pw.totalToDownload)), humanize.Bytes(uint64(int64(pw.speedAverager.GetAverageSpeed())))))
+		phase := tp.phase
+		tp.progressMutex.Unlock()
+		if phase == wiiudownloader.PROGRESS_PHASE_METADATA {
+			// The size of the title isn't known yet
+			tp.bar.Pulse()
+			return
+		}
+		tp.bar.SetFraction(float64(total) / float64(tp.totalToDownload))
+		if tp == tp.window.titleProgress {
+			showAppProgress(tp.window.parent, tp.bar.GetFraction())
+		}
+		tp.speedAverager.AddSpeed(calculateDownloadSpeed(total, tp.startTime, time.Now()))
+		tp.bar.SetText(fmt.Sprintf("Downloading... (%s/%s) (%s/s)", humanize.Bytes(uint64(total)), humanize.Bytes(uint64(tp.totalToDownload)), humanize.Bytes(uint64(int64(tp.speedAverager.GetAverageSpeed())))))
 	})
 	for gtk.EventsPending() {
 		gtk.MainIteration()
 	}
 }
 
-func (pw *ProgressWindow) UpdateDecryptionProgress(progress float64) {
+func (tp *titleProgress) UpdateDecryptionProgress(progress float64) {
 	glib.IdleAdd(func() {
-		pw.cancelButton.SetSensitive(false)
-		pw.bar.SetFraction(progress)
-		pw.bar.SetText(fmt.Sprintf("Decrypting (%.2f%%)", progress*100))
+		tp.window.cancelButton.SetSensitive(false)
+		tp.bar.SetFraction(progress)
+		if tp == tp.window.titleProgress {
+			showAppProgress(tp.window.parent, progress)
+		}
+		tp.bar.SetText(fmt.Sprintf("Decrypting (%.2f%%)", progress*100))
 	})
 	for gtk.EventsPending() {
 		gtk.MainIteration()
 	}
 }
 
+func (tp *titleProgress) Cancelled() bool {
+	return tp.window.Cancelled()
+}
+
+func (tp *titleProgress) SetCancelled() {
+	tp.window.SetCancelled()
+}
+
+func (tp *titleProgress) Paused() bool {
+	return tp.window.Paused()
+}
+
 func (pw *ProgressWindow) Cancelled() bool {
 	if pw == nil {
 		return false
@@ -127,49 +193,202 @@ func (pw *ProgressWindow) SetCancelled() {
 	}
 }
 
-func (pw *ProgressWindow) SetDownloadSize(size int64) {
-	pw.totalToDownload = size
+func (pw *ProgressWindow) Paused() bool {
+	if pw == nil {
+		return false
+	}
+	pw.pauseMutex.Lock()
+	defer pw.pauseMutex.Unlock()
+	return len(pw.pauseReasons) > 0
 }
 
-func (pw *ProgressWindow) ResetTotals() {
-	pw.progressPerFile = make(map[string]int64)
-	pw.totalDownloaded = 0
-	pw.totalToDownload = 0
+// SetPaused pauses the downloads for source, with the reason shown in the
+// progress bars, or lifts the pause of source. The downloads resume once no
+// source pauses them anymore.
+func (pw *ProgressWindow) SetPaused(source string, paused bool, reason string) {
+	if pw == nil {
+		return
+	}
+	pw.pauseMutex.Lock()
+	if pw.pauseReasons == nil {
+		pw.pauseReasons = make(map[string]string)
+	}
+	known, wasPaused := pw.pauseReasons[source]
+	if !paused && !wasPaused || paused && wasPaused && known == reason {
+		pw.pauseMutex.Unlock()
+		return
+	}
+	if paused {
+		pw.pauseReasons[source] = reason
+	} else {
+		delete(pw.pauseReasons, source)
+	}
+	reasons := make([]string, 0, len(pw.pauseReasons))
+	for _, reason := range pw.pauseReasons {
+		reasons = append(reasons, reason)
+	}
+	pw.pauseMutex.Unlock()
+	slices.Sort(reasons)
+
+	glib.IdleAdd(func() {
+		for _, row := range pw.allRows() {
+			if len(reasons) > 0 {
+				row.bar.SetText(fmt.Sprintf("Paused (%s)", strings.Join(reasons, ", ")))
+			} else {
+				row.bar.SetText("Resuming...")
+			}
+		}
+	})
 }
 
-func (pw *ProgressWindow) MarkFileAsDone(filename string) {
-	pw.progressMutex.Lock()
-	pw.totalDownloaded += pw.progressPerFile[filename]
-	delete(pw.progressPerFile, filename)
-	pw.progressMutex.Unlock()
+func (tp *titleProgress) BandwidthLimit() int64 {
+	if tp.bandwidthLimit == nil {
+		return 0
+	}
+	return tp.bandwidthLimit()
 }
 
-func (pw *ProgressWindow) SetTotalDownloadedForFile(filename string, downloaded int64) {
-	pw.progressMutex.Lock()
-	pw.progressPerFile[filename] = downloaded
-	pw.progressMutex.Unlock()
+func (pw *ProgressWindow) BandwidthLimit() int64 {
+	if pw == nil {
+		return 0
+	}
+	return pw.titleProgress.BandwidthLimit()
 }
 
-func (pw *ProgressWindow) SetStartTime(startTime time.Time) {
-	pw.startTime = startTime
+func (tp *titleProgress) SetBandwidthLimitFunc(bandwidthLimit func() int64) {
+	tp.bandwidthLimit = bandwidthLimit
 }
 
-func createProgressWindow(parent *gtk.Window) (*ProgressWindow, error) {
-	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
-	if err != nil {
-		return nil, err
+func (tp *titleProgress) SetDownloadSize(size int64) {
+	tp.totalToDownload = size
+}
+
+func (tp *titleProgress) ResetTotals() {
+	tp.progressMutex.Lock()
+	tp.progressPerFile = make(map[string]int64)
+	tp.totalDownloaded = 0
+	tp.receivedBytes = 0
+	tp.progressMutex.Unlock()
+	tp.totalToDownload = 0
+}
+
+func (tp *titleProgress) MarkFileAsDone(filename string) {
+	tp.progressMutex.Lock()
+	tp.totalDownloaded += tp.progressPerFile[filename]
+	delete(tp.progressPerFile, filename)
+	tp.progressMutex.Unlock()
+}
+
+func (tp *titleProgress) SetTotalDownloadedForFile(filename string, downloaded int64) {
+	tp.progressMutex.Lock()
+	tp.progressPerFile[filename] = downloaded
+	tp.progressMutex.Unlock()
+}
+
+func (tp *titleProgress) SetStartTime(startTime time.Time) {
+	tp.startTime = startTime
+}
+
+func (tp *titleProgress) SetPhase(phase wiiudownloader.ProgressPhase) {
+	tp.progressMutex.Lock()
+	tp.phase = phase
+	tp.progressMutex.Unlock()
+	glib.IdleAdd(func() {
+		switch phase {
+		case wiiudownloader.PROGRESS_PHASE_METADATA:
+			tp.hidePieceMap()
+			tp.bar.SetFraction(0)
+			tp.bar.SetText("Fetching metadata...")
+		case wiiudownloader.PROGRESS_PHASE_DOWNLOADING:
+			tp.bar.SetText("Downloading contents...")
+		case wiiudownloader.PROGRESS_PHASE_DECRYPTING:
+			tp.hidePieceMap()
+			tp.bar.SetText("Decrypting...")
+		case wiiudownloader.PROGRESS_PHASE_ARCHIVING:
+			tp.hidePieceMap()
+			tp.bar.Pulse()
+			tp.bar.SetText("Packing into an archive...")
+		}
+	})
+	for gtk.EventsPending() {
+		gtk.MainIteration()
 	}
-	win.SetTitle("WiiUDownloader - Downloading")
+}
 
-	win.SetTransientFor(parent)
-	win.SetDeletable(false)
+// UpdatePieceMap shows the pieces of the content being downloaded. Of the
+// contents downloaded at the same time, the one shown is kept until it is
+// complete.
+func (tp *titleProgress) UpdatePieceMap(pieceMap wiiudownloader.PieceMap) {
+	tp.progressMutex.Lock()
+	if tp.pieceMap != nil && tp.pieceMap.Filename != pieceMap.Filename && !pieceMapComplete(tp.pieceMap) {
+		tp.progressMutex.Unlock()
+		return
+	}
+	tp.pieceMap = &pieceMap
+	tp.progressMutex.Unlock()
+	glib.IdleAdd(func() {
+		tp.pieceArea.SetTooltipText(pieceMap.Filename)
+		tp.pieceArea.SetVisible(true)
+		tp.pieceArea.QueueDraw()
+	})
+}
 
-	box, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 5)
-	if err != nil {
-		return nil, err
+func pieceMapComplete(pieceMap *wiiudownloader.PieceMap) bool {
+	for _, piece := range pieceMap.Pieces {
+		if piece != wiiudownloader.PIECE_COMPLETE {
+			return false
+		}
 	}
-	win.Add(box)
+	return true
+}
+
+// hidePieceMap hides the piece map once the contents are downloaded. It must
+// be called from the main thread.
+func (tp *titleProgress) hidePieceMap() {
+	tp.progressMutex.Lock()
+	tp.pieceMap = nil
+	tp.progressMutex.Unlock()
+	tp.pieceArea.SetVisible(false)
+}
+
+// drawPieceMap draws the pieces of the content as a strip of colored cells.
+func (tp *titleProgress) drawPieceMap(area *gtk.DrawingArea, cr *cairo.Context) bool {
+	tp.progressMutex.Lock()
+	pieceMap := tp.pieceMap
+	tp.progressMutex.Unlock()
+	if pieceMap == nil || len(pieceMap.Pieces) == 0 {
+		return false
+	}
+	width, height := float64(area.GetAllocatedWidth()), float64(area.GetAllocatedHeight())
+	pieceWidth := width / float64(len(pieceMap.Pieces))
+	// Neighbouring pieces in the same state are drawn at once
+	for start := 0; start < len(pieceMap.Pieces); {
+		end := start + 1
+		for end < len(pieceMap.Pieces) && pieceMap.Pieces[end] == pieceMap.Pieces[start] {
+			end++
+		}
+		color := pieceColors[pieceMap.Pieces[start]]
+		cr.SetSourceRGB(color[0], color[1], color[2])
+		cr.Rectangle(float64(start)*pieceWidth, 0, float64(end-start)*pieceWidth, height)
+		cr.Fill()
+		start = end
+	}
+	return true
+}
+
+// titleStats returns the bytes received for the last title downloaded and how
+// long downloading it took, decryption left out. What was already on the disk
+// when the download was resumed isn't counted.
+func (tp *titleProgress) titleStats() (int64, time.Duration) {
+	tp.progressMutex.Lock()
+	defer tp.progressMutex.Unlock()
+	if tp.lastProgress.Before(tp.startTime) {
+		return tp.receivedBytes, 0
+	}
+	return tp.receivedBytes, tp.lastProgress.Sub(tp.startTime)
+}
 
+func newTitleProgress(window *ProgressWindow, box *gtk.Box) (*titleProgress, error) {
 	gameLabel, err := gtk.LabelNew("")
 	if err != nil {
 		return nil, err
@@ -181,8 +400,128 @@ func createProgressWindow(parent *gtk.Window) (*ProgressWindow, error) {
 		return nil, err
 	}
 	progressBar.SetShowText(true)
+	// The label holds the name of the title, the bar is announced as its progress
+	labelWidget(gameLabel, progressBar)
 	box.PackStart(progressBar, false, false, 0)
 
+	// Shown once a content has a piece map, only segmented and hashed
+	// downloads have one
+	pieceArea, err := gtk.DrawingAreaNew()
+	if err != nil {
+		return nil, err
+	}
+	pieceArea.SetSizeRequest(-1, scaled(pieceMapHeight))
+	pieceArea.SetNoShowAll(true)
+	box.PackStart(pieceArea, false, false, 0)
+
+	tp := &titleProgress{
+		window:          window,
+		gameLabel:       gameLabel,
+		bar:             progressBar,
+		progressPerFile: make(map[string]int64),
+		speedAverager:   newSpeedAverager(),
+		pieceArea:       pieceArea,
+	}
+	pieceArea.Connect("draw", tp.drawPieceMap)
+	return tp, nil
+}
+
+// allRows returns the progress of every title shown in the window.
+func (pw *ProgressWindow) allRows() []*titleProgress {
+	pw.rowsMutex.Lock()
+	defer pw.rowsMutex.Unlock()
+	return append([]*titleProgress{pw.titleProgress}, pw.rows...)
+}
+
+// titleRow returns the progress of the title downloaded by the worker with
+// that number, worker 0 uses the progress of the window. It adds the rows of
+// the other workers as needed and must not be called from the main thread.
+func (pw *ProgressWindow) titleRow(worker int) *titleProgress {
+	if worker == 0 {
+		return pw.titleProgress
+	}
+	pw.rowsMutex.Lock()
+	defer pw.rowsMutex.Unlock()
+	for len(pw.rows) < worker {
+		added := make(chan *titleProgress)
+		glib.IdleAdd(func() {
+			row, err := newTitleProgress(pw, pw.box)
+			if err != nil {
+				row = pw.titleProgress
+			} else {
+				pw.box.ShowAll()
+			}
+			added <- row
+		})
+		pw.rows = append(pw.rows, <-added)
+	}
+	return pw.rows[worker-1]
+}
+
+// ShowCompleted turns the window into a summary of the finished download,
+// offering to open the folder the titles were saved to. It must be called from
+// the main thread.
+func (pw *ProgressWindow) ShowCompleted(outputPath string) {
+	pw.Window.SetTitle("WiiUDownloader - Done")
+	pw.Window.SetDeletable(true)
+	pw.gameLabel.SetText("Download complete")
+	pw.bar.SetFraction(1)
+	pw.bar.SetText(outputPath)
+	hideAppProgress(pw.parent)
+
+	closeButton, err := gtk.ButtonNewWithLabel("Close")
+	if err != nil {
+		return
+	}
+	closeButton.Connect("clicked", func() {
+		pw.Window.Destroy()
+	})
+	pw.bottomhBox.PackEnd(closeButton, false, false, 0)
+
+	openFolderButton, err := gtk.ButtonNewWithLabel("Open containing folder")
+	if err != nil {
+		return
+	}
+	openFolderButton.Connect("clicked", func() {
+		if err := openInFileManager(outputPath); err != nil {
+			errorDialog := gtk.MessageDialogNew(pw.Window, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+			errorDialog.Run()
+			errorDialog.Destroy()
+			return
+		}
+		pw.Window.Destroy()
+	})
+	pw.bottomhBox.PackEnd(openFolderButton, false, false, 0)
+	openFolderButton.GrabFocus()
+
+	pw.Window.ShowAll()
+	pw.cancelButton.Hide()
+	pw.hidePieceMap()
+	for _, row := range pw.rows {
+		row.gameLabel.Hide()
+		row.bar.Hide()
+		row.hidePieceMap()
+	}
+}
+
+func createProgressWindow(parent *gtk.Window) (*ProgressWindow, error) {
+	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	if err != nil {
+		return nil, err
+	}
+	win.SetTitle("WiiUDownloader - Downloading")
+
+	win.SetTransientFor(parent)
+	win.SetDeletable(false)
+	// Wide enough for the sizes and speed, so the window doesn't grow as they change
+	win.SetDefaultSize(scaled(progressWindowWidth), -1)
+
+	box, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 5)
+	if err != nil {
+		return nil, err
+	}
+	win.Add(box)
+
 	cancelButton, err := gtk.ButtonNewWithLabel("Cancel")
 	if err != nil {
 		return nil, err
@@ -200,14 +539,23 @@ func createProgressWindow(parent *gtk.Window) (*ProgressWindow, error) {
 	box.PackEnd(bottomhBox, false, false, 0)
 
 	progressWindow := ProgressWindow{
-		Window:        win,
-		box:           box,
-		gameLabel:     gameLabel,
-		bar:           progressBar,
-		cancelButton:  cancelButton,
-		cancelled:     false,
-		speedAverager: newSpeedAverager(),
+		Window:       win,
+		parent:       parent,
+		box:          box,
+		cancelButton: cancelButton,
+		bottomhBox:   bottomhBox,
+		cancelled:    false,
 	}
+	progressWindow.titleProgress, err = newTitleProgress(&progressWindow, box)
+	if err != nil {
+		return nil, err
+	}
+
+	// The progress of the first title is shown with the icon of the app until
+	// the window is hidden or destroyed, which hides it first
+	win.Connect("hide", func() {
+		hideAppProgress(parent)
+	})
 
 	progressWindow.cancelButton.Connect("clicked", func() {
 		progressWindow.cancelled = true
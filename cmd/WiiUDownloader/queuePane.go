@@ -1,21 +1,61 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
 	"strconv"
+	"sync"
 
 	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
+	"golang.org/x/sync/errgroup"
 )
 
+const (
+	QUEUE_NAME_COLUMN = iota
+	QUEUE_REGION_COLUMN
+	QUEUE_TITLE_ID_COLUMN
+	QUEUE_PRIORITY_COLUMN
+	QUEUE_BANDWIDTH_COLUMN
+)
+
+const (
+	maxQueueBandwidthMiB   = 100
+	maxQueueParallelTitles = 4 // more titles at once only share the same connection
+)
+
+type QueueItem struct {
+	Title          wiiudownloader.TitleEntry
+	Priority       int    // higher priorities are downloaded first
+	BandwidthLimit int64  // bytes per second, 0 means unlimited
+	MetadataOnly   bool   // only keep title.tmd/tik/cert once downloaded
+	OutputPath     string // chosen in the download dialog, empty means the folder from the template
+	downloading    bool
+}
+
 type QueuePane struct {
-	container     *gtk.Box
-	titleTreeView *gtk.TreeView
-	titleQueue    []wiiudownloader.TitleEntry
-	store         *gtk.ListStore
-	updateFunc    func()
+	container         *gtk.Box
+	titleTreeView     *gtk.TreeView
+	titleQueue        []*QueueItem
+	store             *gtk.ListStore
+	updateFunc        func()
+	priorityScale     *gtk.Scale
+	bandwidthScale    *gtk.Scale
+	metadataOnlyCheck *gtk.CheckButton
+	updatingScales    bool
+	queueMutex        sync.Mutex // the queue is changed by the titles downloaded at once
+}
+
+func formatBandwidthLimit(limit int64) string {
+	if limit <= 0 {
+		return "Unlimited"
+	}
+	return fmt.Sprintf("%d MiB/s", limit/(1024*1024))
 }
 
 func createColumn(renderer *gtk.CellRendererText, title string, id int) *gtk.TreeViewColumn {
@@ -30,7 +70,7 @@ func NewQueuePane() (*QueuePane, error) {
 	}
 	scrolledWindow.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
 
-	store, err := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	store, err := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_INT, glib.TYPE_STRING)
 	if err != nil {
 		return nil, err
 	}
@@ -44,6 +84,7 @@ func NewQueuePane() (*QueuePane, error) {
 		log.Fatalln("Unable to get selection:", err)
 	}
 	selection.SetMode(gtk.SELECTION_MULTIPLE)
+	setAccessibleName(titleTreeView, "Download queue")
 
 	titleTreeView.SetModel(store)
 
@@ -52,17 +93,20 @@ func NewQueuePane() (*QueuePane, error) {
 		return nil, err
 	}
 
-	nameColumn := createColumn(renderer, "Name", 0)
+	nameColumn := createColumn(renderer, "Name", QUEUE_NAME_COLUMN)
 	nameColumn.SetMaxWidth(200)
 	nameColumn.SetResizable(true)
 	titleTreeView.AppendColumn(nameColumn)
-	regionColumn := createColumn(renderer, "Region", 1)
+	regionColumn := createColumn(renderer, "Region", QUEUE_REGION_COLUMN)
 	regionColumn.SetMaxWidth(70)
 	titleTreeView.AppendColumn(regionColumn)
-	titleIDColumn := createColumn(renderer, "Title ID", 2)
+	titleIDColumn := createColumn(renderer, "Title ID", QUEUE_TITLE_ID_COLUMN)
 	titleIDColumn.SetMaxWidth(125)
 	titleTreeView.AppendColumn(titleIDColumn)
+	titleTreeView.AppendColumn(createColumn(renderer, "Priority", QUEUE_PRIORITY_COLUMN))
+	titleTreeView.AppendColumn(createColumn(renderer, "Bandwidth", QUEUE_BANDWIDTH_COLUMN))
 	titleTreeView.SetExpanderColumn(nameColumn)
+	titleTreeView.SetReorderable(true)
 
 	scrolledWindow.Add(titleTreeView)
 
@@ -72,71 +116,116 @@ func NewQueuePane() (*QueuePane, error) {
 	}
 	queueVBox.PackStart(scrolledWindow, true, true, 0)
 
-	queuePane := QueuePane{
-		container:     queueVBox,
-		titleTreeView: titleTreeView,
-		store:         store,
-		titleQueue:    make([]wiiudownloader.TitleEntry, 0),
+	priorityScale, err := gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, -5, 5, 1)
+	if err != nil {
+		return nil, err
 	}
+	priorityScale.SetRoundDigits(0)
+	bandwidthScale, err := gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, 0, maxQueueBandwidthMiB, 1)
+	if err != nil {
+		return nil, err
+	}
+	bandwidthScale.SetRoundDigits(0)
 
-	removeFromQueueButton, err := gtk.ButtonNewWithLabel("Remove from Queue")
+	overridesGrid, err := gtk.GridNew()
+	if err != nil {
+		return nil, err
+	}
+	priorityLabel, err := gtk.LabelNew("Priority")
 	if err != nil {
 		return nil, err
 	}
-	removeFromQueueButton.Connect("clicked", func() {
-		selection, err := titleTreeView.GetSelection()
-		if err != nil {
+	bandwidthLabel, err := gtk.LabelNew("Bandwidth (MiB/s, 0 = unlimited)")
+	if err != nil {
+		return nil, err
+	}
+	priorityScale.SetHExpand(true)
+	bandwidthScale.SetHExpand(true)
+	labelWidget(priorityLabel, priorityScale)
+	labelWidget(bandwidthLabel, bandwidthScale)
+	overridesGrid.Attach(priorityLabel, 0, 0, 1, 1)
+	overridesGrid.Attach(priorityScale, 1, 0, 1, 1)
+	overridesGrid.Attach(bandwidthLabel, 0, 1, 1, 1)
+	overridesGrid.Attach(bandwidthScale, 1, 1, 1, 1)
+	metadataOnlyCheck, err := gtk.CheckButtonNewWithLabel("Keep metadata only (TMD, ticket and cert)")
+	if err != nil {
+		return nil, err
+	}
+	overridesGrid.Attach(metadataOnlyCheck, 0, 2, 2, 1)
+	overridesGrid.SetSensitive(false)
+
+	queuePane := QueuePane{
+		container:         queueVBox,
+		titleTreeView:     titleTreeView,
+		store:             store,
+		titleQueue:        make([]*QueueItem, 0),
+		priorityScale:     priorityScale,
+		bandwidthScale:    bandwidthScale,
+		metadataOnlyCheck: metadataOnlyCheck,
+	}
+
+	selection.Connect("changed", func() {
+		selectedItems := queuePane.getSelectedItems()
+		overridesGrid.SetSensitive(len(selectedItems) > 0)
+		if len(selectedItems) == 0 {
 			return
 		}
-
-		store, err := titleTreeView.GetModel()
-		if err != nil {
+		queuePane.updatingScales = true
+		priorityScale.SetValue(float64(selectedItems[0].Priority))
+		bandwidthScale.SetValue(float64(selectedItems[0].BandwidthLimit / (1024 * 1024)))
+		metadataOnlyCheck.SetActive(selectedItems[0].MetadataOnly)
+		queuePane.updatingScales = false
+	})
+	priorityScale.Connect("value-changed", func() {
+		if queuePane.updatingScales {
 			return
 		}
-
-		storeRef := store.(*gtk.ListStore)
-		treeModel := storeRef.ToTreeModel()
-		if treeModel == nil {
+		selectedItems := queuePane.getSelectedItems()
+		queuePane.queueMutex.Lock()
+		for _, item := range selectedItems {
+			item.Priority = int(priorityScale.GetValue())
+		}
+		queuePane.queueMutex.Unlock()
+		queuePane.refreshOverrides()
+		queuePane.sortRows()
+	})
+	bandwidthScale.Connect("value-changed", func() {
+		if queuePane.updatingScales {
 			return
 		}
-
-		selectionSelected := selection.GetSelectedRows(treeModel)
-		if selectionSelected == nil || selectionSelected.Length() == 0 {
+		selectedItems := queuePane.getSelectedItems()
+		queuePane.queueMutex.Lock()
+		for _, item := range selectedItems {
+			item.BandwidthLimit = int64(bandwidthScale.GetValue()) * 1024 * 1024
+		}
+		queuePane.queueMutex.Unlock()
+		queuePane.refreshOverrides()
+	})
+	metadataOnlyCheck.Connect("toggled", func() {
+		if queuePane.updatingScales {
 			return
 		}
+		selectedItems := queuePane.getSelectedItems()
+		queuePane.queueMutex.Lock()
+		for _, item := range selectedItems {
+			item.MetadataOnly = metadataOnlyCheck.GetActive()
+		}
+		queuePane.queueMutex.Unlock()
+	})
+	titleTreeView.Connect("drag-end", queuePane.onRowDragged)
+	queueVBox.PackEnd(overridesGrid, false, false, 0)
 
-		defer func() {
-			if r := recover(); r != nil {
-				log.Fatalln("Error updating model:", r)
-			}
-		}()
-
-		iter, _ := treeModel.GetIterFirst()
-		for iter != nil {
-			isSelected := selection.IterIsSelected(iter)
-			if isSelected {
-				tid, err := treeModel.GetValue(iter, 2)
-				if err != nil {
-					continue
-				}
-				tidStr, err := tid.GetString()
-				if err != nil {
-					continue
-				}
-				tidParsed, err := strconv.ParseUint(tidStr, 16, 64)
-				if err != nil {
-					continue
-				}
-				queuePane.RemoveTitle(wiiudownloader.TitleEntry{TitleID: tidParsed})
-
-				tid.Unset()
-			}
-
-			if !storeRef.IterNext(iter) {
-				break
-			}
+	removeFromQueueButton, err := gtk.ButtonNewWithLabel("Remove from Queue")
+	if err != nil {
+		return nil, err
+	}
+	removeFromQueueButton.Connect("clicked", queuePane.RemoveSelected)
+	titleTreeView.Connect("key-press-event", func(treeView *gtk.TreeView, event *gdk.Event) bool {
+		if gdk.EventKeyNewFromEvent(event).KeyVal() != gdk.KEY_Delete {
+			return false
 		}
-		queuePane.Update(true)
+		queuePane.RemoveSelected()
+		return true
 	})
 	queueVBox.PackEnd(removeFromQueueButton, false, false, 0)
 
@@ -144,20 +233,38 @@ func NewQueuePane() (*QueuePane, error) {
 }
 
 func (qp *QueuePane) AddTitle(title wiiudownloader.TitleEntry) {
-	qp.titleQueue = append(qp.titleQueue, title)
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	qp.titleQueue = append(qp.titleQueue, &QueueItem{Title: title})
 }
 
 func (qp *QueuePane) RemoveTitle(title wiiudownloader.TitleEntry) {
-	for i, t := range qp.titleQueue {
-		if t.TitleID == title.TitleID {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	for i, item := range qp.titleQueue {
+		if item.Title.TitleID == title.TitleID {
 			qp.titleQueue = append(qp.titleQueue[:i], qp.titleQueue[i+1:]...)
 			break
 		}
 	}
 }
 
+// RemoveSelected removes the titles selected in the queue.
+func (qp *QueuePane) RemoveSelected() {
+	selectedItems := qp.getSelectedItems()
+	if len(selectedItems) == 0 {
+		return
+	}
+	for _, item := range selectedItems {
+		qp.RemoveTitle(item.Title)
+	}
+	qp.Update(true)
+}
+
 func (qp *QueuePane) Clear() {
-	qp.titleQueue = make([]wiiudownloader.TitleEntry, 0)
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	qp.titleQueue = make([]*QueueItem, 0)
 }
 
 func (qp *QueuePane) GetContainer() *gtk.Box {
@@ -165,38 +272,136 @@ func (qp *QueuePane) GetContainer() *gtk.Box {
 }
 
 func (qp *QueuePane) GetTitleQueue() []wiiudownloader.TitleEntry {
-	return qp.titleQueue
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	titles := make([]wiiudownloader.TitleEntry, 0, len(qp.titleQueue))
+	for _, item := range qp.titleQueue {
+		titles = append(titles, item.Title)
+	}
+	return titles
 }
 
 func (qp *QueuePane) IsQueueEmpty() bool {
-	return len(qp.titleQueue) == 0
+	return qp.GetTitleQueueSize() == 0
 }
 
 func (qp *QueuePane) GetTitleQueueSize() int {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
 	return len(qp.titleQueue)
 }
 
 func (qp *QueuePane) GetTitleQueueAtIndex(index int) wiiudownloader.TitleEntry {
-	return qp.titleQueue[index]
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	return qp.titleQueue[index].Title
 }
 
-func (qp *QueuePane) IsTitleInQueue(title wiiudownloader.TitleEntry) bool {
-	for _, t := range qp.titleQueue {
-		if t.TitleID == title.TitleID {
-			return true
+// queueItems returns the queued items in their order, the queue itself can
+// change while they are gone through.
+func (qp *QueuePane) queueItems() []*QueueItem {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	return slices.Clone(qp.titleQueue)
+}
+
+// findQueueItem returns the item of a queued title, queueMutex must be held.
+func (qp *QueuePane) findQueueItem(titleID uint64) *QueueItem {
+	for _, item := range qp.titleQueue {
+		if item.Title.TitleID == titleID {
+			return item
 		}
 	}
+	return nil
+}
+
+// queueItem returns the item of a queued title for the main thread, the only
+// one that changes its settings.
+func (qp *QueuePane) queueItem(titleID uint64) *QueueItem {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	return qp.findQueueItem(titleID)
+}
+
+// GetQueueItem returns a copy of the item of a queued title, nil when it isn't
+// queued. Its settings can be changed from the queue while it downloads.
+func (qp *QueuePane) GetQueueItem(titleID uint64) *QueueItem {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	item := qp.findQueueItem(titleID)
+	if item == nil {
+		return nil
+	}
+	itemCopy := *item
+	return &itemCopy
+}
+
+// SetOutputPath sets the folder a queued title is downloaded to.
+func (qp *QueuePane) SetOutputPath(titleID uint64, path string) {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	if item := qp.findQueueItem(titleID); item != nil {
+		item.OutputPath = path
+	}
+}
+
+func (qp *QueuePane) IsTitleInQueue(title wiiudownloader.TitleEntry) bool {
+	return qp.GetQueueItem(title.TitleID) != nil
+}
 
-	return false
+// GetBandwidthLimit returns the bandwidth limit of a queued title, it is read
+// on every write so changes made while the title downloads apply immediately.
+func (qp *QueuePane) GetBandwidthLimit(titleID uint64) int64 {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	if item := qp.findQueueItem(titleID); item != nil {
+		return item.BandwidthLimit
+	}
+	return 0
+}
+
+// takeNextQueueItem returns the queued item with the highest priority that
+// isn't being downloaded yet and marks it as downloading, the first queued one
+// wins ties.
+func (qp *QueuePane) takeNextQueueItem() *QueueItem {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	var next *QueueItem
+	for _, item := range qp.titleQueue {
+		if !item.downloading && (next == nil || item.Priority > next.Priority) {
+			next = item
+		}
+	}
+	if next != nil {
+		next.downloading = true
+	}
+	return next
 }
 
-func (qp *QueuePane) ForEachRemoving(f func(wiiudownloader.TitleEntry)) {
-	titleQueueCopy := make([]wiiudownloader.TitleEntry, len(qp.titleQueue))
-	copy(titleQueueCopy, qp.titleQueue)
-	for _, title := range titleQueueCopy {
-		f(title)
-		qp.RemoveTitle(title)
+// ForEachRemoving picks the next title by priority every time, so priorities
+// changed while the queue runs are taken into account. Up to parallel titles
+// are handled at once, f is given the number of the worker handling the title,
+// from 0 to parallel-1. Once f fails no other title is started.
+func (qp *QueuePane) ForEachRemoving(parallel int, f func(worker int, title wiiudownloader.TitleEntry) error) error {
+	errGroup, ctx := errgroup.WithContext(context.Background())
+	for worker := 0; worker < max(parallel, 1); worker++ {
+		worker := worker
+		errGroup.Go(func() error {
+			for ctx.Err() == nil {
+				next := qp.takeNextQueueItem()
+				if next == nil {
+					return nil
+				}
+				err := f(worker, next.Title)
+				qp.RemoveTitle(next.Title)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	}
+	return errGroup.Wait()
 }
 
 func (qp *QueuePane) GetTitleTreeView() *gtk.TreeView {
@@ -207,13 +412,197 @@ func (qp *QueuePane) SetTitleTreeView(titleTreeView *gtk.TreeView) {
 	qp.titleTreeView = titleTreeView
 }
 
+func (qp *QueuePane) getSelectedItems() []*QueueItem {
+	selectedItems := make([]*QueueItem, 0)
+	selection, err := qp.titleTreeView.GetSelection()
+	if err != nil {
+		return selectedItems
+	}
+	treeModel := qp.store.ToTreeModel()
+	iter, ok := treeModel.GetIterFirst()
+	for ok {
+		if selection.IterIsSelected(iter) {
+			if tid, err := treeModel.GetValue(iter, QUEUE_TITLE_ID_COLUMN); err == nil {
+				if tidStr, err := tid.GetString(); err == nil {
+					if tidParsed, err := strconv.ParseUint(tidStr, 16, 64); err == nil {
+						if item := qp.queueItem(tidParsed); item != nil {
+							selectedItems = append(selectedItems, item)
+						}
+					}
+				}
+				tid.Unset()
+			}
+		}
+		ok = treeModel.IterNext(iter)
+	}
+	return selectedItems
+}
+
+// refreshOverrides updates the priority and bandwidth columns in place, keeping the selection.
+func (qp *QueuePane) refreshOverrides() {
+	treeModel := qp.store.ToTreeModel()
+	iter, ok := treeModel.GetIterFirst()
+	for ok {
+		if tid, err := treeModel.GetValue(iter, QUEUE_TITLE_ID_COLUMN); err == nil {
+			if tidStr, err := tid.GetString(); err == nil {
+				if tidParsed, err := strconv.ParseUint(tidStr, 16, 64); err == nil {
+					if item := qp.queueItem(tidParsed); item != nil {
+						qp.store.Set(iter, []int{QUEUE_PRIORITY_COLUMN, QUEUE_BANDWIDTH_COLUMN}, []interface{}{item.Priority, formatBandwidthLimit(item.BandwidthLimit)})
+					}
+				}
+			}
+			tid.Unset()
+		}
+		ok = treeModel.IterNext(iter)
+	}
+}
+
+// sortByPriority puts the queue in the order it is downloaded in, the first
+// queued title wins ties.
+func (qp *QueuePane) sortByPriority() {
+	qp.queueMutex.Lock()
+	defer qp.queueMutex.Unlock()
+	sort.SliceStable(qp.titleQueue, func(i, j int) bool {
+		return qp.titleQueue[i].Priority > qp.titleQueue[j].Priority
+	})
+}
+
+func rowTitleID(treeModel *gtk.TreeModel, iter *gtk.TreeIter) (uint64, bool) {
+	tid, err := treeModel.GetValue(iter, QUEUE_TITLE_ID_COLUMN)
+	if err != nil {
+		return 0, false
+	}
+	defer tid.Unset()
+	tidStr, err := tid.GetString()
+	if err != nil {
+		return 0, false
+	}
+	tidParsed, err := strconv.ParseUint(tidStr, 16, 64)
+	return tidParsed, err == nil
+}
+
+// findRow returns the row of a queued title, nil when it isn't listed.
+func (qp *QueuePane) findRow(titleID uint64) *gtk.TreeIter {
+	treeModel := qp.store.ToTreeModel()
+	iter, ok := treeModel.GetIterFirst()
+	for ok {
+		if id, found := rowTitleID(treeModel, iter); found && id == titleID {
+			return iter
+		}
+		ok = treeModel.IterNext(iter)
+	}
+	return nil
+}
+
+// sortRows moves the rows to the order of the queue after a priority changed,
+// keeping the selection.
+func (qp *QueuePane) sortRows() {
+	qp.sortByPriority()
+	for _, item := range qp.queueItems() {
+		if iter := qp.findRow(item.Title.TitleID); iter != nil {
+			qp.store.MoveBefore(iter, nil)
+		}
+	}
+}
+
+// movedQueueItem returns the index in after of the only item that was moved
+// from its position in before, -1 when none was.
+func movedQueueItem(before, after []*QueueItem) int {
+	without := func(items []*QueueItem, removed *QueueItem) []*QueueItem {
+		remaining := make([]*QueueItem, 0, len(items))
+		for _, item := range items {
+			if item != removed {
+				remaining = append(remaining, item)
+			}
+		}
+		return remaining
+	}
+	sameOrder := func(a, b []*QueueItem) bool {
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return len(a) == len(b)
+	}
+	for i := range after {
+		if before[i] == after[i] {
+			continue
+		}
+		// Either after[i] was moved up or before[i] was moved down
+		if sameOrder(without(before, after[i]), without(after, after[i])) {
+			return i
+		}
+		for j := i + 1; j < len(after); j++ {
+			if after[j] == before[i] {
+				return j
+			}
+		}
+		return -1
+	}
+	return -1
+}
+
+// onRowDragged puts the queue in the order of the rows once one was dragged
+// to another place. The dragged title takes the priority of the title it was
+// dropped in front of, or behind when dropped last, so it is downloaded at the
+// place it was dropped.
+func (qp *QueuePane) onRowDragged() {
+	queue := qp.queueItems()
+	order := make([]*QueueItem, 0, len(queue))
+	treeModel := qp.store.ToTreeModel()
+	iter, ok := treeModel.GetIterFirst()
+	for ok {
+		if titleID, found := rowTitleID(treeModel, iter); found {
+			if item := qp.queueItem(titleID); item != nil {
+				order = append(order, item)
+			}
+		}
+		ok = treeModel.IterNext(iter)
+	}
+	if len(order) != len(queue) {
+		// The drop didn't complete, list the queue again
+		qp.Update(false)
+		return
+	}
+
+	dragged := movedQueueItem(queue, order)
+	if dragged < 0 {
+		return
+	}
+	qp.queueMutex.Lock()
+	if len(qp.titleQueue) != len(queue) {
+		// A title was done downloading meanwhile, list the queue again
+		qp.queueMutex.Unlock()
+		qp.Update(false)
+		return
+	}
+	if dragged+1 < len(order) {
+		order[dragged].Priority = order[dragged+1].Priority
+	} else if dragged > 0 {
+		order[dragged].Priority = order[dragged-1].Priority
+	}
+	qp.titleQueue = order
+	qp.queueMutex.Unlock()
+	qp.refreshOverrides()
+	if selectedItems := qp.getSelectedItems(); len(selectedItems) > 0 {
+		qp.updatingScales = true
+		qp.priorityScale.SetValue(float64(selectedItems[0].Priority))
+		qp.updatingScales = false
+	}
+}
+
 func (qp *QueuePane) Update(doUpdateFunc bool) {
+	qp.sortByPriority()
 	qp.store.Clear()
 
-	for _, title := range qp.titleQueue {
+	for _, item := range qp.queueItems() {
 		iter := qp.store.Append()
 
-		qp.store.Set(iter, []int{0, 1, 2}, []interface{}{title.Name, wiiudownloader.GetFormattedRegion(title.Region), fmt.Sprintf("%016x", title.TitleID)})
+		qp.store.Set(iter,
+			[]int{QUEUE_NAME_COLUMN, QUEUE_REGION_COLUMN, QUEUE_TITLE_ID_COLUMN, QUEUE_PRIORITY_COLUMN, QUEUE_BANDWIDTH_COLUMN},
+			[]interface{}{item.Title.Name, wiiudownloader.GetFormattedRegion(item.Title.Region), fmt.Sprintf("%016x", item.Title.TitleID), item.Priority, formatBandwidthLimit(item.BandwidthLimit)},
+		)
 	}
 
 	if qp.updateFunc != nil && doUpdateFunc {
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+// runRestoreCommand implements "WiiUDownloader restore [--tid <title ID>]
+// [--version <version>] <title folder>...", which writes the title.tmd,
+// title.tik and title.cert missing from title folders. It returns the process
+// exit code.
+func runRestoreCommand(args []string) int {
+	flagSet := flag.NewFlagSet("restore", flag.ContinueOnError)
+	tid := flagSet.String("tid", "", "title ID of the contents, found in the folder name by default")
+	version := flagSet.Int("version", -1, "version of the contents, found from their sizes and hashes by default")
+	locale := flagSet.String("locale", "", "language of the output, defaults to the one of the environment")
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	wiiudownloader.SetLocale(*locale)
+	if flagSet.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, wiiudownloader.Localize("usage: WiiUDownloader restore [--tid <title ID>] [--version <version>] <title folder>..."))
+		return 2
+	}
+	var titleID uint64
+	if *tid != "" {
+		var err error
+		if titleID, err = wiiudownloader.ParseTitleID(*tid); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := config.loadKeys(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	client := wiiudownloader.NewHTTPClient(config.getClientOptions())
+
+	exitCode := 0
+	for _, path := range flagSet.Args() {
+		restored, err := wiiudownloader.RestoreTitleMetadata(path, titleID, *version, client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			exitCode = 1
+			continue
+		}
+		fmt.Fprintln(os.Stdout, formatRestoredMetadata(path, restored))
+	}
+	return exitCode
+}
+
+// formatRestoredMetadata describes what RestoreTitleMetadata did to the title
+// folder at path.
+func formatRestoredMetadata(path string, restored *wiiudownloader.RestoredMetadata) string {
+	if len(restored.Restored) == 0 {
+		return fmt.Sprintf(wiiudownloader.Localize("%s: %016x v%d, nothing is missing"), path, restored.TitleID, restored.Version)
+	}
+	message := fmt.Sprintf(wiiudownloader.Localize("%s: %016x v%d, restored %s"), path, restored.TitleID, restored.Version, strings.Join(restored.Restored, ", "))
+	if restored.TicketGenerated {
+		message += " " + wiiudownloader.Localize("(the CDN has no ticket for it, one was generated)")
+	}
+	return message
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gotk3/gotk3/gdk"
+)
+
+// textScale returns how much larger than at 96 DPI the text of the GUI is
+// drawn, 1.5 at 150%. GTK scales everything by whole factors, 200% on its own,
+// while fractional scaling like 150% only makes the text larger: sizes given
+// in pixels have to grow with it to fit the text.
+func textScale() float64 {
+	screen, err := gdk.ScreenGetDefault()
+	if err != nil {
+		return 1
+	}
+	// -1 when no resolution was set, which is 96 DPI
+	resolution := screen.GetResolution()
+	if resolution <= 0 {
+		return 1
+	}
+	return math.Max(resolution/96, 1)
+}
+
+// scaled returns a size in pixels for 100% at the current text scale.
+func scaled(size int) int {
+	return int(math.Round(float64(size) * textScale()))
+}
+
+// unscaled returns a size in pixels at the current text scale for 100%, to
+// save sizes that stay right when the scale changes.
+func unscaled(size int) int {
+	return int(math.Round(float64(size) / textScale()))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// parseTimeOfDay parses a "HH:MM" time and returns it as minutes since midnight.
+func parseTimeOfDay(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// inScheduleWindow reports whether now is between start and end, in minutes
+// since midnight. Windows that end before they start span midnight, like 23:00
+// to 07:00.
+func inScheduleWindow(now time.Time, start, end int) bool {
+	minute := now.Hour()*60 + now.Minute()
+	if start == end {
+		return true
+	}
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func shouldPauseForSchedule(config *Config, now time.Time) bool {
+	if !config.ScheduleEnabled {
+		return false
+	}
+	start, err := parseTimeOfDay(config.ScheduleStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseTimeOfDay(config.ScheduleEnd)
+	if err != nil {
+		return false
+	}
+	return !inScheduleWindow(now, start, end)
+}
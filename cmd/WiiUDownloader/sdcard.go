@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// sdInstallDir is where WUP installers look for titles to install.
+const sdInstallDir = "install"
+
+type removableVolume struct {
+	device     string
+	mountPoint string
+	label      string
+	filesystem string
+	free       uint64
+	size       uint64
+}
+
+func (v removableVolume) String() string {
+	name := v.label
+	if name == "" {
+		name = v.mountPoint
+	}
+	return fmt.Sprintf("%s (%s, %s, %s free of %s)", name, v.mountPoint, v.filesystem, humanize.Bytes(v.free), humanize.Bytes(v.size))
+}
+
+// isFAT32 reports whether the Wii U can read the volume, it only supports FAT32 SD cards.
+func (v removableVolume) isFAT32() bool {
+	switch strings.ToLower(v.filesystem) {
+	case "vfat", "fat32", "msdos", "ms-dos fat32":
+		return true
+	}
+	return false
+}
+
+// lsblkValue reads a column of lsblk's JSON output, which depending on its
+// version are strings, numbers or booleans.
+func lsblkValue(device map[string]interface{}, column string) string {
+	switch value := device[column].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		if value {
+			return "1"
+		}
+		return "0"
+	}
+	return ""
+}
+
+func appendLsblkVolumes(volumes []removableVolume, devices []interface{}, removable bool) []removableVolume {
+	for _, rawDevice := range devices {
+		device, ok := rawDevice.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		deviceRemovable := removable || lsblkValue(device, "rm") == "1" || lsblkValue(device, "hotplug") == "1"
+		if mountPoint := lsblkValue(device, "mountpoint"); deviceRemovable && mountPoint != "" {
+			volume := removableVolume{
+				device:     lsblkValue(device, "name"),
+				mountPoint: mountPoint,
+				label:      lsblkValue(device, "label"),
+				filesystem: lsblkValue(device, "fstype"),
+			}
+			volume.free, _ = strconv.ParseUint(lsblkValue(device, "fsavail"), 10, 64)
+			volume.size, _ = strconv.ParseUint(lsblkValue(device, "size"), 10, 64)
+			volumes = append(volumes, volume)
+		}
+		if children, ok := device["children"].([]interface{}); ok {
+			volumes = appendLsblkVolumes(volumes, children, deviceRemovable)
+		}
+	}
+	return volumes
+}
+
+var diskutilBytesRegexp = regexp.MustCompile(`\((\d+) Bytes\)`)
+
+func parseDiskutilInfo(output string) map[string]string {
+	info := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if found {
+			info[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return info
+}
+
+func parseDiskutilBytes(value string) uint64 {
+	match := diskutilBytesRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0
+	}
+	bytes, _ := strconv.ParseUint(match[1], 10, 64)
+	return bytes
+}
+
+// listRemovableVolumes returns the mounted removable volumes, like SD cards and
+// USB drives, using the tools every OS ships with.
+func listRemovableVolumes() ([]removableVolume, error) {
+	volumes := make([]removableVolume, 0)
+	switch runtime.GOOS {
+	case "linux":
+		output, err := exec.Command("lsblk", "-J", "-b", "-p", "-o", "NAME,MOUNTPOINT,LABEL,FSTYPE,FSAVAIL,SIZE,RM,HOTPLUG").Output()
+		if err != nil {
+			return nil, err
+		}
+		lsblk := struct {
+			BlockDevices []interface{} `json:"blockdevices"`
+		}{}
+		if err := json.Unmarshal(output, &lsblk); err != nil {
+			return nil, err
+		}
+		volumes = appendLsblkVolumes(volumes, lsblk.BlockDevices, false)
+
+	case "darwin":
+		mountPoints, err := filepath.Glob("/Volumes/*")
+		if err != nil {
+			return nil, err
+		}
+		for _, mountPoint := range mountPoints {
+			output, err := exec.Command("diskutil", "info", mountPoint).Output()
+			if err != nil {
+				continue
+			}
+			info := parseDiskutilInfo(string(output))
+			if info["Removable Media"] != "Removable" && info["Device Location"] != "External" {
+				continue
+			}
+			volumes = append(volumes, removableVolume{
+				device:     info["Device Node"],
+				mountPoint: mountPoint,
+				label:      info["Volume Name"],
+				filesystem: info["File System Personality"],
+				free:       parseDiskutilBytes(info["Volume Free Space"]),
+				size:       parseDiskutilBytes(info["Disk Size"]),
+			})
+		}
+
+	case "windows":
+		output, err := exec.Command("WMIC", "LogicalDisk", "Where", "DriveType=2", "Get", "DeviceID,FileSystem,FreeSpace,Size,VolumeName", "/value").Output()
+		if err != nil {
+			return nil, err
+		}
+		volume := removableVolume{}
+		for _, line := range strings.Split(string(output), "\n") {
+			key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+			if !found {
+				continue
+			}
+			switch key {
+			case "DeviceID":
+				volume.device = value
+				volume.mountPoint = value + `\`
+			case "FileSystem":
+				volume.filesystem = value
+			case "FreeSpace":
+				volume.free, _ = strconv.ParseUint(value, 10, 64)
+			case "Size":
+				volume.size, _ = strconv.ParseUint(value, 10, 64)
+			case "VolumeName":
+				// VolumeName is the last value of every disk
+				volume.label = value
+				if volume.mountPoint != "" && volume.filesystem != "" {
+					volumes = append(volumes, volume)
+				}
+				volume = removableVolume{}
+			}
+		}
+	}
+	return volumes, nil
+}
+
+// ejectVolume flushes everything written to the volume and unmounts it, so the
+// card can be removed safely.
+func ejectVolume(volume removableVolume) error {
+	switch runtime.GOOS {
+	case "linux":
+		if err := exec.Command("sync").Run(); err != nil {
+			return err
+		}
+		if output, err := exec.Command("udisksctl", "unmount", "-b", volume.device).CombinedOutput(); err != nil {
+			return fmt.Errorf("unable to unmount %s: %s", volume.mountPoint, strings.TrimSpace(string(output)))
+		}
+	case "darwin":
+		if err := exec.Command("sync").Run(); err != nil {
+			return err
+		}
+		if output, err := exec.Command("diskutil", "eject", volume.mountPoint).CombinedOutput(); err != nil {
+			return fmt.Errorf("unable to eject %s: %s", volume.mountPoint, strings.TrimSpace(string(output)))
+		}
+	case "windows":
+		script := fmt.Sprintf(`(New-Object -ComObject Shell.Application).Namespace(17).ParseName('%s').InvokeVerb('Eject')`, volume.device)
+		if output, err := exec.Command("powershell", "-NoProfile", "-Command", script).CombinedOutput(); err != nil {
+			return fmt.Errorf("unable to eject %s: %s", volume.mountPoint, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+func checkVolumeWritable(volume removableVolume) error {
+	installPath := filepath.Join(volume.mountPoint, sdInstallDir)
+	if err := os.MkdirAll(installPath, 0755); err != nil {
+		return err
+	}
+	testFile, err := os.CreateTemp(installPath, ".wiiudownloader")
+	if err != nil {
+		return err
+	}
+	testFile.Close()
+	return os.Remove(testFile.Name())
+}
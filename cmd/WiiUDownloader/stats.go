@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	statsFilename    = "stats.json"
+	statsDateLayout  = "2006-01-02"
+	statsHistoryDays = 30
+)
+
+type dayStats struct {
+	Bytes   int64   `json:"bytes"`
+	Titles  int     `json:"titles"`
+	Seconds float64 `json:"seconds"` // time spent downloading
+}
+
+// downloadStatsMutex guards the statistics file, titles downloaded at the same
+// time finish from their own goroutines.
+var downloadStatsMutex sync.Mutex
+
+// downloadStats are the cumulative statistics of every title downloaded from
+// the GUI, with a history by day.
+type downloadStats struct {
+	TotalBytes   int64                `json:"totalBytes"`
+	TotalTitles  int                  `json:"totalTitles"`
+	TotalSeconds float64              `json:"totalSeconds"`
+	Days         map[string]*dayStats `json:"days"` // by date, YYYY-MM-DD
+}
+
+func getStatsPath() (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, statsFilename), nil
+}
+
+func loadDownloadStats() *downloadStats {
+	stats := &downloadStats{Days: make(map[string]*dayStats)}
+	path, err := getStatsPath()
+	if err != nil {
+		return stats
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return stats
+	}
+	if err := json.Unmarshal(data, stats); err != nil || stats.Days == nil {
+		return &downloadStats{Days: make(map[string]*dayStats)}
+	}
+	return stats
+}
+
+func (s *downloadStats) save() error {
+	path, err := getStatsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *downloadStats) addTitle(bytes int64, duration time.Duration, finishedAt time.Time) {
+	date := finishedAt.Format(statsDateLayout)
+	day, ok := s.Days[date]
+	if !ok {
+		day = &dayStats{}
+		s.Days[date] = day
+	}
+	day.Bytes += bytes
+	day.Titles++
+	day.Seconds += duration.Seconds()
+	s.TotalBytes += bytes
+	s.TotalTitles++
+	s.TotalSeconds += duration.Seconds()
+}
+
+// averageSpeed returns the average download speed in bytes per second.
+func averageSpeed(bytes int64, seconds float64) uint64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return uint64(float64(bytes) / seconds)
+}
+
+// recentDays returns the dates of the history, most recent first.
+func (s *downloadStats) recentDays(limit int) []string {
+	dates := make([]string, 0, len(s.Days))
+	for date := range s.Days {
+		dates = append(dates, date)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+	if len(dates) > limit {
+		dates = dates[:limit]
+	}
+	return dates
+}
+
+// recordDownloadStats adds the title a row of the progress window just
+// finished to the statistics.
+func (mw *MainWindow) recordDownloadStats(progress *titleProgress) {
+	bytes, duration := progress.titleStats()
+	downloadStatsMutex.Lock()
+	defer downloadStatsMutex.Unlock()
+	stats := loadDownloadStats()
+	stats.addTitle(bytes, duration, time.Now())
+	if err := stats.save(); err != nil {
+		log.Println(err)
+	}
+}
+
+func (mw *MainWindow) showDownloadStats() {
+	downloadStatsMutex.Lock()
+	stats := loadDownloadStats()
+	downloadStatsMutex.Unlock()
+
+	statsDialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Fatalln("Unable to create dialog:", err)
+	}
+	defer statsDialog.Destroy()
+	statsDialog.SetTitle("Download statistics")
+	statsDialog.SetTransientFor(mw.window)
+	statsDialog.SetModal(true)
+	statsDialog.SetDefaultSize(scaled(480), scaled(360))
+	statsDialog.AddButton("Close", gtk.RESPONSE_CLOSE)
+
+	contentArea, err := statsDialog.GetContentArea()
+	if err != nil {
+		log.Fatalln("Unable to get content area:", err)
+	}
+	summaryLabel, err := gtk.LabelNew(fmt.Sprintf("%d titles downloaded, %s in total, at %s/s on average.",
+		stats.TotalTitles, humanize.Bytes(uint64(stats.TotalBytes)), humanize.Bytes(averageSpeed(stats.TotalBytes, stats.TotalSeconds))))
+	if err != nil {
+		log.Fatalln("Unable to create label:", err)
+	}
+	contentArea.PackStart(summaryLabel, false, false, 5)
+
+	store, err := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_INT, glib.TYPE_STRING, glib.TYPE_STRING)
+	if err != nil {
+		log.Fatalln("Unable to create list store:", err)
+	}
+	for _, date := range stats.recentDays(statsHistoryDays) {
+		day := stats.Days[date]
+		if err := store.Set(store.Append(), []int{0, 1, 2, 3}, []interface{}{date, day.Titles, humanize.Bytes(uint64(day.Bytes)), humanize.Bytes(averageSpeed(day.Bytes, day.Seconds)) + "/s"}); err != nil {
+			log.Fatalln("Unable to set values:", err)
+		}
+	}
+	treeView, err := gtk.TreeViewNewWithModel(store)
+	if err != nil {
+		log.Fatalln("Unable to create tree view:", err)
+	}
+	renderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		log.Fatalln("Unable to create cell renderer:", err)
+	}
+	for i, title := range []string{"Day", "Titles", "Downloaded", "Average speed"} {
+		column, err := gtk.TreeViewColumnNewWithAttribute(title, renderer, "text", i)
+		if err != nil {
+			log.Fatalln("Unable to create tree view column:", err)
+		}
+		treeView.AppendColumn(column)
+	}
+	scrolledWindow, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		log.Fatalln("Unable to create scrolled window:", err)
+	}
+	scrolledWindow.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scrolledWindow.Add(treeView)
+	contentArea.PackStart(scrolledWindow, true, true, 5)
+
+	statsDialog.ShowAll()
+	statsDialog.Run()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// appVersion is the version of this build. The release workflows set it to the
+// tag being built with -ldflags "-X main.appVersion=v2.61", other builds take
+// the version of the module from the build info, see init.
+var appVersion string
+
+// DEVELOPMENT_VERSION is the version of the builds that are not releases,
+// they aren't checked for updates unless asked.
+const DEVELOPMENT_VERSION = "development"
+
+func init() {
+	if appVersion != "" {
+		return
+	}
+	appVersion = DEVELOPMENT_VERSION
+	// go install github.com/Xpl0itU/WiiUDownloader/cmd/WiiUDownloader@v2.61
+	// builds it as v2.61, local builds are (devel)
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		appVersion = info.Main.Version
+	}
+}
+
+const (
+	latestReleaseURL = "https://api.github.com/repos/Xpl0itU/WiiUDownloader/releases/latest"
+	releasesPageURL  = "https://github.com/Xpl0itU/WiiUDownloader/releases/latest"
+)
+
+type releaseAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// githubRelease is the part of a release of the GitHub API that is shown.
+type githubRelease struct {
+	TagName string         `json:"tag_name"`
+	Name    string         `json:"name"`
+	Body    string         `json:"body"` // the changelog, in Markdown
+	HTMLURL string         `json:"html_url"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+func fetchLatestRelease(client *http.Client) (*githubRelease, error) {
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub answered with status code %d", resp.StatusCode)
+	}
+	release := githubRelease{}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// compareVersions compares two versions like 2.60 or v2.60.1 number by number,
+// returning -1, 0 or 1 as a is older, the same or newer than b.
+func compareVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(strings.TrimSpace(a), "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(strings.TrimSpace(b), "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aNumber, bNumber int
+		if i < len(aParts) {
+			aNumber, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bNumber, _ = strconv.Atoi(bParts[i])
+		}
+		if aNumber != bNumber {
+			if aNumber < bNumber {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// downloadURL returns the link of the asset of the release for this OS, the
+// release page when it has none.
+func (release *githubRelease) downloadURL() string {
+	var suffix string
+	switch runtime.GOOS {
+	case "windows":
+		suffix = "-Windows.zip"
+	case "darwin":
+		suffix = ".dmg"
+	default:
+		suffix = ".AppImage"
+	}
+	for _, asset := range release.Assets {
+		if strings.HasSuffix(asset.Name, suffix) {
+			return asset.BrowserDownloadURL
+		}
+	}
+	if release.HTMLURL != "" {
+		return release.HTMLURL
+	}
+	return releasesPageURL
+}
+
+// openURL opens a link in the web browser.
+func openURL(url string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		return exec.Command("open", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
+
+// checkForUpdates asks GitHub for the latest release in the background and
+// offers to download it when it is newer. Unless the user asked for the check,
+// nothing is shown when there is none or it fails, nor for a skipped version,
+// and development builds aren't checked.
+func (mw *MainWindow) checkForUpdates(config *Config, userAsked bool) {
+	if appVersion == DEVELOPMENT_VERSION && !userAsked {
+		return
+	}
+	client := wiiudownloader.NewHTTPClient(config.getClientOptions())
+	goWithCrashReport(func() {
+		release, err := fetchLatestRelease(client)
+		glib.IdleAdd(func() {
+			switch {
+			case err != nil:
+				if userAsked {
+					mw.showError(fmt.Errorf("Unable to check for updates: %w", err))
+				}
+			case compareVersions(release.TagName, appVersion) <= 0:
+				if userAsked {
+					mw.showInfo(fmt.Sprintf("WiiUDownloader %s is the latest version.", appVersion))
+				}
+			case !userAsked && release.TagName == config.SkippedVersion:
+			default:
+				mw.showUpdateDialog(config, release)
+			}
+		})
+	})
+}
+
+// showUpdateDialog shows the changelog of a newer release and offers to
+// download it.
+func (mw *MainWindow) showUpdateDialog(config *Config, release *githubRelease) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		return
+	}
+	defer dialog.Destroy()
+	dialog.SetTitle("Update available")
+	dialog.SetTransientFor(mw.window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(scaled(500), scaled(400))
+
+	contentArea, err := dialog.GetContentArea()
+	if err != nil {
+		return
+	}
+	contentArea.SetSpacing(5)
+	contentArea.SetMarginStart(5)
+	contentArea.SetMarginEnd(5)
+	contentArea.SetMarginTop(5)
+
+	name := release.Name
+	if name == "" {
+		name = release.TagName
+	}
+	label, err := gtk.LabelNew(fmt.Sprintf("WiiUDownloader %s is available, you have %s. What's new:", name, appVersion))
+	if err != nil {
+		return
+	}
+	label.SetLineWrap(true)
+	label.SetXAlign(0)
+	contentArea.PackStart(label, false, false, 0)
+
+	changelogView, err := gtk.TextViewNew()
+	if err != nil {
+		return
+	}
+	changelogView.SetEditable(false)
+	changelogView.SetWrapMode(gtk.WRAP_WORD)
+	labelWidget(label, changelogView)
+	buffer, err := changelogView.GetBuffer()
+	if err != nil {
+		return
+	}
+	buffer.SetText(strings.TrimSpace(release.Body))
+	scrolledWindow, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return
+	}
+	scrolledWindow.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scrolledWindow.Add(changelogView)
+	contentArea.PackStart(scrolledWindow, true, true, 0)
+
+	dialog.AddButton("Skip this version", gtk.RESPONSE_REJECT)
+	dialog.AddButton("Later", gtk.RESPONSE_CANCEL)
+	dialog.AddButton("Download", gtk.RESPONSE_ACCEPT)
+	dialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+	dialog.ShowAll()
+
+	switch dialog.Run() {
+	case gtk.RESPONSE_ACCEPT:
+		if err := openURL(release.downloadURL()); err != nil {
+			mw.showError(err)
+		}
+	case gtk.RESPONSE_REJECT:
+		config.SkippedVersion = release.TagName
+		if err := config.Save(); err != nil {
+			mw.showError(err)
+		}
+	}
+}
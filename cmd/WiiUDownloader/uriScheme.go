@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"runtime"
+	"strings"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+// Websites link to a title with wiiudownloader://tid/0005000010145D00, which
+// opens WiiUDownloader, or the instance already running, with it selected.
+const (
+	titleURIScheme = "wiiudownloader"
+	titleURIHost   = "tid"
+)
+
+func isTitleURI(text string) bool {
+	return strings.HasPrefix(strings.ToLower(text), titleURIScheme+":")
+}
+
+// parseTitleURI returns the title ID of a wiiudownloader://tid/<title ID> link.
+func parseTitleURI(uri string) (uint64, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return 0, err
+	}
+	if !strings.EqualFold(parsed.Scheme, titleURIScheme) || !strings.EqualFold(parsed.Host, titleURIHost) {
+		return 0, fmt.Errorf("%s is not a link to a title, they look like %s://%s/<title ID>", uri, titleURIScheme, titleURIHost)
+	}
+	return wiiudownloader.ParseTitleID(strings.Trim(parsed.Path, "/"))
+}
+
+// registerURIScheme makes WiiUDownloader open the wiiudownloader:// links.
+// The AppImage and the app bundle declare it, Windows only knows of it once
+// it is in the registry. handle gets the links macOS sends to the running app
+// instead of starting it with them.
+func registerURIScheme(handle func(arguments []string)) {
+	switch runtime.GOOS {
+	case "windows":
+		if err := registerWindowsURIScheme(); err != nil {
+			log.Println(err)
+		}
+	case "darwin":
+		handleURLEvents(handle)
+	}
+}
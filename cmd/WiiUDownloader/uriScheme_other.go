@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+// registerWindowsURIScheme does nothing, the scheme is declared by the
+// AppImage and the app bundle.
+func registerWindowsURIScheme() error { return nil }
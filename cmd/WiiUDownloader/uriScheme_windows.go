@@ -0,0 +1,47 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// registerWindowsURIScheme points the scheme to this executable for the
+// current user, again if it was moved.
+func registerWindowsURIScheme() error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	keyPath := `Software\Classes\` + titleURIScheme
+	command := fmt.Sprintf(`"%s" "%%1"`, execPath)
+	if commandKey, err := registry.OpenKey(registry.CURRENT_USER, keyPath+`\shell\open\command`, registry.QUERY_VALUE); err == nil {
+		current, _, err := commandKey.GetStringValue("")
+		commandKey.Close()
+		if err == nil && current == command {
+			return nil
+		}
+	}
+
+	for _, value := range []struct {
+		path, name, data string
+	}{
+		{keyPath, "", "URL:WiiUDownloader"},
+		{keyPath, "URL Protocol", ""},
+		{keyPath + `\shell\open\command`, "", command},
+	} {
+		key, _, err := registry.CreateKey(registry.CURRENT_USER, value.path, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("unable to register the %s:// links: %w", titleURIScheme, err)
+		}
+		err = key.SetStringValue(value.name, value.data)
+		key.Close()
+		if err != nil {
+			return fmt.Errorf("unable to register the %s:// links: %w", titleURIScheme, err)
+		}
+	}
+	return nil
+}
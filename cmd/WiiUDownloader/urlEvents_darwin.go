@@ -0,0 +1,28 @@
+//go:build darwin
+
+package main
+
+/*
+void installURLEventHandler(void);
+*/
+import "C"
+
+import "github.com/gotk3/gotk3/glib"
+
+var urlEventHandler func(arguments []string)
+
+//export goHandleURLEvent
+func goHandleURLEvent(url *C.char) {
+	uri := C.GoString(url)
+	glib.IdleAdd(func() {
+		urlEventHandler([]string{uri})
+	})
+}
+
+// handleURLEvents passes the links macOS opens with WiiUDownloader to handle,
+// on the main thread. macOS sends them as events, to the app that is running
+// or the one it starts, and never as arguments.
+func handleURLEvents(handle func(arguments []string)) {
+	urlEventHandler = handle
+	C.installURLEventHandler()
+}
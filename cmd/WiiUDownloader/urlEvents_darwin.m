@@ -0,0 +1,21 @@
+#import <Cocoa/Cocoa.h>
+#include "_cgo_export.h"
+
+@interface WiiUDownloaderURLHandler : NSObject
+@end
+
+@implementation WiiUDownloaderURLHandler
+- (void)handleGetURLEvent:(NSAppleEventDescriptor *)event withReplyEvent:(NSAppleEventDescriptor *)replyEvent {
+	NSString *url = [[event paramDescriptorForKeyword:keyDirectObject] stringValue];
+	if (url != nil) {
+		goHandleURLEvent((char *)[url UTF8String]);
+	}
+}
+@end
+
+static WiiUDownloaderURLHandler *urlHandler = nil;
+
+void installURLEventHandler(void) {
+	urlHandler = [[WiiUDownloaderURLHandler alloc] init];
+	[[NSAppleEventManager sharedAppleEventManager] setEventHandler:urlHandler andSelector:@selector(handleGetURLEvent:withReplyEvent:) forEventClass:kInternetEventClass andEventID:kAEGetURL];
+}
@@ -2,48 +2,55 @@ package main
 
 import (
 	"log"
+	"os/exec"
+	"runtime"
 	"strings"
 
 	"github.com/gotk3/gotk3/gtk"
 )
 
-func normalizeFilename(filename string) string {
-	var out strings.Builder
-	shouldAppend := true
-	firstChar := true
-
-	for _, c := range filename {
-		switch {
-		case c == '_':
-			if shouldAppend {
-				out.WriteRune('_')
-				shouldAppend = false
-			}
-			firstChar = false
-		case c == ' ':
-			if shouldAppend && !firstChar {
-				out.WriteRune(' ')
-				shouldAppend = false
-			}
-		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'):
-			out.WriteRune(c)
-			shouldAppend = true
-			firstChar = false
-		}
-	}
-
-	result := out.String()
-	if len(result) > 0 && result[len(result)-1] == '_' {
-		result = result[:len(result)-1]
-	}
+const (
+	THEME_SYSTEM = "" // follows the dark mode setting of the OS
+	THEME_DARK   = "dark"
+	THEME_LIGHT  = "light"
+)
 
-	return result
+var themeNames = map[string]string{
+	THEME_SYSTEM: "Follow the system",
+	THEME_DARK:   "Dark",
+	THEME_LIGHT:  "Light",
 }
 
-func setDarkTheme(darkMode bool) {
+func setTheme(theme string) {
 	gSettings, err := gtk.SettingsGetDefault()
 	if err != nil {
 		log.Println(err.Error())
+		return
 	}
+	darkMode := theme == THEME_DARK || (theme == THEME_SYSTEM && isDarkMode())
 	gSettings.SetProperty("gtk-application-prefer-dark-theme", darkMode)
+
+	// A dark GTK theme, like Adwaita-dark, has no light variant to prefer
+	if theme == THEME_LIGHT {
+		themeName, err := gSettings.GetProperty("gtk-theme-name")
+		if err != nil {
+			return
+		}
+		if name, ok := themeName.(string); ok && strings.HasSuffix(strings.ToLower(name), "-dark") {
+			gSettings.SetProperty("gtk-theme-name", name[:len(name)-len("-dark")])
+		}
+	}
+}
+
+// openInFileManager opens a folder in the file manager of the OS.
+func openInFileManager(path string) error {
+	switch runtime.GOOS {
+	case "windows":
+		// explorer exits with 1 even when it opened the folder
+		return exec.Command("explorer", path).Start()
+	case "darwin":
+		return exec.Command("open", path).Start()
+	default:
+		return exec.Command("xdg-open", path).Start()
+	}
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+var signatureStatusNames = map[string]string{
+	wiiudownloader.SIGNATURE_STATUS_VALID:     "valid",
+	wiiudownloader.SIGNATURE_STATUS_INVALID:   "INVALID",
+	wiiudownloader.SIGNATURE_STATUS_UNCHECKED: "not checked",
+}
+
+func writeSignatureStatus(w io.Writer, name string, status string, err error) {
+	if status == wiiudownloader.SIGNATURE_STATUS_VALID || err == nil {
+		fmt.Fprintf(w, "%s: %s\n", name, wiiudownloader.Localize(signatureStatusNames[status]))
+		return
+	}
+	fmt.Fprintf(w, "%s: %s (%v)\n", name, wiiudownloader.Localize(signatureStatusNames[status]), err)
+}
+
+func writeVerificationTable(w io.Writer, result *wiiudownloader.TitleVerificationResult) {
+	fmt.Fprintf(w, wiiudownloader.Localize("Title %016x v%d")+"\n", result.TitleID, result.Version)
+	writeSignatureStatus(w, wiiudownloader.Localize("TMD signature"), result.Signatures.TMD, result.Signatures.TMDErr)
+	writeSignatureStatus(w, wiiudownloader.Localize("Ticket signature"), result.Signatures.Ticket, result.Signatures.TicketErr)
+	if result.Slimmed {
+		fmt.Fprintln(w, wiiudownloader.Localize("Metadata only, no contents to verify"))
+		return
+	}
+	if result.Quick {
+		fmt.Fprintln(w, wiiudownloader.Localize("Quick verification, only the sizes of the contents were checked"))
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, wiiudownloader.Localize("CONTENT\tSIZE\tEXPECTED\tRESULT"))
+	for _, content := range result.Contents {
+		status := wiiudownloader.Localize("OK")
+		if content.Err != nil {
+			status = fmt.Sprintf(wiiudownloader.Localize("FAIL: %s"), content.Err)
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\t%s\n", content.ContentID, content.Size, content.ExpectedSize, status)
+	}
+	table.Flush()
+}
+
+// runVerifyCommand implements "WiiUDownloader verify [--repair] [--quick] <dir>...",
+// it returns the process exit code.
+func runVerifyCommand(args []string) int {
+	flagSet := flag.NewFlagSet("verify", flag.ContinueOnError)
+	repair := flagSet.Bool("repair", false, "download again the contents that fail verification")
+	quick := flagSet.Bool("quick", false, "only check that the contents are there with the right size, without hashing them")
+	locale := flagSet.String("locale", "", "language of the output, defaults to the one of the environment")
+	userAgent := flagSet.String("user-agent", "", "User-Agent sent with every request")
+	headers := make([]string, 0)
+	flagSet.Func("header", `extra "Name: value" header sent with every request, can be repeated`, func(header string) error {
+		headers = append(headers, header)
+		return nil
+	})
+	hostsFile := flagSet.String("hosts", "", "file in the hosts file format with addresses to use for hostnames like the CDN")
+	ipv4 := flagSet.Bool("ipv4", false, "only connect over IPv4")
+	ipv6 := flagSet.Bool("ipv6", false, "only connect over IPv6")
+	keysPath := flagSet.String("keys", "", "keys.txt, otp.bin or folder of a console dump with the Wii U common key")
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	wiiudownloader.SetLocale(*locale)
+	if flagSet.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, wiiudownloader.Localize("usage: WiiUDownloader verify [--repair] [--quick] <title folder>..."))
+		return 2
+	}
+
+	if *keysPath != "" {
+		if err := wiiudownloader.LoadKeys(*keysPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	extraHeaders, err := wiiudownloader.ParseHeaders(headers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	clientOptions := wiiudownloader.ClientOptions{UserAgent: *userAgent, ExtraHeaders: extraHeaders}
+	if *hostsFile != "" {
+		data, err := os.ReadFile(*hostsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		clientOptions.HostOverrides, err = wiiudownloader.ParseHostOverrides(strings.Split(string(data), "\n"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	switch {
+	case *ipv4 && *ipv6:
+		fmt.Fprintln(os.Stderr, wiiudownloader.Localize("--ipv4 and --ipv6 can't be used together"))
+		return 2
+	case *ipv4:
+		clientOptions.IPVersion = wiiudownloader.IP_VERSION_4
+	case *ipv6:
+		clientOptions.IPVersion = wiiudownloader.IP_VERSION_6
+	}
+
+	var client *http.Client
+	exitCode := 0
+	for _, path := range flagSet.Args() {
+		verify := wiiudownloader.VerifyTitle
+		if *quick {
+			verify = wiiudownloader.QuickVerifyTitle
+		}
+		result, err := verify(path, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			exitCode = 1
+			continue
+		}
+		writeVerificationTable(os.Stdout, result)
+		if *repair && !result.Passed() {
+			if client == nil {
+				client = wiiudownloader.NewHTTPClient(clientOptions)
+			}
+			fmt.Fprintf(os.Stdout, wiiudownloader.Localize("Downloading %d corrupted contents again")+"\n", len(result.FailedContents()))
+			result, err = wiiudownloader.RepairTitle(path, result, newCLIProgressReporter(os.Stdout), client)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				exitCode = 1
+				continue
+			}
+			writeVerificationTable(os.Stdout, result)
+		}
+		if !result.Passed() {
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+const watchStateFilename = "watch.json"
+
+func getWatchStatePath() (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, watchStateFilename), nil
+}
+
+// loadWatchState returns the last seen version of every watched title.
+func loadWatchState(path string) map[uint64]uint16 {
+	known := make(map[uint64]uint16)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return known
+	}
+	saved := make(map[string]uint16)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return known
+	}
+	for tid, version := range saved {
+		if titleID, err := strconv.ParseUint(tid, 16, 64); err == nil {
+			known[titleID] = version
+		}
+	}
+	return known
+}
+
+func saveWatchState(path string, known map[uint64]uint16) error {
+	saved := make(map[string]uint16, len(known))
+	for titleID, version := range known {
+		saved[fmt.Sprintf("%016x", titleID)] = version
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// runWatchCommand implements "WiiUDownloader watch [<title ID>...]", which checks
+// the watched titles for new versions every interval until it is stopped.
+func runWatchCommand(args []string) int {
+	flagSet := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := flagSet.Duration("interval", 6*time.Hour, "time between checks")
+	once := flagSet.Bool("once", false, "check once and exit, for running from cron or a scheduled task")
+	tidFile := flagSet.String("tid-file", "", "text, JSON or CSV file with the title IDs to watch")
+	desktop := flagSet.Bool("notify", true, "show a desktop notification for new versions")
+	webhook := flagSet.String("webhook", "", "URL a JSON description of every new version is posted to")
+	downloadDirectory := flagSet.String("download", "", "download new versions to this folder")
+	decrypt := flagSet.Bool("decrypt", false, "decrypt the downloaded versions")
+	locale := flagSet.String("locale", "", "language of the output, defaults to the one of the environment")
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	wiiudownloader.SetLocale(*locale)
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	wiiudownloader.SetBufferMemoryBudget(int64(config.BufferMemoryMiB) * 1024 * 1024)
+	if err := config.loadKeys(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	titleIDs := make([]uint64, 0)
+	values := append(flagSet.Args(), config.WatchedTitles...)
+	if *tidFile != "" {
+		imported, err := wiiudownloader.ImportTitleIDsFromFile(*tidFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		for _, title := range imported.Titles {
+			titleIDs = append(titleIDs, title.TitleID)
+		}
+	}
+	for _, value := range values {
+		titleID, err := wiiudownloader.ParseTitleID(value)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		titleIDs = append(titleIDs, titleID)
+	}
+	if len(titleIDs) == 0 {
+		fmt.Fprintln(os.Stderr, wiiudownloader.Localize("usage: WiiUDownloader watch [--once] [--webhook <url>] [--download <folder>] <title ID>..."))
+		return 2
+	}
+
+	statePath, err := getWatchStatePath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	known := loadWatchState(statePath)
+	client := wiiudownloader.NewHTTPClient(config.getClientOptions())
+
+	for {
+		changes, err := wiiudownloader.CheckTitleVersions(client, titleIDs, known)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if err := saveWatchState(statePath, known); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, change := range changes {
+			reportTitleVersionChange(client, change, *desktop, *webhook)
+			if *downloadDirectory != "" {
+				downloadTitleVersionChange(client, config, change, *downloadDirectory, *decrypt)
+			}
+		}
+		if *once {
+			return 0
+		}
+		time.Sleep(*interval)
+	}
+}
+
+func reportTitleVersionChange(client *http.Client, change wiiudownloader.TitleVersionChange, desktop bool, webhook string) {
+	event := wiiudownloader.NewTitleUpdateWebhookEvent(change)
+	message := event.Message()
+	fmt.Fprintln(os.Stdout, message)
+	if desktop {
+		if err := showDesktopNotification("WiiUDownloader", message); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if webhook != "" {
+		if err := wiiudownloader.SendWebhook(client, webhook, event); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+func downloadTitleVersionChange(client *http.Client, config *Config, change wiiudownloader.TitleVersionChange, outputDirectory string, decrypt bool) {
+	options := []wiiudownloader.DownloadTitleOption{
+		wiiudownloader.WithHTTPClient(client),
+		wiiudownloader.WithTitleDirTemplate(config.TitleDirTemplate),
+		wiiudownloader.WithVerifyAfterWrite(config.VerifyAfterWrite),
+		wiiudownloader.WithIncrementalUpdates(config.IncrementalUpdates),
+		wiiudownloader.WithContinueOnContentFailure(config.ContinueOnFailure),
+		wiiudownloader.WithSyncWrites(config.SyncWrites),
+		wiiudownloader.WithContentStore(config.ContentStorePath),
+		wiiudownloader.WithPostDownloadHook(config.PostDownloadHook),
+		wiiudownloader.WithCemuInstall(config.CemuMLCPath),
+		wiiudownloader.WithArchiveOutput(config.ArchiveFormat),
+		config.getTimeoutsOption(),
+		config.getStallDetectionOption(),
+		wiiudownloader.WithSegmentedDownloads(config.SegmentsPerContent),
+	}
+	if decrypt {
+		options = append(options, wiiudownloader.WithEncryptedContentsPolicy(config.getEncryptedContentsPolicy()))
+	}
+	if err := wiiudownloader.DownloadTitleWithOptions(fmt.Sprintf("%016x", change.TitleID), outputDirectory, newCLIProgressReporter(os.Stdout), options...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/Xpl0itU/WiiUDownloader/server"
+)
+
+// runArchiveCommand implements "wiiudownloader-server archive <dir>", which
+// serves a read-only report of the titles downloaded below dir until the
+// process is stopped, or prints it as JSON with --json.
+func runArchiveCommand(args []string) int {
+	flagSet := flag.NewFlagSet("archive", flag.ContinueOnError)
+	listen := flagSet.String("listen", "127.0.0.1:8080", "address to listen on, use :8080 to accept connections from other machines")
+	token := flagSet.String("token", os.Getenv("WIIUDOWNLOADER_TOKEN"), "token clients must send as \"Authorization: Bearer <token>\" or ?token=, defaults to $WIIUDOWNLOADER_TOKEN")
+	printJSON := flagSet.Bool("json", false, "print the report as JSON and exit instead of serving it")
+	locale := flagSet.String("locale", "", "language of the messages, defaults to the one of the environment")
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	wiiudownloader.SetLocale(*locale)
+	if flagSet.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, wiiudownloader.Localize("usage: wiiudownloader-server archive [--listen <address>] [--token <token>] [--json] <folder>"))
+		return 2
+	}
+	root := flagSet.Arg(0)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, wiiudownloader.Localize("%s is not a folder")+"\n", root)
+		return 2
+	}
+
+	srv := server.NewArchiveServer(root, *token)
+	if *printJSON {
+		report, err := srv.Report()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, wiiudownloader.Localize("Listening on %s")+"\n", *listen)
+	if err := http.Serve(listener, srv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
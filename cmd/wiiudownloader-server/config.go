@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+// Config holds the settings of the configuration file of WiiUDownloader that
+// apply to the server. The file is shared with the GTK interface, which writes
+// it, the server only reads it.
+type Config struct {
+	TitleDirTemplate      string   `koanf:"titleDirTemplate"`
+	VerifyAfterWrite      bool     `koanf:"verifyAfterWrite"`
+	HighPerformanceWrites bool     `koanf:"highPerformanceWrites"`
+	IncrementalUpdates    bool     `koanf:"incrementalUpdates"`
+	ContinueOnFailure     bool     `koanf:"continueOnFailure"`
+	SyncWrites            bool     `koanf:"syncWrites"`
+	ContentStorePath      string   `koanf:"contentStorePath"`
+	PostDownloadHook      string   `koanf:"postDownloadHook"`
+	CemuMLCPath           string   `koanf:"cemuMLCPath"`
+	ArchiveFormat         string   `koanf:"archiveFormat"` // one of the wiiudownloader.ARCHIVE_FORMAT_* values
+	RequestTimeoutSeconds int      `koanf:"requestTimeoutSeconds"`
+	TitleTimeoutMinutes   int      `koanf:"titleTimeoutMinutes"`
+	StallTimeoutSeconds   int      `koanf:"stallTimeoutSeconds"`
+	SegmentsPerContent    int      `koanf:"segmentsPerContent"`
+	BufferMemoryMiB       int      `koanf:"bufferMemoryMiB"`
+	WebhookURL            string   `koanf:"webhookURL"` // notified when downloads start, complete or fail
+	UserAgent             string   `koanf:"userAgent"`
+	ExtraHeaders          []string `koanf:"extraHeaders"` // "Name: value"
+	IPVersion             string   `koanf:"ipVersion"`
+	HostOverrides         []string `koanf:"hostOverrides"` // hosts file lines, "address hostname"
+	KeysPath              string   `koanf:"keysPath"`      // keys.txt or console dump with the Wii U common key
+	TitleKeysPath         string   `koanf:"titleKeysPath"` // JSON or CSV file with the title keys of titles
+}
+
+const (
+	wiiudownloaderConfigDir = "WiiUDownloader"
+	configFilename          = "config.json"
+	portableCacheDir        = "cache"
+)
+
+// portableDirectory is the folder of the executable when a config.json is next
+// to it, as WiiUDownloader keeps it in portable mode. It is empty otherwise.
+var portableDirectory string
+
+// setupPortableMode reads the configuration file and keeps the caches next to
+// the executable when there is a config.json there. It must be called before
+// anything is loaded.
+func setupPortableMode() error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(execPath); err == nil {
+		execPath = resolved
+	}
+	directory := filepath.Dir(execPath)
+	if _, err := os.Stat(filepath.Join(directory, configFilename)); err != nil {
+		return nil
+	}
+	portableDirectory = directory
+	wiiudownloader.SetCacheDirectory(filepath.Join(directory, portableCacheDir))
+	return nil
+}
+
+// getConfigDir returns the folder of the configuration file.
+func getConfigDir() (string, error) {
+	if portableDirectory != "" {
+		return portableDirectory, nil
+	}
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userConfigDir, wiiudownloaderConfigDir), nil
+}
+
+// getDefaultConfig returns the defaults of the GTK interface, used for the
+// settings that aren't in the configuration file.
+func getDefaultConfig() *Config {
+	return &Config{
+		TitleDirTemplate:      wiiudownloader.DEFAULT_TITLE_DIR_TEMPLATE,
+		IncrementalUpdates:    true,
+		ArchiveFormat:         wiiudownloader.ARCHIVE_FORMAT_NONE,
+		RequestTimeoutSeconds: 60,
+		StallTimeoutSeconds:   20,
+		SegmentsPerContent:    1,
+		BufferMemoryMiB:       64,
+		ExtraHeaders:          []string{},
+		IPVersion:             wiiudownloader.IP_VERSION_AUTO,
+		HostOverrides:         []string{},
+	}
+}
+
+// loadConfig reads the configuration file, a missing one leaves the defaults.
+func loadConfig() (*Config, error) {
+	config := getDefaultConfig()
+	configDir, err := getConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	k := koanf.New(".")
+	if err := k.Load(file.Provider(filepath.Join(configDir, configFilename)), json.Parser()); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := k.Unmarshal("", config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// getTimeoutsOption returns the download option with the configured timeouts.
+func (c *Config) getTimeoutsOption() wiiudownloader.DownloadTitleOption {
+	return wiiudownloader.WithTimeouts(time.Duration(c.RequestTimeoutSeconds)*time.Second, time.Duration(c.TitleTimeoutMinutes)*time.Minute)
+}
+
+// getStallDetectionOption returns the download option that reconnects the
+// stalled transfers.
+func (c *Config) getStallDetectionOption() wiiudownloader.DownloadTitleOption {
+	return wiiudownloader.WithStallDetection(time.Duration(c.StallTimeoutSeconds) * time.Second)
+}
+
+func (c *Config) getClientOptions() wiiudownloader.ClientOptions {
+	extraHeaders, err := wiiudownloader.ParseHeaders(c.ExtraHeaders)
+	if err != nil {
+		log.Println(err)
+	}
+	hostOverrides, err := wiiudownloader.ParseHostOverrides(c.HostOverrides)
+	if err != nil {
+		log.Println(err)
+	}
+	return wiiudownloader.ClientOptions{
+		UserAgent:     c.UserAgent,
+		ExtraHeaders:  extraHeaders,
+		IPVersion:     c.IPVersion,
+		HostOverrides: hostOverrides,
+	}
+}
+
+// loadKeys makes the library use the common key of the keys file and the title
+// keys of the title keys file set in the settings, if any.
+func (c *Config) loadKeys() error {
+	if c.KeysPath != "" {
+		if err := wiiudownloader.LoadKeys(c.KeysPath); err != nil {
+			return err
+		}
+	}
+	if c.TitleKeysPath != "" {
+		imported, err := wiiudownloader.LoadTitleKeys(c.TitleKeysPath)
+		if err != nil {
+			return err
+		}
+		if len(imported.Invalid) > 0 {
+			log.Printf("%d entries of %s are not valid title keys and were left out", len(imported.Invalid), c.TitleKeysPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Command wiiudownloader-server runs WiiUDownloader on machines without a
+// desktop, like a NAS, and controls it over HTTP. It needs no GTK.
+//
+// "wiiudownloader-server serve" downloads titles through the JSON API of the
+// server package, see its documentation for the endpoints.
+// "wiiudownloader-server archive" serves a read-only report of the titles
+// downloaded to a folder.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+func main() {
+	if err := setupPortableMode(); err != nil {
+		log.Println(err)
+	}
+	// The title database refreshed by the GTK interface replaces the embedded one
+	if err := wiiudownloader.LoadCachedTitleDatabase(); err != nil {
+		log.Println(err)
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			os.Exit(runServeCommand(os.Args[2:]))
+		case "archive":
+			os.Exit(runArchiveCommand(os.Args[2:]))
+		}
+	}
+	fmt.Fprintln(os.Stderr, wiiudownloader.Localize("usage: wiiudownloader-server <serve|archive> [flags]"))
+	os.Exit(2)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/Xpl0itU/WiiUDownloader/server"
+)
+
+// runServeCommand implements "wiiudownloader-server serve --output <dir>",
+// which serves the JSON API of the server package, and its gRPC API with
+// --grpc, until the process is stopped. The network and download settings are the ones of the configuration
+// file of WiiUDownloader.
+func runServeCommand(args []string) int {
+	flagSet := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := flagSet.String("listen", "127.0.0.1:8080", "address to listen on, use :8080 to accept connections from other machines")
+	socket := flagSet.String("socket", "", "listen on this Unix socket instead, for other tools on the same machine")
+	grpcAddress := flagSet.String("grpc", "", "also serve the gRPC API on this address, unix:<path> for a Unix socket")
+	outputDirectory := flagSet.String("output", "", "folder the titles are downloaded to")
+	token := flagSet.String("token", os.Getenv("WIIUDOWNLOADER_TOKEN"), "token clients must send as \"Authorization: Bearer <token>\", defaults to $WIIUDOWNLOADER_TOKEN")
+	decrypt := flagSet.Bool("decrypt", false, "decrypt the contents after downloading them")
+	deleteEncrypted := flagSet.Bool("delete-encrypted", false, "delete the encrypted contents after decrypting them, same as --encrypted-contents delete")
+	encryptedContents := flagSet.String("encrypted-contents", "", "what to do with the encrypted contents after decrypting them: keep, delete, folder (move them to a subfolder) or zip")
+	decryptTo := flagSet.String("decrypt-to", "", "write the decrypted files to this folder instead of next to the encrypted contents")
+	locale := flagSet.String("locale", "", "language of the messages, defaults to the one of the environment")
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	wiiudownloader.SetLocale(*locale)
+	encryptedContentsPolicy, err := getEncryptedContentsPolicyFlag(*encryptedContents, *deleteEncrypted)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *outputDirectory == "" || flagSet.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, wiiudownloader.Localize("usage: wiiudownloader-server serve --output <folder> [--listen <address>] [--token <token>]"))
+		return 2
+	}
+	if err := os.MkdirAll(*outputDirectory, os.ModePerm); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	wiiudownloader.SetBufferMemoryBudget(int64(config.BufferMemoryMiB) * 1024 * 1024)
+	if err := config.loadKeys(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	downloadOptions := []wiiudownloader.DownloadTitleOption{
+		wiiudownloader.WithHTTPClient(wiiudownloader.NewHTTPClient(config.getClientOptions())),
+		wiiudownloader.WithTitleDirTemplate(config.TitleDirTemplate),
+		wiiudownloader.WithVerifyAfterWrite(config.VerifyAfterWrite),
+		wiiudownloader.WithHighPerformanceWrites(config.HighPerformanceWrites),
+		wiiudownloader.WithIncrementalUpdates(config.IncrementalUpdates),
+		wiiudownloader.WithContinueOnContentFailure(config.ContinueOnFailure),
+		wiiudownloader.WithSyncWrites(config.SyncWrites),
+		wiiudownloader.WithContentStore(config.ContentStorePath),
+		wiiudownloader.WithPostDownloadHook(config.PostDownloadHook),
+		wiiudownloader.WithCemuInstall(config.CemuMLCPath),
+		wiiudownloader.WithArchiveOutput(config.ArchiveFormat),
+		config.getTimeoutsOption(),
+		config.getStallDetectionOption(),
+		wiiudownloader.WithSegmentedDownloads(config.SegmentsPerContent),
+	}
+	if *decrypt {
+		downloadOptions = append(downloadOptions, wiiudownloader.WithEncryptedContentsPolicy(encryptedContentsPolicy))
+		if *decryptTo != "" {
+			downloadOptions = append(downloadOptions, wiiudownloader.WithDecryptedOutputDirectory(*decryptTo))
+		}
+	}
+
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, wiiudownloader.Localize("warning: no --token set, anyone who can reach the server can control it"))
+	}
+	address := *listen
+	if *socket != "" {
+		address = "unix:" + *socket
+	}
+	listener, err := listenOn(address)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, wiiudownloader.Localize("Listening on %s")+"\n", listener.Addr())
+	srv := server.New(*outputDirectory, *token, downloadOptions...)
+	if config.WebhookURL != "" {
+		srv.SetWebhook(wiiudownloader.NewHTTPClient(config.getClientOptions()), config.WebhookURL)
+	}
+	if *grpcAddress != "" {
+		grpcListener, err := listenOn(*grpcAddress)
+		if err != nil {
+			listener.Close()
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stdout, wiiudownloader.Localize("Serving the gRPC API on %s")+"\n", grpcListener.Addr())
+		go func() {
+			if err := srv.NewGRPCServer().Serve(grpcListener); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+	if err := http.Serve(listener, srv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// listenOn listens on a TCP address, or on the Unix socket of an address starting
+// with "unix:", which only the user running the server can open.
+func listenOn(address string) (net.Listener, error) {
+	path, isSocket := strings.CutPrefix(address, "unix:")
+	if !isSocket {
+		return net.Listen("tcp", address)
+	}
+	// A socket left behind by a previous run would make Listen fail
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is created with the umask, other users could connect to it
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// getEncryptedContentsPolicyFlag returns the policy of the --encrypted-contents
+// flag, --delete-encrypted is the older way of asking for the delete one.
+func getEncryptedContentsPolicyFlag(value string, deleteEncrypted bool) (string, error) {
+	if value == "" && deleteEncrypted {
+		return wiiudownloader.ENCRYPTED_CONTENTS_DELETE, nil
+	}
+	return wiiudownloader.ParseEncryptedContentsPolicy(value)
+}
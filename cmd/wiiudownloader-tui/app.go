@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	paneSearch = iota
+	paneQueue
+)
+
+// statusNoUpdate is the status of the updates skipped as none was published.
+const statusNoUpdate = "no update available"
+
+var categories = []uint8{
+	wiiudownloader.TITLE_CATEGORY_GAME,
+	wiiudownloader.TITLE_CATEGORY_UPDATE,
+	wiiudownloader.TITLE_CATEGORY_DLC,
+	wiiudownloader.TITLE_CATEGORY_DEMO,
+	wiiudownloader.TITLE_CATEGORY_ALL,
+}
+
+var categoryNames = map[uint8]string{
+	wiiudownloader.TITLE_CATEGORY_GAME:   "Game",
+	wiiudownloader.TITLE_CATEGORY_UPDATE: "Update",
+	wiiudownloader.TITLE_CATEGORY_DLC:    "DLC",
+	wiiudownloader.TITLE_CATEGORY_DEMO:   "Demo",
+	wiiudownloader.TITLE_CATEGORY_ALL:    "All",
+}
+
+type queuedTitle struct {
+	entry  wiiudownloader.TitleEntry
+	mutex  sync.Mutex // status is set by the download goroutine
+	status string
+}
+
+func (q *queuedTitle) setStatus(status string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.status = status
+}
+
+func (q *queuedTitle) getStatus() string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.status
+}
+
+type app struct {
+	term            *terminal
+	outputDirectory string
+	downloadOptions []wiiudownloader.DownloadTitleOption
+
+	pane     int
+	category int // index in categories
+	entries  []wiiudownloader.TitleEntry
+	query    string
+	results  []wiiudownloader.TitleEntry
+	cursor   int
+	queue    []*queuedTitle
+	queuePos int
+	message  string
+
+	downloading  bool
+	reporter     *wiiudownloader.EventReporter
+	events       chan wiiudownloader.ProgressEvent
+	lastEvent    wiiudownloader.ProgressEvent
+	fileProgress map[string]int64
+	decrypting   float64
+	startTime    time.Time
+}
+
+func newApp(term *terminal, outputDirectory string, downloadOptions []wiiudownloader.DownloadTitleOption) *app {
+	a := &app{
+		term:            term,
+		outputDirectory: outputDirectory,
+		downloadOptions: downloadOptions,
+		events:          make(chan wiiudownloader.ProgressEvent, 256),
+	}
+	a.loadCategory()
+	return a
+}
+
+func (a *app) loadCategory() {
+	a.entries = wiiudownloader.GetTitleEntries(categories[a.category])
+	a.search()
+}
+
+func (a *app) search() {
+	a.results = make([]wiiudownloader.TitleEntry, 0)
+	for _, entry := range a.entries {
+		if wiiudownloader.TitleMatchesQuery(entry, a.query) {
+			a.results = append(a.results, entry)
+		}
+	}
+	a.cursor = 0
+}
+
+func (a *app) isQueued(titleID uint64) int {
+	for i, queued := range a.queue {
+		if queued.entry.TitleID == titleID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (a *app) toggleQueued(entry wiiudownloader.TitleEntry) {
+	if i := a.isQueued(entry.TitleID); i >= 0 {
+		a.queue = append(a.queue[:i], a.queue[i+1:]...)
+		return
+	}
+	a.queue = append(a.queue, &queuedTitle{entry: entry, status: "queued"})
+}
+
+// handleKey returns false when the application should exit.
+func (a *app) handleKey(k key) bool {
+	a.message = ""
+	if a.downloading {
+		if k.keyType == keyCtrlC || k.keyType == keyCtrlQ {
+			a.reporter.SetCancelled()
+			a.message = "Cancelling..."
+		}
+		return true
+	}
+
+	switch k.keyType {
+	case keyCtrlC, keyCtrlQ:
+		return false
+	case keyTab:
+		a.pane = (a.pane + 1) % 2
+	case keyCtrlT:
+		a.category = (a.category + 1) % len(categories)
+		a.loadCategory()
+	case keyCtrlD:
+		a.startDownload()
+	case keyUp, keyDown, keyPageUp, keyPageDown:
+		a.moveCursor(k.keyType)
+	case keyEnter:
+		if a.pane == paneSearch && a.cursor < len(a.results) {
+			a.toggleQueued(a.results[a.cursor])
+		}
+	case keyBackspace, keyDelete:
+		if a.pane == paneQueue {
+			if a.queuePos < len(a.queue) {
+				a.queue = append(a.queue[:a.queuePos], a.queue[a.queuePos+1:]...)
+				if a.queuePos > 0 && a.queuePos >= len(a.queue) {
+					a.queuePos--
+				}
+			}
+		} else if k.keyType == keyBackspace && a.query != "" {
+			queryRunes := []rune(a.query)
+			a.query = string(queryRunes[:len(queryRunes)-1])
+			a.search()
+		}
+	case keyEscape:
+		if a.pane == paneSearch {
+			a.query = ""
+			a.search()
+		}
+	case keyRune:
+		if a.pane == paneSearch {
+			a.query += string(k.r)
+			a.search()
+		}
+	}
+	return true
+}
+
+func (a *app) moveCursor(keyType keyType) {
+	position, length := &a.cursor, len(a.results)
+	if a.pane == paneQueue {
+		position, length = &a.queuePos, len(a.queue)
+	}
+	page := a.listHeight()
+	switch keyType {
+	case keyUp:
+		*position--
+	case keyDown:
+		*position++
+	case keyPageUp:
+		*position -= page
+	case keyPageDown:
+		*position += page
+	}
+	if *position >= length {
+		*position = length - 1
+	}
+	if *position < 0 {
+		*position = 0
+	}
+}
+
+func (a *app) listHeight() int {
+	return max(a.term.height-6, 1)
+}
+
+func (a *app) startDownload() {
+	if len(a.queue) == 0 {
+		a.message = "The queue is empty, add titles with Enter"
+		return
+	}
+	a.downloading = true
+	a.reporter = wiiudownloader.NewEventReporter(a.events)
+	a.startTime = time.Now()
+	a.lastEvent = wiiudownloader.ProgressEvent{}
+	a.fileProgress = make(map[string]int64)
+	queue := append([]*queuedTitle(nil), a.queue...)
+	for _, queued := range queue {
+		queued.setStatus("queued")
+	}
+	reporter, events := a.reporter, a.events
+	go func() {
+		defer close(events)
+		for _, queued := range queue {
+			if reporter.Cancelled() {
+				return
+			}
+			queued.setStatus("downloading")
+			titleID := fmt.Sprintf("%016x", queued.entry.TitleID)
+			err := reporter.DownloadTitle(titleID, a.outputDirectory, a.downloadOptions...)
+			if errors.Is(err, wiiudownloader.ErrNoUpdateAvailable) {
+				queued.setStatus(statusNoUpdate)
+				continue
+			}
+			if err != nil {
+				queued.setStatus("failed: " + err.Error())
+				continue
+			}
+			if reporter.Cancelled() {
+				queued.setStatus("cancelled")
+				return
+			}
+			queued.setStatus("done")
+		}
+	}()
+}
+
+func (a *app) handleEvent(event wiiudownloader.ProgressEvent) {
+	a.lastEvent = event
+	switch event.Type {
+	case wiiudownloader.PROGRESS_EVENT_TITLE_STARTED:
+		a.fileProgress = make(map[string]int64)
+		a.decrypting = 0
+	case wiiudownloader.PROGRESS_EVENT_FILE_STARTED, wiiudownloader.PROGRESS_EVENT_PROGRESS:
+		a.fileProgress[event.Filename] = event.FileDownloaded
+	case wiiudownloader.PROGRESS_EVENT_FILE_DONE:
+		delete(a.fileProgress, event.Filename)
+	case wiiudownloader.PROGRESS_EVENT_DECRYPTION_PROGRESS:
+		a.decrypting = event.DecryptionProgress
+	}
+}
+
+// downloadFinished is called once every title of the queue was handled.
+func (a *app) downloadFinished() {
+	a.downloading = false
+	a.events = make(chan wiiudownloader.ProgressEvent, 256)
+	remaining := make([]*queuedTitle, 0)
+	skipped := 0
+	for _, queued := range a.queue {
+		switch queued.getStatus() {
+		case "done":
+		case statusNoUpdate:
+			skipped++
+		default:
+			remaining = append(remaining, queued)
+		}
+	}
+	a.message = fmt.Sprintf("Downloaded %d titles to %s", len(a.queue)-len(remaining)-skipped, a.outputDirectory)
+	if skipped > 0 {
+		a.message += fmt.Sprintf(", %d updates skipped as none is available", skipped)
+	}
+	a.queue = remaining
+	a.queuePos = 0
+}
+
+func progressBar(width int, fraction float64) string {
+	width = max(width, 3)
+	filled := int(fraction * float64(width-2))
+	filled = min(max(filled, 0), width-2)
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-2-filled) + "]"
+}
+
+func formatEntry(entry wiiudownloader.TitleEntry) string {
+	return fmt.Sprintf("%016x  %-10s %-8s %s", entry.TitleID, wiiudownloader.GetFormattedRegion(entry.Region), wiiudownloader.GetFormattedKind(entry.TitleID), entry.Name)
+}
+
+// render returns the lines of the screen and the one that is selected, -1
+// when none is.
+func (a *app) render() ([]string, int) {
+	if a.downloading {
+		return a.renderDownload()
+	}
+	lines := make([]string, 0, a.term.height)
+	lines = append(lines, fmt.Sprintf("WiiUDownloader  category: %s  queue: %d  output: %s", categoryNames[categories[a.category]], len(a.queue), a.outputDirectory))
+	if a.pane == paneSearch {
+		lines = append(lines, "Search: "+a.query+"_")
+	} else {
+		lines = append(lines, "Queue")
+	}
+	lines = append(lines, strings.Repeat("─", a.term.width))
+
+	height := a.listHeight()
+	items := make([]string, 0)
+	position := a.cursor
+	if a.pane == paneSearch {
+		for _, entry := range a.results {
+			marker := "  "
+			if a.isQueued(entry.TitleID) >= 0 {
+				marker = "+ "
+			}
+			items = append(items, marker+formatEntry(entry))
+		}
+		if len(items) == 0 {
+			items = append(items, "  No titles found")
+		}
+	} else {
+		position = a.queuePos
+		for _, queued := range a.queue {
+			items = append(items, fmt.Sprintf("  %s  (%s)", formatEntry(queued.entry), queued.getStatus()))
+		}
+		if len(items) == 0 {
+			items = append(items, "  The queue is empty")
+		}
+	}
+	first := 0
+	if position >= height {
+		first = position - height + 1
+	}
+	selected := -1
+	for i := first; i < len(items) && i < first+height; i++ {
+		if i == position {
+			selected = len(lines)
+		}
+		lines = append(lines, items[i])
+	}
+	for len(lines) < a.term.height-2 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, a.message)
+	lines = append(lines, "Tab: search/queue  Enter: add/remove  Del: remove from queue  Ctrl-T: category  Ctrl-D: download  Ctrl-Q: quit")
+	return lines, selected
+}
+
+func (a *app) renderDownload() ([]string, int) {
+	event := a.lastEvent
+	lines := make([]string, 0, a.term.height)
+	lines = append(lines, "Downloading "+event.Title)
+	lines = append(lines, strings.Repeat("─", a.term.width))
+
+	barWidth := max(a.term.width-40, 10)
+	fraction := 0.0
+	if event.TotalSize > 0 {
+		fraction = float64(event.TotalDownloaded) / float64(event.TotalSize)
+	}
+	speed := ""
+	if elapsed := time.Since(a.startTime).Seconds(); elapsed > 0 {
+		speed = humanize.Bytes(uint64(float64(event.TotalDownloaded)/elapsed)) + "/s"
+	}
+	lines = append(lines, fmt.Sprintf("%s %s / %s %s", progressBar(barWidth, fraction), humanize.Bytes(uint64(event.TotalDownloaded)), humanize.Bytes(uint64(event.TotalSize)), speed))
+	if a.decrypting > 0 {
+		lines = append(lines, fmt.Sprintf("%s decrypting %.0f%%", progressBar(barWidth, a.decrypting), a.decrypting*100))
+	}
+	lines = append(lines, "")
+	filenames := make([]string, 0, len(a.fileProgress))
+	for filename := range a.fileProgress {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		lines = append(lines, fmt.Sprintf("  %-14s %s", filename, humanize.Bytes(uint64(a.fileProgress[filename]))))
+	}
+	lines = append(lines, "")
+	for _, queued := range a.queue {
+		lines = append(lines, fmt.Sprintf("  %-40s %s", queued.entry.Name, queued.getStatus()))
+	}
+	for len(lines) < a.term.height-2 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, a.message)
+	lines = append(lines, "Ctrl-C: cancel")
+	return lines, -1
+}
+
+func (a *app) run() {
+	keys := make(chan key, 64)
+	go a.term.readKeys(keys)
+	redrawTicker := time.NewTicker(200 * time.Millisecond)
+	defer redrawTicker.Stop()
+
+	a.term.draw(a.render())
+	for {
+		var events <-chan wiiudownloader.ProgressEvent
+		if a.downloading {
+			events = a.events
+		}
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return
+			}
+			if k.keyType == keyResize {
+				a.term.updateSize()
+			} else if !a.handleKey(k) {
+				return
+			}
+			a.term.draw(a.render())
+		case event, ok := <-events:
+			if !ok {
+				a.downloadFinished()
+				a.term.draw(a.render())
+				continue
+			}
+			a.handleEvent(event)
+		case <-redrawTicker.C:
+			if a.downloading {
+				a.term.draw(a.render())
+			}
+		}
+	}
+}
+
+func defaultOutputDirectory() string {
+	dir, err := filepath.Abs(".")
+	if err != nil {
+		return "."
+	}
+	return dir
+}
@@ -0,0 +1,60 @@
+// Command wiiudownloader-tui is a terminal frontend for WiiUDownloader, for
+// headless machines and SSH sessions where the GTK interface can't run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+func main() {
+	outputDirectory := flag.String("output", defaultOutputDirectory(), "folder the titles are downloaded to")
+	decrypt := flag.Bool("decrypt", false, "decrypt the contents after downloading them")
+	deleteEncrypted := flag.Bool("delete-encrypted", false, "delete the encrypted contents after decrypting them, same as -encrypted-contents delete")
+	encryptedContents := flag.String("encrypted-contents", "", "what to do with the encrypted contents after decrypting them: keep, delete, folder (move them to a subfolder) or zip")
+	archiveFormat := flag.String("archive", "", "pack the completed titles into archives of this format, zip or 7z, instead of folders")
+	locale := flag.String("locale", "", "language of the messages, defaults to the one of the environment")
+	flag.Parse()
+
+	wiiudownloader.SetLocale(*locale)
+	if err := wiiudownloader.LoadCachedTitleDatabase(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	encryptedContentsPolicy, err := wiiudownloader.ParseEncryptedContentsPolicy(*encryptedContents)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if _, err := wiiudownloader.ParseArchiveFormat(*archiveFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *encryptedContents == "" && *deleteEncrypted {
+		encryptedContentsPolicy = wiiudownloader.ENCRYPTED_CONTENTS_DELETE
+	}
+
+	downloadOptions := []wiiudownloader.DownloadTitleOption{
+		wiiudownloader.WithTitleDirTemplate(wiiudownloader.DEFAULT_TITLE_DIR_TEMPLATE),
+		wiiudownloader.WithArchiveOutput(*archiveFormat),
+	}
+	if *decrypt {
+		downloadOptions = append(downloadOptions, wiiudownloader.WithEncryptedContentsPolicy(encryptedContentsPolicy))
+	}
+
+	if err := os.MkdirAll(*outputDirectory, os.ModePerm); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	term, err := newTerminal()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer term.restore()
+
+	newApp(term, *outputDirectory, downloadOptions).run()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+type keyType int
+
+const (
+	keyRune keyType = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyEnter
+	keyBackspace
+	keyDelete
+	keyTab
+	keyEscape
+	keyCtrlC
+	keyCtrlD
+	keyCtrlQ
+	keyCtrlT
+	keyResize // not a key, the terminal was resized
+)
+
+type key struct {
+	keyType keyType
+	r       rune
+}
+
+// keyTypes are the keys of tcell the application handles, the others are
+// ignored.
+var keyTypes = map[tcell.Key]keyType{
+	tcell.KeyUp:         keyUp,
+	tcell.KeyDown:       keyDown,
+	tcell.KeyPgUp:       keyPageUp,
+	tcell.KeyPgDn:       keyPageDown,
+	tcell.KeyEnter:      keyEnter,
+	tcell.KeyBackspace:  keyBackspace,
+	tcell.KeyBackspace2: keyBackspace,
+	tcell.KeyDelete:     keyDelete,
+	tcell.KeyTab:        keyTab,
+	tcell.KeyEscape:     keyEscape,
+	tcell.KeyCtrlC:      keyCtrlC,
+	tcell.KeyCtrlD:      keyCtrlD,
+	tcell.KeyCtrlQ:      keyCtrlQ,
+	tcell.KeyCtrlT:      keyCtrlT,
+}
+
+// terminal draws the application with tcell, which handles the terminals of
+// every platform, Windows consoles included.
+type terminal struct {
+	screen tcell.Screen
+	width  int
+	height int
+}
+
+func newTerminal() (*terminal, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the terminal, is this an interactive terminal? %w", err)
+	}
+	if err := screen.Init(); err != nil {
+		return nil, fmt.Errorf("unable to set up the terminal: %w", err)
+	}
+	screen.HideCursor()
+	t := &terminal{screen: screen}
+	t.updateSize()
+	return t, nil
+}
+
+func (t *terminal) restore() {
+	t.screen.Fini()
+}
+
+func (t *terminal) updateSize() {
+	t.width, t.height = t.screen.Size()
+}
+
+// draw replaces the screen with lines, cut to the size of the terminal. The
+// line at selected, if any, is drawn in reverse video.
+func (t *terminal) draw(lines []string, selected int) {
+	t.screen.Clear()
+	for y := 0; y < t.height && y < len(lines); y++ {
+		style := tcell.StyleDefault
+		if y == selected {
+			style = style.Reverse(true)
+		}
+		x := 0
+		for _, r := range truncate(lines[y], t.width) {
+			t.screen.SetContent(x, y, r, nil, style)
+			x += runewidth.RuneWidth(r)
+		}
+	}
+	t.screen.Show()
+}
+
+// truncate cuts line to width columns, wide characters taking two.
+func truncate(line string, width int) string {
+	return runewidth.Truncate(line, width, "…")
+}
+
+// readKeys sends the keys typed, and the resizes of the terminal, to keys
+// until the screen is closed.
+func (t *terminal) readKeys(keys chan<- key) {
+	for {
+		switch event := t.screen.PollEvent().(type) {
+		case nil:
+			close(keys)
+			return
+		case *tcell.EventResize:
+			keys <- key{keyType: keyResize}
+		case *tcell.EventKey:
+			if event.Key() == tcell.KeyRune {
+				keys <- key{keyType: keyRune, r: event.Rune()}
+			} else if keyType, ok := keyTypes[event.Key()]; ok {
+				keys <- key{keyType: keyType}
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"crypto/aes"
+	"fmt"
+	"sync"
+)
+
+// Common key indices of tickets, which tell the common key their title key is
+// encrypted with. The Wii U titles use the Wii U common key.
+const (
+	COMMON_KEY_INDEX_DEFAULT = 0 // the Wii U common key, or the Wii one for Wii and vWii titles
+	COMMON_KEY_INDEX_KOREAN  = 1 // Korean Wii titles
+	COMMON_KEY_INDEX_VWII    = 2 // vWii titles
+)
+
+var (
+	commonKeysMutex sync.RWMutex
+	// The Wii and vWii common keys are only known once the keys of a console
+	// are loaded
+	wiiCommonKey       []byte
+	koreanWiiCommonKey []byte
+	vWiiCommonKey      []byte
+)
+
+// isWiiUTitle reports whether titleID is a title of the Wii U itself rather
+// than of its Wii mode.
+func isWiiUTitle(titleID uint64) bool {
+	return TIDHigh(titleID)>>16 == TID_HIGH_GAME>>16
+}
+
+// CommonKeyIndexForTitle returns the common key index of the tickets of titleID,
+// the one generated tickets are given.
+func CommonKeyIndexForTitle(titleID uint64) uint8 {
+	switch TIDHigh(titleID) {
+	case TID_HIGH_VWII_IOS, TID_HIGH_VWII_SYSTEM_APP, TID_HIGH_VWII_SYSTEM:
+		return COMMON_KEY_INDEX_VWII
+	default:
+		return COMMON_KEY_INDEX_DEFAULT
+	}
+}
+
+// setWiiCommonKeys makes the keys of the Wii mode of a console known, nil
+// keys are left as they are.
+func setWiiCommonKeys(wii, koreanWii, vWii []byte) error {
+	for _, key := range [][]byte{wii, koreanWii, vWii} {
+		if key != nil && len(key) != aes.BlockSize {
+			return fmt.Errorf(Localize("common keys must be %d bytes long, got %d"), aes.BlockSize, len(key))
+		}
+	}
+	commonKeysMutex.Lock()
+	defer commonKeysMutex.Unlock()
+	if wii != nil {
+		wiiCommonKey = bytes.Clone(wii)
+	}
+	if koreanWii != nil {
+		koreanWiiCommonKey = bytes.Clone(koreanWii)
+	}
+	if vWii != nil {
+		vWiiCommonKey = bytes.Clone(vWii)
+	}
+	return nil
+}
+
+// getCommonKey returns the common key of index in the tickets of titleID.
+func getCommonKey(titleID uint64, index uint8) ([]byte, error) {
+	commonKeysMutex.RLock()
+	defer commonKeysMutex.RUnlock()
+	if isWiiUTitle(titleID) {
+		if index != COMMON_KEY_INDEX_DEFAULT {
+			return nil, wrapKind(ErrTicketUnavailable, fmt.Errorf(Localize("the ticket of %016x uses the unsupported common key index %d"), titleID, index))
+		}
+		return commonKey, nil
+	}
+
+	var key []byte
+	var name string
+	switch index {
+	case COMMON_KEY_INDEX_DEFAULT:
+		key, name = wiiCommonKey, "Wii"
+	case COMMON_KEY_INDEX_KOREAN:
+		key, name = koreanWiiCommonKey, "Korean Wii"
+	case COMMON_KEY_INDEX_VWII:
+		key, name = vWiiCommonKey, "vWii"
+	default:
+		return nil, wrapKind(ErrTicketUnavailable, fmt.Errorf(Localize("the ticket of %016x uses the unsupported common key index %d"), titleID, index))
+	}
+	if key == nil {
+		return nil, wrapKind(ErrTicketUnavailable, fmt.Errorf(Localize("the title key of %016x is encrypted with the %s common key, load the keys of your console to use it"), titleID, name))
+	}
+	return key, nil
+}
@@ -0,0 +1,215 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// contentStore is a folder of contents shared by every title, addressed by the
+// SHA-1 the TMD has for them. Many contents, like the shared system data, are
+// the same in several titles or regions, they are only downloaded once.
+//
+// Every content is stored encrypted, as it was downloaded, in <hash>.app along
+// with <hash>.h3 for contents with a hash tree and <hash>.key, the title key
+// and index it is encrypted with. A content encrypted the same way is hard
+// linked, one of another title is decrypted and encrypted again with its key.
+type contentStore struct {
+	path     string
+	titleKey []byte // of the title being downloaded
+}
+
+// newContentStore returns nil when there is no store or the title key isn't
+// known, as the contents of the store couldn't be encrypted for the title.
+func newContentStore(path string, titleKey []byte) *contentStore {
+	if path == "" || len(titleKey) != aes.BlockSize {
+		return nil
+	}
+	return &contentStore{path: path, titleKey: titleKey}
+}
+
+// contentKey is stored next to every content of the store.
+func contentKey(titleKey []byte, content Content) []byte {
+	return append(bytes.Clone(titleKey), content.Index...)
+}
+
+func (s *contentStore) contentPath(content Content) string {
+	name := hex.EncodeToString(content.Hash[:sha1.Size])
+	return filepath.Join(s.path, name[:2], name)
+}
+
+// reencryptContent decrypts the content read from src with from and encrypts
+// it again with to, writing it to dst. fromIndex is the index of the content
+// src was encrypted with, for contents without a hash tree.
+func reencryptContent(src io.Reader, dst io.Writer, from cipher.Block, fromIndex []byte, to cipher.Block, content Content) error {
+	if content.Type&0x2 == 2 {
+		zeroIV := make([]byte, aes.BlockSize)
+		block := make([]byte, BLOCK_SIZE_HASHED)
+		for blockNumber := 0; ; blockNumber = (blockNumber + 1) % 16 {
+			if _, err := io.ReadFull(src, block); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			hashes := block[:HASHES_SIZE]
+			data := block[HASHES_SIZE:]
+			cipher.NewCBCDecrypter(from, zeroIV).CryptBlocks(hashes, hashes)
+			h0Hash := bytes.Clone(hashes[0x14*blockNumber : 0x14*blockNumber+aes.BlockSize])
+			cipher.NewCBCDecrypter(from, h0Hash).CryptBlocks(data, data)
+			cipher.NewCBCEncrypter(to, zeroIV).CryptBlocks(hashes, hashes)
+			cipher.NewCBCEncrypter(to, h0Hash).CryptBlocks(data, data)
+			if _, err := dst.Write(block); err != nil {
+				return checkDiskFull(err)
+			}
+		}
+	}
+
+	decrypter := cipher.NewCBCDecrypter(from, append(bytes.Clone(fromIndex), make([]byte, 14)...))
+	encrypter := cipher.NewCBCEncrypter(to, append(bytes.Clone(content.Index), make([]byte, 14)...))
+	buffer := make([]byte, decryptionReadSize)
+	for {
+		n, err := io.ReadFull(src, buffer)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		n -= n % aes.BlockSize
+		decrypter.CryptBlocks(buffer[:n], buffer[:n])
+		encrypter.CryptBlocks(buffer[:n], buffer[:n])
+		if _, err := dst.Write(buffer[:n]); err != nil {
+			return checkDiskFull(err)
+		}
+		if n < len(buffer) {
+			return nil
+		}
+	}
+}
+
+// get puts the files of content in the title folder at outputDir when the
+// store has it, and reports whether it did.
+func (s *contentStore) get(content Content, outputDir string) (bool, error) {
+	storedPath := s.contentPath(content)
+	storedKey, err := os.ReadFile(storedPath + ".key")
+	if err != nil || len(storedKey) != aes.BlockSize+2 {
+		return false, nil
+	}
+	info, err := os.Stat(storedPath + ".app")
+	if err != nil || checkContentSize(info.Size(), content) != nil {
+		return false, nil
+	}
+
+	dstPath := filepath.Join(outputDir, fmt.Sprintf("%08X", content.ID))
+	if content.Type&0x2 == 2 {
+		// The H3 hashes aren't encrypted
+		if err := linkOrCopyFile(storedPath+".h3", dstPath+".h3"); err != nil {
+			return false, nil
+		}
+	}
+	if bytes.Equal(storedKey, contentKey(s.titleKey, content)) {
+		if err := linkOrCopyFile(storedPath+".app", dstPath+".app"); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	from, err := aes.NewCipher(storedKey[:aes.BlockSize])
+	if err != nil {
+		return false, err
+	}
+	to, err := aes.NewCipher(s.titleKey)
+	if err != nil {
+		return false, err
+	}
+	src, err := os.Open(storedPath + ".app")
+	if err != nil {
+		return false, nil
+	}
+	defer src.Close()
+	if err := os.Remove(dstPath + ".app"); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	dst, err := os.Create(dstPath + ".app")
+	if err != nil {
+		return false, err
+	}
+	if err := reencryptContent(src, dst, from, storedKey[aes.BlockSize:], to, content); err != nil {
+		dst.Close()
+		return false, err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return false, err
+	}
+	return true, dst.Close()
+}
+
+// put adds a downloaded content of the title folder at outputDir to the store,
+// unless it already has it.
+func (s *contentStore) put(content Content, outputDir string) error {
+	storedPath := s.contentPath(content)
+	if _, err := os.Stat(storedPath + ".app"); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(storedPath), os.ModePerm); err != nil {
+		return err
+	}
+	srcPath := filepath.Join(outputDir, fmt.Sprintf("%08X", content.ID))
+	if content.Type&0x2 == 2 {
+		if err := linkOrCopyFile(srcPath+".h3", storedPath+".h3"); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(storedPath+".key", contentKey(s.titleKey, content), 0644); err != nil {
+		return checkDiskFull(err)
+	}
+	// The .app is added last, the others are ignored until it is there
+	if err := linkOrCopyFile(srcPath+".app", storedPath+".app.tmp"); err != nil {
+		return err
+	}
+	return os.Rename(storedPath+".app.tmp", storedPath+".app")
+}
+
+// remove drops a content from the store, when it turned out to be corrupted.
+func (s *contentStore) remove(content Content) {
+	storedPath := s.contentPath(content)
+	for _, ext := range []string{".app", ".h3", ".key"} {
+		os.Remove(storedPath + ext)
+	}
+}
+
+// reuseFromStore puts the files of content in the title folder from the
+// content store instead of downloading them, and reports whether it did. The
+// content is verified, a corrupted one is removed from the store and
+// downloaded again.
+func (cd *contentDownloader) reuseFromStore(content Content, outputDir string) (bool, error) {
+	if cd.store == nil || cd.titleKey == nil {
+		return false, nil
+	}
+	found, err := cd.store.get(content, outputDir)
+	if err != nil || !found {
+		return false, err
+	}
+	if result := verifyContent(outputDir, content, cd.titleKey); result.Err != nil {
+		cd.store.remove(content)
+		return false, nil
+	}
+	for _, ext := range []string{".app", ".h3"} {
+		name := fmt.Sprintf("%08X%s", content.ID, ext)
+		info, err := os.Stat(filepath.Join(outputDir, name))
+		if err != nil {
+			continue
+		}
+		cd.session.markDone(name, info.Size(), true)
+		cd.progressReporter.SetTotalDownloadedForFile(name, info.Size())
+		cd.progressReporter.MarkFileAsDone(name)
+	}
+	return true, nil
+}
@@ -0,0 +1,125 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ContentVersionCheck is what CheckContentVersions found in a title folder.
+type ContentVersionCheck struct {
+	// Stale are the files of contents its title.tmd doesn't have, left by
+	// another version of the title
+	Stale []string
+	// Mismatched are the contents of its title.tmd whose size or .h3 file is
+	// the one of another version
+	Mismatched []string
+}
+
+// Mixed reports whether the folder has files of another version.
+func (c *ContentVersionCheck) Mixed() bool {
+	return len(c.Stale) > 0 || len(c.Mismatched) > 0
+}
+
+// contentFileMatches reports whether the content file name of the folder at
+// path is the one of content: it has its size, and the hash of its .h3 file,
+// when there is one, is the hash of content.
+func contentFileMatches(path, name string, content Content) bool {
+	info, err := os.Stat(filepath.Join(path, name+".app"))
+	if err != nil || checkContentSize(info.Size(), content) != nil {
+		return false
+	}
+	if content.Type&0x2 == 0 {
+		return true
+	}
+	// The hash of a content with a hash tree is the hash of its .h3 file
+	h3, err := os.ReadFile(filepath.Join(path, name+".h3"))
+	if err != nil {
+		return true
+	}
+	hash := sha1.Sum(h3)
+	return bytes.Equal(hash[:], content.Hash[:sha1.Size])
+}
+
+// CheckContentVersions finds the files of other versions of the title in the
+// title folder at path, like the ones left when a download is run again after
+// an update. Only the sizes and the .h3 files are checked, the contents are
+// not hashed, and missing contents are not reported.
+func CheckContentVersions(path string) (*ContentVersionCheck, error) {
+	tmd, err := readTMDFromDir(path)
+	if err != nil {
+		return nil, err
+	}
+	contentIDs, err := localContentIDs(path)
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[uint32]Content, len(tmd.Contents))
+	for _, content := range tmd.Contents {
+		contents[content.ID] = content
+	}
+
+	check := &ContentVersionCheck{Stale: make([]string, 0), Mismatched: make([]string, 0)}
+	for _, id := range contentIDs {
+		name, _ := findContentFile(path, id)
+		content, ok := contents[id]
+		if !ok {
+			check.Stale = append(check.Stale, name+".app")
+			if _, err := os.Stat(filepath.Join(path, name+".h3")); err == nil {
+				check.Stale = append(check.Stale, name+".h3")
+			}
+			continue
+		}
+		if !contentFileMatches(path, name, content) {
+			check.Mismatched = append(check.Mismatched, name+".app")
+		}
+	}
+	return check, nil
+}
+
+// RemoveStaleContents deletes the files of contents the title.tmd of the title
+// folder at path doesn't have, see CheckContentVersions, and returns them.
+func RemoveStaleContents(path string) ([]string, error) {
+	check, err := CheckContentVersions(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range check.Stale {
+		if err := os.Remove(filepath.Join(path, name)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return check.Stale, nil
+}
+
+// checkContentVersionsBeforeDecryption fails when some of the contents of the
+// title folder at path are of another version, as they can't be decrypted
+// with its TMD. The contents its TMD doesn't have are removed with
+// removeStale, downloads clean up the folder they wrote to, and only logged
+// otherwise: they don't get in the way of the decryption.
+func checkContentVersionsBeforeDecryption(path string, removeStale bool) error {
+	check, err := CheckContentVersions(path)
+	if err != nil {
+		// Decrypting reports what is wrong with the TMD
+		return nil
+	}
+	if len(check.Mismatched) > 0 {
+		return wrapKind(ErrHashMismatch, fmt.Errorf(Localize("%s has contents of another version of the title: %s, download the title again"), path, strings.Join(check.Mismatched, ", ")))
+	}
+	if len(check.Stale) == 0 {
+		return nil
+	}
+	if !removeStale {
+		log.Printf("%s: kept the contents of another version: %s", path, strings.Join(check.Stale, ", "))
+		return nil
+	}
+	if _, err := RemoveStaleContents(path); err != nil {
+		return err
+	}
+	log.Printf("%s: removed the contents of another version: %s", path, strings.Join(check.Stale, ", "))
+	return nil
+}
@@ -2,17 +2,21 @@ package wiiudownloader
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha1"
 	"encoding/binary"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/Xpl0itU/WiiUDownloader/tmd"
+	"golang.org/x/sync/errgroup"
 )
 
 var commonKey = []byte{0xD7, 0xB0, 0x04, 0x02, 0x65, 0x9B, 0xA2, 0xAB, 0xD2, 0xCB, 0x0D, 0xB2, 0x7F, 0xA2, 0xB6, 0x56}
@@ -53,102 +57,134 @@ type FSTData struct {
 	FSTEntries  []FEntry
 }
 
-func extractFileHash(src *os.File, partDataOffset uint64, fileOffset uint64, size uint64, path string, contentId uint16, cipherHashTree cipher.Block) error {
-	encryptedContent := make([]byte, BLOCK_SIZE_HASHED)
-	decryptedContent := make([]byte, BLOCK_SIZE_HASHED)
-	hashes := make([]byte, HASHES_SIZE)
-
-	writeSize := HASH_BLOCK_SIZE
-	blockNumber := (fileOffset / HASH_BLOCK_SIZE) & 0x0F
-
-	dst, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("could not create '%s': %w", path, err)
-	}
-	defer dst.Close()
-
+// decryptionReadSize is how much of a content is read and decrypted at once,
+// large reads keep the AES-NI accelerated CBC mode of crypto/aes busy instead
+// of waiting on small reads.
+const decryptionReadSize = 256 * 1024
+
+// extractFileHash decrypts size bytes from fileOffset of a content with a hash
+// tree to dst, checking every block against the hash tree up to h3Data, the
+// H3 hashes of the content. path is the file dst writes to, for the errors.
+func extractFileHash(src *os.File, partDataOffset uint64, fileOffset uint64, size uint64, dst io.Writer, path string, content Content, h3Data []byte, cipherHashTree cipher.Block) error {
+	blockIndex := fileOffset / HASH_BLOCK_SIZE
+	blockNumber := blockIndex & 0x0F
 	roffset := fileOffset / HASH_BLOCK_SIZE * BLOCK_SIZE_HASHED
 	soffset := fileOffset - (fileOffset / HASH_BLOCK_SIZE * HASH_BLOCK_SIZE)
 
-	if soffset+size > uint64(writeSize) {
-		writeSize = writeSize - int(soffset)
-	}
-
-	_, err = src.Seek(int64(partDataOffset+roffset), io.SeekStart)
-	if err != nil {
+	if _, err := src.Seek(int64(partDataOffset+roffset), io.SeekStart); err != nil {
 		return err
 	}
 
-	for size > 0 {
-		if uint64(writeSize) > size {
-			writeSize = int(size)
-		}
-
-		if _, err := io.ReadFull(src, encryptedContent); err != nil {
-			return fmt.Errorf("could not read %d bytes from '%s': %w", BLOCK_SIZE_HASHED, path, err)
-		}
-
-		iv := make([]byte, aes.BlockSize)
-		iv[1] = byte(contentId)
-		cipher.NewCBCDecrypter(cipherHashTree, iv).CryptBlocks(hashes, encryptedContent[:HASHES_SIZE])
+	blocksLeft := (soffset + size + HASH_BLOCK_SIZE - 1) / HASH_BLOCK_SIZE
+	buffer := make([]byte, min(blocksLeft, decryptionReadSize/BLOCK_SIZE_HASHED)*BLOCK_SIZE_HASHED)
+	zeroIV := make([]byte, aes.BlockSize)
 
-		h0Hash := hashes[0x14*blockNumber : 0x14*blockNumber+sha1.Size]
-		iv = hashes[0x14*blockNumber : 0x14*blockNumber+aes.BlockSize]
-
-		if blockNumber == 0 {
-			iv[1] ^= byte(contentId)
+	for size > 0 {
+		readSize := min(uint64(len(buffer)), blocksLeft*BLOCK_SIZE_HASHED)
+		if _, err := io.ReadFull(src, buffer[:readSize]); err != nil {
+			return fmt.Errorf(Localize("could not read %d bytes from '%s': %w"), readSize, path, err)
 		}
 
-		cipher.NewCBCDecrypter(cipherHashTree, iv).CryptBlocks(decryptedContent, encryptedContent[HASHES_SIZE:])
-
-		hash := sha1.Sum(decryptedContent[:HASH_BLOCK_SIZE])
+		// The decrypted data of every block is moved to the start of the
+		// buffer, so it is written at once
+		decryptedSize := uint64(0)
+		for offset := uint64(0); offset < readSize && size > 0; offset += BLOCK_SIZE_HASHED {
+			hashes := buffer[offset : offset+HASHES_SIZE]
+			data := buffer[offset+HASHES_SIZE : offset+BLOCK_SIZE_HASHED]
 
-		if !reflect.DeepEqual(hash[:], h0Hash) {
-			return errors.New("h0 hash mismatch")
-		}
-
-		size -= uint64(writeSize)
+			cipher.NewCBCDecrypter(cipherHashTree, zeroIV).CryptBlocks(hashes, hashes)
+			if level := checkHashTree(hashes, h3Data, blockIndex); level != "" {
+				return &HashTreeError{ContentID: content.CIDStr, Block: blockIndex, Level: level, Path: path}
+			}
+			h0Hash := hashes[0x14*blockNumber : 0x14*blockNumber+sha1.Size]
+			cipher.NewCBCDecrypter(cipherHashTree, h0Hash[:aes.BlockSize]).CryptBlocks(data, data)
 
-		_, err = dst.Write(decryptedContent[soffset : soffset+uint64(writeSize)])
-		if err != nil {
-			return err
-		}
+			hash := sha1.Sum(data)
+			if !bytes.Equal(hash[:], h0Hash) {
+				return &HashTreeError{ContentID: content.CIDStr, Block: blockIndex, Level: HASH_LEVEL_H0, Path: path}
+			}
 
-		blockNumber++
-		if blockNumber >= 16 {
-			blockNumber = 0
+			writeSize := min(HASH_BLOCK_SIZE-soffset, size)
+			copy(buffer[decryptedSize:], data[soffset:soffset+writeSize])
+			decryptedSize += writeSize
+			size -= writeSize
+			soffset = 0
+			blocksLeft--
+			blockIndex++
+			blockNumber = blockIndex & 0x0F
 		}
 
-		if soffset != 0 {
-			writeSize = HASH_BLOCK_SIZE
-			soffset = 0
+		if _, err := dst.Write(buffer[:decryptedSize]); err != nil {
+			return checkDiskFull(err)
 		}
 	}
 
 	return nil
 }
 
-func extractFile(src *os.File, partDataOffset uint64, fileOffset uint64, size uint64, path string, contentId uint16, cipherHashTree cipher.Block) error {
-	encryptedContent := make([]byte, BLOCK_SIZE)
-	decryptedContent := make([]byte, BLOCK_SIZE)
+// The levels of the hash tree of a content, H0 are the hashes of the data of
+// every block and H3 the ones in the .h3 file
+const (
+	HASH_LEVEL_H0 = "H0"
+	HASH_LEVEL_H1 = "H1"
+	HASH_LEVEL_H2 = "H2"
+	HASH_LEVEL_H3 = "H3"
+)
 
-	writeSize := BLOCK_SIZE
+// checkHashTree checks the decrypted hashes of the block at blockIndex of a
+// content against the levels above them, and returns the level that failed.
+// The H3 level is skipped when h3Data is nil.
+func checkHashTree(hashes []byte, h3Data []byte, blockIndex uint64) string {
+	h0Hashes := hashes[0:0x140]
+	h1Hashes := hashes[0x140:0x280]
+	h2Hashes := hashes[0x280:0x3C0]
+	h1Num := (blockIndex / 16) % 16
+	h2Num := (blockIndex / 256) % 16
+	h3Num := blockIndex / 4096
+
+	h0HashesHash := sha1.Sum(h0Hashes)
+	if !bytes.Equal(h0HashesHash[:], h1Hashes[h1Num*0x14:h1Num*0x14+sha1.Size]) {
+		return HASH_LEVEL_H1
+	}
+	h1HashesHash := sha1.Sum(h1Hashes)
+	if !bytes.Equal(h1HashesHash[:], h2Hashes[h2Num*0x14:h2Num*0x14+sha1.Size]) {
+		return HASH_LEVEL_H2
+	}
+	if h3Data == nil {
+		return ""
+	}
+	h2HashesHash := sha1.Sum(h2Hashes)
+	if uint64(len(h3Data)) < h3Num*0x14+sha1.Size || !bytes.Equal(h2HashesHash[:], h3Data[h3Num*0x14:h3Num*0x14+sha1.Size]) {
+		return HASH_LEVEL_H3
+	}
+	return ""
+}
 
-	dst, err := os.Create(path)
+// loadH3 reads the H3 hashes of a content and checks them against the TMD. A
+// missing .h3 file returns nil, the hash tree is then checked up to H2.
+func loadH3(path string, content Content) ([]byte, error) {
+	h3Path := filepath.Join(path, content.CIDStr+".h3")
+	h3Data, err := os.ReadFile(h3Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("could not create '%s': %w", path, err)
+		return nil, err
+	}
+	h3Hash := sha1.Sum(h3Data)
+	if !bytes.Equal(h3Hash[:], content.Hash[:sha1.Size]) {
+		return nil, &VerificationError{Path: h3Path, Layer: VERIFICATION_LAYER_NETWORK}
 	}
-	defer dst.Close()
+	return h3Data, nil
+}
 
+// extractFile decrypts size bytes from fileOffset of a content without a hash
+// tree to dst. path is the file dst writes to, for the errors.
+func extractFile(src *os.File, partDataOffset uint64, fileOffset uint64, size uint64, dst io.Writer, path string, contentId uint16, cipherHashTree cipher.Block) error {
 	roffset := fileOffset / BLOCK_SIZE * BLOCK_SIZE
 	soffset := fileOffset - (fileOffset / BLOCK_SIZE * BLOCK_SIZE)
 
-	if soffset+size > uint64(writeSize) {
-		writeSize = writeSize - int(soffset)
-	}
-
-	_, err = src.Seek(int64(partDataOffset+roffset), io.SeekStart)
-	if err != nil {
+	if _, err := src.Seek(int64(partDataOffset+roffset), io.SeekStart); err != nil {
 		return err
 	}
 
@@ -157,28 +193,25 @@ func extractFile(src *os.File, partDataOffset uint64, fileOffset uint64, size ui
 
 	aesCipher := cipher.NewCBCDecrypter(cipherHashTree, iv)
 
-	for size > 0 {
-		if uint64(writeSize) > size {
-			writeSize = int(size)
-		}
-
-		if n, err := io.ReadFull(src, encryptedContent); err != nil && n != BLOCK_SIZE {
-			return fmt.Errorf("could not read %d bytes from '%s': %w", BLOCK_SIZE, path, err)
-		}
-
-		aesCipher.CryptBlocks(decryptedContent, encryptedContent)
+	// Contents without a hash tree are only padded to the AES block size
+	left := (soffset + size + aes.BlockSize - 1) / aes.BlockSize * aes.BlockSize
+	buffer := make([]byte, min(left, decryptionReadSize))
 
-		n, err := dst.Write(decryptedContent[soffset : soffset+uint64(writeSize)])
-		if err != nil {
-			return err
+	for size > 0 {
+		readSize := min(uint64(len(buffer)), left)
+		if _, err := io.ReadFull(src, buffer[:readSize]); err != nil {
+			return fmt.Errorf(Localize("could not read %d bytes from '%s': %w"), readSize, path, err)
 		}
+		left -= readSize
 
-		size -= uint64(n)
+		aesCipher.CryptBlocks(buffer[:readSize], buffer[:readSize])
 
-		if soffset != 0 {
-			writeSize = BLOCK_SIZE
-			soffset = 0
+		writeSize := min(readSize-soffset, size)
+		if _, err := dst.Write(buffer[soffset : soffset+writeSize]); err != nil {
+			return checkDiskFull(err)
 		}
+		size -= writeSize
+		soffset = 0
 	}
 
 	return nil
@@ -280,7 +313,18 @@ func read3BytesBE(f io.ReadSeeker) int {
 	return int(uint(b[2]) | uint(b[1])<<8 | uint(b[0])<<16)
 }
 
-func decryptContentToBuffer(encryptedFile *os.File, decryptedBuffer *bytes.Buffer, cipherHashTree cipher.Block, content Content) error {
+// decryptionBufferPool holds the buffers decryptContentToBuffer reads and
+// decrypts with, so verifying or decrypting a title doesn't allocate one per
+// content.
+var decryptionBufferPool = sync.Pool{New: func() interface{} {
+	buffer := make([]byte, decryptionReadSize)
+	return &buffer
+}}
+
+// decryptContentToBuffer decrypts a whole content to decryptedBuffer, checking
+// its blocks against the hash tree, or its SHA-1 for contents without one.
+// The hashes of the blocks of a content with a hash tree are written too.
+func decryptContentToBuffer(encryptedFile *os.File, decryptedBuffer io.Writer, cipherHashTree cipher.Block, content Content) error {
 	hasHashTree := content.Type&2 != 0
 	encryptedStat, err := encryptedFile.Stat()
 	if err != nil {
@@ -289,136 +333,91 @@ func decryptContentToBuffer(encryptedFile *os.File, decryptedBuffer *bytes.Buffe
 	encryptedSize := encryptedStat.Size()
 	path := filepath.Dir(encryptedFile.Name())
 
+	bufferPointer := decryptionBufferPool.Get().(*[]byte)
+	defer decryptionBufferPool.Put(bufferPointer)
+	buffer := *bufferPointer
+
 	if hasHashTree { // if has a hash tree
-		chunkCount := encryptedSize / 0x10000
 		h3Data, err := os.ReadFile(filepath.Join(path, fmt.Sprintf("%s.h3", content.CIDStr)))
 		if err != nil {
 			return err
 		}
 		h3BytesSHASum := sha1.Sum(h3Data)
-		if hex.EncodeToString(h3BytesSHASum[:]) != hex.EncodeToString(content.Hash) {
-			return errors.New("H3 Hash mismatch")
+		if !bytes.Equal(h3BytesSHASum[:], content.Hash[:sha1.Size]) {
+			return wrapKind(ErrHashMismatch, errors.New(Localize("H3 Hash mismatch")))
 		}
 
-		h0HashNum := int64(0)
-		h1HashNum := int64(0)
-		h2HashNum := int64(0)
-		h3HashNum := int64(0)
-
-		hashes := make([]byte, 0x400)
-		buffer := make([]byte, 0x400)
-
-		for chunkNum := int64(0); chunkNum < chunkCount; chunkNum++ {
-			encryptedFile.Read(buffer)
-			cipher.NewCBCDecrypter(cipherHashTree, make([]byte, aes.BlockSize)).CryptBlocks(hashes, buffer)
-
-			h0Hashes := hashes[0:0x140]
-			h1Hashes := hashes[0x140:0x280]
-			h2Hashes := hashes[0x280:0x3c0]
-
-			h0Hash := h0Hashes[(h0HashNum * 0x14):((h0HashNum + 1) * 0x14)]
-			h1Hash := h1Hashes[(h1HashNum * 0x14):((h1HashNum + 1) * 0x14)]
-			h2Hash := h2Hashes[(h2HashNum * 0x14):((h2HashNum + 1) * 0x14)]
-			h3Hash := h3Data[(h3HashNum * 0x14):((h3HashNum + 1) * 0x14)]
-
-			h0HashesHash := sha1.Sum(h0Hashes)
-			h1HashesHash := sha1.Sum(h1Hashes)
-			h2HashesHash := sha1.Sum(h2Hashes)
-
-			if !reflect.DeepEqual(h0HashesHash[:], h1Hash) {
-				return errors.New("h0 Hashes Hash mismatch")
-			}
-			if !reflect.DeepEqual(h1HashesHash[:], h2Hash) {
-				return errors.New("h1 Hashes Hash mismatch")
-			}
-			if !reflect.DeepEqual(h2HashesHash[:], h3Hash) {
-				return errors.New("h2 Hashes Hash mismatch")
+		zeroIV := make([]byte, aes.BlockSize)
+		blocksLeft := uint64(encryptedSize / BLOCK_SIZE_HASHED)
+		blockIndex := uint64(0)
+		for blocksLeft > 0 {
+			readSize := min(uint64(len(buffer)), blocksLeft*BLOCK_SIZE_HASHED)
+			if _, err := io.ReadFull(encryptedFile, buffer[:readSize]); err != nil {
+				return fmt.Errorf(Localize("could not read %d bytes from '%s': %w"), readSize, encryptedFile.Name(), err)
 			}
 
-			decryptedData := make([]byte, 0xFC00)
-			encryptedFile.Read(decryptedData)
+			for offset := uint64(0); offset < readSize; offset += BLOCK_SIZE_HASHED {
+				hashes := buffer[offset : offset+HASHES_SIZE]
+				data := buffer[offset+HASHES_SIZE : offset+BLOCK_SIZE_HASHED]
 
-			cipher.NewCBCDecrypter(cipherHashTree, h0Hash[:16]).CryptBlocks(decryptedData, decryptedData)
-			decryptedDataHash := sha1.Sum(decryptedData)
+				cipher.NewCBCDecrypter(cipherHashTree, zeroIV).CryptBlocks(hashes, hashes)
+				if level := checkHashTree(hashes, h3Data, blockIndex); level != "" {
+					return &HashTreeError{ContentID: content.CIDStr, Block: blockIndex, Level: level}
+				}
+				blockNumber := blockIndex & 0x0F
+				h0Hash := hashes[0x14*blockNumber : 0x14*blockNumber+sha1.Size]
 
-			if !reflect.DeepEqual(decryptedDataHash[:], h0Hash) {
-				return errors.New("data block hash invalid")
+				cipher.NewCBCDecrypter(cipherHashTree, h0Hash[:aes.BlockSize]).CryptBlocks(data, data)
+				decryptedDataHash := sha1.Sum(data)
+				if !bytes.Equal(decryptedDataHash[:], h0Hash) {
+					return &HashTreeError{ContentID: content.CIDStr, Block: blockIndex, Level: HASH_LEVEL_H0}
+				}
+				blockIndex++
+				blocksLeft--
 			}
 
-			_, err = decryptedBuffer.Write(hashes)
-			if err != nil {
+			if _, err := decryptedBuffer.Write(buffer[:readSize]); err != nil {
 				return err
 			}
-			_, err = decryptedBuffer.Write(decryptedData)
-			if err != nil {
-				return err
-			}
-
-			h0HashNum++
-			if h0HashNum >= 16 {
-				h0HashNum = 0
-				h1HashNum++
-			}
-			if h1HashNum >= 16 {
-				h1HashNum = 0
-				h2HashNum++
-			}
-			if h2HashNum >= 16 {
-				h2HashNum = 0
-				h3HashNum++
-			}
 		}
 	} else {
 		cipherContent := cipher.NewCBCDecrypter(cipherHashTree, append(content.Index, make([]byte, 14)...))
 		contentHash := sha1.New()
 		left := content.Size
-		leftHash := content.Size
-
-		for i := 0; i <= int(content.Size/READ_SIZE)+1; i++ {
-			toRead := min(READ_SIZE, left)
-			toReadHash := min(READ_SIZE, leftHash)
 
-			encryptedContent := make([]byte, toRead)
-			_, err = io.ReadFull(encryptedFile, encryptedContent)
-			if err != nil {
+		for left > 0 {
+			toRead := min(uint64(len(buffer)), left)
+			if _, err := io.ReadFull(encryptedFile, buffer[:toRead]); err != nil {
 				return err
 			}
 
-			decryptedContent := make([]byte, len(encryptedContent))
-			cipherContent.CryptBlocks(decryptedContent, encryptedContent)
-			contentHash.Write(decryptedContent[:toReadHash])
-			_, err = decryptedBuffer.Write(decryptedContent)
-			if err != nil {
+			cipherContent.CryptBlocks(buffer[:toRead], buffer[:toRead])
+			contentHash.Write(buffer[:toRead])
+			if _, err := decryptedBuffer.Write(buffer[:toRead]); err != nil {
 				return err
 			}
-
 			left -= toRead
-			leftHash -= toRead
-
-			if left == 0 {
-				break
-			}
 		}
-		if !reflect.DeepEqual(content.Hash[:sha1.Size], contentHash.Sum(nil)) {
-			return errors.New("content hash mismatch")
+		if !bytes.Equal(content.Hash[:sha1.Size], contentHash.Sum(nil)) {
+			return wrapKind(ErrHashMismatch, errors.New(Localize("content hash mismatch")))
 		}
 	}
 	return nil
 }
 
-func DecryptContents(path string, progressReporter ProgressReporter, deleteEncryptedContents bool) error {
+func loadFST(path string) (*TMD, cipher.Block, *FSTData, error) {
 	tmdPath := filepath.Join(path, "title.tmd")
 	if _, err := os.Stat(tmdPath); os.IsNotExist(err) {
-		return err
+		return nil, nil, nil, err
 	}
 
 	tmdData, err := os.ReadFile(tmdPath)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 	tmd, err := ParseTMD(tmdData)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
 	// Check if all contents are present and how they are named
@@ -429,63 +428,138 @@ func DecryptContents(path string, progressReporter ProgressReporter, deleteEncry
 			tmd.Contents[i].CIDStr = fmt.Sprintf("%08x", tmd.Contents[i].ID)
 			_, err = os.Stat(filepath.Join(path, tmd.Contents[i].CIDStr+".app"))
 			if err != nil {
-				return errors.New("content not found")
+				return nil, nil, nil, errors.New(Localize("content not found"))
 			}
 		}
 	}
 
+	cipherHashTree, err := loadTitleKey(path, tmd.TitleID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fstEncFile, err := os.Open(filepath.Join(path, tmd.Contents[0].CIDStr+".app"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	decryptedBuffer := bytes.Buffer{}
+	if err := decryptContentToBuffer(fstEncFile, &decryptedBuffer, cipherHashTree, tmd.Contents[0]); err != nil {
+		fstEncFile.Close()
+		return nil, nil, nil, err
+	}
+	fstEncFile.Close()
+	fst := FSTData{FSTReader: bytes.NewReader(bytes.Clone(decryptedBuffer.Bytes())), FSTEntries: make([]FEntry, 0), EntryCount: 0, Entries: 0, NamesOffset: 0}
+	parseFST(&fst)
+
+	return tmd, cipherHashTree, &fst, nil
+}
+
+// loadTitleKey decrypts the title key stored in the ticket of a title folder.
+func loadTitleKey(path string, titleID uint64) (cipher.Block, error) {
+	decryptedTitleKey, err := decryptTitleKey(path, titleID)
+	if err != nil {
+		return nil, err
+	}
+	cipherHashTree, err := aes.NewCipher(decryptedTitleKey)
+	if err != nil {
+		return nil, wrapKind(ErrTicketUnavailable, fmt.Errorf("failed to create AES cipher: %w", err))
+	}
+	return cipherHashTree, nil
+}
+
+// decryptTitleKey returns the title key stored in the ticket of a title
+// folder, decrypted with the common key its common key index tells.
+func decryptTitleKey(path string, titleID uint64) ([]byte, error) {
 	// Find the encrypted titlekey
 	var encryptedTitleKey []byte
+	commonKeyIndex := CommonKeyIndexForTitle(titleID)
 
-	ticketPath := filepath.Join(path, "title.tik")
-
-	if _, err := os.Stat(ticketPath); err == nil {
-		cetk, err := os.Open(ticketPath)
-		if err == nil {
-			cetk.Seek(0x1BF, 0)
-			encryptedTitleKey = make([]byte, 0x10)
-			cetk.Read(encryptedTitleKey)
-			cetk.Close()
+	if ticketData, err := os.ReadFile(filepath.Join(path, "title.tik")); err == nil {
+		if ticket, err := tmd.UnmarshalTicket(ticketData); err == nil {
+			encryptedTitleKey = ticket.Header.TitleKey[:]
+			commonKeyIndex = ticket.Header.CommonKeyIndex
 		}
 	}
-	c, err := aes.NewCipher(commonKey)
+	titleCommonKey, err := getCommonKey(titleID, commonKeyIndex)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	c, err := aes.NewCipher(titleCommonKey)
+	if err != nil {
+		return nil, err
 	}
 
 	titleIDBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(titleIDBytes, tmd.TitleID)
+	binary.BigEndian.PutUint64(titleIDBytes, titleID)
 	cbc := cipher.NewCBCDecrypter(c, append(titleIDBytes, make([]byte, 8)...))
 
 	decryptedTitleKey := make([]byte, len(encryptedTitleKey))
 	cbc.CryptBlocks(decryptedTitleKey, encryptedTitleKey)
+	return decryptedTitleKey, nil
+}
 
-	cipherHashTree, err := aes.NewCipher(decryptedTitleKey)
-	if err != nil {
-		return fmt.Errorf("failed to create AES cipher: %w", err)
+// DecryptContents decrypts the title folder at path in place.
+func DecryptContents(path string, progressReporter ProgressReporter, deleteEncryptedContents bool) error {
+	return DecryptContentsTo(path, path, progressReporter, deleteEncryptedContents)
+}
+
+// DecryptContentsTo decrypts the title folder at path and writes the decrypted
+// files to decryptedPath, which can be on another drive.
+func DecryptContentsTo(path string, decryptedPath string, progressReporter ProgressReporter, deleteEncryptedContents bool) error {
+	policy := ENCRYPTED_CONTENTS_KEEP
+	if deleteEncryptedContents {
+		policy = ENCRYPTED_CONTENTS_DELETE
 	}
+	return DecryptContentsWithPolicy(path, decryptedPath, progressReporter, policy)
+}
 
-	fstEncFile, err := os.Open(filepath.Join(path, tmd.Contents[0].CIDStr+".app"))
+// DecryptContentsWithPolicy is DecryptContentsTo, doing what policy, one of
+// the ENCRYPTED_CONTENTS_* values, says to the encrypted contents once the
+// decrypted files matched their hashes.
+func DecryptContentsWithPolicy(path string, decryptedPath string, progressReporter ProgressReporter, policy string, options ...DecryptOption) error {
+	decryptOptions := DecryptOptions{}
+	for _, option := range options {
+		option(&decryptOptions)
+	}
+	if err := decryptContentsTo(path, decryptedPath, progressReporter, false, decryptOptions.RemoveStaleContents); err != nil {
+		return err
+	}
+	_, err := applyEncryptedContentsPolicy(longPath(path), policy)
+	return err
+}
+
+// decryptContentsTo decrypts the title folder at path to decryptedPath, leaving
+// its encrypted contents as they are, and flushes the decrypted files and
+// their folders to the disk when syncWrites is set. The contents of other
+// versions of the title are deleted first with removeStaleContents.
+func decryptContentsTo(path string, decryptedPath string, progressReporter ProgressReporter, syncWrites bool, removeStaleContents bool) error {
+	path = longPath(path)
+	decryptedPath = longPath(decryptedPath)
+	if err := checkContentVersionsBeforeDecryption(path, removeStaleContents); err != nil {
+		return err
+	}
+	tmd, cipherHashTree, fst, err := loadFST(path)
 	if err != nil {
 		return err
 	}
 
-	decryptedBuffer := bytes.Buffer{}
-	if err := decryptContentToBuffer(fstEncFile, &decryptedBuffer, cipherHashTree, tmd.Contents[0]); err != nil {
-		fstEncFile.Close()
+	if err := checkFSTPathLengths(decryptedPath, fst); err != nil {
 		return err
 	}
-	fstEncFile.Close()
-	fst := FSTData{FSTReader: bytes.NewReader(bytes.Clone(decryptedBuffer.Bytes())), FSTEntries: make([]FEntry, 0), EntryCount: 0, Entries: 0, NamesOffset: 0}
-	parseFST(&fst)
 
-	outputPath := path
+	if err := os.MkdirAll(decryptedPath, 0755); err != nil {
+		return checkDiskFull(err)
+	}
+
+	tasks := make([]decryptionTask, 0, fst.Entries)
+	h3Hashes := make(map[uint16][]byte) // by content index, loaded once per content
+	outputPath := decryptedPath
 	entry := make([]uint32, 0x10)
 	lEntry := make([]uint32, 0x10)
 	level := uint32(0)
 
 	for i := uint32(0); i < fst.Entries-1; i++ {
-		progressReporter.UpdateDecryptionProgress(float64(i) / float64(fst.Entries-1))
 		if level > 0 {
 			for (level >= 1) && (lEntry[level-1] == i+1) {
 				level--
@@ -501,41 +575,182 @@ func DecryptContents(path string, progressReporter ProgressReporter, deleteEncry
 			}
 		} else {
 			pathOffset := uint32(0)
-			outputPath = path
+			outputPath = decryptedPath
 			for j := uint32(0); j < level; j++ {
 				pathOffset = fst.FSTEntries[entry[j]].NameOffset & 0x00FFFFFF
 				fst.FSTReader.Seek(int64(fst.NamesOffset+pathOffset), io.SeekStart)
-				outputPath = filepath.Join(outputPath, readString(fst.FSTReader))
+				outputPath = filepath.Join(outputPath, SanitizeFilename(readString(fst.FSTReader)))
 				os.MkdirAll(outputPath, 0755)
 			}
 			pathOffset = fst.FSTEntries[i].NameOffset & 0x00FFFFFF
 			fst.FSTReader.Seek(int64(fst.NamesOffset+pathOffset), io.SeekStart)
-			outputPath = filepath.Join(outputPath, readString(fst.FSTReader))
+			outputPath = filepath.Join(outputPath, SanitizeFilename(readString(fst.FSTReader)))
 			contentOffset := uint64(fst.FSTEntries[i].Offset)
 			if fst.FSTEntries[i].Flags&4 == 0 {
 				contentOffset <<= 5
 			}
 			if fst.FSTEntries[i].Type&0x80 == 0 {
-				matchingContent := tmd.Contents[fst.FSTEntries[i].ContentID]
-				tmdFlags := matchingContent.Type
-				srcFile, err := os.Open(filepath.Join(path, matchingContent.CIDStr+".app"))
+				// The files are created here, the tasks only write into them
+				dst, err := os.Create(outputPath)
 				if err != nil {
-					return err
+					return checkDiskFull(fmt.Errorf(Localize("could not create '%s': %w"), outputPath, err))
 				}
-				if tmdFlags&0x02 != 0 {
-					err = extractFileHash(srcFile, 0, contentOffset, uint64(fst.FSTEntries[i].Length), outputPath, fst.FSTEntries[i].ContentID, cipherHashTree)
-				} else {
-					err = extractFile(srcFile, 0, contentOffset, uint64(fst.FSTEntries[i].Length), outputPath, fst.FSTEntries[i].ContentID, cipherHashTree)
-				}
-				srcFile.Close()
-				if err != nil {
-					return err
+				dst.Close()
+				matchingContent := tmd.Contents[fst.FSTEntries[i].ContentID]
+				hashed := matchingContent.Type&0x02 != 0
+				h3Data, loaded := h3Hashes[fst.FSTEntries[i].ContentID]
+				if hashed && !loaded {
+					if h3Data, err = loadH3(path, matchingContent); err != nil {
+						return err
+					}
+					h3Hashes[fst.FSTEntries[i].ContentID] = h3Data
 				}
+				tasks = appendDecryptionTasks(tasks, decryptionTask{
+					srcPath:    filepath.Join(path, matchingContent.CIDStr+".app"),
+					dstPath:    outputPath,
+					fileOffset: contentOffset,
+					size:       uint64(fst.FSTEntries[i].Length),
+					contentID:  fst.FSTEntries[i].ContentID,
+					content:    matchingContent,
+					h3Data:     h3Data,
+					hashed:     hashed,
+				})
 			}
 		}
 	}
-	if deleteEncryptedContents {
-		doDeleteEncryptedContents(path)
+
+	if err := runDecryptionTasks(tasks, cipherHashTree, progressReporter); err != nil {
+		// Never leave a decrypted file behind that is known to be corrupt
+		var hashTreeErr *HashTreeError
+		if errors.As(err, &hashTreeErr) && hashTreeErr.Path != "" {
+			os.Remove(hashTreeErr.Path)
+		}
+		return err
+	}
+	if syncWrites {
+		if err := syncDecryptedFiles(tasks); err != nil {
+			return err
+		}
+	}
+	learnTMDInfo(tmd)
+	learnTitleInfo(tmd.TitleID, decryptedPath)
+	return nil
+}
+
+// syncDecryptedFiles flushes the files written by tasks and the folders they
+// are in to the disk.
+func syncDecryptedFiles(tasks []decryptionTask) error {
+	synced := make(map[string]bool)
+	folders := make(map[string]bool)
+	for _, task := range tasks {
+		// Large files are decrypted by several tasks
+		if synced[task.dstPath] {
+			continue
+		}
+		synced[task.dstPath] = true
+		if err := syncFile(task.dstPath); err != nil {
+			return checkDiskFull(err)
+		}
+		folders[filepath.Dir(task.dstPath)] = true
+	}
+	for folder := range folders {
+		if err := syncDirectory(folder); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// decryptionSegmentSize is how much of a file with a hash tree a single task
+// decrypts, every block of those can be decrypted on its own.
+const decryptionSegmentSize = 256 * HASH_BLOCK_SIZE
+
+// decryptionTask decrypts size bytes from fileOffset of a content to offset in
+// the decrypted file.
+type decryptionTask struct {
+	srcPath    string
+	dstPath    string
+	offset     uint64
+	fileOffset uint64
+	size       uint64
+	contentID  uint16
+	content    Content
+	h3Data     []byte // nil for contents without a hash tree or an .h3 file
+	hashed     bool
+}
+
+// appendDecryptionTasks splits large files with a hash tree in segments, so they
+// are decrypted in parallel too. Files without one are chained with CBC and are
+// decrypted by a single task.
+func appendDecryptionTasks(tasks []decryptionTask, task decryptionTask) []decryptionTask {
+	if !task.hashed {
+		return append(tasks, task)
+	}
+	for offset := uint64(0); offset < task.size; offset += decryptionSegmentSize {
+		segment := task
+		segment.offset = offset
+		segment.fileOffset = task.fileOffset + offset
+		segment.size = min(decryptionSegmentSize, task.size-offset)
+		tasks = append(tasks, segment)
+	}
+	return tasks
+}
+
+func (t decryptionTask) run(cipherHashTree cipher.Block) error {
+	src, err := os.Open(t.srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(t.dstPath, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	dstWriter := io.NewOffsetWriter(dst, int64(t.offset))
+	if t.hashed {
+		err = extractFileHash(src, 0, t.fileOffset, t.size, dstWriter, t.dstPath, t.content, t.h3Data, cipherHashTree)
+	} else {
+		err = extractFile(src, 0, t.fileOffset, t.size, dstWriter, t.dstPath, t.contentID, cipherHashTree)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = checkDiskFull(closeErr)
+	}
+	return err
+}
+
+// runDecryptionTasks decrypts with as many workers as there are CPUs, as
+// decrypting and hashing is CPU-bound.
+func runDecryptionTasks(tasks []decryptionTask, cipherHashTree cipher.Block, progressReporter ProgressReporter) error {
+	var totalSize uint64
+	for _, task := range tasks {
+		totalSize += task.size
+	}
+
+	var progressMutex sync.Mutex
+	var decryptedSize uint64
+	progressReporter.SetPhase(PROGRESS_PHASE_DECRYPTING)
+	progressReporter.UpdateDecryptionProgress(0)
+
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for _, task := range tasks {
+		task := task
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := task.run(cipherHashTree); err != nil {
+				return err
+			}
+			progressMutex.Lock()
+			defer progressMutex.Unlock()
+			decryptedSize += task.size
+			if totalSize > 0 {
+				progressReporter.UpdateDecryptionProgress(float64(decryptedSize) / float64(totalSize))
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
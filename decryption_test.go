@@ -0,0 +1,267 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testContent is an encrypted content written to a temporary folder, with
+// the data it decrypts to.
+type testContent struct {
+	content Content
+	path    string // of the .app file
+	block   cipher.Block
+	data    []byte // decrypted, without the hashes of the blocks
+}
+
+func newTestTitleKey(t testing.TB) cipher.Block {
+	t.Helper()
+	key := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func randomTestData(t testing.TB, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func writeTestContentFile(t testing.TB, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestContent encrypts size bytes of random data like a content without
+// a hash tree.
+func writeTestContent(t testing.TB, size int) *testContent {
+	t.Helper()
+	block := newTestTitleKey(t)
+	data := randomTestData(t, size)
+	content := Content{ID: 1, Index: []byte{0, 1}, Size: uint64(size), CIDStr: "00000001"}
+	hash := sha1.Sum(data)
+	content.Hash = append(hash[:], make([]byte, 12)...)
+
+	encrypted := make([]byte, size)
+	cipher.NewCBCEncrypter(block, append(bytes.Clone(content.Index), make([]byte, 14)...)).CryptBlocks(encrypted, data)
+	path := writeTestContentFile(t, content.CIDStr+".app", encrypted)
+	return &testContent{content: content, path: path, block: block, data: data}
+}
+
+// sha1Levels returns the hashes of every group of 16 hashes of level, the
+// groups padded with zeros, which make the level above it.
+func sha1Levels(level [][]byte) [][]byte {
+	groups := make([][]byte, (len(level)+15)/16)
+	for i := range groups {
+		group := make([]byte, 16*0x14)
+		for j := 0; j < 16 && i*16+j < len(level); j++ {
+			copy(group[j*0x14:], level[i*16+j])
+		}
+		hash := sha1.Sum(group)
+		groups[i] = hash[:]
+	}
+	return groups
+}
+
+// hashGroup returns the 16 hashes of level in the group of index.
+func hashGroup(level [][]byte, index int) []byte {
+	group := make([]byte, 16*0x14)
+	for j := 0; j < 16 && index/16*16+j < len(level); j++ {
+		copy(group[j*0x14:], level[index/16*16+j])
+	}
+	return group
+}
+
+// writeTestHashedContent encrypts blocks blocks of random data like a content
+// with a hash tree, and writes its .h3 file next to it.
+func writeTestHashedContent(t testing.TB, blocks int) *testContent {
+	t.Helper()
+	block := newTestTitleKey(t)
+	data := randomTestData(t, blocks*HASH_BLOCK_SIZE)
+
+	h0 := make([][]byte, blocks)
+	for i := range h0 {
+		hash := sha1.Sum(data[i*HASH_BLOCK_SIZE : (i+1)*HASH_BLOCK_SIZE])
+		h0[i] = hash[:]
+	}
+	h1 := sha1Levels(h0)
+	h2 := sha1Levels(h1)
+	h3 := sha1Levels(h2)
+	h3Data := bytes.Join(h3, nil)
+
+	encrypted := make([]byte, blocks*BLOCK_SIZE_HASHED)
+	for i := 0; i < blocks; i++ {
+		hashes := make([]byte, HASHES_SIZE)
+		copy(hashes[0:0x140], hashGroup(h0, i))
+		copy(hashes[0x140:0x280], hashGroup(h1, i/16))
+		copy(hashes[0x280:0x3C0], hashGroup(h2, i/256))
+
+		blockData := encrypted[i*BLOCK_SIZE_HASHED : (i+1)*BLOCK_SIZE_HASHED]
+		cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(blockData[:HASHES_SIZE], hashes)
+		cipher.NewCBCEncrypter(block, h0[i][:aes.BlockSize]).CryptBlocks(blockData[HASHES_SIZE:], data[i*HASH_BLOCK_SIZE:(i+1)*HASH_BLOCK_SIZE])
+	}
+
+	content := Content{ID: 2, Index: []byte{0, 2}, Type: 0x2, Size: uint64(len(encrypted)), CIDStr: "00000002"}
+	hash := sha1.Sum(h3Data)
+	content.Hash = append(hash[:], make([]byte, 12)...)
+	path := writeTestContentFile(t, content.CIDStr+".app", encrypted)
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), content.CIDStr+".h3"), h3Data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &testContent{content: content, path: path, block: block, data: data}
+}
+
+func (c *testContent) decrypt(t testing.TB, w io.Writer) error {
+	t.Helper()
+	file, err := os.Open(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	return decryptContentToBuffer(file, w, c.block, c.content)
+}
+
+// withoutHashes drops the hashes of every block of a decrypted content with a
+// hash tree.
+func withoutHashes(decrypted []byte) []byte {
+	data := make([]byte, 0, len(decrypted))
+	for offset := 0; offset < len(decrypted); offset += BLOCK_SIZE_HASHED {
+		data = append(data, decrypted[offset+HASHES_SIZE:offset+BLOCK_SIZE_HASHED]...)
+	}
+	return data
+}
+
+func TestDecryptContentToBuffer(t *testing.T) {
+	t.Run("without hash tree", func(t *testing.T) {
+		content := writeTestContent(t, decryptionReadSize*2+0x1230)
+		var decrypted bytes.Buffer
+		if err := content.decrypt(t, &decrypted); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), content.data) {
+			t.Error("decrypted data differs")
+		}
+	})
+	t.Run("with hash tree", func(t *testing.T) {
+		// More than 16 blocks, for a second group of H0 hashes
+		content := writeTestHashedContent(t, 21)
+		var decrypted bytes.Buffer
+		if err := content.decrypt(t, &decrypted); err != nil {
+			t.Fatal(err)
+		}
+		if decrypted.Len() != int(content.content.Size) {
+			t.Fatalf("decrypted %d bytes, want %d", decrypted.Len(), content.content.Size)
+		}
+		if !bytes.Equal(withoutHashes(decrypted.Bytes()), content.data) {
+			t.Error("decrypted data differs")
+		}
+	})
+}
+
+func TestDecryptContentToBufferMismatch(t *testing.T) {
+	t.Run("without hash tree", func(t *testing.T) {
+		content := writeTestContent(t, 0x2000)
+		content.content.Hash[0] ^= 0xFF
+		if err := content.decrypt(t, io.Discard); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("error = %v, want ErrHashMismatch", err)
+		}
+	})
+	t.Run("with hash tree", func(t *testing.T) {
+		content := writeTestHashedContent(t, 18)
+		file, err := os.OpenFile(content.path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A byte of the data of block 17
+		if _, err := file.WriteAt([]byte{0xFF}, 17*BLOCK_SIZE_HASHED+0x5000); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		var hashTreeErr *HashTreeError
+		if err := content.decrypt(t, io.Discard); !errors.As(err, &hashTreeErr) {
+			t.Fatalf("error = %v, want a HashTreeError", err)
+		}
+		if hashTreeErr.Block != 17 || hashTreeErr.Level != HASH_LEVEL_H0 {
+			t.Errorf("failed at block %d level %s, want block 17 level H0", hashTreeErr.Block, hashTreeErr.Level)
+		}
+	})
+}
+
+func BenchmarkDecryptContentToBuffer(b *testing.B) {
+	for _, test := range []struct {
+		name    string
+		content *testContent
+	}{
+		{"without hash tree", writeTestContent(b, 64*BLOCK_SIZE)},
+		{"with hash tree", writeTestHashedContent(b, 32)},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			b.SetBytes(int64(test.content.content.Size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := test.content.decrypt(b, io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExtractFile(b *testing.B) {
+	content := writeTestContent(b, 64*BLOCK_SIZE)
+	file, err := os.Open(content.path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	size := uint64(len(content.data)) - 0x100
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := extractFile(file, 0, 0x100, size, io.Discard, "", 1, content.block); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtractFileHash(b *testing.B) {
+	content := writeTestHashedContent(b, 32)
+	file, err := os.Open(content.path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	h3Data, err := loadH3(filepath.Dir(content.path), content.content)
+	if err != nil {
+		b.Fatal(err)
+	}
+	size := uint64(len(content.data)) - 0x100
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := extractFileHash(file, 0, 0x100, size, io.Discard, "", content.content, h3Data, content.block); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Xpl0itU/WiiUDownloader/tmd"
+)
+
+// previousVersion is an older version of a title already on disk. The contents
+// it shares with the version being downloaded are taken from it instead of
+// being downloaded again.
+type previousVersion struct {
+	path     string
+	tmd      *TMD
+	titleKey []byte // encrypted title key of its ticket
+}
+
+func readTicketTitleKey(path string) []byte {
+	ticketData, err := os.ReadFile(filepath.Join(path, "title.tik"))
+	if err != nil {
+		return nil
+	}
+	ticket, err := tmd.UnmarshalTicket(ticketData)
+	if err != nil {
+		return nil
+	}
+	return bytes.Clone(ticket.Header.TitleKey[:])
+}
+
+// readPreviousVersion returns the version of titleID in the title folder at
+// path, nil when there is none or its encrypted contents aren't there anymore.
+func readPreviousVersion(path string, titleID uint64) *previousVersion {
+	previousTMD, err := readTMDFromDir(path)
+	if err != nil || previousTMD.TitleID != titleID {
+		return nil
+	}
+	if manifest, err := ReadManifest(path); err == nil && (manifest.Slimmed || manifest.EncryptedContentsDeleted) {
+		return nil
+	}
+	titleKey := readTicketTitleKey(path)
+	if titleKey == nil {
+		return nil
+	}
+	return &previousVersion{path: path, tmd: previousTMD, titleKey: titleKey}
+}
+
+// findPreviousVersion returns the newest version of titleID older than version
+// in the folders next to outputDir, where title folder templates with the
+// version put the other versions of the title.
+func findPreviousVersion(outputDir string, titleID uint64, version uint16) *previousVersion {
+	entries, err := os.ReadDir(filepath.Dir(outputDir))
+	if err != nil {
+		return nil
+	}
+	var newest *previousVersion
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == filepath.Base(outputDir) {
+			continue
+		}
+		previous := readPreviousVersion(filepath.Join(filepath.Dir(outputDir), entry.Name()), titleID)
+		if previous == nil || previous.tmd.TitleVersion >= version {
+			continue
+		}
+		if newest == nil || previous.tmd.TitleVersion > newest.tmd.TitleVersion {
+			newest = previous
+		}
+	}
+	return newest
+}
+
+// usableFor reports whether the contents of the previous version can be used
+// for newTMD: it must be older and encrypted with the same title key.
+func (p *previousVersion) usableFor(newTMD *TMD, titleKey []byte) bool {
+	return p.tmd.TitleVersion < newTMD.TitleVersion && bytes.Equal(p.titleKey, titleKey)
+}
+
+// findContent returns the name of the file of content in the previous version
+// when it has the same content, encrypted the same way.
+func (p *previousVersion) findContent(content Content) (string, bool) {
+	for _, previous := range p.tmd.Contents {
+		if previous.ID != content.ID {
+			continue
+		}
+		// Contents without a hash tree are encrypted with their index as IV
+		if previous.Type != content.Type || previous.Size != content.Size || !bytes.Equal(previous.Index, content.Index) || !bytes.Equal(previous.Hash, content.Hash) {
+			return "", false
+		}
+		return findContentFile(p.path, content.ID)
+	}
+	return "", false
+}
+
+// linkOrCopyFile hard links src to dst, or copies it when they are on
+// different drives or the filesystem has no hard links.
+func linkOrCopyFile(src, dst string) error {
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return checkDiskFull(err)
+	}
+	if err := dstFile.Sync(); err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// reusePreviousVersion puts the files of content in the title folder from the
+// previous version when it has the same content, instead of downloading them.
+// It reports whether it did, contents that don't pass verification when
+// verifyAfterWrite is set are downloaded again.
+func (cd *contentDownloader) reusePreviousVersion(content Content, outputDir string) (bool, error) {
+	if cd.previous == nil {
+		return false, nil
+	}
+	name, found := cd.previous.findContent(content)
+	if !found {
+		return false, nil
+	}
+	extensions := []string{".app"}
+	if content.Type&0x2 == 2 {
+		if verifyH3File(filepath.Join(cd.previous.path, name+".h3"), content) != nil {
+			return false, nil
+		}
+		extensions = append(extensions, ".h3")
+	}
+	info, err := os.Stat(filepath.Join(cd.previous.path, name+".app"))
+	if err != nil || checkContentSize(info.Size(), content) != nil {
+		return false, nil
+	}
+	if cd.verifyAfterWrite && cd.titleKey != nil {
+		if result := verifyContent(cd.previous.path, content, cd.titleKey); result.Err != nil {
+			return false, nil
+		}
+	}
+
+	for _, ext := range extensions {
+		src := filepath.Join(cd.previous.path, name+ext)
+		dstName := fmt.Sprintf("%08X%s", content.ID, ext)
+		dst := filepath.Join(outputDir, dstName)
+		if src != dst {
+			var err error
+			if cd.previous.path == outputDir {
+				err = os.Rename(src, dst)
+			} else {
+				err = linkOrCopyFile(src, dst)
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		info, err := os.Stat(dst)
+		if err != nil {
+			return false, err
+		}
+		cd.session.markDone(dstName, info.Size(), cd.verifyAfterWrite)
+		cd.progressReporter.SetTotalDownloadedForFile(dstName, info.Size())
+		cd.progressReporter.MarkFileAsDone(dstName)
+	}
+	return true, nil
+}
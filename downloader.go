@@ -1,15 +1,23 @@
 package wiiudownloader
 
 import (
+	"bufio"
+	"cmp"
 	"context"
+	"crypto/cipher"
+	"crypto/sha1"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	ctxio "github.com/jbenet/go-context/io"
@@ -21,6 +29,9 @@ const (
 	maxRetries             = 5
 	retryDelay             = 5 * time.Second
 	maxConcurrentDownloads = 4
+	pausePollInterval      = 500 * time.Millisecond
+	largeWriteBufferSize   = 4 * 1024 * 1024
+	largeCopyBufferSize    = 1024 * 1024
 )
 
 var (
@@ -33,82 +44,307 @@ type ProgressReporter interface {
 	UpdateDecryptionProgress(progress float64)
 	Cancelled() bool
 	SetCancelled()
+	Paused() bool
+	BandwidthLimit() int64 // bytes per second, 0 means unlimited
 	SetDownloadSize(size int64)
 	ResetTotals()
 	MarkFileAsDone(filename string)
 	SetTotalDownloadedForFile(filename string, downloaded int64)
 	SetStartTime(startTime time.Time)
+	SetPhase(phase ProgressPhase)
 }
 
-func downloadFileWithSemaphore(ctx context.Context, progressReporter ProgressReporter, client *http.Client, downloadURL, dstPath string, doRetries bool, sem *semaphore.Weighted) error {
-	if err := sem.Acquire(ctx, 1); err != nil {
+// ProgressPhase is what a download is busy with, so frontends can tell the
+// user more than the progress of the bytes.
+type ProgressPhase string
+
+const (
+	PROGRESS_PHASE_METADATA    ProgressPhase = "metadata" // the TMD, ticket and certificates
+	PROGRESS_PHASE_DOWNLOADING ProgressPhase = "downloading"
+	PROGRESS_PHASE_DECRYPTING  ProgressPhase = "decrypting"
+	PROGRESS_PHASE_ARCHIVING   ProgressPhase = "archiving" // packing the title folder, see WithArchiveOutput
+)
+
+// contentDownloader holds the state shared by the parallel content downloads of a title.
+type contentDownloader struct {
+	ctx              context.Context
+	progressReporter ProgressReporter
+	client           *http.Client
+	sem              *semaphore.Weighted
+	limiter          *BandwidthLimiter
+	sharedLimiter    *BandwidthLimiter // nil unless the title shares its bandwidth with others
+	session          *downloadSession
+	maxRetries       int
+	retryDelay       time.Duration
+	verifyAfterWrite bool
+	titleKey         cipher.Block // nil when the ticket can't be read, contents are then only checked when decrypted
+	// highPerformanceWrites writes contents in large chunks, which reduces
+	// sync stalls on spinning disks
+	highPerformanceWrites bool
+	previous              *previousVersion // nil unless incremental updates found an older version
+	store                 *contentStore    // nil without a content store
+	requestTimeout        time.Duration    // 0 never gives up on a silent request
+	stallTimeout          time.Duration    // 0 leaves a stalled transfer to requestTimeout
+	segments              int              // connections a large content is downloaded with
+}
+
+func openForResume(dstPath string, offset int64) (*os.File, error) {
+	if offset == 0 {
+		// The file may be hard linked to the content store or another version
+		// of the title, which must be left as they are
+		if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return os.Create(dstPath)
+	}
+	file, err := os.OpenFile(dstPath, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func hashFilePrefix(path string, length int64, hash io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
 		return err
 	}
-	defer sem.Release(1)
+	defer file.Close()
+	_, err = io.CopyN(hash, file, length)
+	return err
+}
+
+// retry reports whether a failed attempt is tried again, after waiting for the
+// retry delay.
+func (cd *contentDownloader) retry(doRetries bool, attempt int) bool {
+	if !doRetries || attempt >= cd.maxRetries || cd.progressReporter.Cancelled() {
+		return false
+	}
+	return sleepContext(cd.ctx, cd.retryDelay) == nil
+}
+
+// download fetches a file of the title, content is nil for files that are not a
+// content like the .h3 hash trees.
+func (cd *contentDownloader) download(downloadURL, dstPath string, doRetries bool, content *Content) error {
+	if err := cd.sem.Acquire(cd.ctx, 1); err != nil {
+		return err
+	}
+	defer cd.sem.Release(1)
 
 	basePath := filepath.Base(dstPath)
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		req := &http.Request{}
+	if size, ok := cd.session.completedFileSize(dstPath); ok {
+		cd.progressReporter.SetTotalDownloadedForFile(basePath, size)
+		cd.progressReporter.MarkFileAsDone(basePath)
+		return nil
+	}
+
+	if cd.isSegmented(content) {
+		if err := cd.downloadSegmented(downloadURL, dstPath, doRetries, content); err != errSingleConnection {
+			return err
+		}
+	}
+
+	for attempt := 1; attempt <= cd.maxRetries; attempt++ {
+		offset := cd.session.resumeOffset(dstPath)
+
+		req := &http.Request{Header: make(http.Header)}
 		parsedURL, err := url.Parse(downloadURL)
 		if err != nil {
 			return err
 		}
 		req.URL = parsedURL
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		// Cancelling the title, or the request receiving nothing for too
+		// long, aborts the request wherever it is
+		requestCtx, watchdog := newRequestWatchdog(cd.ctx, cd.requestTimeout, cd.stallTimeout, cd.progressReporter.Paused)
+		req = req.WithContext(requestCtx)
 
-		resp, err := client.Do(req)
+		resp, err := cd.client.Do(req)
 		if err != nil {
-			if doRetries && attempt < maxRetries && !progressReporter.Cancelled() {
-				time.Sleep(retryDelay)
+			watchdog.stop()
+			err = watchdog.err(err)
+			if cd.retry(doRetries, attempt) {
 				continue
 			}
 			return err
 		}
 
-		if resp.StatusCode != http.StatusOK {
+		switch resp.StatusCode {
+		case http.StatusOK:
+			offset = 0 // The server ignored the range, start over
+			cd.session.resetContent(basePath)
+		case http.StatusPartialContent:
+		default:
 			resp.Body.Close()
-			if doRetries && attempt < maxRetries && !progressReporter.Cancelled() {
-				time.Sleep(retryDelay)
+			watchdog.stop()
+			if cd.retry(doRetries, attempt) {
 				continue
 			}
-			return fmt.Errorf("download error after %d attempts, status code: %d", attempt, resp.StatusCode)
+			return wrapKind(ErrCDNStatus, fmt.Errorf(Localize("download error after %d attempts, status code: %d"), attempt, resp.StatusCode))
 		}
 
-		file, err := os.Create(dstPath)
+		file, err := openForResume(dstPath, offset)
 		if err != nil {
 			resp.Body.Close()
+			watchdog.stop()
 			return err
 		}
 
-		progressReporter.SetTotalDownloadedForFile(basePath, 0)
-		writerProgress := newWriterProgress(file, progressReporter, basePath)
-		writerProgressWithContext := ctxio.NewWriter(ctx, writerProgress)
-		bodyReaderWithContext := ctxio.NewReader(ctx, resp.Body)
-		_, err = io.Copy(writerProgressWithContext, bodyReaderWithContext)
+		receivedHash := sha1.New()
+		hashes := make([]io.Writer, 0, 2)
+		if cd.verifyAfterWrite {
+			hashes = append(hashes, receivedHash)
+		}
+		var hasher *contentHasher
+		var pieces *pieceTracker
+		if content != nil && content.Type&0x2 == 0 && cd.titleKey != nil {
+			hasher = newContentHasher(cd.titleKey, *content)
+			hashes = append(hashes, hasher)
+			// The size of the contents that can be checked is known up front
+			size := contentFileSize(*content)
+			pieces = newPieceTracker(cd.progressReporter, basePath, size, []ByteRange{{Start: offset, End: size}})
+		}
+		var writtenHash io.Writer
+		if len(hashes) > 0 {
+			writtenHash = io.MultiWriter(hashes...)
+			if offset > 0 {
+				if err := hashFilePrefix(dstPath, offset, writtenHash); err != nil {
+					file.Close()
+					resp.Body.Close()
+					watchdog.stop()
+					return err
+				}
+			}
+		}
+
+		if resp.ContentLength > 0 {
+			// Give the file its final size right away, so the OS can lay it out
+			// contiguously and users see its real size. Preallocating is best
+			// effort as not every filesystem supports it, the session keeps
+			// track of which bytes were actually written.
+			finalSize := offset + resp.ContentLength
+			preallocateFile(file, finalSize)
+			if err := file.Truncate(finalSize); err != nil {
+				file.Close()
+				resp.Body.Close()
+				watchdog.stop()
+				return err
+			}
+		}
+
+		// The session only records bytes once they reached the file, so that
+		// buffered bytes lost in a crash are downloaded again.
+		var fileWriter io.Writer = &sessionWriter{writer: file, file: file, session: cd.session, pieces: pieces, filename: basePath, offset: offset}
+		var buffers *transferBuffers
+		if cd.highPerformanceWrites {
+			// Once the memory budget is used up, the transfer goes without
+			buffers = getTransferBuffers(fileWriter, true)
+		}
+		var bufferedWriter *bufio.Writer
+		var copyBuffer []byte
+		if buffers != nil {
+			bufferedWriter = buffers.writer
+			fileWriter = bufferedWriter
+			copyBuffer = *buffers.copyBuffer
+		}
+
+		cd.progressReporter.SetTotalDownloadedForFile(basePath, offset)
+		writerProgress := newWriterProgress(fileWriter, cd.progressReporter, basePath)
+		writerProgress.limiter = cd.limiter
+		writerProgress.sharedLimiter = cd.sharedLimiter
+		writerProgress.hash = writtenHash
+		writerProgressWithContext := ctxio.NewWriter(requestCtx, writerProgress)
+		bodyReaderWithContext := ctxio.NewReader(requestCtx, watchdog.watch(resp.Body))
+		written, err := io.CopyBuffer(writerProgressWithContext, bodyReaderWithContext, copyBuffer)
+		watchdog.stop()
+		err = watchdog.err(err)
+		if bufferedWriter != nil {
+			// Flush even on errors, so a resumed download keeps what was received
+			if flushErr := bufferedWriter.Flush(); err == nil {
+				err = flushErr
+			}
+		}
+		buffers.release()
 		if err != nil {
 			file.Close()
 			resp.Body.Close()
 			writerProgress.Close()
-			if doRetries && attempt < maxRetries && !progressReporter.Cancelled() {
-				time.Sleep(retryDelay)
+			if err := checkDiskFull(err); errors.Is(err, ErrDiskFull) {
+				return err
+			}
+			if watchdog.hasStalled() && written > 0 && cd.ctx.Err() == nil {
+				// The connection went quiet after making progress, reconnect
+				// from where it stopped without using up an attempt
+				log.Printf("%s stalled at %d bytes for %s, reconnecting", basePath, offset+written, cd.stallTimeout)
+				attempt--
+				continue
+			}
+			if cd.retry(doRetries, attempt) {
 				continue
 			}
 			return err
 		}
+		// Drop what was preallocated past the data if the server sent less, and
+		// make sure the content is on disk before the session marks it as done
+		truncateErr := file.Truncate(offset + written)
+		if truncateErr == nil {
+			truncateErr = file.Sync()
+		}
 		file.Close()
 		resp.Body.Close()
 		writerProgress.Close()
-		progressReporter.MarkFileAsDone(basePath)
+		if truncateErr != nil {
+			return truncateErr
+		}
+		if hasher != nil {
+			pieces.setState(PIECE_VERIFYING)
+			if err := hasher.verify(dstPath); err != nil {
+				cd.session.resetContent(basePath)
+				if doRetries && attempt < cd.maxRetries && !cd.progressReporter.Cancelled() && cd.ctx.Err() == nil {
+					continue
+				}
+				return err
+			}
+		}
+		if cd.verifyAfterWrite {
+			if err := verifyWrittenFile(dstPath, receivedHash.Sum(nil)); err != nil {
+				return err
+			}
+		}
+		cd.session.markDone(basePath, offset+written, hasher != nil || cd.verifyAfterWrite)
+		pieces.setState(PIECE_COMPLETE)
+		cd.progressReporter.MarkFileAsDone(basePath)
 		break
 	}
 
 	return nil
 }
 
-func downloadFile(progressReporter ProgressReporter, client *http.Client, downloadURL, dstPath string, doRetries bool) error {
+// downloadFile fetches a small file of the title like its TMD or ticket, ctx
+// and requestTimeout abort it like the contents.
+func downloadFile(ctx context.Context, progressReporter ProgressReporter, client *http.Client, downloadURL, dstPath string, doRetries bool, requestTimeout time.Duration) error {
+	retry := func(attempt int) bool {
+		if !doRetries || attempt >= maxRetries || progressReporter.Cancelled() {
+			return false
+		}
+		return sleepContext(ctx, retryDelay) == nil
+	}
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		req, err := http.NewRequest("GET", downloadURL, nil)
+		requestCtx, watchdog := newRequestWatchdog(ctx, requestTimeout, 0, progressReporter.Paused)
+		req, err := http.NewRequestWithContext(requestCtx, "GET", downloadURL, nil)
 		if err != nil {
+			watchdog.stop()
 			return err
 		}
 
@@ -116,35 +352,41 @@ func downloadFile(progressReporter ProgressReporter, client *http.Client, downlo
 
 		resp, err := client.Do(req)
 		if err != nil {
-			if doRetries && attempt < maxRetries && !progressReporter.Cancelled() {
-				time.Sleep(retryDelay)
-				continue
+			watchdog.stop()
+			if err := watchdog.err(err); !retry(attempt) {
+				return err
 			}
-			return err
+			continue
 		}
 
 		if resp.StatusCode != http.StatusOK {
 			resp.Body.Close()
-			if doRetries && attempt < maxRetries && !progressReporter.Cancelled() {
-				time.Sleep(retryDelay)
+			watchdog.stop()
+			// Files the CDN doesn't have won't show up by trying again
+			if resp.StatusCode != http.StatusNotFound && retry(attempt) {
 				continue
 			}
-			return fmt.Errorf("download error after %d attempts, status code: %d", attempt, resp.StatusCode)
+			return newCDNStatusError(resp.StatusCode, fmt.Errorf(Localize("download error after %d attempts, status code: %d"), attempt, resp.StatusCode))
 		}
 
 		file, err := os.Create(dstPath)
 		if err != nil {
 			resp.Body.Close()
+			watchdog.stop()
 			return err
 		}
 
 		writerProgress := newWriterProgress(file, progressReporter, filepath.Base(dstPath))
-		_, err = io.Copy(writerProgress, resp.Body)
+		_, err = io.Copy(writerProgress, watchdog.watch(resp.Body))
+		watchdog.stop()
+		err = watchdog.err(err)
 		if err != nil {
 			file.Close()
 			resp.Body.Close()
-			if doRetries && attempt < maxRetries && !progressReporter.Cancelled() {
-				time.Sleep(retryDelay)
+			if err := checkDiskFull(err); errors.Is(err, ErrDiskFull) {
+				return err
+			}
+			if retry(attempt) {
 				continue
 			}
 			return err
@@ -157,7 +399,116 @@ func downloadFile(progressReporter ProgressReporter, client *http.Client, downlo
 	return nil
 }
 
-func DownloadTitle(titleID, outputDirectory string, doDecryption bool, progressReporter ProgressReporter, deleteEncryptedContents bool, client *http.Client) error {
+// tmdFilename is the name of the TMD of a version of a title on the CDN, of its
+// latest version when version is negative.
+func tmdFilename(version int) string {
+	if version < 0 {
+		return "tmd"
+	}
+	return fmt.Sprintf("tmd.%d", version)
+}
+
+func fetchTMD(client *http.Client, titleID string) (*TMD, error) {
+	return fetchTMDVersion(context.Background(), client, titleID, -1, 0, nil)
+}
+
+// fetchTMDVersion downloads and parses a TMD of a title, ctx and
+// requestTimeout abort it like the files of the title.
+func fetchTMDVersion(ctx context.Context, client *http.Client, titleID string, version int, requestTimeout time.Duration, paused func() bool) (*TMD, error) {
+	requestCtx, watchdog := newRequestWatchdog(ctx, requestTimeout, 0, paused)
+	defer watchdog.stop()
+	req, err := http.NewRequestWithContext(requestCtx, "GET", fmt.Sprintf("http://ccs.cdn.c.shop.nintendowifi.net/ccs/download/%s/%s", titleID, tmdFilename(version)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "WiiUDownloader")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, watchdog.err(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := newCDNStatusError(resp.StatusCode, fmt.Errorf(Localize("tmd download error, status code: %d"), resp.StatusCode))
+		if tid, parseErr := strconv.ParseUint(titleID, 16, 64); parseErr == nil {
+			err = checkNoUpdateAvailable(tid, err)
+		}
+		return nil, err
+	}
+
+	tmdData, err := io.ReadAll(watchdog.watch(resp.Body))
+	if err != nil {
+		return nil, watchdog.err(err)
+	}
+	return ParseTMD(tmdData)
+}
+
+// FetchTMD downloads and parses the TMD of a title, of its latest version when
+// version is negative.
+func FetchTMD(client *http.Client, titleID uint64, version int) (*TMD, error) {
+	return fetchTMDVersion(context.Background(), client, fmt.Sprintf("%016x", titleID), version, 0, nil)
+}
+
+// FetchTitleSize downloads the latest TMD of a title and returns the total size of its contents.
+func FetchTitleSize(client *http.Client, titleID uint64) (uint64, error) {
+	tmd, err := fetchTMD(client, fmt.Sprintf("%016x", titleID))
+	if err != nil {
+		return 0, err
+	}
+
+	var titleSize uint64
+	for i := 0; i < int(tmd.ContentCount); i++ {
+		titleSize += tmd.Contents[i].Size
+	}
+	return titleSize, nil
+}
+
+// FetchTitleVersion downloads the latest TMD of a title and returns its version.
+func FetchTitleVersion(client *http.Client, titleID uint64) (uint16, error) {
+	tmd, err := fetchTMD(client, fmt.Sprintf("%016x", titleID))
+	if err != nil {
+		return 0, err
+	}
+	return tmd.TitleVersion, nil
+}
+
+// DownloadTitle downloads a title to outputDirectory. With verifyAfterWrite every
+// content is read back from disk after it was written and compared to what was
+// received, highPerformanceWrites writes contents in large chunks which is faster
+// on spinning disks.
+//
+// Deprecated: use DownloadTitleWithOptions.
+func DownloadTitle(titleID, outputDirectory string, doDecryption bool, progressReporter ProgressReporter, deleteEncryptedContents bool, client *http.Client, verifyAfterWrite bool, highPerformanceWrites bool) error {
+	options := []DownloadTitleOption{
+		WithHTTPClient(client),
+		WithVerifyAfterWrite(verifyAfterWrite),
+		WithHighPerformanceWrites(highPerformanceWrites),
+	}
+	if doDecryption {
+		options = append(options, WithDecryption(deleteEncryptedContents))
+	}
+	return DownloadTitleWithOptions(titleID, outputDirectory, progressReporter, options...)
+}
+
+// DownloadTitleWithOptions downloads a title to outputDirectory, or to a folder
+// inside it when a title folder template is given.
+func DownloadTitleWithOptions(titleID, outputDirectory string, progressReporter ProgressReporter, options ...DownloadTitleOption) error {
+	downloadOptions := newDownloadTitleOptions(options)
+	ctx := context.Background()
+	if downloadOptions.TitleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, downloadOptions.TitleTimeout)
+		defer cancel()
+	}
+	err := downloadTitle(ctx, titleID, outputDirectory, progressReporter, downloadOptions)
+	return checkTitleTimeout(ctx, downloadOptions.TitleTimeout, err)
+}
+
+// downloadTitle downloads a title until ctx is done.
+func downloadTitle(ctx context.Context, titleID, outputDirectory string, progressReporter ProgressReporter, downloadOptions DownloadTitleOptions) error {
+	client := downloadOptions.Client
+
 	tid, err := strconv.ParseUint(titleID, 16, 64)
 	if err != nil {
 		return err
@@ -166,19 +517,43 @@ func DownloadTitle(titleID, outputDirectory string, doDecryption bool, progressR
 
 	progressReporter.ResetTotals()
 	progressReporter.SetGameTitle(tEntry.Name)
+	progressReporter.SetPhase(PROGRESS_PHASE_METADATA)
+
+	if downloadOptions.TitleDirTemplate != "" {
+		titleVersion := uint16(0)
+		if TitleDirTemplateUsesVersion(downloadOptions.TitleDirTemplate) {
+			tmd, err := fetchTMDVersion(ctx, client, titleID, downloadOptions.Version, downloadOptions.RequestTimeout, progressReporter.Paused)
+			if err != nil {
+				return err
+			}
+			titleVersion = tmd.TitleVersion
+		}
+		outputDirectory = filepath.Join(outputDirectory, FormatTitleDir(downloadOptions.TitleDirTemplate, tEntry, titleVersion))
+	}
 
-	outputDir := strings.TrimRight(outputDirectory, "/\\")
+	outputDir := longPath(strings.TrimRight(outputDirectory, "/\\"))
 	baseURL := fmt.Sprintf("http://ccs.cdn.c.shop.nintendowifi.net/ccs/download/%s", titleID)
 
 	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
 		return err
 	}
 
+	// The new TMD and ticket replace the ones of an older version downloaded
+	// to the same folder
+	var previous *previousVersion
+	if downloadOptions.IncrementalUpdates {
+		previous = readPreviousVersion(outputDir, tid)
+	}
+
 	tmdPath := filepath.Join(outputDir, "title.tmd")
-	if err := downloadFile(progressReporter, client, fmt.Sprintf("%s/%s", baseURL, "tmd"), tmdPath, true); err != nil {
+	if err := downloadFile(ctx, progressReporter, client, fmt.Sprintf("%s/%s", baseURL, tmdFilename(downloadOptions.Version)), tmdPath, true, downloadOptions.RequestTimeout); err != nil {
 		if progressReporter.Cancelled() {
 			return nil
 		}
+		err = checkNoUpdateAvailable(tid, err)
+		if errors.Is(err, ErrNoUpdateAvailable) {
+			os.Remove(outputDir) // only removed when empty, nothing was downloaded to it
+		}
 		return err
 	}
 
@@ -191,64 +566,161 @@ func DownloadTitle(titleID, outputDirectory string, doDecryption bool, progressR
 	if err != nil {
 		return err
 	}
+	learnTMDInfo(tmd)
 
 	tikPath := filepath.Join(outputDir, "title.tik")
-	if err := downloadFile(progressReporter, client, fmt.Sprintf("%s/%s", baseURL, "cetk"), tikPath, false); err != nil {
+	generateTicket := func() error {
+		titleKey, err := GetTicketTitleKey(tid)
+		if err != nil {
+			return err
+		}
+		return GenerateTicket(tikPath, tid, titleKey, tmd.TitleVersion)
+	}
+	ticketGenerated := false
+	if err := downloadFile(ctx, progressReporter, client, fmt.Sprintf("%s/%s", baseURL, "cetk"), tikPath, false, downloadOptions.RequestTimeout); err != nil {
 		if progressReporter.Cancelled() {
 			return nil
 		}
-		titleKey, err := GenerateKey(titleID)
-		if err != nil {
+		if err := generateTicket(); err != nil {
 			return err
 		}
-		if err := GenerateTicket(tikPath, tEntry.TitleID, titleKey, tmd.TitleVersion); err != nil {
-			return err
+		ticketGenerated = true
+	}
+
+	contents := tmd.Contents
+	if downloadOptions.ContentIDs != nil {
+		contents = make([]Content, 0, len(downloadOptions.ContentIDs))
+		for _, content := range tmd.Contents {
+			if slices.Contains(downloadOptions.ContentIDs, content.ID) {
+				contents = append(contents, content)
+			}
 		}
 	}
 
 	var titleSize uint64
 
-	for i := 0; i < int(tmd.ContentCount); i++ {
-		titleSize += tmd.Contents[i].Size
+	for _, content := range contents {
+		titleSize += content.Size
 	}
 
 	progressReporter.SetDownloadSize(int64(titleSize))
 
-	if err := GenerateCert(tmd, filepath.Join(outputDir, "title.cert"), progressReporter, client); err != nil {
+	if err := generateCert(ctx, tmd, filepath.Join(outputDir, "title.cert"), client, downloadOptions.RequestTimeout, progressReporter.Paused); err != nil {
 		if progressReporter.Cancelled() {
 			return nil
 		}
 		return err
 	}
 
-	g, ctx := errgroup.WithContext(context.Background())
-	g.SetLimit(maxConcurrentDownloads)
-	sem := semaphore.NewWeighted(maxConcurrentDownloads)
+	// Without a readable ticket the contents are only checked when they are decrypted
+	titleKey, _ := loadTitleKey(outputDir, tmd.TitleID)
+	if titleKey != nil {
+		if err := checkTitleKey(ctx, client, baseURL, tmd, titleKey, downloadOptions.RequestTimeout, progressReporter.Paused); err != nil {
+			// The ticket of the CDN can't decrypt the title, try a generated one
+			if ticketGenerated {
+				return err
+			}
+			if err := generateTicket(); err != nil {
+				return err
+			}
+			if titleKey, err = loadTitleKey(outputDir, tmd.TitleID); err != nil {
+				return err
+			}
+			if err := checkTitleKey(ctx, client, baseURL, tmd, titleKey, downloadOptions.RequestTimeout, progressReporter.Paused); err != nil {
+				return err
+			}
+		}
+	}
+
+	if downloadOptions.IncrementalUpdates {
+		if previous == nil {
+			previous = findPreviousVersion(outputDir, tid, tmd.TitleVersion)
+		}
+		if previous != nil && !previous.usableFor(tmd, readTicketTitleKey(outputDir)) {
+			previous = nil
+		}
+	}
+
+	// Without a ticket the contents of the store can't be encrypted for the title
+	titleKeyBytes, _ := decryptTitleKey(outputDir, tmd.TitleID)
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(downloadOptions.Concurrency)
+	downloader := &contentDownloader{
+		ctx:                   ctx,
+		progressReporter:      progressReporter,
+		client:                client,
+		sem:                   semaphore.NewWeighted(int64(downloadOptions.Concurrency)),
+		limiter:               newBandwidthLimiter(progressReporter),
+		sharedLimiter:         downloadOptions.SharedBandwidthLimiter,
+		session:               loadDownloadSession(outputDir, tmd.TitleVersion),
+		maxRetries:            downloadOptions.MaxRetries,
+		retryDelay:            downloadOptions.RetryDelay,
+		verifyAfterWrite:      downloadOptions.VerifyAfterWrite,
+		titleKey:              titleKey,
+		highPerformanceWrites: downloadOptions.HighPerformanceWrites,
+		previous:              previous,
+		store:                 newContentStore(downloadOptions.ContentStore, titleKeyBytes),
+		requestTimeout:        downloadOptions.RequestTimeout,
+		stallTimeout:          downloadOptions.StallTimeout,
+		segments:              downloadOptions.Segments,
+	}
+	downloader.session.syncFolder = downloadOptions.SyncWrites
+	progressReporter.SetPhase(PROGRESS_PHASE_DOWNLOADING)
 	progressReporter.SetStartTime(time.Now())
 
-	for i := 0; i < int(tmd.ContentCount); i++ {
-		i := i
-		g.Go(func() error {
-			filePath := filepath.Join(outputDir, fmt.Sprintf("%08X.app", tmd.Contents[i].ID))
-			if err := downloadFileWithSemaphore(ctx, progressReporter, client, fmt.Sprintf("%s/%08X", baseURL, tmd.Contents[i].ID), filePath, true, sem); err != nil {
+	downloadContent := func(content Content) error {
+		if reused, err := downloader.reusePreviousVersion(content, outputDir); err != nil || reused {
+			return err
+		}
+		if reused, err := downloader.reuseFromStore(content, outputDir); err != nil || reused {
+			return err
+		}
+		filePath := filepath.Join(outputDir, fmt.Sprintf("%08X.app", content.ID))
+		if err := downloader.download(fmt.Sprintf("%s/%08X", baseURL, content.ID), filePath, true, &content); err != nil {
+			if progressReporter.Cancelled() {
+				return errCancel
+			}
+			return err
+		}
+
+		if content.Type&0x2 == 2 { // has a hash
+			filePath = filepath.Join(outputDir, fmt.Sprintf("%08X.h3", content.ID))
+			if err := downloader.download(fmt.Sprintf("%s/%08X.h3", baseURL, content.ID), filePath, true, nil); err != nil {
 				if progressReporter.Cancelled() {
 					return errCancel
 				}
 				return err
 			}
-
-			if tmd.Contents[i].Type&0x2 == 2 { // has a hash
-				filePath = filepath.Join(outputDir, fmt.Sprintf("%08X.h3", tmd.Contents[i].ID))
-				if err := downloadFileWithSemaphore(ctx, progressReporter, client, fmt.Sprintf("%s/%08X.h3", baseURL, tmd.Contents[i].ID), filePath, true, sem); err != nil {
-					if progressReporter.Cancelled() {
-						return errCancel
-					}
+			if downloadOptions.VerifyAfterWrite && !downloader.session.isVerified(filepath.Base(filePath)) {
+				if err := verifyH3File(filePath, content); err != nil {
 					return err
 				}
+				downloader.session.markVerified(filepath.Base(filePath))
 			}
-			if progressReporter.Cancelled() {
-				return errCancel
+		}
+		if progressReporter.Cancelled() {
+			return errCancel
+		}
+		if downloader.store != nil {
+			// The store is only a cache, the title is complete without it
+			downloader.store.put(content, outputDir)
+		}
+		return nil
+	}
+
+	var failedContents []*ContentError
+	var failedMutex sync.Mutex
+	for i := range contents {
+		i := i
+		g.Go(func() error {
+			err := downloadContent(contents[i])
+			if err == nil || err == errCancel || !downloadOptions.ContinueOnContentFailure || errors.Is(err, ErrDiskFull) {
+				return err
 			}
+			failedMutex.Lock()
+			failedContents = append(failedContents, &ContentError{ContentID: contents[i].ID, Err: err})
+			failedMutex.Unlock()
 			return nil
 		})
 	}
@@ -260,11 +732,93 @@ func DownloadTitle(titleID, outputDirectory string, doDecryption bool, progressR
 		return err
 	}
 
-	if doDecryption && !progressReporter.Cancelled() {
-		if err := DecryptContents(outputDir, progressReporter, deleteEncryptedContents); err != nil {
+	manifest := newManifest(tmd)
+	manifest.Partial = len(contents) != len(tmd.Contents) || len(failedContents) > 0
+	if !manifest.Partial {
+		// The contents of another version downloaded to the same folder can't
+		// be decrypted with this TMD
+		if _, err := RemoveStaleContents(outputDir); err != nil {
+			return err
+		}
+	}
+	signatures := CheckTitleSignatures(outputDir)
+	manifest.TMDSignature, manifest.TicketSignature = signatures.TMD, signatures.Ticket
+	if err := WriteManifest(outputDir, manifest); err != nil {
+		return err
+	}
+	if downloadOptions.SyncWrites {
+		if err := syncTitleFiles(outputDir); err != nil {
+			return err
+		}
+	}
+
+	if len(failedContents) > 0 {
+		// The session is kept, downloading the title again only downloads
+		// the contents that failed
+		slices.SortFunc(failedContents, func(a, b *ContentError) int {
+			return cmp.Compare(a.ContentID, b.ContentID)
+		})
+		return &PartialDownloadError{TitleID: tmd.TitleID, Failed: failedContents}
+	}
+
+	// The decrypted files are spread over every content
+	if downloadOptions.Decrypt && !manifest.Partial && !progressReporter.Cancelled() {
+		decryptedDir := outputDir
+		if downloadOptions.DecryptedOutputDirectory != "" {
+			decryptedDir = filepath.Join(downloadOptions.DecryptedOutputDirectory, filepath.Base(outputDir))
+			manifest.DecryptedPath = decryptedDir
+		}
+		if err := decryptContentsTo(outputDir, decryptedDir, progressReporter, downloadOptions.SyncWrites, true); err != nil {
+			return err
+		}
+		manifest.Decrypted = true
+		archive, err := applyEncryptedContentsPolicy(outputDir, downloadOptions.EncryptedContentsPolicy)
+		if err != nil {
 			return err
 		}
+		manifest.EncryptedContentsDeleted = downloadOptions.EncryptedContentsPolicy != ENCRYPTED_CONTENTS_KEEP
+		manifest.EncryptedContentsArchive = archive
+		if downloadOptions.CemuMLCPath != "" {
+			if err := InstallToCemu(decryptedDir, downloadOptions.CemuMLCPath, tmd.TitleID); err != nil {
+				return err
+			}
+			manifest.CemuPath = CemuTitlePath(downloadOptions.CemuMLCPath, tmd.TitleID)
+		}
+		if err := WriteManifest(outputDir, manifest); err != nil {
+			return err
+		}
+		if downloadOptions.SyncWrites {
+			if err := syncTitleFiles(outputDir); err != nil {
+				return err
+			}
+		}
 	}
 
+	// The session is kept until the title is finished, so a crash while
+	// decrypting doesn't download the contents again
+	if err := downloader.session.remove(); err != nil {
+		return err
+	}
+	if downloadOptions.PostDownloadHook != "" && !progressReporter.Cancelled() {
+		if err := RunPostDownloadHook(downloadOptions.PostDownloadHook, outputDir); err != nil {
+			return err
+		}
+	}
+	if downloadOptions.ArchiveFormat != ARCHIVE_FORMAT_NONE && !progressReporter.Cancelled() {
+		return archiveTitleOutput(outputDir, manifest, downloadOptions.ArchiveFormat, progressReporter)
+	}
 	return nil
 }
+
+// archiveTitleOutput replaces the title folder at outputDir, and the folder of
+// its decrypted files when they were written elsewhere, with archives.
+func archiveTitleOutput(outputDir string, manifest *Manifest, format string, progressReporter ProgressReporter) error {
+	progressReporter.SetPhase(PROGRESS_PHASE_ARCHIVING)
+	if manifest.DecryptedPath != "" {
+		if _, err := archiveTitleWithManifest(manifest.DecryptedPath, manifest, format, true); err != nil {
+			return err
+		}
+	}
+	_, err := archiveTitleWithManifest(outputDir, manifest, format, true)
+	return err
+}
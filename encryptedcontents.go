@@ -0,0 +1,176 @@
+package wiiudownloader
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// What happens to the encrypted contents of a title once it was decrypted.
+const (
+	ENCRYPTED_CONTENTS_KEEP   = "keep"   // left where they are
+	ENCRYPTED_CONTENTS_DELETE = "delete" // deleted once the decrypted files matched their hashes
+	ENCRYPTED_CONTENTS_FOLDER = "folder" // moved to the encrypted subfolder of the title folder
+	ENCRYPTED_CONTENTS_ZIP    = "zip"    // moved to encrypted.zip in the title folder
+)
+
+const (
+	encryptedContentsFolder = "encrypted"
+	encryptedContentsZip    = "encrypted.zip"
+)
+
+// EncryptedContentsPolicies are the valid encrypted contents policies, in the
+// order frontends list them.
+var EncryptedContentsPolicies = []string{ENCRYPTED_CONTENTS_KEEP, ENCRYPTED_CONTENTS_DELETE, ENCRYPTED_CONTENTS_FOLDER, ENCRYPTED_CONTENTS_ZIP}
+
+// ParseEncryptedContentsPolicy checks that value is one of the
+// ENCRYPTED_CONTENTS_* values, an empty value keeps the encrypted contents.
+func ParseEncryptedContentsPolicy(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ENCRYPTED_CONTENTS_KEEP, nil
+	}
+	for _, policy := range EncryptedContentsPolicies {
+		if value == policy {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf(Localize("unknown encrypted contents policy %q, expected one of %s"), value, strings.Join(EncryptedContentsPolicies, ", "))
+}
+
+// encryptedContentFiles returns the names of the .app and .h3 files of the
+// title folder at path.
+func encryptedContentFiles(path string) ([]string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.Type().IsRegular() && (ext == ".app" || ext == ".h3") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// applyEncryptedContentsPolicy does what policy says to the encrypted contents
+// of the title folder at path, which was just decrypted, and returns the
+// subfolder or zip file they were moved to, if any. The title.tmd, title.tik
+// and title.cert are only deleted with ENCRYPTED_CONTENTS_DELETE, so the
+// archived contents can still be installed once put back.
+func applyEncryptedContentsPolicy(path, policy string) (string, error) {
+	switch policy {
+	case ENCRYPTED_CONTENTS_DELETE:
+		return "", doDeleteEncryptedContents(path)
+	case ENCRYPTED_CONTENTS_FOLDER:
+		return encryptedContentsFolder, moveEncryptedContentsToFolder(path)
+	case ENCRYPTED_CONTENTS_ZIP:
+		return encryptedContentsZip, moveEncryptedContentsToZip(path)
+	default:
+		return "", nil
+	}
+}
+
+// moveEncryptedContentsToFolder moves the encrypted contents of the title
+// folder at path to its encrypted subfolder.
+func moveEncryptedContentsToFolder(path string) error {
+	names, err := encryptedContentFiles(path)
+	if err != nil {
+		return err
+	}
+	folder := filepath.Join(path, encryptedContentsFolder)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return checkDiskFull(err)
+	}
+	for _, name := range names {
+		dst := filepath.Join(folder, name)
+		// Renaming over a file fails on Windows
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Rename(filepath.Join(path, name), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveEncryptedContentsToZip stores the encrypted contents of the title folder
+// at path in its encrypted.zip, replacing the one already there, then deletes
+// them. They are stored uncompressed, encrypted data doesn't compress.
+func moveEncryptedContentsToZip(path string) error {
+	names, err := encryptedContentFiles(path)
+	if err != nil {
+		return err
+	}
+	zipPath := filepath.Join(path, encryptedContentsZip)
+	partPath := zipPath + ".part"
+	if err := writeEncryptedContentsZip(path, partPath, names); err != nil {
+		os.Remove(partPath)
+		return checkDiskFull(err)
+	}
+	if err := syncFile(partPath); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if err := os.Remove(zipPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(partPath, zipPath); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(path, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeEncryptedContentsZip(path, zipPath string, names []string) error {
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer zipFile.Close()
+
+	zipWriter := zip.NewWriter(zipFile)
+	for _, name := range names {
+		if err := addFileToZip(zipWriter, filepath.Join(path, name), name); err != nil {
+			return err
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	return zipFile.Close()
+}
+
+func addFileToZip(zipWriter *zip.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
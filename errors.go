@@ -0,0 +1,131 @@
+package wiiudownloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The errors returned by the library wrap one of these when the failure is of
+// a known kind, so callers can check it with errors.Is and offer a way to
+// recover instead of only showing the message.
+var (
+	// ErrCDNStatus is wrapped when the CDN answers with an unexpected status code.
+	ErrCDNStatus = errors.New("unexpected status code from the CDN")
+	// ErrTicketUnavailable is wrapped when a ticket can't be downloaded or read.
+	ErrTicketUnavailable = errors.New("ticket unavailable")
+	// ErrHashMismatch is wrapped when downloaded or decrypted data doesn't match its hash.
+	ErrHashMismatch = errors.New("hash mismatch")
+	// ErrDiskFull is wrapped when there is no space left to write to.
+	ErrDiskFull = errors.New("not enough disk space")
+	// ErrNoUpdateAvailable is wrapped when the CDN has no TMD for an update,
+	// as no update was ever published for the game.
+	ErrNoUpdateAvailable = errors.New("no update available")
+	// ErrTimeout is wrapped when a request received nothing for the request
+	// timeout, or a title wasn't downloaded within the title timeout.
+	ErrTimeout = errors.New("download timed out")
+)
+
+// kindError keeps the message of err while matching kind too.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+func wrapKind(kind error, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// cdnStatusError is an ErrCDNStatus failure that keeps its status code.
+type cdnStatusError struct {
+	statusCode int
+	err        error
+}
+
+func (e *cdnStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *cdnStatusError) Unwrap() []error {
+	return []error{ErrCDNStatus, e.err}
+}
+
+func newCDNStatusError(statusCode int, err error) error {
+	return &cdnStatusError{statusCode: statusCode, err: err}
+}
+
+// isNotFound reports whether err is the CDN answering that a file doesn't exist.
+func isNotFound(err error) bool {
+	var statusErr *cdnStatusError
+	return errors.As(err, &statusErr) && statusErr.statusCode == http.StatusNotFound
+}
+
+// checkNoUpdateAvailable turns the CDN not having the TMD of an update into
+// ErrNoUpdateAvailable, it only has TMDs for the updates that were published.
+func checkNoUpdateAvailable(titleID uint64, err error) error {
+	if !IsUpdate(titleID) || !isNotFound(err) {
+		return err
+	}
+	return wrapKind(ErrNoUpdateAvailable, fmt.Errorf(Localize("no update is available for %016x"), titleID))
+}
+
+// checkDiskFull wraps err with ErrDiskFull when it was caused by the disk
+// running out of space.
+func checkDiskFull(err error) error {
+	if err != nil && isDiskFullError(err) {
+		return wrapKind(ErrDiskFull, err)
+	}
+	return err
+}
+
+// ContentError is the final failure of a content of a title, once its retries
+// were used up.
+type ContentError struct {
+	ContentID uint32
+	Err       error
+}
+
+func (e *ContentError) Error() string {
+	return fmt.Sprintf("%08X: %v", e.ContentID, e.Err)
+}
+
+func (e *ContentError) Unwrap() error {
+	return e.Err
+}
+
+// PartialDownloadError is returned when downloading a title with
+// WithContinueOnContentFailure and some of its contents failed. Every other
+// content was downloaded, the failed ones are downloaded by downloading the
+// title again or repairing it once verified.
+type PartialDownloadError struct {
+	TitleID uint64
+	Failed  []*ContentError // sorted by content ID
+}
+
+func (e *PartialDownloadError) Error() string {
+	failed := make([]string, 0, len(e.Failed))
+	for _, contentErr := range e.Failed {
+		failed = append(failed, contentErr.Error())
+	}
+	return fmt.Sprintf(Localize("%d contents of %016x failed to download: %s"), len(e.Failed), e.TitleID, strings.Join(failed, "; "))
+}
+
+func (e *PartialDownloadError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, contentErr := range e.Failed {
+		errs = append(errs, contentErr)
+	}
+	return errs
+}
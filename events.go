@@ -0,0 +1,221 @@
+package wiiudownloader
+
+import (
+	"sync"
+	"time"
+)
+
+type ProgressEventType int
+
+const (
+	PROGRESS_EVENT_TITLE_STARTED ProgressEventType = iota
+	PROGRESS_EVENT_FILE_STARTED
+	PROGRESS_EVENT_PROGRESS
+	PROGRESS_EVENT_DECRYPTION_PROGRESS
+	PROGRESS_EVENT_FILE_DONE
+	PROGRESS_EVENT_TITLE_DONE
+	PROGRESS_EVENT_ERROR
+	PROGRESS_EVENT_PHASE
+)
+
+func (t ProgressEventType) String() string {
+	switch t {
+	case PROGRESS_EVENT_TITLE_STARTED:
+		return "TitleStarted"
+	case PROGRESS_EVENT_FILE_STARTED:
+		return "FileStarted"
+	case PROGRESS_EVENT_PROGRESS:
+		return "Progress"
+	case PROGRESS_EVENT_DECRYPTION_PROGRESS:
+		return "DecryptionProgress"
+	case PROGRESS_EVENT_FILE_DONE:
+		return "FileDone"
+	case PROGRESS_EVENT_TITLE_DONE:
+		return "TitleDone"
+	case PROGRESS_EVENT_ERROR:
+		return "Error"
+	case PROGRESS_EVENT_PHASE:
+		return "Phase"
+	}
+	return "Unknown"
+}
+
+// ProgressEvent is sent by an EventReporter, only the fields relevant to its
+// type are set.
+type ProgressEvent struct {
+	Type               ProgressEventType
+	Title              string
+	Phase              ProgressPhase
+	Filename           string
+	FileDownloaded     int64 // bytes of Filename downloaded so far
+	TotalDownloaded    int64 // bytes of the title downloaded so far
+	TotalSize          int64
+	DecryptionProgress float64 // from 0 to 1
+	Err                error
+}
+
+// EventReporter is a ProgressReporter that turns the progress of a download into
+// ProgressEvents sent to a channel, for frontends that would rather consume a
+// stream of events than implement ProgressReporter. Sending blocks, so the
+// channel must be drained while downloading.
+type EventReporter struct {
+	events          chan<- ProgressEvent
+	mutex           sync.Mutex
+	title           string
+	phase           ProgressPhase
+	cancelled       bool
+	paused          bool
+	bandwidthLimit  int64
+	totalSize       int64
+	totalDownloaded int64 // bytes of the files that are done
+	progressPerFile map[string]int64
+}
+
+func NewEventReporter(events chan<- ProgressEvent) *EventReporter {
+	return &EventReporter{events: events, progressPerFile: make(map[string]int64)}
+}
+
+// newEvent must be called with the mutex held.
+func (r *EventReporter) newEvent(eventType ProgressEventType, filename string) ProgressEvent {
+	totalDownloaded := r.totalDownloaded
+	for _, downloaded := range r.progressPerFile {
+		totalDownloaded += downloaded
+	}
+	return ProgressEvent{
+		Type:            eventType,
+		Title:           r.title,
+		Phase:           r.phase,
+		Filename:        filename,
+		FileDownloaded:  r.progressPerFile[filename],
+		TotalDownloaded: totalDownloaded,
+		TotalSize:       r.totalSize,
+	}
+}
+
+func (r *EventReporter) SetGameTitle(title string) {
+	r.mutex.Lock()
+	r.title = title
+	event := r.newEvent(PROGRESS_EVENT_TITLE_STARTED, "")
+	r.mutex.Unlock()
+	r.events <- event
+}
+
+func (r *EventReporter) UpdateDownloadProgress(downloaded int64, filename string) {
+	r.mutex.Lock()
+	_, started := r.progressPerFile[filename]
+	r.progressPerFile[filename] += downloaded
+	events := make([]ProgressEvent, 0, 2)
+	if !started {
+		events = append(events, r.newEvent(PROGRESS_EVENT_FILE_STARTED, filename))
+	}
+	events = append(events, r.newEvent(PROGRESS_EVENT_PROGRESS, filename))
+	r.mutex.Unlock()
+	for _, event := range events {
+		r.events <- event
+	}
+}
+
+func (r *EventReporter) UpdateDecryptionProgress(progress float64) {
+	r.mutex.Lock()
+	event := r.newEvent(PROGRESS_EVENT_DECRYPTION_PROGRESS, "")
+	r.mutex.Unlock()
+	event.DecryptionProgress = progress
+	r.events <- event
+}
+
+func (r *EventReporter) Cancelled() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cancelled
+}
+
+func (r *EventReporter) SetCancelled() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cancelled = true
+}
+
+func (r *EventReporter) Paused() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.paused
+}
+
+func (r *EventReporter) SetPaused(paused bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.paused = paused
+}
+
+func (r *EventReporter) BandwidthLimit() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.bandwidthLimit
+}
+
+// SetBandwidthLimit limits the download speed in bytes per second, 0 means unlimited.
+func (r *EventReporter) SetBandwidthLimit(limit int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.bandwidthLimit = limit
+}
+
+func (r *EventReporter) SetDownloadSize(size int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.totalSize = size
+}
+
+func (r *EventReporter) ResetTotals() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.totalSize = 0
+	r.totalDownloaded = 0
+	r.progressPerFile = make(map[string]int64)
+}
+
+func (r *EventReporter) MarkFileAsDone(filename string) {
+	r.mutex.Lock()
+	event := r.newEvent(PROGRESS_EVENT_FILE_DONE, filename)
+	r.totalDownloaded += r.progressPerFile[filename]
+	delete(r.progressPerFile, filename)
+	r.mutex.Unlock()
+	r.events <- event
+}
+
+func (r *EventReporter) SetTotalDownloadedForFile(filename string, downloaded int64) {
+	r.mutex.Lock()
+	_, started := r.progressPerFile[filename]
+	r.progressPerFile[filename] = downloaded
+	event := r.newEvent(PROGRESS_EVENT_FILE_STARTED, filename)
+	r.mutex.Unlock()
+	if !started {
+		r.events <- event
+	}
+}
+
+func (r *EventReporter) SetStartTime(startTime time.Time) {}
+
+func (r *EventReporter) SetPhase(phase ProgressPhase) {
+	r.mutex.Lock()
+	r.phase = phase
+	event := r.newEvent(PROGRESS_EVENT_PHASE, "")
+	r.mutex.Unlock()
+	r.events <- event
+}
+
+// DownloadTitle downloads a title like DownloadTitleWithOptions, and ends its
+// events with a TitleDone or an Error event.
+func (r *EventReporter) DownloadTitle(titleID, outputDirectory string, options ...DownloadTitleOption) error {
+	err := DownloadTitleWithOptions(titleID, outputDirectory, r, options...)
+
+	r.mutex.Lock()
+	event := r.newEvent(PROGRESS_EVENT_TITLE_DONE, "")
+	r.mutex.Unlock()
+	if err != nil {
+		event.Type = PROGRESS_EVENT_ERROR
+		event.Err = err
+	}
+	r.events <- event
+	return err
+}
@@ -0,0 +1,92 @@
+package wiiudownloader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type ExportedTitle struct {
+	Name        string `json:"name"`
+	TitleID     string `json:"titleID"`
+	Region      string `json:"region"`
+	Kind        string `json:"kind"`
+	Size        uint64 `json:"size,omitempty"`
+	ProductCode string `json:"productCode,omitempty"`
+	OSVersion   string `json:"osVersion,omitempty"` // OS version the title needs, OSv10
+	Genre       string `json:"genre,omitempty"`
+	Players     uint8  `json:"players,omitempty"`   // most players at once
+	Languages   string `json:"languages,omitempty"` // EN, FR, ES
+}
+
+func newExportedTitles(entries []TitleEntry, sizes map[uint64]uint64) []ExportedTitle {
+	exported := make([]ExportedTitle, 0, len(entries))
+	for _, entry := range entries {
+		info, _ := GetTitleInfo(entry.TitleID)
+		exported = append(exported, ExportedTitle{
+			Name:        entry.Name,
+			TitleID:     fmt.Sprintf("%016x", entry.TitleID),
+			Region:      GetFormattedRegion(entry.Region),
+			Kind:        GetFormattedKind(entry.TitleID),
+			Size:        sizes[entry.TitleID],
+			ProductCode: info.ProductCode,
+			OSVersion:   GetFormattedRequiredOSVersion(entry.TitleID),
+			Genre:       info.Genre,
+			Players:     info.Players,
+			Languages:   GetFormattedLanguages(info.Languages),
+		})
+	}
+	return exported
+}
+
+// ExportTitlesJSON writes the given titles as a JSON array. Sizes are optional and
+// only written for the titles present in the map.
+func ExportTitlesJSON(w io.Writer, entries []TitleEntry, sizes map[uint64]uint64) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newExportedTitles(entries, sizes))
+}
+
+func ExportTitlesCSV(w io.Writer, entries []TitleEntry, sizes map[uint64]uint64) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write([]string{"name", "titleID", "region", "kind", "size"}); err != nil {
+		return err
+	}
+	for _, title := range newExportedTitles(entries, sizes) {
+		size := ""
+		if title.Size != 0 {
+			size = strconv.FormatUint(title.Size, 10)
+		}
+		if err := csvWriter.Write([]string{title.Name, title.TitleID, title.Region, title.Kind, size}); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// ExportTitlesToFile picks the export format from the file extension (.json or .csv).
+func ExportTitlesToFile(path string, entries []TitleEntry, sizes map[uint64]uint64) error {
+	var export func(io.Writer, []TitleEntry, map[uint64]uint64) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		export = ExportTitlesJSON
+	case ".csv":
+		export = ExportTitlesCSV
+	default:
+		return fmt.Errorf(Localize("unsupported export format: %s"), filepath.Ext(path))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return export(file, entries, sizes)
+}
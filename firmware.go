@@ -0,0 +1,155 @@
+package wiiudownloader
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const firmwareInstallOrderFilename = "install_order.txt"
+
+func firmwareInstallStage(titleID uint64) int {
+	switch TIDHigh(titleID) {
+	case TID_HIGH_SYSTEM_DATA:
+		return 0
+	case TID_HIGH_SYSTEM_APP:
+		return 1
+	case TID_HIGH_SYSTEM_APPLET:
+		return 2
+	default: // vWii titles go last
+		return 3
+	}
+}
+
+// GetFirmwareTitles returns the system titles of a region in install order:
+// system data first, then system applications (OS and IOSU come first as they
+// have the lowest title IDs), applets and finally the vWii titles.
+func GetFirmwareTitles(region uint8) []TitleEntry {
+	titles := make([]TitleEntry, 0)
+	for _, entry := range getAllTitleEntries() {
+		if IsSystemTitle(entry.TitleID) && entry.Region&region != 0 {
+			titles = append(titles, entry)
+		}
+	}
+
+	sort.SliceStable(titles, func(i, j int) bool {
+		stageI, stageJ := firmwareInstallStage(titles[i].TitleID), firmwareInstallStage(titles[j].TitleID)
+		if stageI != stageJ {
+			return stageI < stageJ
+		}
+		return titles[i].TitleID < titles[j].TitleID
+	})
+	return titles
+}
+
+// firmwareVersionsFilename lists the title IDs and versions of a downloaded
+// system version, ReadFirmwareVersions reads it back to download it again.
+const firmwareVersionsFilename = "versions.txt"
+
+// ReadFirmwareVersions reads the system titles of a system version from a text
+// file, one title ID and version by line like "0005001010041000 v96", as in
+// the versions.txt DownloadFirmware writes. Empty lines and the ones starting
+// with # are skipped.
+func ReadFirmwareVersions(path string) (map[uint64]uint16, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[uint64]uint16)
+	for number, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(Localize("%s line %d: expected a title ID and a version"), path, number+1)
+		}
+		titleID, err := ParseTitleID(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf(Localize("%s line %d: %w"), path, number+1, err)
+		}
+		version, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(fields[1]), "v"), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf(Localize("%s line %d: invalid version %q"), path, number+1, fields[1])
+		}
+		versions[titleID] = uint16(version)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf(Localize("%s doesn't list any system title"), path)
+	}
+	return versions, nil
+}
+
+// firmwareTitleIDs returns the title IDs of the system titles to download, in
+// install order: the ones of the region, or the ones of versions.
+func firmwareTitleIDs(region uint8, versions map[uint64]uint16) []uint64 {
+	titleIDs := make([]uint64, 0)
+	if versions == nil {
+		for _, title := range GetFirmwareTitles(region) {
+			titleIDs = append(titleIDs, title.TitleID)
+		}
+		return titleIDs
+	}
+	for titleID := range versions {
+		titleIDs = append(titleIDs, titleID)
+	}
+	sort.Slice(titleIDs, func(i, j int) bool {
+		stageI, stageJ := firmwareInstallStage(titleIDs[i]), firmwareInstallStage(titleIDs[j])
+		if stageI != stageJ {
+			return stageI < stageJ
+		}
+		return titleIDs[i] < titleIDs[j]
+	})
+	return titleIDs
+}
+
+// DownloadFirmware downloads the latest version of every system title of a region,
+// or the titles of a system version with WithFirmwareVersions, each one into a
+// folder named after its title ID. It writes the order in which they have to be
+// installed to install_order.txt, and the versions it downloaded to versions.txt.
+func DownloadFirmware(outputDirectory string, region uint8, progressReporter ProgressReporter, client *http.Client, options ...FirmwareOption) error {
+	firmwareOptions := FirmwareOptions{}
+	for _, option := range options {
+		option(&firmwareOptions)
+	}
+	titleIDs := firmwareTitleIDs(region, firmwareOptions.TitleVersions)
+	if len(titleIDs) == 0 {
+		return fmt.Errorf(Localize("no system titles found for region %s"), GetFormattedRegion(region))
+	}
+
+	if err := os.MkdirAll(outputDirectory, os.ModePerm); err != nil {
+		return err
+	}
+
+	installOrder := make([]string, 0, len(titleIDs))
+	for _, titleID := range titleIDs {
+		installOrder = append(installOrder, fmt.Sprintf("%016x", titleID))
+	}
+	if err := os.WriteFile(filepath.Join(outputDirectory, firmwareInstallOrderFilename), []byte(strings.Join(installOrder, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+
+	downloaded := make([]string, 0, len(titleIDs))
+	for i, tid := range installOrder {
+		if progressReporter.Cancelled() {
+			return nil
+		}
+		titlePath := filepath.Join(outputDirectory, tid)
+		downloadOptions := []DownloadTitleOption{WithHTTPClient(client)}
+		if version, ok := firmwareOptions.TitleVersions[titleIDs[i]]; ok {
+			downloadOptions = append(downloadOptions, WithVersion(version))
+		}
+		if err := DownloadTitleWithOptions(tid, titlePath, progressReporter, downloadOptions...); err != nil {
+			return fmt.Errorf(Localize("failed to download system title %s: %w"), tid, err)
+		}
+		if tmd, err := readTMDFromDir(titlePath); err == nil {
+			downloaded = append(downloaded, fmt.Sprintf("%s v%d", tid, tmd.TitleVersion))
+		}
+	}
+	return os.WriteFile(filepath.Join(outputDirectory, firmwareVersionsFilename), []byte(strings.Join(downloaded, "\n")+"\n"), 0644)
+}
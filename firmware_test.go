@@ -0,0 +1,39 @@
+package wiiudownloader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadFirmwareVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "versions.txt")
+	data := "# 5.5.6U\n0005001010041000 v96\n\n0005001B10042000 v32\n00050030-1001000A 4096\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := ReadFirmwareVersions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]uint16{0x0005001010041000: 96, 0x0005001b10042000: 32, 0x000500301001000a: 4096}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("versions = %x, want %x", versions, want)
+	}
+
+	// Installed system data first, then the applications and the applets
+	order := firmwareTitleIDs(MCP_REGION_USA, versions)
+	if wantOrder := []uint64{0x0005001b10042000, 0x0005001010041000, 0x000500301001000a}; !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("install order = %x, want %x", order, wantOrder)
+	}
+
+	for _, data := range []string{"", "# nothing\n", "0005001010041000\n", "0005001010041000 v70000\n", "notatitle v1\n"} {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadFirmwareVersions(path); err == nil {
+			t.Errorf("ReadFirmwareVersions(%q) succeeded", data)
+		}
+	}
+}
@@ -4,9 +4,33 @@ go 1.21
 
 require (
 	github.com/Xpl0itU/dialog v0.0.0-20230805114139-ec888310aded
+	github.com/bodgit/sevenzip v1.6.0
 	github.com/dustin/go-humanize v1.0.1
+	github.com/gdamore/tcell/v2 v2.8.1
 	github.com/gotk3/gotk3 v0.6.5-0.20240618185848-ff349ae13f56
-	golang.org/x/crypto v0.24.0
+	github.com/mattn/go-runewidth v0.0.16
+	golang.org/x/crypto v0.26.0
+	google.golang.org/grpc v1.67.3
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
+	github.com/gdamore/encoding v1.0.1 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/rivo/uniseg v0.4.3 // indirect
+	github.com/ulikunitz/xz v0.5.12 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
+	golang.org/x/term v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
 )
 
 require (
@@ -19,16 +43,16 @@ require (
 	github.com/knadh/koanf/v2 v2.1.1
 	github.com/mitchellh/copystructure v1.2.0 // indirect
 	github.com/mitchellh/reflectwalk v1.0.2 // indirect
-	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/sys v0.29.0
 )
 
 require (
 	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99
-	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/net v0.28.0 // indirect
 )
 
 require (
 	github.com/TheTitanrain/w32 v0.0.0-20200114052255-2654d97dbd3d // indirect
 	github.com/knadh/koanf/providers/structs v0.1.0
-	golang.org/x/sync v0.7.0
+	golang.org/x/sync v0.10.0
 )
@@ -1,8 +1,14 @@
 #!/bin/env python
 
+import io
+import json
 import os
-import urllib.request
+import re
 import ssl
+import urllib.request
+import xml.etree.ElementTree as ElementTree
+import zipfile
+from html.parser import HTMLParser
 
 # Don't edit below this line
 
@@ -24,3 +30,119 @@ urllib.request.install_opener(opener)
 
 checkAndDeleteFile("db.go")
 urllib.request.urlretrieve("https://napi.v10lator.de/db?t=go", "db.go")
+
+# titledata.json has what the title database doesn't: the product code of the
+# titles from the title database of WiiUBrew, and the genre, number of players
+# and languages of the games from GameTDB, found by their product code.
+TITLE_DATA_FILE = "titledata.json"
+WIIUBREW_URL = "https://wiiubrew.org/wiki/Title_database"
+GAMETDB_URL = "https://www.gametdb.com/wiiutdb.zip?LANG=EN"
+
+PRODUCT_CODE = re.compile(r"WUP-[A-Z]-([A-Z0-9]{4})")
+# GameTDB language codes that aren't the ones of the LANGUAGE_* flags
+GAMETDB_LANGUAGES = {"ZHCN": "ZHS", "ZHTW": "ZHT"}
+LANGUAGES = {"JA", "EN", "FR", "DE", "IT", "ES", "ZHS", "KO", "NL", "PT", "RU", "ZHT"}
+
+
+class TitleTableParser(HTMLParser):
+    """Collects the title ID and product code of the rows of every table
+    whose header has both columns."""
+
+    def __init__(self):
+        super().__init__()
+        self.productCodes = {}
+        self.columns = {}
+        self.row = None
+        self.cell = None
+
+    def handle_starttag(self, tag, attrs):
+        if tag == "table":
+            self.columns = {}
+        elif tag == "tr":
+            self.row = []
+        elif tag in ("td", "th") and self.row is not None:
+            self.cell = ""
+
+    def handle_data(self, data):
+        if self.cell is not None:
+            self.cell += data
+
+    def handle_endtag(self, tag):
+        if tag in ("td", "th") and self.cell is not None:
+            self.row.append(" ".join(self.cell.split()))
+            self.cell = None
+        elif tag == "tr" and self.row is not None:
+            self.handle_row(self.row)
+            self.row = None
+
+    def handle_row(self, row):
+        names = [cell.lower() for cell in row]
+        if "title id" in names and "product code" in names:
+            self.columns = {"titleID": names.index("title id"), "productCode": names.index("product code")}
+            return
+        if not self.columns or len(row) <= max(self.columns.values()):
+            return
+        titleID = re.sub(r"[^0-9a-fA-F]", "", row[self.columns["titleID"]]).lower()
+        productCode = PRODUCT_CODE.search(row[self.columns["productCode"]].upper())
+        if len(titleID) == 16 and productCode:
+            self.productCodes[titleID] = productCode.group(0)
+
+
+def grabProductCodes():
+    parser = TitleTableParser()
+    with urllib.request.urlopen(WIIUBREW_URL) as response:
+        parser.feed(response.read().decode("utf-8"))
+    return parser.productCodes
+
+
+def grabGameTDB():
+    """Returns the genre, number of players and languages of the games of
+    GameTDB by their game code, the four letters ending the product code."""
+    with urllib.request.urlopen(GAMETDB_URL) as response:
+        archive = zipfile.ZipFile(io.BytesIO(response.read()))
+    root = ElementTree.fromstring(archive.read("wiiutdb.xml"))
+    games = {}
+    for game in root.iter("game"):
+        gameID = (game.findtext("id") or "").strip().upper()
+        if len(gameID) < 4 or gameID[:4] in games:
+            continue
+        info = {}
+        genres = [genre.strip() for genre in (game.findtext("genre") or "").split(",") if genre.strip()]
+        if genres:
+            info["genre"] = genres[0].title()
+        playerInput = game.find("input")
+        if playerInput is not None and playerInput.get("players", "").isdigit():
+            info["players"] = min(int(playerInput.get("players")), 255)
+        languages = []
+        for language in (game.findtext("languages") or "").split(","):
+            language = GAMETDB_LANGUAGES.get(language.strip().upper(), language.strip().upper())
+            if language in LANGUAGES and language not in languages:
+                languages.append(language)
+        if languages:
+            info["languages"] = languages
+        games[gameID[:4]] = info
+    return games
+
+
+def grabTitleData():
+    productCodes = grabProductCodes()
+    games = grabGameTDB()
+    titles = {}
+    for titleID, productCode in sorted(productCodes.items()):
+        title = {"productCode": productCode}
+        title.update(games.get(PRODUCT_CODE.match(productCode).group(1), {}))
+        titles[titleID] = title
+    return titles
+
+
+# The title data is optional, when a source can't be reached the one in the
+# repository is kept
+try:
+    titleData = grabTitleData()
+except Exception as error:
+    print(f"Keeping {TITLE_DATA_FILE}, the title data can't be downloaded: {error}")
+else:
+    with open(TITLE_DATA_FILE, "w") as file:
+        json.dump(titleData, file, indent=1, sort_keys=True)
+        file.write("\n")
+    print(f"Wrote the data of {len(titleData)} titles to {TITLE_DATA_FILE}")
@@ -9,6 +9,23 @@ const (
 	MCP_REGION_TAIWAN = 0x40
 )
 
+// Languages a title supports, in the order of the longname_* fields of its
+// meta.xml.
+const (
+	LANGUAGE_JAPANESE uint16 = 1 << iota
+	LANGUAGE_ENGLISH
+	LANGUAGE_FRENCH
+	LANGUAGE_GERMAN
+	LANGUAGE_ITALIAN
+	LANGUAGE_SPANISH
+	LANGUAGE_CHINESE_SIMPLIFIED
+	LANGUAGE_KOREAN
+	LANGUAGE_DUTCH
+	LANGUAGE_PORTUGUESE
+	LANGUAGE_RUSSIAN
+	LANGUAGE_CHINESE_TRADITIONAL
+)
+
 const (
 	TITLE_KEY_mypass = iota
 	TITLE_KEY_nintendo
@@ -29,6 +46,9 @@ const (
 	TITLE_CATEGORY_DEMO
 	TITLE_CATEGORY_ALL
 	TITLE_CATEGORY_DISC
+	TITLE_CATEGORY_SYSTEM_APP
+	TITLE_CATEGORY_SYSTEM_DATA
+	TITLE_CATEGORY_SYSTEM_APPLET
 )
 
 const (
@@ -44,13 +64,65 @@ const (
 	TID_HIGH_UPDATE          = 0x0005000E
 )
 
+// getSystemCategory returns the system category a title belongs to based on its
+// TID high, or TITLE_CATEGORY_ALL when it is not a system title.
+func getSystemCategory(titleID uint64) uint8 {
+	switch TIDHigh(titleID) {
+	case TID_HIGH_SYSTEM_APP, TID_HIGH_VWII_SYSTEM_APP:
+		return TITLE_CATEGORY_SYSTEM_APP
+	case TID_HIGH_SYSTEM_DATA, TID_HIGH_VWII_SYSTEM, TID_HIGH_VWII_IOS:
+		return TITLE_CATEGORY_SYSTEM_DATA
+	case TID_HIGH_SYSTEM_APPLET:
+		return TITLE_CATEGORY_SYSTEM_APPLET
+	default:
+		return TITLE_CATEGORY_ALL
+	}
+}
+
+// IsSystemTitle reports whether titleID is a Wii U or vWii system title.
+func IsSystemTitle(titleID uint64) bool {
+	return getSystemCategory(titleID) != TITLE_CATEGORY_ALL
+}
+
+func isSystemCategory(category uint8) bool {
+	return category == TITLE_CATEGORY_SYSTEM_APP || category == TITLE_CATEGORY_SYSTEM_DATA || category == TITLE_CATEGORY_SYSTEM_APPLET
+}
+
+// GetTitleEntries returns the titles of a category. System titles are only
+// returned for the system categories, never for TITLE_CATEGORY_ALL.
 func GetTitleEntries(category uint8) []TitleEntry {
+	titleEntriesMutex.RLock()
+	defer titleEntriesMutex.RUnlock()
+
 	titleEntries := make([]TitleEntry, 0)
 	for _, entry := range titleEntry {
-		if category == TITLE_CATEGORY_ALL || category == entry.Category {
-			if entry.Category == TITLE_CATEGORY_DISC {
-				continue
+		if entry.Category == TITLE_CATEGORY_DISC {
+			continue
+		}
+		if isSystemCategory(category) {
+			if getSystemCategory(entry.TitleID) == category {
+				titleEntries = append(titleEntries, entry)
 			}
+			continue
+		}
+		if IsSystemTitle(entry.TitleID) {
+			continue
+		}
+		if category == TITLE_CATEGORY_ALL || category == entry.Category {
+			titleEntries = append(titleEntries, entry)
+		}
+	}
+	return titleEntries
+}
+
+// getAllTitleEntries returns every downloadable title, system titles included.
+func getAllTitleEntries() []TitleEntry {
+	titleEntriesMutex.RLock()
+	defer titleEntriesMutex.RUnlock()
+
+	titleEntries := make([]TitleEntry, 0, len(titleEntry))
+	for _, entry := range titleEntry {
+		if entry.Category != TITLE_CATEGORY_DISC {
 			titleEntries = append(titleEntries, entry)
 		}
 	}
@@ -83,7 +155,7 @@ func GetFormattedRegion(region uint8) string {
 }
 
 func GetFormattedKind(titleID uint64) string {
-	switch titleID >> 32 {
+	switch TIDHigh(titleID) {
 	case TID_HIGH_GAME:
 		return "Game"
 	case TID_HIGH_DEMO:
@@ -121,16 +193,99 @@ func GetCategoryFromFormattedCategory(formattedCategory string) uint8 {
 		return TITLE_CATEGORY_DEMO
 	case "All":
 		return TITLE_CATEGORY_ALL
+	case "System App":
+		return TITLE_CATEGORY_SYSTEM_APP
+	case "System Data":
+		return TITLE_CATEGORY_SYSTEM_DATA
+	case "System Applet":
+		return TITLE_CATEGORY_SYSTEM_APPLET
 	default:
 		return TITLE_CATEGORY_ALL
 	}
 }
 
 func GetTitleEntryFromTid(tid uint64) TitleEntry {
-	for _, entry := range GetTitleEntries(TITLE_CATEGORY_ALL) {
+	for _, entry := range getAllTitleEntries() {
 		if entry.TitleID == tid {
 			return entry
 		}
 	}
 	return TitleEntry{}
 }
+
+type RelatedTitles struct {
+	Base   TitleEntry
+	Update TitleEntry
+	DLC    TitleEntry
+}
+
+// TIDHigh returns the high half of titleID, which tells the kind of title.
+func TIDHigh(titleID uint64) uint32 {
+	return uint32(titleID >> 32)
+}
+
+// TIDLow returns the low half of titleID, shared by a game, its update and DLC.
+func TIDLow(titleID uint64) uint32 {
+	return uint32(titleID)
+}
+
+func withTIDHigh(titleID uint64, high uint32) uint64 {
+	return uint64(high)<<32 | uint64(TIDLow(titleID))
+}
+
+// ToBaseTID returns the title ID of the game an update or DLC belongs to.
+func ToBaseTID(titleID uint64) uint64 {
+	return withTIDHigh(titleID, TID_HIGH_GAME)
+}
+
+// ToUpdateTID returns the title ID of the update of the game titleID belongs to.
+func ToUpdateTID(titleID uint64) uint64 {
+	return withTIDHigh(titleID, TID_HIGH_UPDATE)
+}
+
+// ToDLCTID returns the title ID of the DLC of the game titleID belongs to.
+func ToDLCTID(titleID uint64) uint64 {
+	return withTIDHigh(titleID, TID_HIGH_DLC)
+}
+
+// IsGame reports whether titleID is a base game.
+func IsGame(titleID uint64) bool {
+	return TIDHigh(titleID) == TID_HIGH_GAME
+}
+
+// IsUpdate reports whether titleID is the update of a game.
+func IsUpdate(titleID uint64) bool {
+	return TIDHigh(titleID) == TID_HIGH_UPDATE
+}
+
+// IsDLC reports whether titleID is the DLC of a game.
+func IsDLC(titleID uint64) bool {
+	return TIDHigh(titleID) == TID_HIGH_DLC
+}
+
+// IsDemo reports whether titleID is a demo. Demos have their own low TID, they
+// don't share it with the game.
+func IsDemo(titleID uint64) bool {
+	return TIDHigh(titleID) == TID_HIGH_DEMO
+}
+
+// GetRelatedTitles returns the base game, update and DLC entries that share the
+// given title's low TID, entries that are not in the database have a zero TitleID.
+func GetRelatedTitles(titleID uint64) RelatedTitles {
+	related := RelatedTitles{}
+	baseTID := ToBaseTID(titleID)
+	updateTID := ToUpdateTID(titleID)
+	dlcTID := ToDLCTID(titleID)
+
+	for _, entry := range GetTitleEntries(TITLE_CATEGORY_ALL) {
+		switch entry.TitleID {
+		case baseTID:
+			related.Base = entry
+		case updateTID:
+			related.Update = entry
+		case dlcTID:
+			related.DLC = entry
+		}
+	}
+	return related
+}
@@ -0,0 +1,73 @@
+package wiiudownloader
+
+import "testing"
+
+func TestTitleIDKinds(t *testing.T) {
+	const low = 0x10145D00
+	tests := []struct {
+		high                    uint32
+		game, update, dlc, demo bool
+		system                  bool
+		systemCategory          uint8
+	}{
+		{high: TID_HIGH_GAME, game: true, systemCategory: TITLE_CATEGORY_ALL},
+		{high: TID_HIGH_DEMO, demo: true, systemCategory: TITLE_CATEGORY_ALL},
+		{high: TID_HIGH_DLC, dlc: true, systemCategory: TITLE_CATEGORY_ALL},
+		{high: TID_HIGH_UPDATE, update: true, systemCategory: TITLE_CATEGORY_ALL},
+		{high: TID_HIGH_SYSTEM_APP, system: true, systemCategory: TITLE_CATEGORY_SYSTEM_APP},
+		{high: TID_HIGH_SYSTEM_DATA, system: true, systemCategory: TITLE_CATEGORY_SYSTEM_DATA},
+		{high: TID_HIGH_SYSTEM_APPLET, system: true, systemCategory: TITLE_CATEGORY_SYSTEM_APPLET},
+		{high: TID_HIGH_VWII_IOS, system: true, systemCategory: TITLE_CATEGORY_SYSTEM_DATA},
+		{high: TID_HIGH_VWII_SYSTEM_APP, system: true, systemCategory: TITLE_CATEGORY_SYSTEM_APP},
+		{high: TID_HIGH_VWII_SYSTEM, system: true, systemCategory: TITLE_CATEGORY_SYSTEM_DATA},
+		// Not a Wii U title at all
+		{high: 0x00010001, systemCategory: TITLE_CATEGORY_ALL},
+	}
+	for _, test := range tests {
+		titleID := uint64(test.high)<<32 | low
+		if TIDHigh(titleID) != test.high || TIDLow(titleID) != low {
+			t.Errorf("%016x: TIDHigh, TIDLow = %08x, %08x", titleID, TIDHigh(titleID), TIDLow(titleID))
+		}
+		if got := IsGame(titleID); got != test.game {
+			t.Errorf("IsGame(%016x) = %v, want %v", titleID, got, test.game)
+		}
+		if got := IsUpdate(titleID); got != test.update {
+			t.Errorf("IsUpdate(%016x) = %v, want %v", titleID, got, test.update)
+		}
+		if got := IsDLC(titleID); got != test.dlc {
+			t.Errorf("IsDLC(%016x) = %v, want %v", titleID, got, test.dlc)
+		}
+		if got := IsDemo(titleID); got != test.demo {
+			t.Errorf("IsDemo(%016x) = %v, want %v", titleID, got, test.demo)
+		}
+		if got := IsSystemTitle(titleID); got != test.system {
+			t.Errorf("IsSystemTitle(%016x) = %v, want %v", titleID, got, test.system)
+		}
+		if got := getSystemCategory(titleID); got != test.systemCategory {
+			t.Errorf("getSystemCategory(%016x) = %d, want %d", titleID, got, test.systemCategory)
+		}
+
+		// The conversions only change the high half, whatever it was
+		if got, want := ToBaseTID(titleID), uint64(TID_HIGH_GAME)<<32|low; got != want {
+			t.Errorf("ToBaseTID(%016x) = %016x, want %016x", titleID, got, want)
+		}
+		if got, want := ToUpdateTID(titleID), uint64(TID_HIGH_UPDATE)<<32|low; got != want {
+			t.Errorf("ToUpdateTID(%016x) = %016x, want %016x", titleID, got, want)
+		}
+		if got, want := ToDLCTID(titleID), uint64(TID_HIGH_DLC)<<32|low; got != want {
+			t.Errorf("ToDLCTID(%016x) = %016x, want %016x", titleID, got, want)
+		}
+	}
+}
+
+func TestTitleIDConversionsRoundTrip(t *testing.T) {
+	const game = 0x0005000010145D00
+	for _, titleID := range []uint64{ToUpdateTID(game), ToDLCTID(game)} {
+		if got := ToBaseTID(titleID); got != game {
+			t.Errorf("ToBaseTID(%016x) = %016x, want %016x", titleID, got, game)
+		}
+	}
+	if got := ToDLCTID(ToUpdateTID(game)); got != 0x0005000C10145D00 {
+		t.Errorf("ToDLCTID(ToUpdateTID(%016x)) = %016x", uint64(game), got)
+	}
+}
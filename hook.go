@@ -0,0 +1,65 @@
+package wiiudownloader
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// postDownloadHookOutputLimit is how much of the output of a failed hook is
+// kept in its error.
+const postDownloadHookOutputLimit = 1024
+
+// RunPostDownloadHook runs command with the shell of the OS (sh, or cmd on
+// Windows) in the title folder at path, once the title was downloaded. The
+// title is described to the command by these environment variables:
+//
+//	WIIUDOWNLOADER_PATH            the title folder
+//	WIIUDOWNLOADER_DECRYPTED_PATH  the folder with the decrypted files, empty when not decrypted
+//	WIIUDOWNLOADER_TITLE_ID        the title ID, as 16 hex digits
+//	WIIUDOWNLOADER_NAME            the name of the title
+//	WIIUDOWNLOADER_VERSION         the version of the title
+//	WIIUDOWNLOADER_REGION          the region of the title
+//	WIIUDOWNLOADER_KIND            Game, Update, DLC, Demo...
+func RunPostDownloadHook(command string, path string) error {
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		return err
+	}
+	titleID, err := strconv.ParseUint(manifest.TitleID, 16, 64)
+	if err != nil {
+		return err
+	}
+	decryptedPath := ""
+	if manifest.Decrypted {
+		decryptedPath = path
+		if manifest.DecryptedPath != "" {
+			decryptedPath = manifest.DecryptedPath
+		}
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Dir = path
+	cmd.Env = append(os.Environ(),
+		"WIIUDOWNLOADER_PATH="+path,
+		"WIIUDOWNLOADER_DECRYPTED_PATH="+decryptedPath,
+		"WIIUDOWNLOADER_TITLE_ID="+manifest.TitleID,
+		"WIIUDOWNLOADER_NAME="+manifest.Name,
+		"WIIUDOWNLOADER_VERSION="+strconv.Itoa(int(manifest.Version)),
+		"WIIUDOWNLOADER_REGION="+GetFormattedRegion(GetTitleEntryFromTid(titleID).Region),
+		"WIIUDOWNLOADER_KIND="+GetFormattedKind(titleID),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		output = output[max(0, len(output)-postDownloadHookOutputLimit):]
+		return fmt.Errorf(Localize("the post-download command failed: %v: %s"), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
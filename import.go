@@ -0,0 +1,305 @@
+package wiiudownloader
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type ImportedTitles struct {
+	Titles  []TitleEntry
+	Invalid []string // entries that are not a valid title ID
+	Unknown []string // valid title IDs missing from the title database
+}
+
+// ImportTitleIDsFromFile reads a list of title IDs from a text, JSON or CSV file.
+// Text files hold one title ID per line, JSON files an array of title IDs or of
+// objects with a "titleID" field, and CSV files either a "titleID" column or the
+// title IDs in the first column.
+func ImportTitleIDsFromFile(path string) (*ImportedTitles, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var values []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		values, err = readTitleIDsJSON(file)
+	case ".csv":
+		values, err = readTitleIDsCSV(file)
+	default:
+		values, err = readTitleIDsText(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveTitleIDs(values), nil
+}
+
+func readTitleIDsText(r io.Reader) ([]string, error) {
+	values := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		values = append(values, strings.Fields(line)[0])
+	}
+	return values, scanner.Err()
+}
+
+func readTitleIDsJSON(r io.Reader) ([]string, error) {
+	var rawEntries []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&rawEntries); err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(rawEntries))
+	for _, rawEntry := range rawEntries {
+		var value string
+		if err := json.Unmarshal(rawEntry, &value); err == nil {
+			values = append(values, value)
+			continue
+		}
+		var title ExportedTitle
+		if err := json.Unmarshal(rawEntry, &title); err != nil {
+			return nil, fmt.Errorf(Localize("unexpected entry in title ID list: %s"), rawEntry)
+		}
+		values = append(values, title.TitleID)
+	}
+	return values, nil
+}
+
+func readTitleIDsCSV(r io.Reader) ([]string, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	column := 0
+	for i, header := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(header), "titleID") {
+			column = i
+			records = records[1:]
+			break
+		}
+	}
+
+	values := make([]string, 0, len(records))
+	for _, record := range records {
+		if column < len(record) {
+			values = append(values, record[column])
+		}
+	}
+	return values, nil
+}
+
+// ParseTitleID accepts title IDs in the common notations (0005000010145D00,
+// 0x0005000010145d00, 00050000-10145D00).
+func ParseTitleID(value string) (uint64, error) {
+	normalized := strings.TrimSpace(value)
+	normalized = strings.TrimPrefix(strings.TrimPrefix(normalized, "0x"), "0X")
+	normalized = strings.ReplaceAll(normalized, "-", "")
+	if len(normalized) != 16 {
+		return 0, fmt.Errorf(Localize("invalid title ID: %q"), value)
+	}
+	tid, err := strconv.ParseUint(normalized, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf(Localize("invalid title ID: %q"), value)
+	}
+	return tid, nil
+}
+
+// titleIDInTextRegexp matches the title IDs in text, FindTitleID checks that
+// they aren't part of a longer run of hex digits: RE2 has no lookarounds, and
+// a boundary matched by the regexp would be consumed, missing the second of
+// two IDs only separated by a comma.
+var titleIDInTextRegexp = regexp.MustCompile(`(?i)([0-9a-f]{8})[-_]?([0-9a-f]{8})`)
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// findTitleIDsInText returns the title IDs in text, in order.
+func findTitleIDsInText(text string) []uint64 {
+	tids := make([]uint64, 0)
+	for start := 0; start < len(text); {
+		match := titleIDInTextRegexp.FindStringSubmatchIndex(text[start:])
+		if match == nil {
+			break
+		}
+		begin, end := start+match[0], start+match[1]
+		if (begin > 0 && isHexDigit(text[begin-1])) || (end < len(text) && isHexDigit(text[end])) {
+			// Part of a longer run of hex digits, an ID may start further in
+			start = begin + 1
+			continue
+		}
+		if tid, err := strconv.ParseUint(text[start+match[2]:start+match[3]]+text[start+match[4]:start+match[5]], 16, 64); err == nil {
+			tids = append(tids, tid)
+		}
+		start = end
+	}
+	return tids
+}
+
+// FindTitleID looks for a title ID in free text, like a pasted line, a file name
+// or a title database URL (https://example.com/titles/0005000010145D00). When the
+// text holds several, the first one found in the title database wins. Without
+// one, the game of a Nintendo eShop page URL is looked up, see eShopTitleID.
+func FindTitleID(text string) (uint64, bool) {
+	tids := findTitleIDsInText(text)
+	for _, tid := range tids {
+		if GetTitleEntryFromTid(tid).TitleID == tid {
+			return tid, true
+		}
+	}
+	if tid, ok := eShopTitleID(text); ok {
+		return tid, true
+	}
+	if len(tids) > 0 {
+		return tids[0], true
+	}
+	return 0, false
+}
+
+var eShopURLRegexp = regexp.MustCompile(`(?i)https?://[^\s"'<>]+`)
+
+// eShopURLRegions are the regions of the games of the Nintendo sites, by the
+// end of their host name. The other European sites end in their country code.
+var eShopURLRegions = []struct {
+	suffix string
+	region uint8
+}{
+	{"nintendo.co.jp", MCP_REGION_JAPAN},
+	{"nintendo.co.kr", MCP_REGION_KOREA},
+	{"nintendo.com.hk", MCP_REGION_CHINA},
+	{"nintendo.tw", MCP_REGION_TAIWAN},
+	{"nintendo.com", MCP_REGION_USA},
+	{"nintendo.ca", MCP_REGION_USA},
+}
+
+// eShopPageSuffixRegexp matches what the Nintendo sites append to the name of a
+// game in the URL of its page: the platform, and the number of the page.
+var eShopPageSuffixRegexp = regexp.MustCompile(`(?i)(?:-wii-?u)?(?:-\d+)?(?:\.html?)?$`)
+
+var nameAccents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n", "ò", "o", "ó", "o", "ô", "o", "ö", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+)
+
+// normalizeTitleName lowers name and keeps only its letters and digits, split
+// by single spaces, so the name of a title matches the one in a URL.
+func normalizeTitleName(name string) string {
+	name = nameAccents.Replace(strings.ToLower(name))
+	var builder strings.Builder
+	space := false
+	for _, r := range name {
+		switch {
+		case r == '\'' || r == '’':
+			// Yoshi's Woolly World is yoshis-woolly-world
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && builder.Len() > 0 {
+				builder.WriteByte(' ')
+			}
+			builder.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return builder.String()
+}
+
+// eShopTitleID looks up the game of the first Nintendo eShop page URL in text,
+// like https://www.nintendo.com/us/store/products/super-mario-3d-world-wii-u/
+// or https://www.nintendo.co.uk/Games/Wii-U/Super-Mario-3D-World-841049.html.
+// The pages don't carry title IDs, the game is found by the name in the URL,
+// in the region of the site when the game is in several.
+func eShopTitleID(text string) (uint64, bool) {
+	for _, match := range eShopURLRegexp.FindAllString(text, -1) {
+		pageURL, err := url.Parse(match)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(pageURL.Hostname())
+		if !strings.HasPrefix(host, "nintendo.") && !strings.Contains(host, ".nintendo.") {
+			continue
+		}
+		segments := strings.Split(strings.Trim(pageURL.Path, "/"), "/")
+		name := normalizeTitleName(eShopPageSuffixRegexp.ReplaceAllString(segments[len(segments)-1], ""))
+		if name == "" {
+			continue
+		}
+		region := uint8(MCP_REGION_EUROPE)
+		for _, site := range eShopURLRegions {
+			if host == site.suffix || strings.HasSuffix(host, "."+site.suffix) {
+				region = site.region
+				break
+			}
+		}
+
+		found := false
+		var first uint64
+		for _, entry := range getAllTitleEntries() {
+			if entry.TitleID>>32 != TID_HIGH_GAME || normalizeTitleName(entry.Name) != name {
+				continue
+			}
+			if entry.Region&region != 0 {
+				return entry.TitleID, true
+			}
+			if !found {
+				first, found = entry.TitleID, true
+			}
+		}
+		if found {
+			return first, true
+		}
+	}
+	return 0, false
+}
+
+func resolveTitleIDs(values []string) *ImportedTitles {
+	entriesByTid := make(map[uint64]TitleEntry)
+	for _, entry := range getAllTitleEntries() {
+		entriesByTid[entry.TitleID] = entry
+	}
+
+	imported := &ImportedTitles{}
+	seen := make(map[uint64]bool)
+	for _, value := range values {
+		tid, err := ParseTitleID(value)
+		if err != nil {
+			imported.Invalid = append(imported.Invalid, value)
+			continue
+		}
+		entry, ok := entriesByTid[tid]
+		if !ok {
+			imported.Unknown = append(imported.Unknown, value)
+			continue
+		}
+		if !seen[tid] {
+			seen[tid] = true
+			imported.Titles = append(imported.Titles, entry)
+		}
+	}
+	return imported
+}
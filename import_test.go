@@ -0,0 +1,62 @@
+package wiiudownloader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindTitleIDsInText(t *testing.T) {
+	tests := []struct {
+		text string
+		want []uint64
+	}{
+		{"0005000010145d00", []uint64{0x0005000010145d00}},
+		{"0005000010145D00,0005000E10145D00", []uint64{0x0005000010145d00, 0x0005000e10145d00}},
+		{"00050000-10145d00 00050000_10145d01", []uint64{0x0005000010145d00, 0x0005000010145d01}},
+		{"Super Mario 3D World [0005000010145d00] (v16).zip", []uint64{0x0005000010145d00}},
+		{"https://example.com/titles/0005000010145D00", []uint64{0x0005000010145d00}},
+		// 17 and 15 hex digits are no title ID
+		{"00005000010145d00 005000010145d00", []uint64{}},
+	}
+	for _, test := range tests {
+		if got := findTitleIDsInText(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("findTitleIDsInText(%q) = %x, want %x", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFindTitleIDEShopURL(t *testing.T) {
+	for _, text := range []string{
+		"https://www.nintendo.com/us/store/products/super-mario-3d-world-wii-u/",
+		"https://www.nintendo.com/games/detail/super-mario-3d-world-wii-u",
+		"Look: https://www.nintendo.co.uk/Games/Wii-U/Super-Mario-3D-World-841049.html",
+		"https://www.nintendo.de/Spiele/Wii-U/Super-Mario-3D-World-841049.html?utm_source=x#top",
+	} {
+		if tid, ok := FindTitleID(text); !ok || tid != 0x0005000010145d00 {
+			t.Errorf("FindTitleID(%q) = %016x, %v, want 0005000010145d00", text, tid, ok)
+		}
+	}
+	for _, text := range []string{
+		"https://www.nintendo.com/us/store/products/not-a-wii-u-game/",
+		"https://example.com/super-mario-3d-world",
+	} {
+		if tid, ok := FindTitleID(text); ok {
+			t.Errorf("FindTitleID(%q) = %016x, want none", text, tid)
+		}
+	}
+}
+
+func TestNormalizeTitleName(t *testing.T) {
+	tests := map[string]string{
+		"Super Mario 3D World":        "super mario 3d world",
+		"Yoshi's Woolly World":        "yoshis woolly world",
+		"Pokkén Tournament":           "pokken tournament",
+		"The Legend of Zelda: BotW ™": "the legend of zelda botw",
+		"super-mario-3d-world":        "super mario 3d world",
+	}
+	for name, want := range tests {
+		if got := normalizeTitleName(name); got != want {
+			t.Errorf("normalizeTitleName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/cipher"
 	"crypto/md5"
 	"crypto/sha1"
+	"strconv"
 
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -58,7 +59,16 @@ func GenerateKey(tid string) ([]byte, error) {
 	}
 	copy(iv[8:], make([]byte, 8))
 
-	encrypted, err := encryptAES(key, commonKey, iv)
+	titleID, err := strconv.ParseUint(tid, 16, 64)
+	if err != nil {
+		return []byte{}, err
+	}
+	// The key is encrypted with the common key the generated ticket tells
+	titleCommonKey, err := getCommonKey(titleID, CommonKeyIndexForTitle(titleID))
+	if err != nil {
+		return []byte{}, err
+	}
+	encrypted, err := encryptAES(key, titleCommonKey, iv)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -0,0 +1,250 @@
+package wiiudownloader
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	otpSize                 = 0x400
+	seepromSize             = 0x200
+	seepromUSBKeySeedOffset = 0xB0
+)
+
+const (
+	otpFilename     = "otp.bin"
+	seepromFilename = "seeprom.bin"
+)
+
+// ConsoleKeys are the keys read from the OTP dump of a console, and from its
+// SEEPROM dump when there is one.
+type ConsoleKeys struct {
+	WiiCommonKey      []byte
+	StarbuckAncastKey []byte
+	SEEPROMKey        []byte
+	VWiiCommonKey     []byte
+	WiiUCommonKey     []byte
+	USBSeedKey        []byte // encrypts the USB key seed of the SEEPROM
+	SLCKey            []byte
+	MLCKey            []byte
+	USBKeySeed        []byte // nil without a SEEPROM dump
+}
+
+// commonKeySHA1 is the SHA-1 of the Wii U common key, the keys users supply
+// are checked against it.
+var commonKeySHA1 = []byte{0x6a, 0x0b, 0x87, 0xfc, 0x98, 0xb3, 0x06, 0xae, 0x33, 0x66, 0xf0, 0xe0, 0xa8, 0x8d, 0x0b, 0x06, 0xa2, 0x81, 0x33, 0x13}
+
+// commonKeyNames are the names the common key goes by in keys.txt files, once
+// lowercased and without separators.
+var commonKeyNames = []string{"commonkey", "wiiucommonkey"}
+
+// Names of the common keys of the Wii mode in keys.txt files, once lowercased
+// and without separators
+const (
+	wiiCommonKeyName       = "wiicommonkey"
+	koreanWiiCommonKeyName = "wiikoreancommonkey"
+	vWiiCommonKeyName      = "vwiicommonkey"
+)
+
+// keysFileKeys are the common keys of a keys.txt file, nil when it doesn't
+// have them.
+type keysFileKeys struct {
+	wiiU      []byte
+	wii       []byte
+	koreanWii []byte
+	vWii      []byte
+}
+
+// SetCommonKey makes decryption and ticket generation use key as the Wii U
+// common key instead of the built-in one.
+func SetCommonKey(key []byte) error {
+	if len(key) != aes.BlockSize {
+		return fmt.Errorf(Localize("the Wii U common key must be %d bytes long, got %d"), aes.BlockSize, len(key))
+	}
+	if hash := sha1.Sum(key); !bytes.Equal(hash[:], commonKeySHA1) {
+		return fmt.Errorf(Localize("the key supplied is not the Wii U common key"))
+	}
+	commonKeysMutex.Lock()
+	defer commonKeysMutex.Unlock()
+	commonKey = bytes.Clone(key)
+	return nil
+}
+
+// LoadKeys reads the Wii U common key from path, either the dump of a console
+// (see ReadConsoleKeys) or a keys.txt file with a "wiiu_common_key = <hex>"
+// line, and uses it instead of the built-in one. The common keys of the Wii
+// mode are read too, from the dump or from the "wii_common_key",
+// "wii_korean_common_key" and "vwii_common_key" lines, so the titles of the
+// Wii mode can be decrypted.
+func LoadKeys(path string) error {
+	if info, err := os.Stat(path); err == nil && (info.IsDir() || strings.EqualFold(filepath.Ext(path), ".bin")) {
+		keys, err := ReadConsoleKeys(path)
+		if err != nil {
+			return err
+		}
+		if err := SetCommonKey(keys.WiiUCommonKey); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return setWiiCommonKeys(keys.WiiCommonKey, nil, keys.VWiiCommonKey)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf(Localize("could not read the keys file %s: %w"), path, err)
+	}
+
+	keys, err := parseKeysFile(data)
+	if err != nil {
+		return fmt.Errorf(Localize("invalid keys file %s: %w"), path, err)
+	}
+	if keys.wiiU == nil {
+		return fmt.Errorf(Localize("no Wii U common key found in %s, add a \"wiiu_common_key = <key>\" line"), path)
+	}
+
+	if err := SetCommonKey(keys.wiiU); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := setWiiCommonKeys(keys.wii, keys.koreanWii, keys.vWii); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// parseKeysFile returns the common keys of a keys.txt file. Lines are
+// "name = value" or "name: value", # and ; start comments.
+func parseKeysFile(data []byte) (keysFileKeys, error) {
+	keys := keysFileKeys{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			name, value, found = strings.Cut(line, ":")
+		}
+		if !found {
+			continue
+		}
+		name = strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+		var key *[]byte
+		switch {
+		case slices.Contains(commonKeyNames, name):
+			key = &keys.wiiU
+		case name == wiiCommonKeyName:
+			key = &keys.wii
+		case name == koreanWiiCommonKeyName:
+			key = &keys.koreanWii
+		case name == vWiiCommonKeyName:
+			key = &keys.vWii
+		default:
+			continue
+		}
+		// The first line of a key wins
+		if *key != nil {
+			continue
+		}
+		decoded, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return keys, err
+		}
+		*key = decoded
+	}
+	return keys, scanner.Err()
+}
+
+// ParseOTP reads the keys of the OTP dump of a console.
+func ParseOTP(data []byte) (*ConsoleKeys, error) {
+	if len(data) != otpSize {
+		return nil, fmt.Errorf(Localize("not an OTP dump, it must be %d bytes long, got %d"), otpSize, len(data))
+	}
+	if bytes.Count(data, []byte{0}) == len(data) {
+		return nil, errors.New(Localize("the OTP dump is empty, dump it again"))
+	}
+	key := func(offset int) []byte {
+		return bytes.Clone(data[offset : offset+aes.BlockSize])
+	}
+	return &ConsoleKeys{
+		WiiCommonKey:      key(0x14),
+		StarbuckAncastKey: key(0x90),
+		SEEPROMKey:        key(0xA0),
+		VWiiCommonKey:     key(0xD0),
+		WiiUCommonKey:     key(0xE0),
+		USBSeedKey:        key(0x130),
+		SLCKey:            key(0x170),
+		MLCKey:            key(0x180),
+	}, nil
+}
+
+// AddSEEPROM reads the USB key seed of the SEEPROM dump of the same console.
+func (k *ConsoleKeys) AddSEEPROM(data []byte) error {
+	if len(data) != seepromSize {
+		return fmt.Errorf(Localize("not a SEEPROM dump, it must be %d bytes long, got %d"), seepromSize, len(data))
+	}
+	k.USBKeySeed = bytes.Clone(data[seepromUSBKeySeedOffset : seepromUSBKeySeedOffset+aes.BlockSize])
+	return nil
+}
+
+// USBKey returns the key of the USB storage devices formatted by the console,
+// nil without a SEEPROM dump.
+func (k *ConsoleKeys) USBKey() ([]byte, error) {
+	if k.USBKeySeed == nil {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(k.USBSeedKey)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, aes.BlockSize)
+	block.Encrypt(key, k.USBKeySeed)
+	return key, nil
+}
+
+// ReadConsoleKeys reads the keys of a console dump. path is the otp.bin file,
+// the seeprom.bin file or the folder with both, the seeprom.bin next to the
+// otp.bin is read too when there is one.
+func ReadConsoleKeys(path string) (*ConsoleKeys, error) {
+	dir, otpPath := path, filepath.Join(path, otpFilename)
+	if info, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf(Localize("could not read the keys file %s: %w"), path, err)
+	} else if !info.IsDir() {
+		dir = filepath.Dir(path)
+		otpPath = path
+		if strings.EqualFold(filepath.Base(path), seepromFilename) {
+			otpPath = filepath.Join(dir, otpFilename)
+		}
+	}
+
+	otp, err := os.ReadFile(otpPath)
+	if errors.Is(err, fs.ErrNotExist) && otpPath != path {
+		return nil, fmt.Errorf(Localize("%s has no %s, the OTP dump of the console is needed for the common key"), dir, otpFilename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(Localize("could not read the keys file %s: %w"), otpPath, err)
+	}
+	keys, err := ParseOTP(otp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", otpPath, err)
+	}
+
+	seepromPath := filepath.Join(dir, seepromFilename)
+	if seeprom, err := os.ReadFile(seepromPath); err == nil {
+		if err := keys.AddSEEPROM(seeprom); err != nil {
+			return nil, fmt.Errorf("%s: %w", seepromPath, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf(Localize("could not read the keys file %s: %w"), seepromPath, err)
+	}
+	return keys, nil
+}
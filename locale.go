@@ -0,0 +1,451 @@
+package wiiudownloader
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+const DEFAULT_LOCALE = "en"
+
+var (
+	currentLocale = DEFAULT_LOCALE
+	localeMutex   sync.RWMutex
+)
+
+// localeNames are the languages messages can be shown in, in their own language.
+var localeNames = map[string]string{
+	"en": "English",
+	"es": "Español",
+	"de": "Deutsch",
+	"fr": "Français",
+}
+
+// messageCatalogs maps the English message, which is also the format string
+// passed to fmt, to its translation. The verbs must stay in the same order.
+var messageCatalogs = map[string]map[string]string{
+	"es": {
+		"failed to download OSv10 cetk, length: %d":                    "no se pudo descargar el cetk de OSv10, tamaño: %d",
+		"could not create '%s': %w":                                    "no se pudo crear '%s': %w",
+		"could not read %d bytes from '%s': %w":                        "no se pudieron leer %d bytes de '%s': %w",
+		"H3 Hash mismatch":                                             "el hash H3 no coincide",
+		"content hash mismatch":                                        "el hash del contenido no coincide",
+		"content not found":                                            "no se encontró el contenido",
+		"download error after %d attempts, status code: %d":            "error de descarga tras %d intentos, código de estado: %d",
+		"tmd download error, status code: %d":                          "error al descargar el tmd, código de estado: %d",
+		"unsupported export format: %s":                                "formato de exportación no soportado: %s",
+		"no system titles found for region %s":                         "no se encontraron títulos del sistema para la región %s",
+		"failed to download system title %s: %w":                       "no se pudo descargar el título del sistema %s: %w",
+		"unexpected entry in title ID list: %s":                        "entrada inesperada en la lista de IDs de título: %s",
+		"invalid title ID: %q":                                         "ID de título no válido: %q",
+		"invalid manifest in %s: %w":                                   "manifiesto no válido en %s: %w",
+		"decrypted path is too long for this filesystem (%d > %d): %s": "la ruta descifrada es demasiado larga para este sistema de archivos (%d > %d): %s",
+		"title folder is already as short as possible: %s":             "la carpeta del título ya es lo más corta posible: %s",
+		"cannot shorten title folder, %s already exists":               "no se puede acortar la carpeta del título, %s ya existe",
+		"content %s is not part of the TMD":                            "el contenido %s no forma parte del TMD",
+		"unknown TMD version: %d":                                      "versión de TMD desconocida: %d",
+		"size mismatch, expected %d bytes":                             "el tamaño no coincide, se esperaban %d bytes",
+		"missing":                                                      "no encontrado",
+		"verification of %s failed: the data read back from disk differs from the data received, check your disk and RAM": "la verificación de %s falló: los datos leídos del disco difieren de los recibidos, revisa tu disco y tu RAM",
+		"verification of %s failed: the data received from the CDN does not match the TMD":                                "la verificación de %s falló: los datos recibidos de la CDN no coinciden con el TMD",
+		"usage: WiiUDownloader verify [--repair] [--quick] <title folder>...":                                             "uso: WiiUDownloader verify [--repair] [--quick] <carpeta del título>...",
+		"Title %016x v%d":                      "Título %016x v%d",
+		"Metadata only, no contents to verify": "Solo metadatos, no hay contenidos que verificar",
+		"CONTENT\tSIZE\tEXPECTED\tRESULT":      "CONTENIDO\tTAMAÑO\tESPERADO\tRESULTADO",
+		"OK":                                   "OK",
+		"FAIL: %s":                             "FALLO: %s",
+		"Downloading %d corrupted contents again":                                                     "Descargando de nuevo %d contenidos dañados",
+		"%s done (%s / %s)":                                                                           "%s completado (%s / %s)",
+		"the folder name template is empty":                                                           "la plantilla del nombre de carpeta está vacía",
+		"unknown placeholder in folder name template: %s":                                             "marcador desconocido en la plantilla del nombre de carpeta: %s",
+		"invalid folder in folder name template: %q":                                                  "carpeta no válida en la plantilla del nombre de carpeta: %q",
+		"invalid header, expected \"Name: value\": %q":                                                "cabecera no válida, se esperaba \"Nombre: valor\": %q",
+		"--ipv4 and --ipv6 can't be used together":                                                    "--ipv4 y --ipv6 no se pueden usar a la vez",
+		"invalid host override, expected \"address hostname\": %q":                                    "redirección de host no válida, se esperaba \"dirección nombre_de_host\": %q",
+		"usage: wiiudownloader-server serve --output <folder> [--listen <address>] [--token <token>]": "uso: wiiudownloader-server serve --output <carpeta> [--listen <dirección>] [--token <token>]",
+		"warning: no --token set, anyone who can reach the server can control it":                     "aviso: no se ha indicado --token, cualquiera que pueda acceder al servidor puede controlarlo",
+		"Listening on %s": "Escuchando en %s",
+		"usage: WiiUDownloader watch [--once] [--webhook <url>] [--download <folder>] <title ID>...":   "uso: WiiUDownloader watch [--once] [--webhook <url>] [--download <carpeta>] <ID de título>...",
+		"%s (%s) was updated from v%d to v%d":                                                          "%s (%s) se ha actualizado de v%d a v%d",
+		"Started downloading %s (%s)":                                                                  "Se ha empezado a descargar %s (%s)",
+		"Finished downloading %s (%s)":                                                                 "Se ha terminado de descargar %s (%s)",
+		"Failed to download %s (%s): %s":                                                               "No se ha podido descargar %s (%s): %s",
+		"webhook answered with status code %d":                                                         "el webhook respondió con el código de estado %d",
+		"block %d (offset 0x%X) of content %s failed the %s hash check":                                "el bloque %d (desplazamiento 0x%X) del contenido %s no superó la comprobación del hash %s",
+		"the title key of %016x can't decrypt its contents, its ticket is wrong or for another region": "la clave del título %016x no puede descifrar sus contenidos, su ticket es incorrecto o de otra región",
+		"the Wii U common key must be %d bytes long, got %d":                                           "la clave común de Wii U debe tener %d bytes, tiene %d",
+		"the key supplied is not the Wii U common key":                                                 "la clave proporcionada no es la clave común de Wii U",
+		"could not read the keys file %s: %w":                                                          "no se pudo leer el archivo de claves %s: %w",
+		"invalid keys file %s: %w":                                                                     "archivo de claves no válido %s: %w",
+		"no Wii U common key found in %s, add a \"wiiu_common_key = <key>\" line":                      "no se encontró la clave común de Wii U en %s, añade una línea \"wiiu_common_key = <clave>\"",
+		"not an OTP dump, it must be %d bytes long, got %d":                                            "no es un volcado de la OTP, debe tener %d bytes y tiene %d",
+		"the OTP dump is empty, dump it again":                                                         "el volcado de la OTP está vacío, vuelve a volcarlo",
+		"not a SEEPROM dump, it must be %d bytes long, got %d":                                         "no es un volcado de la SEEPROM, debe tener %d bytes y tiene %d",
+		"%s has no %s, the OTP dump of the console is needed for the common key":                       "%s no tiene %s, hace falta el volcado de la OTP de la consola para la clave común",
+		"TMD signature":    "Firma del TMD",
+		"Ticket signature": "Firma del ticket",
+		"valid":            "válida",
+		"INVALID":          "NO VÁLIDA",
+		"not checked":      "sin comprobar",
+		"the XS certificate isn't cached yet, build a title.cert once with network access":           "el certificado XS aún no está en caché, genera un title.cert una vez con acceso a la red",
+		"cetk download error, status code: %d":                                                       "error al descargar el cetk, código de estado: %d",
+		"usage: WiiUDownloader offline <cert|verify|decrypt|package|pack> [flags] <title folder>...": "uso: WiiUDownloader offline <cert|verify|decrypt|package|pack> [opciones] <carpeta del título>...",
+		"done": "hecho",
+		"%s was slimmed, its contents have to be downloaded again":        "%s fue reducido, hay que volver a descargar su contenido",
+		"%s is missing %d files: %s":                                      "a %s le faltan %d archivos: %s",
+		"the post-download command failed: %v: %s":                        "el comando posterior a la descarga falló: %v: %s",
+		"the Cemu mlc01 folder %s doesn't exist":                          "la carpeta mlc01 de Cemu %s no existe",
+		"%s isn't a decrypted title, it has no code folder":               "%s no es un título descifrado, no tiene carpeta code",
+		"Quick verification, only the sizes of the contents were checked": "Verificación rápida, solo se comprobaron los tamaños de los contenidos",
+		"missing .h3 file":                            "falta el archivo .h3",
+		"Fetching metadata...":                        "Obteniendo metadatos...",
+		"Downloading contents...":                     "Descargando contenidos...",
+		"Decrypting...":                               "Descifrando...",
+		"%d contents of %016x failed to download: %s": "%d contenidos de %016x no se pudieron descargar: %s",
+		"no update is available for %016x":            "no hay ninguna actualización disponible para %016x",
+		"no data received for %s":                     "no se recibieron datos durante %s",
+		"the title was not downloaded within %s":      "el título no se descargó en %s",
+		"the download stalled for %s":                 "la descarga se detuvo durante %s",
+		"usage: wiiudownloader-server archive [--listen <address>] [--token <token>] [--json] <folder>": "uso: wiiudownloader-server archive [--listen <dirección>] [--token <token>] [--json] <carpeta>",
+		"%s is not a folder":                                                                                  "%s no es una carpeta",
+		"could not read the title keys file %s: %w":                                                           "no se pudo leer el archivo de claves de título %s: %w",
+		"unsupported title keys file %s, expected a JSON or CSV file":                                         "archivo de claves de título %s no compatible, se esperaba un archivo JSON o CSV",
+		"the title keys file %s has no valid title key":                                                       "el archivo de claves de título %s no tiene ninguna clave de título válida",
+		"common keys must be %d bytes long, got %d":                                                           "las claves comunes deben tener %d bytes, se obtuvieron %d",
+		"the ticket of %016x uses the unsupported common key index %d":                                        "el ticket de %016x usa el índice de clave común no compatible %d",
+		"the title key of %016x is encrypted with the %s common key, load the keys of your console to use it": "la clave de título de %016x está cifrada con la clave común de %s, carga las claves de tu consola para usarla",
+		"%s download error, status code: %d":                                                                  "error al descargar %s, código de estado: %d",
+		"%s has no contents":                                                                                  "%s no tiene contenidos",
+		"the contents of %s are not the ones of %016x v%d":                                                    "los contenidos de %s no son los de %016x v%d",
+		"no version of %016x on the CDN matches the contents of %s, give its version":                         "ninguna versión de %016x en el CDN coincide con los contenidos de %s, indica su versión",
+		"the title ID of %s is not in its name, give it":                                                      "el ID de título de %s no está en su nombre, indícalo",
+		"usage: WiiUDownloader restore [--tid <title ID>] [--version <version>] <title folder>...":            "uso: WiiUDownloader restore [--tid <ID de título>] [--version <versión>] <carpeta del título>...",
+		"%s: %016x v%d, nothing is missing":                                                                   "%s: %016x v%d, no falta nada",
+		"%s: %016x v%d, restored %s":                                                                          "%s: %016x v%d, restaurado %s",
+		"(the CDN has no ticket for it, one was generated)":                                                   "(el CDN no tiene ticket para él, se generó uno)",
+		"%s has contents of another version of the title: %s, download the title again":                       "%s tiene contenidos de otra versión del título: %s, descarga el título de nuevo",
+		"unknown encrypted contents policy %q, expected one of %s":                                            "política de contenidos cifrados %q desconocida, se esperaba una de %s",
+		"unknown archive format %q, expected zip or 7z":                                                       "formato de archivo comprimido %q desconocido, se esperaba zip o 7z",
+		"Packing into an archive...":                                                                          "Empaquetando en un archivo comprimido...",
+		"%s (%s) was updated":                                                                                 "%s (%s) se ha actualizado",
+		"expected string in title database, got %T":                                                           "se esperaba una cadena en la base de datos de títulos, se obtuvo %T",
+		"failed to parse title database: %w":                                                                  "no se ha podido analizar la base de datos de títulos: %w",
+		"title database does not contain any entries":                                                         "la base de datos de títulos no contiene ninguna entrada",
+		"title database download error, status code: %d":                                                      "error al descargar la base de datos de títulos, código de estado: %d",
+		"title database value 0x%X overflows %s":                                                              "el valor 0x%X de la base de datos de títulos desborda %s",
+		"unexpected literal in title database: %s":                                                            "literal inesperado en la base de datos de títulos: %s",
+		"unexpected title database element: %T":                                                               "elemento inesperado en la base de datos de títulos: %T",
+		"unexpected title database key: %T":                                                                   "clave inesperada en la base de datos de títulos: %T",
+		"unknown constant in title database: %s":                                                              "constante desconocida en la base de datos de títulos: %s",
+		"unsupported expression in title database: %T":                                                        "expresión no admitida en la base de datos de títulos: %T",
+		"unsupported operator in title database: %s":                                                          "operador no admitido en la base de datos de títulos: %s",
+		"%s line %d: expected a title ID and a version":                                                       "%s línea %d: se esperaba un ID de título y una versión",
+		"%s line %d: %w":                                       "%s línea %d: %w",
+		"%s line %d: invalid version %q":                       "%s línea %d: versión %q no válida",
+		"%s doesn't list any system title":                     "%s no contiene ningún título del sistema",
+		"usage: wiiudownloader-server <serve|archive> [flags]": "uso: wiiudownloader-server <serve|archive> [opciones]",
+		"Serving the gRPC API on %s":                           "Sirviendo la API gRPC en %s",
+	},
+	"de": {
+		"failed to download OSv10 cetk, length: %d":                    "OSv10-cetk konnte nicht heruntergeladen werden, Länge: %d",
+		"could not create '%s': %w":                                    "'%s' konnte nicht erstellt werden: %w",
+		"could not read %d bytes from '%s': %w":                        "%d Bytes konnten nicht aus '%s' gelesen werden: %w",
+		"H3 Hash mismatch":                                             "H3-Hash stimmt nicht überein",
+		"content hash mismatch":                                        "Hash des Inhalts stimmt nicht überein",
+		"content not found":                                            "Inhalt nicht gefunden",
+		"download error after %d attempts, status code: %d":            "Downloadfehler nach %d Versuchen, Statuscode: %d",
+		"tmd download error, status code: %d":                          "Fehler beim Herunterladen der TMD, Statuscode: %d",
+		"unsupported export format: %s":                                "nicht unterstütztes Exportformat: %s",
+		"no system titles found for region %s":                         "keine Systemtitel für die Region %s gefunden",
+		"failed to download system title %s: %w":                       "Systemtitel %s konnte nicht heruntergeladen werden: %w",
+		"unexpected entry in title ID list: %s":                        "unerwarteter Eintrag in der Titel-ID-Liste: %s",
+		"invalid title ID: %q":                                         "ungültige Titel-ID: %q",
+		"invalid manifest in %s: %w":                                   "ungültiges Manifest in %s: %w",
+		"decrypted path is too long for this filesystem (%d > %d): %s": "entschlüsselter Pfad ist zu lang für dieses Dateisystem (%d > %d): %s",
+		"title folder is already as short as possible: %s":             "der Titelordner ist bereits so kurz wie möglich: %s",
+		"cannot shorten title folder, %s already exists":               "Titelordner kann nicht gekürzt werden, %s existiert bereits",
+		"content %s is not part of the TMD":                            "Inhalt %s ist nicht Teil der TMD",
+		"unknown TMD version: %d":                                      "unbekannte TMD-Version: %d",
+		"size mismatch, expected %d bytes":                             "Größe stimmt nicht überein, erwartet wurden %d Bytes",
+		"missing":                                                      "fehlt",
+		"verification of %s failed: the data read back from disk differs from the data received, check your disk and RAM": "Überprüfung von %s fehlgeschlagen: die von der Festplatte gelesenen Daten weichen von den empfangenen ab, überprüfe Festplatte und RAM",
+		"verification of %s failed: the data received from the CDN does not match the TMD":                                "Überprüfung von %s fehlgeschlagen: die vom CDN empfangenen Daten stimmen nicht mit der TMD überein",
+		"usage: WiiUDownloader verify [--repair] [--quick] <title folder>...":                                             "Verwendung: WiiUDownloader verify [--repair] [--quick] <Titelordner>...",
+		"Title %016x v%d":                      "Titel %016x v%d",
+		"Metadata only, no contents to verify": "Nur Metadaten, keine Inhalte zu überprüfen",
+		"CONTENT\tSIZE\tEXPECTED\tRESULT":      "INHALT\tGRÖSSE\tERWARTET\tERGEBNIS",
+		"OK":                                   "OK",
+		"FAIL: %s":                             "FEHLER: %s",
+		"Downloading %d corrupted contents again":                                                     "%d beschädigte Inhalte werden erneut heruntergeladen",
+		"%s done (%s / %s)":                                                                           "%s fertig (%s / %s)",
+		"the folder name template is empty":                                                           "die Vorlage für den Ordnernamen ist leer",
+		"unknown placeholder in folder name template: %s":                                             "unbekannter Platzhalter in der Vorlage für den Ordnernamen: %s",
+		"invalid folder in folder name template: %q":                                                  "ungültiger Ordner in der Vorlage für den Ordnernamen: %q",
+		"invalid header, expected \"Name: value\": %q":                                                "ungültiger Header, erwartet wurde \"Name: Wert\": %q",
+		"--ipv4 and --ipv6 can't be used together":                                                    "--ipv4 und --ipv6 können nicht zusammen verwendet werden",
+		"invalid host override, expected \"address hostname\": %q":                                    "ungültige Host-Umleitung, erwartet wurde \"Adresse Hostname\": %q",
+		"usage: wiiudownloader-server serve --output <folder> [--listen <address>] [--token <token>]": "Verwendung: wiiudownloader-server serve --output <Ordner> [--listen <Adresse>] [--token <Token>]",
+		"warning: no --token set, anyone who can reach the server can control it":                     "Warnung: kein --token gesetzt, jeder, der den Server erreicht, kann ihn steuern",
+		"Listening on %s": "Lausche auf %s",
+		"usage: WiiUDownloader watch [--once] [--webhook <url>] [--download <folder>] <title ID>...":   "Verwendung: WiiUDownloader watch [--once] [--webhook <URL>] [--download <Ordner>] <Titel-ID>...",
+		"%s (%s) was updated from v%d to v%d":                                                          "%s (%s) wurde von v%d auf v%d aktualisiert",
+		"Started downloading %s (%s)":                                                                  "Download von %s (%s) gestartet",
+		"Finished downloading %s (%s)":                                                                 "Download von %s (%s) abgeschlossen",
+		"Failed to download %s (%s): %s":                                                               "%s (%s) konnte nicht heruntergeladen werden: %s",
+		"webhook answered with status code %d":                                                         "Webhook antwortete mit Statuscode %d",
+		"block %d (offset 0x%X) of content %s failed the %s hash check":                                "Block %d (Offset 0x%X) von Inhalt %s hat die %s-Hashprüfung nicht bestanden",
+		"the title key of %016x can't decrypt its contents, its ticket is wrong or for another region": "der Titelschlüssel von %016x kann seine Inhalte nicht entschlüsseln, sein Ticket ist falsch oder für eine andere Region",
+		"the Wii U common key must be %d bytes long, got %d":                                           "der gemeinsame Wii U-Schlüssel muss %d Bytes lang sein, ist aber %d",
+		"the key supplied is not the Wii U common key":                                                 "der angegebene Schlüssel ist nicht der gemeinsame Wii U-Schlüssel",
+		"could not read the keys file %s: %w":                                                          "die Schlüsseldatei %s konnte nicht gelesen werden: %w",
+		"invalid keys file %s: %w":                                                                     "ungültige Schlüsseldatei %s: %w",
+		"no Wii U common key found in %s, add a \"wiiu_common_key = <key>\" line":                      "kein gemeinsamer Wii U-Schlüssel in %s gefunden, füge eine Zeile \"wiiu_common_key = <Schlüssel>\" hinzu",
+		"not an OTP dump, it must be %d bytes long, got %d":                                            "kein OTP-Dump, er muss %d Bytes lang sein, ist aber %d",
+		"the OTP dump is empty, dump it again":                                                         "der OTP-Dump ist leer, erstelle ihn erneut",
+		"not a SEEPROM dump, it must be %d bytes long, got %d":                                         "kein SEEPROM-Dump, er muss %d Bytes lang sein, ist aber %d",
+		"%s has no %s, the OTP dump of the console is needed for the common key":                       "%s enthält kein %s, der OTP-Dump der Konsole wird für den gemeinsamen Schlüssel benötigt",
+		"TMD signature":    "TMD-Signatur",
+		"Ticket signature": "Ticket-Signatur",
+		"valid":            "gültig",
+		"INVALID":          "UNGÜLTIG",
+		"not checked":      "nicht geprüft",
+		"the XS certificate isn't cached yet, build a title.cert once with network access":           "das XS-Zertifikat ist noch nicht zwischengespeichert, erstelle einmal eine title.cert mit Netzwerkzugriff",
+		"cetk download error, status code: %d":                                                       "Fehler beim Herunterladen des cetk, Statuscode: %d",
+		"usage: WiiUDownloader offline <cert|verify|decrypt|package|pack> [flags] <title folder>...": "Verwendung: WiiUDownloader offline <cert|verify|decrypt|package|pack> [Optionen] <Titelordner>...",
+		"done": "fertig",
+		"%s was slimmed, its contents have to be downloaded again":        "%s wurde verkleinert, seine Inhalte müssen erneut heruntergeladen werden",
+		"%s is missing %d files: %s":                                      "in %s fehlen %d Dateien: %s",
+		"the post-download command failed: %v: %s":                        "der Befehl nach dem Download ist fehlgeschlagen: %v: %s",
+		"the Cemu mlc01 folder %s doesn't exist":                          "der mlc01-Ordner von Cemu %s existiert nicht",
+		"%s isn't a decrypted title, it has no code folder":               "%s ist kein entschlüsselter Titel, es hat keinen code-Ordner",
+		"Quick verification, only the sizes of the contents were checked": "Schnellprüfung, nur die Größen der Inhalte wurden geprüft",
+		"missing .h3 file":                            ".h3-Datei fehlt",
+		"Fetching metadata...":                        "Metadaten werden abgerufen...",
+		"Downloading contents...":                     "Inhalte werden heruntergeladen...",
+		"Decrypting...":                               "Wird entschlüsselt...",
+		"%d contents of %016x failed to download: %s": "%d Inhalte von %016x konnten nicht heruntergeladen werden: %s",
+		"no update is available for %016x":            "für %016x ist kein Update verfügbar",
+		"no data received for %s":                     "%s lang keine Daten empfangen",
+		"the title was not downloaded within %s":      "der Titel wurde nicht innerhalb von %s heruntergeladen",
+		"the download stalled for %s":                 "der Download hing %s lang",
+		"usage: wiiudownloader-server archive [--listen <address>] [--token <token>] [--json] <folder>": "Verwendung: wiiudownloader-server archive [--listen <Adresse>] [--token <Token>] [--json] <Ordner>",
+		"%s is not a folder":                                                                                  "%s ist kein Ordner",
+		"could not read the title keys file %s: %w":                                                           "die Titelschlüsseldatei %s konnte nicht gelesen werden: %w",
+		"unsupported title keys file %s, expected a JSON or CSV file":                                         "nicht unterstützte Titelschlüsseldatei %s, erwartet wird eine JSON- oder CSV-Datei",
+		"the title keys file %s has no valid title key":                                                       "die Titelschlüsseldatei %s enthält keinen gültigen Titelschlüssel",
+		"common keys must be %d bytes long, got %d":                                                           "gemeinsame Schlüssel müssen %d Bytes lang sein, erhalten: %d",
+		"the ticket of %016x uses the unsupported common key index %d":                                        "das Ticket von %016x verwendet den nicht unterstützten gemeinsamen Schlüsselindex %d",
+		"the title key of %016x is encrypted with the %s common key, load the keys of your console to use it": "der Titelschlüssel von %016x ist mit dem gemeinsamen Schlüssel der %s verschlüsselt, lade die Schlüssel deiner Konsole, um ihn zu verwenden",
+		"%s download error, status code: %d":                                                                  "Fehler beim Herunterladen von %s, Statuscode: %d",
+		"%s has no contents":                                                                                  "%s hat keine Inhalte",
+		"the contents of %s are not the ones of %016x v%d":                                                    "die Inhalte von %s sind nicht die von %016x v%d",
+		"no version of %016x on the CDN matches the contents of %s, give its version":                         "keine Version von %016x im CDN passt zu den Inhalten von %s, gib ihre Version an",
+		"the title ID of %s is not in its name, give it":                                                      "die Titel-ID von %s ist nicht in ihrem Namen, gib sie an",
+		"usage: WiiUDownloader restore [--tid <title ID>] [--version <version>] <title folder>...":            "Verwendung: WiiUDownloader restore [--tid <Titel-ID>] [--version <Version>] <Titelordner>...",
+		"%s: %016x v%d, nothing is missing":                                                                   "%s: %016x v%d, es fehlt nichts",
+		"%s: %016x v%d, restored %s":                                                                          "%s: %016x v%d, wiederhergestellt: %s",
+		"(the CDN has no ticket for it, one was generated)":                                                   "(das CDN hat kein Ticket dafür, es wurde eines erzeugt)",
+		"%s has contents of another version of the title: %s, download the title again":                       "%s enthält Inhalte einer anderen Version des Titels: %s, lade den Titel erneut herunter",
+		"unknown encrypted contents policy %q, expected one of %s":                                            "unbekannte Richtlinie für verschlüsselte Inhalte %q, erwartet wurde eine von %s",
+		"unknown archive format %q, expected zip or 7z":                                                       "unbekanntes Archivformat %q, erwartet wurde zip oder 7z",
+		"Packing into an archive...":                                                                          "Wird in ein Archiv gepackt...",
+		"%s (%s) was updated":                                                                                 "%s (%s) wurde aktualisiert",
+		"expected string in title database, got %T":                                                           "Zeichenkette in der Titeldatenbank erwartet, %T erhalten",
+		"failed to parse title database: %w":                                                                  "Titeldatenbank konnte nicht gelesen werden: %w",
+		"title database does not contain any entries":                                                         "Titeldatenbank enthält keine Einträge",
+		"title database download error, status code: %d":                                                      "Fehler beim Herunterladen der Titeldatenbank, Statuscode: %d",
+		"title database value 0x%X overflows %s":                                                              "Wert 0x%X der Titeldatenbank passt nicht in %s",
+		"unexpected literal in title database: %s":                                                            "Unerwartetes Literal in der Titeldatenbank: %s",
+		"unexpected title database element: %T":                                                               "Unerwartetes Element in der Titeldatenbank: %T",
+		"unexpected title database key: %T":                                                                   "Unerwarteter Schlüssel in der Titeldatenbank: %T",
+		"unknown constant in title database: %s":                                                              "Unbekannte Konstante in der Titeldatenbank: %s",
+		"unsupported expression in title database: %T":                                                        "Nicht unterstützter Ausdruck in der Titeldatenbank: %T",
+		"unsupported operator in title database: %s":                                                          "Nicht unterstützter Operator in der Titeldatenbank: %s",
+		"%s line %d: expected a title ID and a version":                                                       "%s Zeile %d: Titel-ID und Version erwartet",
+		"%s line %d: %w":                                       "%s Zeile %d: %w",
+		"%s line %d: invalid version %q":                       "%s Zeile %d: ungültige Version %q",
+		"%s doesn't list any system title":                     "%s enthält keine Systemtitel",
+		"usage: wiiudownloader-server <serve|archive> [flags]": "Verwendung: wiiudownloader-server <serve|archive> [Optionen]",
+		"Serving the gRPC API on %s":                           "Stelle die gRPC-API auf %s bereit",
+	},
+	"fr": {
+		"failed to download OSv10 cetk, length: %d":                    "échec du téléchargement du cetk OSv10, taille : %d",
+		"could not create '%s': %w":                                    "impossible de créer '%s' : %w",
+		"could not read %d bytes from '%s': %w":                        "impossible de lire %d octets depuis '%s' : %w",
+		"H3 Hash mismatch":                                             "le hash H3 ne correspond pas",
+		"content hash mismatch":                                        "le hash du contenu ne correspond pas",
+		"content not found":                                            "contenu introuvable",
+		"download error after %d attempts, status code: %d":            "erreur de téléchargement après %d tentatives, code d'état : %d",
+		"tmd download error, status code: %d":                          "erreur de téléchargement du tmd, code d'état : %d",
+		"unsupported export format: %s":                                "format d'export non pris en charge : %s",
+		"no system titles found for region %s":                         "aucun titre système trouvé pour la région %s",
+		"failed to download system title %s: %w":                       "échec du téléchargement du titre système %s : %w",
+		"unexpected entry in title ID list: %s":                        "entrée inattendue dans la liste des ID de titre : %s",
+		"invalid title ID: %q":                                         "ID de titre invalide : %q",
+		"invalid manifest in %s: %w":                                   "manifeste invalide dans %s : %w",
+		"decrypted path is too long for this filesystem (%d > %d): %s": "le chemin déchiffré est trop long pour ce système de fichiers (%d > %d) : %s",
+		"title folder is already as short as possible: %s":             "le dossier du titre est déjà aussi court que possible : %s",
+		"cannot shorten title folder, %s already exists":               "impossible de raccourcir le dossier du titre, %s existe déjà",
+		"content %s is not part of the TMD":                            "le contenu %s ne fait pas partie du TMD",
+		"unknown TMD version: %d":                                      "version de TMD inconnue : %d",
+		"size mismatch, expected %d bytes":                             "la taille ne correspond pas, %d octets attendus",
+		"missing":                                                      "manquant",
+		"verification of %s failed: the data read back from disk differs from the data received, check your disk and RAM": "la vérification de %s a échoué : les données relues depuis le disque diffèrent des données reçues, vérifiez votre disque et votre RAM",
+		"verification of %s failed: the data received from the CDN does not match the TMD":                                "la vérification de %s a échoué : les données reçues du CDN ne correspondent pas au TMD",
+		"usage: WiiUDownloader verify [--repair] [--quick] <title folder>...":                                             "utilisation : WiiUDownloader verify [--repair] [--quick] <dossier du titre>...",
+		"Title %016x v%d":                      "Titre %016x v%d",
+		"Metadata only, no contents to verify": "Métadonnées uniquement, aucun contenu à vérifier",
+		"CONTENT\tSIZE\tEXPECTED\tRESULT":      "CONTENU\tTAILLE\tATTENDU\tRÉSULTAT",
+		"OK":                                   "OK",
+		"FAIL: %s":                             "ÉCHEC : %s",
+		"Downloading %d corrupted contents again":                                                     "Nouveau téléchargement de %d contenus corrompus",
+		"%s done (%s / %s)":                                                                           "%s terminé (%s / %s)",
+		"the folder name template is empty":                                                           "le modèle de nom de dossier est vide",
+		"unknown placeholder in folder name template: %s":                                             "espace réservé inconnu dans le modèle de nom de dossier : %s",
+		"invalid folder in folder name template: %q":                                                  "dossier invalide dans le modèle de nom de dossier : %q",
+		"invalid header, expected \"Name: value\": %q":                                                "en-tête invalide, \"Nom: valeur\" attendu : %q",
+		"--ipv4 and --ipv6 can't be used together":                                                    "--ipv4 et --ipv6 ne peuvent pas être utilisés ensemble",
+		"invalid host override, expected \"address hostname\": %q":                                    "redirection d'hôte invalide, \"adresse nom_d_hôte\" attendu : %q",
+		"usage: wiiudownloader-server serve --output <folder> [--listen <address>] [--token <token>]": "utilisation : wiiudownloader-server serve --output <dossier> [--listen <adresse>] [--token <jeton>]",
+		"warning: no --token set, anyone who can reach the server can control it":                     "avertissement : aucun --token défini, toute personne pouvant accéder au serveur peut le contrôler",
+		"Listening on %s": "En écoute sur %s",
+		"usage: WiiUDownloader watch [--once] [--webhook <url>] [--download <folder>] <title ID>...":   "utilisation : WiiUDownloader watch [--once] [--webhook <url>] [--download <dossier>] <ID de titre>...",
+		"%s (%s) was updated from v%d to v%d":                                                          "%s (%s) a été mis à jour de v%d à v%d",
+		"Started downloading %s (%s)":                                                                  "Début du téléchargement de %s (%s)",
+		"Finished downloading %s (%s)":                                                                 "Téléchargement de %s (%s) terminé",
+		"Failed to download %s (%s): %s":                                                               "Échec du téléchargement de %s (%s) : %s",
+		"webhook answered with status code %d":                                                         "le webhook a répondu avec le code d’état %d",
+		"block %d (offset 0x%X) of content %s failed the %s hash check":                                "le bloc %d (décalage 0x%X) du contenu %s a échoué à la vérification du hash %s",
+		"the title key of %016x can't decrypt its contents, its ticket is wrong or for another region": "la clé du titre %016x ne peut pas déchiffrer ses contenus, son ticket est incorrect ou destiné à une autre région",
+		"the Wii U common key must be %d bytes long, got %d":                                           "la clé commune Wii U doit faire %d octets, elle en fait %d",
+		"the key supplied is not the Wii U common key":                                                 "la clé fournie n'est pas la clé commune Wii U",
+		"could not read the keys file %s: %w":                                                          "impossible de lire le fichier de clés %s : %w",
+		"invalid keys file %s: %w":                                                                     "fichier de clés invalide %s : %w",
+		"no Wii U common key found in %s, add a \"wiiu_common_key = <key>\" line":                      "aucune clé commune Wii U trouvée dans %s, ajoutez une ligne \"wiiu_common_key = <clé>\"",
+		"not an OTP dump, it must be %d bytes long, got %d":                                            "ce n'est pas un dump de l'OTP, il doit faire %d octets, il en fait %d",
+		"the OTP dump is empty, dump it again":                                                         "le dump de l'OTP est vide, refaites-le",
+		"not a SEEPROM dump, it must be %d bytes long, got %d":                                         "ce n'est pas un dump de la SEEPROM, il doit faire %d octets, il en fait %d",
+		"%s has no %s, the OTP dump of the console is needed for the common key":                       "%s n'a pas de %s, le dump de l'OTP de la console est nécessaire pour la clé commune",
+		"TMD signature":    "Signature du TMD",
+		"Ticket signature": "Signature du ticket",
+		"valid":            "valide",
+		"INVALID":          "INVALIDE",
+		"not checked":      "non vérifiée",
+		"the XS certificate isn't cached yet, build a title.cert once with network access":           "le certificat XS n'est pas encore en cache, générez un title.cert une fois avec un accès au réseau",
+		"cetk download error, status code: %d":                                                       "erreur de téléchargement du cetk, code d'état : %d",
+		"usage: WiiUDownloader offline <cert|verify|decrypt|package|pack> [flags] <title folder>...": "utilisation : WiiUDownloader offline <cert|verify|decrypt|package|pack> [options] <dossier du titre>...",
+		"done": "terminé",
+		"%s was slimmed, its contents have to be downloaded again":        "%s a été allégé, ses contenus doivent être téléchargés à nouveau",
+		"%s is missing %d files: %s":                                      "%s : %d fichiers manquants : %s",
+		"the post-download command failed: %v: %s":                        "la commande après le téléchargement a échoué : %v : %s",
+		"the Cemu mlc01 folder %s doesn't exist":                          "le dossier mlc01 de Cemu %s n'existe pas",
+		"%s isn't a decrypted title, it has no code folder":               "%s n'est pas un titre déchiffré, il n'a pas de dossier code",
+		"Quick verification, only the sizes of the contents were checked": "Vérification rapide, seules les tailles des contenus ont été vérifiées",
+		"missing .h3 file":                            "fichier .h3 manquant",
+		"Fetching metadata...":                        "Récupération des métadonnées...",
+		"Downloading contents...":                     "Téléchargement des contenus...",
+		"Decrypting...":                               "Déchiffrement...",
+		"%d contents of %016x failed to download: %s": "%d contenus de %016x n'ont pas pu être téléchargés : %s",
+		"no update is available for %016x":            "aucune mise à jour n'est disponible pour %016x",
+		"no data received for %s":                     "aucune donnée reçue pendant %s",
+		"the title was not downloaded within %s":      "le titre n'a pas été téléchargé en %s",
+		"the download stalled for %s":                 "le téléchargement est resté bloqué pendant %s",
+		"usage: wiiudownloader-server archive [--listen <address>] [--token <token>] [--json] <folder>": "utilisation : wiiudownloader-server archive [--listen <adresse>] [--token <jeton>] [--json] <dossier>",
+		"%s is not a folder":                                                                                  "%s n'est pas un dossier",
+		"could not read the title keys file %s: %w":                                                           "impossible de lire le fichier de clés de titre %s : %w",
+		"unsupported title keys file %s, expected a JSON or CSV file":                                         "fichier de clés de titre %s non pris en charge, un fichier JSON ou CSV est attendu",
+		"the title keys file %s has no valid title key":                                                       "le fichier de clés de titre %s ne contient aucune clé de titre valide",
+		"common keys must be %d bytes long, got %d":                                                           "les clés communes doivent faire %d octets, reçu %d",
+		"the ticket of %016x uses the unsupported common key index %d":                                        "le ticket de %016x utilise l'index de clé commune non pris en charge %d",
+		"the title key of %016x is encrypted with the %s common key, load the keys of your console to use it": "la clé de titre de %016x est chiffrée avec la clé commune %s, chargez les clés de votre console pour l'utiliser",
+		"%s download error, status code: %d":                                                                  "erreur de téléchargement de %s, code d'état : %d",
+		"%s has no contents":                                                                                  "%s n'a aucun contenu",
+		"the contents of %s are not the ones of %016x v%d":                                                    "les contenus de %s ne sont pas ceux de %016x v%d",
+		"no version of %016x on the CDN matches the contents of %s, give its version":                         "aucune version de %016x sur le CDN ne correspond aux contenus de %s, indiquez sa version",
+		"the title ID of %s is not in its name, give it":                                                      "l'ID de titre de %s n'est pas dans son nom, indiquez-le",
+		"usage: WiiUDownloader restore [--tid <title ID>] [--version <version>] <title folder>...":            "utilisation : WiiUDownloader restore [--tid <ID de titre>] [--version <version>] <dossier du titre>...",
+		"%s: %016x v%d, nothing is missing":                                                                   "%s : %016x v%d, rien ne manque",
+		"%s: %016x v%d, restored %s":                                                                          "%s : %016x v%d, restauré %s",
+		"(the CDN has no ticket for it, one was generated)":                                                   "(le CDN n'a pas de ticket pour lui, un ticket a été généré)",
+		"%s has contents of another version of the title: %s, download the title again":                       "%s contient des contenus d'une autre version du titre : %s, téléchargez de nouveau le titre",
+		"unknown encrypted contents policy %q, expected one of %s":                                            "politique de contenus chiffrés %q inconnue, une de %s était attendue",
+		"unknown archive format %q, expected zip or 7z":                                                       "format d'archive %q inconnu, zip ou 7z était attendu",
+		"Packing into an archive...":                                                                          "Mise en archive...",
+		"%s (%s) was updated":                                                                                 "%s (%s) a été mis à jour",
+		"expected string in title database, got %T":                                                           "chaîne attendue dans la base de données des titres, %T obtenu",
+		"failed to parse title database: %w":                                                                  "impossible d’analyser la base de données des titres : %w",
+		"title database does not contain any entries":                                                         "la base de données des titres ne contient aucune entrée",
+		"title database download error, status code: %d":                                                      "erreur de téléchargement de la base de données des titres, code d’état : %d",
+		"title database value 0x%X overflows %s":                                                              "la valeur 0x%X de la base de données des titres dépasse %s",
+		"unexpected literal in title database: %s":                                                            "littéral inattendu dans la base de données des titres : %s",
+		"unexpected title database element: %T":                                                               "élément inattendu dans la base de données des titres : %T",
+		"unexpected title database key: %T":                                                                   "clé inattendue dans la base de données des titres : %T",
+		"unknown constant in title database: %s":                                                              "constante inconnue dans la base de données des titres : %s",
+		"unsupported expression in title database: %T":                                                        "expression non prise en charge dans la base de données des titres : %T",
+		"unsupported operator in title database: %s":                                                          "opérateur non pris en charge dans la base de données des titres : %s",
+		"%s line %d: expected a title ID and a version":                                                       "%s ligne %d : un ID de titre et une version sont attendus",
+		"%s line %d: %w":                                       "%s ligne %d : %w",
+		"%s line %d: invalid version %q":                       "%s ligne %d : version %q invalide",
+		"%s doesn't list any system title":                     "%s ne contient aucun titre système",
+		"usage: wiiudownloader-server <serve|archive> [flags]": "utilisation : wiiudownloader-server <serve|archive> [options]",
+		"Serving the gRPC API on %s":                           "API gRPC servie sur %s",
+	},
+}
+
+// normalizeLocale turns values like "es_ES.UTF-8" or "pt-BR" into the
+// language code used by the catalogs.
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "_-.@"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
+
+// DetectLocale returns the language of the environment, following the usual
+// LC_ALL, LC_MESSAGES and LANG precedence.
+func DetectLocale() string {
+	for _, variable := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := normalizeLocale(os.Getenv(variable)); value != "" && value != "c" && value != "posix" {
+			return value
+		}
+	}
+	return DEFAULT_LOCALE
+}
+
+// SetLocale selects the language of the messages returned by the library, an
+// empty locale uses the one of the environment. Unknown languages fall back to English.
+func SetLocale(locale string) {
+	if locale == "" {
+		locale = DetectLocale()
+	}
+	locale = normalizeLocale(locale)
+	if _, ok := localeNames[locale]; !ok {
+		locale = DEFAULT_LOCALE
+	}
+
+	localeMutex.Lock()
+	defer localeMutex.Unlock()
+	currentLocale = locale
+}
+
+func GetLocale() string {
+	localeMutex.RLock()
+	defer localeMutex.RUnlock()
+	return currentLocale
+}
+
+// GetLocaleNames returns the supported languages, keyed by language code.
+func GetLocaleNames() map[string]string {
+	return localeNames
+}
+
+// Localize translates a message, or a format string, to the current locale.
+func Localize(message string) string {
+	localeMutex.RLock()
+	defer localeMutex.RUnlock()
+	if translated, ok := messageCatalogs[currentLocale][message]; ok {
+		return translated
+	}
+	return message
+}
@@ -0,0 +1,106 @@
+package wiiudownloader
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const manifestFilename = "manifest.json"
+
+type ManifestContent struct {
+	ID    string `json:"id"`
+	Size  uint64 `json:"size"`
+	Hash  string `json:"hash"`
+	HasH3 bool   `json:"hasH3"`
+}
+
+// Manifest describes a downloaded title folder. It is the record other tools
+// (verification, library scans) use to know what the folder is supposed to hold.
+type Manifest struct {
+	TitleID                  string            `json:"titleID"`
+	Name                     string            `json:"name"`
+	Version                  uint16            `json:"version"`
+	Contents                 []ManifestContent `json:"contents"`
+	Decrypted                bool              `json:"decrypted"`
+	EncryptedContentsDeleted bool              `json:"encryptedContentsDeleted"`           // not in the title folder anymore, deleted or archived
+	EncryptedContentsArchive string            `json:"encryptedContentsArchive,omitempty"` // the subfolder or zip file they were moved to
+	DecryptedPath            string            `json:"decryptedPath,omitempty"`            // set when decrypted outside of the title folder
+	Slimmed                  bool              `json:"slimmed"`                            // only title.tmd/tik/cert are kept
+	Partial                  bool              `json:"partial,omitempty"`                  // only some of the contents were downloaded
+	TMDSignature             string            `json:"tmdSignature,omitempty"`             // one of the SIGNATURE_STATUS_* values
+	TicketSignature          string            `json:"ticketSignature,omitempty"`          // invalid for generated tickets
+	CemuPath                 string            `json:"cemuPath,omitempty"`                 // set when installed to the mlc01 folder of Cemu
+	LastVerifiedAt           *time.Time        `json:"lastVerifiedAt,omitempty"`           // when VerifyTitle last hashed the contents
+	LastVerificationFailed   bool              `json:"lastVerificationFailed,omitempty"`
+	UpdatedAt                time.Time         `json:"updatedAt"`
+}
+
+func newManifest(tmd *TMD) *Manifest {
+	manifest := &Manifest{
+		TitleID:  fmt.Sprintf("%016x", tmd.TitleID),
+		Name:     GetTitleEntryFromTid(tmd.TitleID).Name,
+		Version:  tmd.TitleVersion,
+		Contents: make([]ManifestContent, 0, len(tmd.Contents)),
+	}
+	for _, content := range tmd.Contents {
+		manifest.Contents = append(manifest.Contents, ManifestContent{
+			ID:    fmt.Sprintf("%08X", content.ID),
+			Size:  content.Size,
+			Hash:  hex.EncodeToString(content.Hash[:20]),
+			HasH3: content.Type&0x2 == 2,
+		})
+	}
+	return manifest
+}
+
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(path, manifestFilename))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf(Localize("invalid manifest in %s: %w"), path, err)
+	}
+	return manifest, nil
+}
+
+func WriteManifest(path string, manifest *Manifest) error {
+	manifest.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(path, manifestFilename), data, 0644)
+}
+
+// SlimTitle removes the contents of a downloaded title, keeping title.tmd,
+// title.tik, title.cert and the manifest, which is marked as slimmed.
+func SlimTitle(path string) error {
+	tmd, err := readTMDFromDir(path)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		manifest = newManifest(tmd)
+	}
+
+	for _, content := range tmd.Contents {
+		for _, name := range []string{fmt.Sprintf("%08X", content.ID), fmt.Sprintf("%08x", content.ID)} {
+			for _, ext := range []string{".app", ".h3"} {
+				if err := os.Remove(filepath.Join(path, name+ext)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+	}
+
+	manifest.Slimmed = true
+	return WriteManifest(path, manifest)
+}
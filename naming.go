@@ -0,0 +1,129 @@
+package wiiudownloader
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DEFAULT_TITLE_DIR_TEMPLATE is the folder name used for downloaded titles
+// unless the user configures a different one.
+const DEFAULT_TITLE_DIR_TEMPLATE = "{name} [{kind}] [{tid}]"
+
+var titleDirPlaceholderRegexp = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// titleDirPlaceholders are the placeholders a title folder template can use.
+var titleDirPlaceholders = []string{"name", "tid", "region", "version", "kind"}
+
+func normalizeFilename(filename string) string {
+	var out strings.Builder
+	shouldAppend := true
+	firstChar := true
+
+	for _, c := range filename {
+		switch {
+		case c == '_':
+			if shouldAppend {
+				out.WriteRune('_')
+				shouldAppend = false
+			}
+			firstChar = false
+		case c == ' ':
+			if shouldAppend && !firstChar {
+				out.WriteRune(' ')
+				shouldAppend = false
+			}
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'):
+			out.WriteRune(c)
+			shouldAppend = true
+			firstChar = false
+		}
+	}
+
+	result := out.String()
+	if len(result) > 0 && result[len(result)-1] == '_' {
+		result = result[:len(result)-1]
+	}
+
+	return result
+}
+
+// GetTitleDirPlaceholders returns the placeholders supported by title folder templates.
+func GetTitleDirPlaceholders() []string {
+	return titleDirPlaceholders
+}
+
+func isTitleDirPlaceholder(name string) bool {
+	for _, placeholder := range titleDirPlaceholders {
+		if placeholder == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTitleDirTemplate checks that a template only uses known placeholders
+// and always produces a folder name.
+func ValidateTitleDirTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return errors.New(Localize("the folder name template is empty"))
+	}
+	for _, match := range titleDirPlaceholderRegexp.FindAllStringSubmatch(template, -1) {
+		if !isTitleDirPlaceholder(match[1]) {
+			return fmt.Errorf(Localize("unknown placeholder in folder name template: %s"), match[0])
+		}
+	}
+	for _, component := range strings.Split(filepath.ToSlash(template), "/") {
+		if strings.TrimSpace(component) == "" || component == "." || component == ".." {
+			return fmt.Errorf(Localize("invalid folder in folder name template: %q"), component)
+		}
+	}
+	return nil
+}
+
+// TitleDirTemplateUsesVersion reports whether rendering the template needs the
+// version of the title, which is only known once its TMD was fetched.
+func TitleDirTemplateUsesVersion(template string) bool {
+	return strings.Contains(template, "{version}")
+}
+
+// FormatTitleDir renders a title folder template. A "/" in the template creates
+// subfolders, every folder name is sanitized separately.
+func FormatTitleDir(template string, title TitleEntry, version uint16) string {
+	return formatTitleDir(template, title, fmt.Sprintf("v%d", version))
+}
+
+// PreviewTitleDir renders a title folder template before the version of the
+// title is known, the {version} placeholder is kept as is.
+func PreviewTitleDir(template string, title TitleEntry) string {
+	return formatTitleDir(template, title, "{version}")
+}
+
+// ResolveTitleDirVersion fills in the {version} placeholder left by PreviewTitleDir.
+func ResolveTitleDirVersion(path string, version uint16) string {
+	return strings.ReplaceAll(path, "{version}", fmt.Sprintf("v%d", version))
+}
+
+func formatTitleDir(template string, title TitleEntry, version string) string {
+	if ValidateTitleDirTemplate(template) != nil {
+		template = DEFAULT_TITLE_DIR_TEMPLATE
+	}
+
+	values := map[string]string{
+		"name":    normalizeFilename(title.Name),
+		"tid":     fmt.Sprintf("%016x", title.TitleID),
+		"region":  GetFormattedRegion(title.Region),
+		"version": version,
+		"kind":    GetFormattedKind(title.TitleID),
+	}
+
+	components := strings.Split(filepath.ToSlash(template), "/")
+	for i, component := range components {
+		components[i] = SanitizeFilename(titleDirPlaceholderRegexp.ReplaceAllStringFunc(component, func(placeholder string) string {
+			return values[strings.Trim(placeholder, "{}")]
+		}))
+	}
+	return filepath.Join(components...)
+}
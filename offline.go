@@ -0,0 +1,57 @@
+package wiiudownloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// missingContents returns the names of the contents of tmd, and of their .h3
+// files, that aren't in the title folder at path.
+func missingContents(path string, tmd *TMD) []string {
+	missing := make([]string, 0)
+	for _, content := range tmd.Contents {
+		name, found := findContentFile(path, content.ID)
+		if !found {
+			missing = append(missing, name+".app")
+			continue
+		}
+		if content.Type&0x2 == 0 {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, name+".h3")); err != nil {
+			missing = append(missing, name+".h3")
+		}
+	}
+	return missing
+}
+
+// PackageTitle makes an already downloaded title folder installable without
+// any network access: a ticket is generated when title.tik is missing and
+// title.cert is built again from the certificates of title.tmd, title.tik and
+// the cache. Every content must be in the folder, encrypted.
+func PackageTitle(path string) error {
+	tmd, err := readTMDFromDir(path)
+	if err != nil {
+		return err
+	}
+	if manifest, err := ReadManifest(path); err == nil && manifest.Slimmed {
+		return fmt.Errorf(Localize("%s was slimmed, its contents have to be downloaded again"), path)
+	}
+	if missing := missingContents(path, tmd); len(missing) > 0 {
+		return fmt.Errorf(Localize("%s is missing %d files: %s"), path, len(missing), strings.Join(missing, ", "))
+	}
+
+	tikPath := filepath.Join(path, "title.tik")
+	if _, err := os.Stat(tikPath); os.IsNotExist(err) {
+		titleKey, err := GetTicketTitleKey(tmd.TitleID)
+		if err != nil {
+			return err
+		}
+		if err := GenerateTicket(tikPath, tmd.TitleID, titleKey, tmd.TitleVersion); err != nil {
+			return checkDiskFull(err)
+		}
+	}
+	return checkDiskFull(GenerateCert(tmd, filepath.Join(path, "title.cert"), nil, nil))
+}
@@ -0,0 +1,329 @@
+package wiiudownloader
+
+import (
+	"net/http"
+	"time"
+)
+
+// DownloadTitleOptions controls how DownloadTitleWithOptions downloads a title.
+// The zero value downloads the encrypted contents with the default concurrency
+// and retry policy.
+type DownloadTitleOptions struct {
+	Client                  *http.Client
+	Decrypt                 bool
+	DeleteEncryptedContents bool // only used with Decrypt, see EncryptedContentsPolicy
+	Concurrency             int  // contents downloaded at once, 0 means maxConcurrentDownloads
+	MaxRetries              int  // attempts per content, 0 means maxRetries
+	RetryDelay              time.Duration
+	// TitleDirTemplate, when not empty, makes the title be downloaded to a
+	// folder named after it (see FormatTitleDir) inside the output directory
+	TitleDirTemplate      string
+	VerifyAfterWrite      bool
+	HighPerformanceWrites bool
+	// DecryptedOutputDirectory, when not empty, makes the decrypted files be
+	// written to a folder named like the title folder inside it, instead of
+	// next to the encrypted contents. Only used with Decrypt
+	DecryptedOutputDirectory string
+	// Version is the version of the title to download, the latest one when
+	// negative. newDownloadTitleOptions sets it to -1 unless WithVersion is used
+	Version int
+	// ContentIDs, when not nil, limits the download to these contents of the
+	// TMD. Decrypt is ignored unless every content is downloaded
+	ContentIDs []uint32
+	// IncrementalUpdates takes the contents that didn't change from an older
+	// version of the title on disk, in the title folder or the folders next to
+	// it, instead of downloading them again
+	IncrementalUpdates bool
+	// ContentStore, when not empty, is a folder shared by every title where
+	// contents are kept by their hash, so the ones that are the same in
+	// several titles are only downloaded once
+	ContentStore string
+	// PostDownloadHook, when not empty, is a command run once the title was
+	// downloaded, see RunPostDownloadHook
+	PostDownloadHook string
+	// CemuMLCPath, when not empty, is the mlc01 folder of Cemu the title is
+	// installed to once decrypted, see InstallToCemu. Only used with Decrypt
+	CemuMLCPath string
+	// SharedBandwidthLimiter, when not nil, limits the speed of the title
+	// along with the other titles downloaded with it at the same time
+	SharedBandwidthLimiter *BandwidthLimiter
+	// ContinueOnContentFailure keeps downloading the other contents when one
+	// fails, the title then ends with a PartialDownloadError
+	ContinueOnContentFailure bool
+	// RequestTimeout, when not 0, aborts a request that received nothing for
+	// that long, waiting for the answer of the CDN or in the middle of the
+	// data. It counts as a failed attempt, and is retried
+	RequestTimeout time.Duration
+	// TitleTimeout, when not 0, stops the title when it wasn't downloaded
+	// within that long, so a hung title doesn't hold up a queue
+	TitleTimeout time.Duration
+	// StallTimeout, when not 0, reconnects a content whose data stopped
+	// arriving for that long in the middle of the transfer, resuming from
+	// where it stopped. Unlike RequestTimeout it doesn't count as an attempt
+	StallTimeout time.Duration
+	// Segments, when more than 1, is the number of connections the contents
+	// of 64 MiB or more are downloaded with, each fetching a range of the
+	// content. The server must support range requests, the content is
+	// downloaded over a single connection otherwise
+	Segments int
+	// SyncWrites also flushes the title folder to the disk when a content is
+	// done, and the metadata and decrypted files once written, so a power
+	// loss can't lose a title that was reported as complete. The contents
+	// themselves are always flushed before they are marked as done
+	SyncWrites bool
+	// EncryptedContentsPolicy is what happens to the encrypted contents once
+	// decrypted, one of the ENCRYPTED_CONTENTS_* values. Only used with
+	// Decrypt. When empty, DeleteEncryptedContents chooses between
+	// ENCRYPTED_CONTENTS_DELETE and ENCRYPTED_CONTENTS_KEEP
+	EncryptedContentsPolicy string
+	// ArchiveFormat, when not empty, replaces the title folder with an
+	// archive of this format once the title is complete, see
+	// WithArchiveOutput
+	ArchiveFormat string
+}
+
+type DownloadTitleOption func(*DownloadTitleOptions)
+
+func WithHTTPClient(client *http.Client) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.Client = client
+	}
+}
+
+func WithDecryption(deleteEncryptedContents bool) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.Decrypt = true
+		options.DeleteEncryptedContents = deleteEncryptedContents
+		options.EncryptedContentsPolicy = ""
+	}
+}
+
+// WithDecryptedOutputDirectory writes the decrypted files to a folder inside
+// directory, for example to keep the encrypted contents on a hard drive and
+// write the decrypted copy to an SD card.
+func WithDecryptedOutputDirectory(directory string) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.DecryptedOutputDirectory = directory
+	}
+}
+
+// WithVersion downloads a version of the title other than the latest one.
+func WithVersion(version uint16) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.Version = int(version)
+	}
+}
+
+// WithContents only downloads the contents of the title with these IDs, along
+// with its TMD, ticket and certificate.
+func WithContents(contentIDs []uint32) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.ContentIDs = contentIDs
+	}
+}
+
+// WithIncrementalUpdates only downloads the contents that changed since an
+// older version of the title already on disk.
+func WithIncrementalUpdates(incrementalUpdates bool) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.IncrementalUpdates = incrementalUpdates
+	}
+}
+
+// WithContentStore takes the contents already in the content store at path
+// instead of downloading them, and adds the downloaded ones to it.
+func WithContentStore(path string) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.ContentStore = path
+	}
+}
+
+// WithPostDownloadHook runs command once the title was downloaded, for example
+// to convert or upload it. A failing command fails the download.
+func WithPostDownloadHook(command string) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.PostDownloadHook = command
+	}
+}
+
+// WithCemuInstall installs the title to the mlc01 folder of Cemu at mlcPath
+// once it is decrypted, so it shows up in the game list of Cemu.
+func WithCemuInstall(mlcPath string) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.CemuMLCPath = mlcPath
+	}
+}
+
+// WithSharedBandwidthLimiter limits the title along with every other title
+// downloaded with limiter, for frontends downloading several titles at once
+// within a single bandwidth limit.
+func WithSharedBandwidthLimiter(limiter *BandwidthLimiter) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.SharedBandwidthLimiter = limiter
+	}
+}
+
+// WithContinueOnContentFailure keeps downloading the other contents of the
+// title when one still fails once its retries were used up, instead of
+// stopping the whole title. The title isn't decrypted and the failed contents
+// are listed by the PartialDownloadError returned at the end.
+func WithContinueOnContentFailure(continueOnContentFailure bool) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.ContinueOnContentFailure = continueOnContentFailure
+	}
+}
+
+// WithTimeouts gives up on requests that receive nothing for requestTimeout,
+// retrying them, and on the whole title after titleTimeout. Either can be 0
+// to never time out. Both fail with an error wrapping ErrTimeout.
+func WithTimeouts(requestTimeout, titleTimeout time.Duration) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.RequestTimeout = requestTimeout
+		options.TitleTimeout = titleTimeout
+	}
+}
+
+// WithStallDetection reconnects the contents whose data stops arriving for
+// stallTimeout mid-transfer, resuming them with a range request without
+// using up one of their retries. 0 turns it off.
+func WithStallDetection(stallTimeout time.Duration) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.StallTimeout = stallTimeout
+	}
+}
+
+// WithSegmentedDownloads downloads each large content with segments range
+// requests at once, which helps filling high-latency connections. Each segment
+// is retried on its own. 0 or 1 downloads every content over one connection.
+func WithSegmentedDownloads(segments int) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.Segments = segments
+	}
+}
+
+// WithSyncWrites flushes the title folders, their metadata and the decrypted
+// files to the disk as they are completed, for archives on external drives,
+// at the cost of some speed.
+func WithSyncWrites(enabled bool) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.SyncWrites = enabled
+	}
+}
+
+// WithEncryptedContentsPolicy decrypts the title, then does what policy, one
+// of the ENCRYPTED_CONTENTS_* values, says to its encrypted contents.
+func WithEncryptedContentsPolicy(policy string) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.Decrypt = true
+		options.EncryptedContentsPolicy = policy
+		options.DeleteEncryptedContents = policy == ENCRYPTED_CONTENTS_DELETE
+	}
+}
+
+// WithArchiveOutput packs the completed title folder, and the folder of its
+// decrypted files when they are written elsewhere, into archives of format,
+// one of the ARCHIVE_FORMAT_* values, next to them and removes the folders,
+// see ArchiveTitleFolder. It happens after the post download hook.
+func WithArchiveOutput(format string) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.ArchiveFormat = format
+	}
+}
+
+func WithConcurrency(concurrency int) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.Concurrency = concurrency
+	}
+}
+
+func WithRetryPolicy(maxRetries int, retryDelay time.Duration) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.MaxRetries = maxRetries
+		options.RetryDelay = retryDelay
+	}
+}
+
+func WithTitleDirTemplate(template string) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.TitleDirTemplate = template
+	}
+}
+
+func WithVerifyAfterWrite(verifyAfterWrite bool) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.VerifyAfterWrite = verifyAfterWrite
+	}
+}
+
+func WithHighPerformanceWrites(highPerformanceWrites bool) DownloadTitleOption {
+	return func(options *DownloadTitleOptions) {
+		options.HighPerformanceWrites = highPerformanceWrites
+	}
+}
+
+func newDownloadTitleOptions(options []DownloadTitleOption) DownloadTitleOptions {
+	downloadOptions := DownloadTitleOptions{Version: -1}
+	for _, option := range options {
+		option(&downloadOptions)
+	}
+	if downloadOptions.Client == nil {
+		downloadOptions.Client = NewHTTPClient(ClientOptions{})
+	}
+	if downloadOptions.Concurrency <= 0 {
+		downloadOptions.Concurrency = maxConcurrentDownloads
+	}
+	if downloadOptions.MaxRetries <= 0 {
+		downloadOptions.MaxRetries = maxRetries
+	}
+	if downloadOptions.RetryDelay <= 0 {
+		downloadOptions.RetryDelay = retryDelay
+	}
+	if downloadOptions.EncryptedContentsPolicy == "" {
+		downloadOptions.EncryptedContentsPolicy = ENCRYPTED_CONTENTS_KEEP
+		if downloadOptions.DeleteEncryptedContents {
+			downloadOptions.EncryptedContentsPolicy = ENCRYPTED_CONTENTS_DELETE
+		}
+	}
+	return downloadOptions
+}
+
+// DecryptOptions controls how DecryptContentsWithPolicy handles a title
+// folder. The zero value leaves the files of other versions of the title in
+// the folder and logs them.
+type DecryptOptions struct {
+	// RemoveStaleContents deletes the contents the title.tmd doesn't have,
+	// left by another version of the title, before decrypting, see
+	// RemoveStaleContents
+	RemoveStaleContents bool
+}
+
+type DecryptOption func(*DecryptOptions)
+
+// WithStaleContentsRemoval deletes the contents of other versions of the title
+// from its folder before decrypting it, downloads always do.
+func WithStaleContentsRemoval(removeStaleContents bool) DecryptOption {
+	return func(options *DecryptOptions) {
+		options.RemoveStaleContents = removeStaleContents
+	}
+}
+
+// FirmwareOptions controls which system titles DownloadFirmware downloads.
+// The zero value downloads the latest version of every system title of the
+// region.
+type FirmwareOptions struct {
+	// TitleVersions, when not nil, is the set of titles of a system version:
+	// only these titles are downloaded, each at its version, see
+	// ReadFirmwareVersions
+	TitleVersions map[uint64]uint16
+}
+
+type FirmwareOption func(*FirmwareOptions)
+
+// WithFirmwareVersions downloads the system titles of versions at their
+// versions, the titles and versions of a system version, instead of the
+// latest ones.
+func WithFirmwareVersions(versions map[uint64]uint16) FirmwareOption {
+	return func(options *FirmwareOptions) {
+		options.TitleVersions = versions
+	}
+}
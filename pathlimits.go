@@ -0,0 +1,151 @@
+package wiiudownloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+)
+
+const maxPathComponentLength = 255
+
+type PathTooLongError struct {
+	Path   string
+	Length int
+	Limit  int
+}
+
+func (e *PathTooLongError) Error() string {
+	return fmt.Sprintf(Localize("decrypted path is too long for this filesystem (%d > %d): %s"), e.Length, e.Limit, e.Path)
+}
+
+func maxPathLength() int {
+	if runtime.GOOS == "windows" {
+		return 32766 // the limit of \\?\ paths minus the terminating NUL, see longPath
+	}
+	return 4095
+}
+
+// longPath turns a path into an extended-length one on Windows, so that titles
+// with long names nested in deep folders are not limited by MAX_PATH (260).
+// Every path derived from the result inherits the prefix.
+func longPath(path string) string {
+	if runtime.GOOS != "windows" || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(absPath, `\\`) { // UNC path, \\server\share
+		return `\\?\UNC\` + absPath[2:]
+	}
+	return `\\?\` + absPath
+}
+
+func pathLength(path string) int {
+	if runtime.GOOS == "windows" {
+		return len(utf16.Encode([]rune(path)))
+	}
+	return len(path)
+}
+
+func readFSTEntryName(fst *FSTData, index uint32) string {
+	fst.FSTReader.Seek(int64(fst.NamesOffset+(fst.FSTEntries[index].NameOffset&0x00FFFFFF)), io.SeekStart)
+	return SanitizeFilename(readString(fst.FSTReader))
+}
+
+// fstFilePaths walks the FST the same way DecryptContents does and returns the
+// relative path of every file that will be extracted.
+func fstFilePaths(fst *FSTData) ([]string, error) {
+	paths := make([]string, 0, fst.Entries)
+	entry := make([]uint32, MAX_LEVELS)
+	lEntry := make([]uint32, MAX_LEVELS)
+	level := uint32(0)
+
+	for i := uint32(0); i < fst.Entries-1; i++ {
+		if level > 0 {
+			for (level >= 1) && (lEntry[level-1] == i+1) {
+				level--
+			}
+		}
+
+		if fst.FSTEntries[i].Type&1 != 0 {
+			entry[level] = i
+			lEntry[level] = fst.FSTEntries[i].Length
+			level++
+			if level >= MAX_LEVELS {
+				return nil, errors.New("level >= MAX_LEVELS")
+			}
+			continue
+		}
+
+		if fst.FSTEntries[i].Type&0x80 != 0 {
+			continue
+		}
+
+		parts := make([]string, 0, level+1)
+		for j := uint32(0); j < level; j++ {
+			parts = append(parts, readFSTEntryName(fst, entry[j]))
+		}
+		parts = append(parts, readFSTEntryName(fst, i))
+		paths = append(paths, filepath.Join(parts...))
+	}
+
+	return paths, nil
+}
+
+func checkFSTPathLengths(basePath string, fst *FSTData) error {
+	absPath, err := filepath.Abs(basePath)
+	if err != nil {
+		return err
+	}
+
+	paths, err := fstFilePaths(fst)
+	if err != nil {
+		return err
+	}
+
+	longest := ""
+	for _, path := range paths {
+		for _, component := range strings.Split(path, string(filepath.Separator)) {
+			if pathLength(component) > maxPathComponentLength {
+				return &PathTooLongError{Path: filepath.Join(absPath, path), Length: pathLength(component), Limit: maxPathComponentLength}
+			}
+		}
+		if pathLength(path) > pathLength(longest) {
+			longest = path
+		}
+	}
+
+	fullPath := filepath.Join(absPath, longest)
+	if pathLength(fullPath) > maxPathLength() {
+		return &PathTooLongError{Path: fullPath, Length: pathLength(fullPath), Limit: maxPathLength()}
+	}
+	return nil
+}
+
+// ShortenTitlePath renames a title folder to its bare title ID so that the
+// decrypted contents fit into the filesystem path limits.
+func ShortenTitlePath(path string) (string, error) {
+	tmd, err := readTMDFromDir(path)
+	if err != nil {
+		return "", err
+	}
+
+	shortPath := filepath.Join(filepath.Dir(filepath.Clean(path)), fmt.Sprintf("%016x", tmd.TitleID))
+	if shortPath == filepath.Clean(path) {
+		return "", fmt.Errorf(Localize("title folder is already as short as possible: %s"), path)
+	}
+	if _, err := os.Stat(shortPath); err == nil {
+		return "", fmt.Errorf(Localize("cannot shorten title folder, %s already exists"), shortPath)
+	}
+	if err := os.Rename(path, shortPath); err != nil {
+		return "", err
+	}
+	return shortPath, nil
+}
@@ -0,0 +1,141 @@
+package wiiudownloader
+
+import (
+	"sync"
+	"time"
+)
+
+// PieceState is the state of a piece of a content, see PieceMap.
+type PieceState uint8
+
+const (
+	PIECE_MISSING     PieceState = iota
+	PIECE_DOWNLOADING            // partly written
+	PIECE_DOWNLOADED             // written, not checked against the hash of the content yet
+	PIECE_VERIFYING              // being checked against the hash of the content
+	PIECE_COMPLETE               // written and checked, when the content can be checked
+)
+
+const (
+	// pieceMapPieces is the number of pieces a content is split in, whatever
+	// its size, so the map keeps the same width
+	pieceMapPieces = 256
+	// pieceMapReportInterval is the most often the pieces of a content are
+	// reported while it is being written
+	pieceMapReportInterval = 200 * time.Millisecond
+)
+
+// PieceMap is the state of the pieces of a content being downloaded, which
+// shows that progress is real on slow links.
+type PieceMap struct {
+	Filename  string
+	Size      int64
+	PieceSize int64 // the last piece can be smaller
+	Pieces    []PieceState
+}
+
+// PieceMapReporter is implemented by the ProgressReporters that show the piece
+// map of the contents being downloaded. Only the contents downloaded in
+// segments, and the ones checked against their hash as they are downloaded,
+// have one.
+type PieceMapReporter interface {
+	UpdatePieceMap(pieceMap PieceMap)
+}
+
+// pieceTracker follows the written ranges of a content and reports its piece
+// map. A nil pieceTracker, for reporters without piece maps, does nothing.
+type pieceTracker struct {
+	mutex      sync.Mutex
+	reporter   PieceMapReporter
+	filename   string
+	size       int64
+	pieceSize  int64
+	written    []ByteRange
+	state      PieceState // PIECE_VERIFYING or PIECE_COMPLETE once every byte is written
+	lastReport time.Time
+}
+
+// newPieceTracker returns the tracker of the content filename of size bytes,
+// of which the missing ranges are still to be written, nil when
+// progressReporter doesn't show piece maps.
+func newPieceTracker(progressReporter ProgressReporter, filename string, size int64, missing []ByteRange) *pieceTracker {
+	reporter, ok := progressReporter.(PieceMapReporter)
+	if !ok || size <= 0 {
+		return nil
+	}
+	written := make([]ByteRange, 0, len(missing)+1)
+	var next int64
+	for _, missingRange := range missing {
+		if missingRange.Start > next {
+			written = append(written, ByteRange{Start: next, End: missingRange.Start})
+		}
+		next = missingRange.End
+	}
+	if next < size {
+		written = append(written, ByteRange{Start: next, End: size})
+	}
+	tracker := &pieceTracker{
+		reporter:  reporter,
+		filename:  filename,
+		size:      size,
+		pieceSize: max((size+pieceMapPieces-1)/pieceMapPieces, 1),
+		written:   written,
+		state:     PIECE_DOWNLOADED,
+	}
+	tracker.report(true)
+	return tracker
+}
+
+// addRange records bytes written to the content.
+func (t *pieceTracker) addRange(start, end int64) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	t.written = mergeByteRanges(append(t.written, ByteRange{Start: start, End: end}))
+	t.mutex.Unlock()
+	t.report(false)
+}
+
+// setState marks the written pieces as being verified or complete.
+func (t *pieceTracker) setState(state PieceState) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	t.state = state
+	t.mutex.Unlock()
+	t.report(true)
+}
+
+// report sends the piece map to the reporter, unless it was sent less than
+// pieceMapReportInterval ago and force isn't set.
+func (t *pieceTracker) report(force bool) {
+	t.mutex.Lock()
+	if !force && time.Since(t.lastReport) < pieceMapReportInterval {
+		t.mutex.Unlock()
+		return
+	}
+	t.lastReport = time.Now()
+	pieceMap := PieceMap{
+		Filename:  t.filename,
+		Size:      t.size,
+		PieceSize: t.pieceSize,
+		Pieces:    make([]PieceState, (t.size+t.pieceSize-1)/t.pieceSize),
+	}
+	for _, written := range t.written {
+		for i := written.Start / t.pieceSize; i < int64(len(pieceMap.Pieces)) && i*t.pieceSize < written.End; i++ {
+			pieceStart, pieceEnd := i*t.pieceSize, (i+1)*t.pieceSize
+			if pieceEnd > t.size {
+				pieceEnd = t.size
+			}
+			if written.Start <= pieceStart && written.End >= pieceEnd {
+				pieceMap.Pieces[i] = t.state
+			} else if pieceMap.Pieces[i] == PIECE_MISSING {
+				pieceMap.Pieces[i] = PIECE_DOWNLOADING
+			}
+		}
+	}
+	t.mutex.Unlock()
+	t.reporter.UpdatePieceMap(pieceMap)
+}
@@ -0,0 +1,37 @@
+package wiiudownloader
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	fPreallocate    = 42 // F_PREALLOCATE
+	fAllocateContig = 0x2
+	fAllocateAll    = 0x4
+	fPeofPosMode    = 3
+)
+
+type fstore struct {
+	flags      uint32
+	posmode    int32
+	offset     int64
+	length     int64
+	bytesalloc int64
+}
+
+// preallocateFile reserves size bytes for file without changing its size, so
+// resuming still knows how much was written. A contiguous allocation is tried
+// first, then any allocation.
+func preallocateFile(file *os.File, size int64) error {
+	store := fstore{flags: fAllocateContig | fAllocateAll, posmode: fPeofPosMode, length: size}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), fPreallocate, uintptr(unsafe.Pointer(&store))); errno == 0 {
+		return nil
+	}
+	store.flags = fAllocateAll
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), fPreallocate, uintptr(unsafe.Pointer(&store))); errno != 0 {
+		return errno
+	}
+	return nil
+}
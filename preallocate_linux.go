@@ -0,0 +1,14 @@
+package wiiudownloader
+
+import (
+	"os"
+	"syscall"
+)
+
+const fallocFlKeepSize = 0x01 // FALLOC_FL_KEEP_SIZE
+
+// preallocateFile reserves size bytes for file without changing its size, so
+// resuming still knows how much was written.
+func preallocateFile(file *os.File, size int64) error {
+	return syscall.Fallocate(int(file.Fd()), fallocFlKeepSize, 0, size)
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package wiiudownloader
+
+import "os"
+
+func preallocateFile(file *os.File, size int64) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+package wiiudownloader
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const fileAllocationInfo = 5 // FileAllocationInfo of FILE_INFO_BY_HANDLE_CLASS
+
+var procSetFileInformationByHandle = syscall.NewLazyDLL("kernel32.dll").NewProc("SetFileInformationByHandle")
+
+// preallocateFile reserves size bytes for file without moving its end of file,
+// so resuming still knows how much was written.
+func preallocateFile(file *os.File, size int64) error {
+	allocationSize := size
+	ret, _, err := procSetFileInformationByHandle.Call(file.Fd(), fileAllocationInfo, uintptr(unsafe.Pointer(&allocationSize)), unsafe.Sizeof(allocationSize))
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package wiiudownloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// FailedContents returns the contents that did not pass verification.
+func (r *TitleVerificationResult) FailedContents() []ContentVerificationResult {
+	failed := make([]ContentVerificationResult, 0)
+	for _, content := range r.Contents {
+		if content.Err != nil {
+			failed = append(failed, content)
+		}
+	}
+	return failed
+}
+
+// RepairTitle downloads again from the CDN only the contents that failed
+// verification, keeping the rest of the title folder untouched, and verifies
+// the title again once done.
+func RepairTitle(path string, result *TitleVerificationResult, progressReporter ProgressReporter, client *http.Client) (*TitleVerificationResult, error) {
+	path = longPath(path)
+	tmd, err := readTMDFromDir(path)
+	if err != nil {
+		return nil, err
+	}
+	contentsByID := make(map[string]Content, len(tmd.Contents))
+	for _, content := range tmd.Contents {
+		contentsByID[fmt.Sprintf("%08X", content.ID)] = content
+	}
+
+	failed := result.FailedContents()
+	titleID := fmt.Sprintf("%016x", tmd.TitleID)
+	baseURL := fmt.Sprintf("http://ccs.cdn.c.shop.nintendowifi.net/ccs/download/%s", titleID)
+
+	progressReporter.ResetTotals()
+	progressReporter.SetGameTitle(GetTitleEntryFromTid(tmd.TitleID).Name)
+	var repairSize uint64
+	for _, content := range failed {
+		repairSize += content.ExpectedSize
+	}
+	progressReporter.SetDownloadSize(int64(repairSize))
+	progressReporter.SetPhase(PROGRESS_PHASE_DOWNLOADING)
+
+	titleKey, _ := loadTitleKey(path, tmd.TitleID)
+
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(maxConcurrentDownloads)
+	downloader := &contentDownloader{
+		ctx:              ctx,
+		progressReporter: progressReporter,
+		client:           client,
+		sem:              semaphore.NewWeighted(maxConcurrentDownloads),
+		limiter:          newBandwidthLimiter(progressReporter),
+		session:          loadDownloadSession(path, tmd.TitleVersion),
+		maxRetries:       maxRetries,
+		retryDelay:       retryDelay,
+		titleKey:         titleKey,
+	}
+	progressReporter.SetStartTime(time.Now())
+
+	for _, failedContent := range failed {
+		failedContent := failedContent
+		g.Go(func() error {
+			content, ok := contentsByID[strings.ToUpper(failedContent.ContentID)]
+			if !ok {
+				return fmt.Errorf(Localize("content %s is not part of the TMD"), failedContent.ContentID)
+			}
+			// A corrupted file must never be resumed from
+			downloader.session.resetContent(filepath.Base(failedContent.Path))
+			if err := downloader.download(fmt.Sprintf("%s/%08X", baseURL, content.ID), failedContent.Path, true, &content); err != nil {
+				if progressReporter.Cancelled() {
+					return errCancel
+				}
+				return err
+			}
+
+			if content.Type&0x2 == 2 { // has a hash
+				h3Path := filepath.Join(path, failedContent.ContentID+".h3")
+				downloader.session.resetContent(filepath.Base(h3Path))
+				if err := downloader.download(fmt.Sprintf("%s/%08X.h3", baseURL, content.ID), h3Path, true, nil); err != nil {
+					if progressReporter.Cancelled() {
+						return errCancel
+					}
+					return err
+				}
+			}
+			if progressReporter.Cancelled() {
+				return errCancel
+			}
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		if err == errCancel {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	if err := downloader.session.remove(); err != nil {
+		return nil, err
+	}
+	return VerifyTitle(path, progressReporter)
+}
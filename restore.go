@@ -0,0 +1,223 @@
+package wiiudownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxRestoreVersions is the number of versions of a title RestoreTitleMetadata
+// tries before giving up on finding the one of the contents.
+const maxRestoreVersions = 64
+
+// RestoredMetadata is what RestoreTitleMetadata did to a title folder.
+type RestoredMetadata struct {
+	TitleID         uint64
+	Version         uint16
+	Restored        []string // names of the files written
+	TicketGenerated bool     // the CDN has no ticket for the title, title.tik was generated
+}
+
+// fetchTitleFile downloads a small file of a title from the CDN, like a TMD or
+// its ticket.
+func fetchTitleFile(client *http.Client, titleID uint64, name string) ([]byte, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://ccs.cdn.c.shop.nintendowifi.net/ccs/download/%016x/%s", titleID, name), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "WiiUDownloader")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newCDNStatusError(resp.StatusCode, fmt.Errorf(Localize("%s download error, status code: %d"), name, resp.StatusCode))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// localContentIDs returns the IDs of the .app files of a folder.
+func localContentIDs(path string) ([]uint32, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint32, 0, len(entries))
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), ".app")
+		if entry.IsDir() || !found || len(name) != 8 {
+			continue
+		}
+		if id, err := strconv.ParseUint(name, 16, 32); err == nil {
+			ids = append(ids, uint32(id))
+		}
+	}
+	return ids, nil
+}
+
+// contentsMatchTMD reports whether the contents in the folder at path are the
+// ones of tmd: every content is there with the right size and no other, and
+// the .h3 files have the hashes tmd has for them.
+func contentsMatchTMD(path string, tmd *TMD, contentIDs []uint32) bool {
+	if len(contentIDs) != len(tmd.Contents) {
+		return false
+	}
+	for _, content := range tmd.Contents {
+		name, found := findContentFile(path, content.ID)
+		if !found {
+			return false
+		}
+		if !contentFileMatches(path, name, content) {
+			return false
+		}
+	}
+	return true
+}
+
+// findTitleTMD returns the TMD of the version of titleID whose contents are in
+// the folder at path, and the TMD file to write. The given version is the only
+// one tried when it isn't negative, otherwise the latest one then the older
+// ones, which come every 16 versions.
+func findTitleTMD(path string, titleID uint64, version int, client *http.Client) (*TMD, []byte, error) {
+	contentIDs, err := localContentIDs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(contentIDs) == 0 {
+		return nil, nil, fmt.Errorf(Localize("%s has no contents"), path)
+	}
+
+	data, err := fetchTitleFile(client, titleID, tmdFilename(version))
+	if err != nil {
+		return nil, nil, err
+	}
+	tmd, err := ParseTMD(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contentsMatchTMD(path, tmd, contentIDs) {
+		return tmd, data, nil
+	}
+	if version >= 0 {
+		return nil, nil, fmt.Errorf(Localize("the contents of %s are not the ones of %016x v%d"), path, titleID, version)
+	}
+
+	tried := 1
+	for olderVersion := int(tmd.TitleVersion) - 1; olderVersion >= 0 && tried < maxRestoreVersions; olderVersion-- {
+		if olderVersion%16 != 0 {
+			continue
+		}
+		tried++
+		data, err := fetchTitleFile(client, titleID, tmdFilename(olderVersion))
+		if isNotFound(err) {
+			// Not every version was published
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		olderTMD, err := ParseTMD(data)
+		if err != nil {
+			continue
+		}
+		if contentsMatchTMD(path, olderTMD, contentIDs) {
+			return olderTMD, data, nil
+		}
+	}
+	return nil, nil, fmt.Errorf(Localize("no version of %016x on the CDN matches the contents of %s, give its version"), titleID, path)
+}
+
+// RestoreTitleMetadata writes the title.tmd, title.tik and title.cert missing
+// from a title folder, like an old dump with only its .app and .h3 files, so
+// it can be installed again. Without a title.tmd, the title is titleID, or the
+// title ID in the folder name when it is 0, and the TMD is the one of version,
+// or of the version whose contents are in the folder when it is negative. The
+// ticket comes from the CDN, or is generated when the CDN has none. The files
+// already in the folder are kept.
+func RestoreTitleMetadata(path string, titleID uint64, version int, client *http.Client) (*RestoredMetadata, error) {
+	path = longPath(path)
+	restored := &RestoredMetadata{Restored: make([]string, 0, 3)}
+
+	tmdPath := filepath.Join(path, "title.tmd")
+	tmd, err := readTMDFromDir(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if titleID == 0 {
+			var found bool
+			if titleID, found = FindTitleID(filepath.Base(filepath.Clean(path))); !found {
+				return nil, fmt.Errorf(Localize("the title ID of %s is not in its name, give it"), path)
+			}
+		}
+		var data []byte
+		if tmd, data, err = findTitleTMD(path, titleID, version, client); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(tmdPath, data, 0644); err != nil {
+			return nil, checkDiskFull(err)
+		}
+		restored.Restored = append(restored.Restored, "title.tmd")
+	} else if err != nil {
+		return nil, err
+	}
+	restored.TitleID = tmd.TitleID
+	restored.Version = tmd.TitleVersion
+
+	tikPath := filepath.Join(path, "title.tik")
+	if _, err := os.Stat(tikPath); os.IsNotExist(err) {
+		if err := restoreTicket(path, tmd, client, restored); err != nil {
+			return nil, err
+		}
+		restored.Restored = append(restored.Restored, "title.tik")
+	}
+
+	certPath := filepath.Join(path, "title.cert")
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		if err := GenerateCert(tmd, certPath, nil, client); err != nil {
+			return nil, checkDiskFull(err)
+		}
+		restored.Restored = append(restored.Restored, "title.cert")
+	}
+	return restored, nil
+}
+
+// restoreTicket writes the ticket of the CDN to the title folder at path, or a
+// generated one when the CDN has none or it can't decrypt the title.
+func restoreTicket(path string, tmd *TMD, client *http.Client, restored *RestoredMetadata) error {
+	tikPath := filepath.Join(path, "title.tik")
+	baseURL := fmt.Sprintf("http://ccs.cdn.c.shop.nintendowifi.net/ccs/download/%016x", tmd.TitleID)
+	if data, err := fetchTitleFile(client, tmd.TitleID, "cetk"); err == nil {
+		if err := os.WriteFile(tikPath, data, 0644); err != nil {
+			return checkDiskFull(err)
+		}
+		titleKey, err := loadTitleKey(path, tmd.TitleID)
+		if err == nil && checkTitleKey(context.Background(), client, baseURL, tmd, titleKey, 0, nil) == nil {
+			return nil
+		}
+	}
+
+	titleKey, err := GetTicketTitleKey(tmd.TitleID)
+	if err != nil {
+		return err
+	}
+	if err := GenerateTicket(tikPath, tmd.TitleID, titleKey, tmd.TitleVersion); err != nil {
+		return checkDiskFull(err)
+	}
+	restored.TicketGenerated = true
+	decryptionKey, err := loadTitleKey(path, tmd.TitleID)
+	if err == nil {
+		err = checkTitleKey(context.Background(), client, baseURL, tmd, decryptionKey, 0, nil)
+	}
+	if err != nil {
+		// A ticket that can't decrypt the title doesn't make it installable
+		os.Remove(tikPath)
+		return err
+	}
+	return nil
+}
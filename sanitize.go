@@ -0,0 +1,89 @@
+package wiiudownloader
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// windowsReservedNames can't be used as a file name on Windows, even with an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFilename makes a single file or folder name valid on the current
+// platform, so that creating it doesn't fail with a cryptic error.
+func SanitizeFilename(name string) string {
+	return sanitizeFilenameFor(name, runtime.GOOS)
+}
+
+func isIllegalFilenameRune(r rune, goos string) bool {
+	if r == '/' || r == 0 {
+		return true
+	}
+	switch goos {
+	case "windows":
+		return r < 0x20 || strings.ContainsRune(`<>:"\|?*`, r)
+	case "darwin":
+		return r == ':'
+	}
+	return false
+}
+
+func sanitizeFilenameFor(name, goos string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || isIllegalFilenameRune(r, goos) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if goos == "windows" {
+		// Explorer and most APIs silently drop trailing dots and spaces
+		name = strings.TrimRight(name, ". ")
+		base := strings.ToUpper(strings.TrimSpace(strings.SplitN(name, ".", 2)[0]))
+		if windowsReservedNames[base] {
+			name = "_" + name
+		}
+	}
+
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return truncateFilename(name, goos)
+}
+
+// filenameLength counts UTF-16 code units on Windows and bytes elsewhere, like
+// the filesystems of each platform do.
+func filenameLength(name, goos string) int {
+	if goos == "windows" {
+		return len(utf16.Encode([]rune(name)))
+	}
+	return len(name)
+}
+
+// truncateFilename shortens a name to the length limit of a path component,
+// keeping its extension and never splitting a character.
+func truncateFilename(name, goos string) string {
+	if filenameLength(name, goos) <= maxPathComponentLength {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > maxPathComponentLength/2 {
+		ext = ""
+	}
+	runes := []rune(strings.TrimSuffix(name, ext))
+	for len(runes) > 0 {
+		truncated := string(runes) + ext
+		if filenameLength(truncated, goos) <= maxPathComponentLength {
+			return truncated
+		}
+		runes = runes[:len(runes)-1]
+	}
+	return "_" + ext
+}
@@ -0,0 +1,84 @@
+package wiiudownloader
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name, goos, want string
+	}{
+		{"Super Mario 3D World", "windows", "Super Mario 3D World"},
+		{"Pokkén Tournament", "linux", "Pokkén Tournament"},
+		{"ゼルダの伝説 ブレス オブ ザ ワイルド", "windows", "ゼルダの伝説 ブレス オブ ザ ワイルド"},
+		{"bad\xffname", "linux", "bad_name"},
+
+		// Illegal characters
+		{"AC/DC", "linux", "AC_DC"},
+		{"AC/DC", "windows", "AC_DC"},
+		{"nul\x00byte", "linux", "nul_byte"},
+		{`Q: "What?" <a|b> *\`, "windows", `Q_ _What__ _a_b_ __`},
+		{"tab\there", "windows", "tab_here"},
+		{"Title: Subtitle", "linux", "Title: Subtitle"},
+		{"Title: Subtitle", "darwin", "Title_ Subtitle"},
+
+		// Reserved Windows names, with or without an extension
+		{"CON", "windows", "_CON"},
+		{"con", "windows", "_con"},
+		{"Nul.txt", "windows", "_Nul.txt"},
+		{"COM1.tar.gz", "windows", "_COM1.tar.gz"},
+		{"LPT9 .zip", "windows", "_LPT9 .zip"},
+		{"CONSOLE", "windows", "CONSOLE"},
+		{"COM10", "windows", "COM10"},
+		{"CON", "linux", "CON"},
+
+		// Trailing dots and spaces
+		{"Version 1.0.", "windows", "Version 1.0"},
+		{"Name . . ", "windows", "Name"},
+		{"Name. ", "linux", "Name. "},
+		{"AUX.", "windows", "_AUX"},
+
+		// Names that are no name at all
+		{"", "linux", "_"},
+		{".", "linux", "_"},
+		{"..", "linux", "_"},
+		{"...", "windows", "_"},
+		{"  ", "windows", "_"},
+	}
+	for _, test := range tests {
+		if got := sanitizeFilenameFor(test.name, test.goos); got != test.want {
+			t.Errorf("sanitizeFilenameFor(%q, %s) = %q, want %q", test.name, test.goos, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeFilenameLength(t *testing.T) {
+	tests := []struct {
+		name, goos, want string
+	}{
+		{strings.Repeat("a", maxPathComponentLength), "linux", strings.Repeat("a", maxPathComponentLength)},
+		{strings.Repeat("a", 300) + ".zip", "linux", strings.Repeat("a", maxPathComponentLength-4) + ".zip"},
+		// Two bytes per character elsewhere, one UTF-16 code unit on Windows
+		{strings.Repeat("é", 200) + ".app", "linux", strings.Repeat("é", 125) + ".app"},
+		{strings.Repeat("é", 200) + ".app", "windows", strings.Repeat("é", 200) + ".app"},
+		// Four bytes per character elsewhere, a surrogate pair on Windows
+		{strings.Repeat("😀", 200) + ".app", "linux", strings.Repeat("😀", 62) + ".app"},
+		{strings.Repeat("😀", 200) + ".app", "windows", strings.Repeat("😀", 125) + ".app"},
+		// An extension too long to be one isn't kept
+		{"a." + strings.Repeat("b", 300), "linux", "a." + strings.Repeat("b", maxPathComponentLength-2)},
+	}
+	for _, test := range tests {
+		got := sanitizeFilenameFor(test.name, test.goos)
+		if got != test.want {
+			t.Errorf("sanitizeFilenameFor(%d bytes, %s) = %d bytes %q, want %d bytes", len(test.name), test.goos, len(got), got, len(test.want))
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("sanitizeFilenameFor(%d bytes, %s) split a character", len(test.name), test.goos)
+		}
+		if length := filenameLength(got, test.goos); length > maxPathComponentLength {
+			t.Errorf("sanitizeFilenameFor(%d bytes, %s) is %d long", len(test.name), test.goos, length)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package wiiudownloader
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	ctxio "github.com/jbenet/go-context/io"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// segmentedDownloadMinSize is the size from which a content is downloaded
+	// in segments, the smaller ones are done before more connections help
+	segmentedDownloadMinSize = 64 * 1024 * 1024
+	// minSegmentSize keeps what is left of a resumed content from being split
+	// in tiny segments
+	minSegmentSize = 4 * 1024 * 1024
+)
+
+// errSingleConnection is returned by downloadSegmented when the content has to
+// be downloaded over a single connection instead, because the server didn't
+// answer the ranges as expected or the segments didn't add up to the content.
+var errSingleConnection = errors.New("the content has to be downloaded over a single connection")
+
+// contentFileSize returns the size of the encrypted file of a content on the CDN.
+func contentFileSize(content Content) int64 {
+	if content.Type&0x2 == 2 {
+		return int64(content.Size)
+	}
+	// contents without a hash tree are padded to the AES block size
+	return int64((content.Size + 0xF) &^ 0xF)
+}
+
+// isSegmented reports whether content is downloaded in segments.
+func (cd *contentDownloader) isSegmented(content *Content) bool {
+	return content != nil && cd.segments > 1 && contentFileSize(*content) >= segmentedDownloadMinSize
+}
+
+// splitSegments splits the missing parts of a content in about segments ranges
+// of the same size, so they are downloaded at once.
+func splitSegments(missing []ByteRange, segments int) []ByteRange {
+	var total int64
+	for _, missingRange := range missing {
+		total += missingRange.End - missingRange.Start
+	}
+	segmentSize := max((total+int64(segments)-1)/int64(segments), minSegmentSize)
+	split := make([]ByteRange, 0, segments)
+	for _, missingRange := range missing {
+		for start := missingRange.Start; start < missingRange.End; start += segmentSize {
+			end := start + segmentSize
+			if end > missingRange.End {
+				end = missingRange.End
+			}
+			split = append(split, ByteRange{Start: start, End: end})
+		}
+	}
+	return split
+}
+
+// downloadSegmented downloads a large content with several range requests at
+// once, each writing to its part of the preallocated file and retried on its
+// own. The session keeps track of the written ranges, so an interrupted
+// download resumes every segment where it stopped.
+func (cd *contentDownloader) downloadSegmented(downloadURL, dstPath string, doRetries bool, content *Content) error {
+	basePath := filepath.Base(dstPath)
+	size := contentFileSize(*content)
+	parsedURL, err := url.Parse(downloadURL)
+	if err != nil {
+		return err
+	}
+
+	missing := cd.session.missingRanges(dstPath, size)
+	if len(missing) == 1 && missing[0].Start == 0 && missing[0].End == size {
+		// Nothing of it is kept, like in openForResume the file may be hard
+		// linked to the content store or another version of the title
+		if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	file, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	preallocateFile(file, size)
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+	written := size
+	for _, missingRange := range missing {
+		written -= missingRange.End - missingRange.Start
+	}
+	cd.progressReporter.SetTotalDownloadedForFile(basePath, written)
+	pieces := newPieceTracker(cd.progressReporter, basePath, size, missing)
+
+	g, ctx := errgroup.WithContext(cd.ctx)
+	g.SetLimit(cd.segments)
+	for _, segment := range splitSegments(missing, cd.segments) {
+		segment := segment
+		g.Go(func() error {
+			return cd.downloadSegment(ctx, parsedURL, file, segment, size, doRetries, pieces)
+		})
+	}
+	err = g.Wait()
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// The segments arrive out of order, the content is hashed once complete
+	verified := cd.verifyAfterWrite
+	if content.Type&0x2 == 0 && cd.titleKey != nil {
+		hasher := newContentHasher(cd.titleKey, *content)
+		pieces.setState(PIECE_VERIFYING)
+		if err := hashFilePrefix(dstPath, size, hasher); err != nil {
+			return err
+		}
+		if err := hasher.verify(dstPath); err != nil {
+			cd.session.resetContent(basePath)
+			return errSingleConnection
+		}
+		verified = true
+	}
+	cd.session.markDone(basePath, size, verified)
+	pieces.setState(PIECE_COMPLETE)
+	cd.progressReporter.MarkFileAsDone(basePath)
+	return nil
+}
+
+// downloadSegment downloads the bytes of segment to file, retrying from where
+// it stopped, and marks them in pieces.
+func (cd *contentDownloader) downloadSegment(ctx context.Context, parsedURL *url.URL, file *os.File, segment ByteRange, size int64, doRetries bool, pieces *pieceTracker) error {
+	basePath := filepath.Base(file.Name())
+	retry := func(attempt int) bool {
+		if !doRetries || attempt >= cd.maxRetries || cd.progressReporter.Cancelled() {
+			return false
+		}
+		return sleepContext(ctx, cd.retryDelay) == nil
+	}
+
+	start := segment.Start
+	for attempt := 1; attempt <= cd.maxRetries; attempt++ {
+		requestCtx, watchdog := newRequestWatchdog(ctx, cd.requestTimeout, cd.stallTimeout, cd.progressReporter.Paused)
+		req := (&http.Request{Header: make(http.Header), URL: parsedURL}).WithContext(requestCtx)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, segment.End-1))
+
+		resp, err := cd.client.Do(req)
+		if err != nil {
+			watchdog.stop()
+			if err := watchdog.err(err); !retry(attempt) {
+				return err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			watchdog.stop()
+			if resp.StatusCode == http.StatusOK {
+				// The server ignores ranges
+				return errSingleConnection
+			}
+			if retry(attempt) {
+				continue
+			}
+			return wrapKind(ErrCDNStatus, fmt.Errorf(Localize("download error after %d attempts, status code: %d"), attempt, resp.StatusCode))
+		}
+		if resp.Header.Get("Content-Range") != fmt.Sprintf("bytes %d-%d/%d", start, segment.End-1, size) {
+			resp.Body.Close()
+			watchdog.stop()
+			return errSingleConnection
+		}
+
+		receivedHash := sha1.New()
+		fileWriter := &sessionWriter{writer: io.NewOffsetWriter(file, start), file: file, session: cd.session, pieces: pieces, filename: basePath, offset: start}
+		writerProgress := newWriterProgress(fileWriter, cd.progressReporter, basePath)
+		writerProgress.limiter = cd.limiter
+		writerProgress.sharedLimiter = cd.sharedLimiter
+		if cd.verifyAfterWrite {
+			writerProgress.hash = receivedHash
+		}
+		writerProgressWithContext := ctxio.NewWriter(requestCtx, writerProgress)
+		bodyReaderWithContext := ctxio.NewReader(requestCtx, watchdog.watch(io.LimitReader(resp.Body, segment.End-start)))
+		var buffers *transferBuffers
+		var copyBuffer []byte
+		if cd.highPerformanceWrites {
+			// The segments write straight to their offset, only the copy is buffered
+			if buffers = getTransferBuffers(nil, false); buffers != nil {
+				copyBuffer = *buffers.copyBuffer
+			}
+		}
+		written, err := io.CopyBuffer(writerProgressWithContext, bodyReaderWithContext, copyBuffer)
+		buffers.release()
+		watchdog.stop()
+		err = watchdog.err(err)
+		resp.Body.Close()
+		writerProgress.Close()
+		if err == nil && written != segment.End-start {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil && cd.verifyAfterWrite {
+			return verifyWrittenRange(file, start, written, receivedHash.Sum(nil))
+		}
+		if err != nil {
+			if err := checkDiskFull(err); errors.Is(err, ErrDiskFull) {
+				return err
+			}
+			start += written
+			if watchdog.hasStalled() && written > 0 && ctx.Err() == nil {
+				log.Printf("%s stalled at %d bytes for %s, reconnecting", basePath, start, cd.stallTimeout)
+				attempt--
+				continue
+			}
+			if retry(attempt) {
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+	return nil
+}
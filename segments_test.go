@@ -0,0 +1,64 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDownloadSegmentedKeepsHardLinks checks that a content downloaded from
+// scratch doesn't write through a hard link to the content store or to another
+// version of the title.
+func TestDownloadSegmentedKeepsHardLinks(t *testing.T) {
+	data := randomTestData(t, 3*minSegmentSize)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "00000001.app", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "store.app")
+	stored := bytes.Repeat([]byte{0xAB}, len(data))
+	if err := os.WriteFile(storePath, stored, 0644); err != nil {
+		t.Fatal(err)
+	}
+	titleDir := filepath.Join(dir, "title")
+	if err := os.Mkdir(titleDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dstPath := filepath.Join(titleDir, "00000001.app")
+	if err := os.Link(storePath, dstPath); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+
+	events := make(chan ProgressEvent)
+	go func() {
+		for range events {
+		}
+	}()
+	defer close(events)
+	cd := &contentDownloader{
+		ctx:              context.Background(),
+		progressReporter: NewEventReporter(events),
+		client:           server.Client(),
+		session:          loadDownloadSession(titleDir, 1),
+		maxRetries:       1,
+		segments:         3,
+	}
+	content := &Content{ID: 1, Type: 0x2, Size: uint64(len(data))}
+	if err := cd.downloadSegmented(server.URL+"/00000001", dstPath, false, content); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := os.ReadFile(dstPath); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("downloaded content differs: %v", err)
+	}
+	if got, err := os.ReadFile(storePath); err != nil || !bytes.Equal(got, stored) {
+		t.Errorf("hard linked file was written to: %v", err)
+	}
+}
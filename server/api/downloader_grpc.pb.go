@@ -0,0 +1,214 @@
+// gRPC API of wiiudownloader-server serve --grpc, for the tools that drive it
+// programmatically. It mirrors the JSON API of the server package.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: downloader.proto
+
+package api
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Downloader_ListTitles_FullMethodName    = "/wiiudownloader.Downloader/ListTitles"
+	Downloader_StartDownload_FullMethodName = "/wiiudownloader.Downloader/StartDownload"
+	Downloader_Cancel_FullMethodName        = "/wiiudownloader.Downloader/Cancel"
+)
+
+// DownloaderClient is the client API for Downloader service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DownloaderClient interface {
+	// ListTitles searches the title database, like GET /api/titles.
+	ListTitles(ctx context.Context, in *ListTitlesRequest, opts ...grpc.CallOption) (*ListTitlesResponse, error)
+	// StartDownload queues the download of a title and streams its job every
+	// time it changes, until it is done, failed or cancelled. Closing the stream
+	// doesn't cancel the download.
+	StartDownload(ctx context.Context, in *StartDownloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error)
+	// Cancel cancels a queued or running job, like DELETE /api/jobs/{id}.
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*Job, error)
+}
+
+type downloaderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDownloaderClient(cc grpc.ClientConnInterface) DownloaderClient {
+	return &downloaderClient{cc}
+}
+
+func (c *downloaderClient) ListTitles(ctx context.Context, in *ListTitlesRequest, opts ...grpc.CallOption) (*ListTitlesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTitlesResponse)
+	err := c.cc.Invoke(ctx, Downloader_ListTitles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *downloaderClient) StartDownload(ctx context.Context, in *StartDownloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Downloader_ServiceDesc.Streams[0], Downloader_StartDownload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StartDownloadRequest, Job]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Downloader_StartDownloadClient = grpc.ServerStreamingClient[Job]
+
+func (c *downloaderClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Downloader_Cancel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DownloaderServer is the server API for Downloader service.
+// All implementations must embed UnimplementedDownloaderServer
+// for forward compatibility.
+type DownloaderServer interface {
+	// ListTitles searches the title database, like GET /api/titles.
+	ListTitles(context.Context, *ListTitlesRequest) (*ListTitlesResponse, error)
+	// StartDownload queues the download of a title and streams its job every
+	// time it changes, until it is done, failed or cancelled. Closing the stream
+	// doesn't cancel the download.
+	StartDownload(*StartDownloadRequest, grpc.ServerStreamingServer[Job]) error
+	// Cancel cancels a queued or running job, like DELETE /api/jobs/{id}.
+	Cancel(context.Context, *CancelRequest) (*Job, error)
+	mustEmbedUnimplementedDownloaderServer()
+}
+
+// UnimplementedDownloaderServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDownloaderServer struct{}
+
+func (UnimplementedDownloaderServer) ListTitles(context.Context, *ListTitlesRequest) (*ListTitlesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTitles not implemented")
+}
+func (UnimplementedDownloaderServer) StartDownload(*StartDownloadRequest, grpc.ServerStreamingServer[Job]) error {
+	return status.Errorf(codes.Unimplemented, "method StartDownload not implemented")
+}
+func (UnimplementedDownloaderServer) Cancel(context.Context, *CancelRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedDownloaderServer) mustEmbedUnimplementedDownloaderServer() {}
+func (UnimplementedDownloaderServer) testEmbeddedByValue()                    {}
+
+// UnsafeDownloaderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DownloaderServer will
+// result in compilation errors.
+type UnsafeDownloaderServer interface {
+	mustEmbedUnimplementedDownloaderServer()
+}
+
+func RegisterDownloaderServer(s grpc.ServiceRegistrar, srv DownloaderServer) {
+	// If the following call pancis, it indicates UnimplementedDownloaderServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Downloader_ServiceDesc, srv)
+}
+
+func _Downloader_ListTitles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTitlesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloaderServer).ListTitles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Downloader_ListTitles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloaderServer).ListTitles(ctx, req.(*ListTitlesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Downloader_StartDownload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StartDownloadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DownloaderServer).StartDownload(m, &grpc.GenericServerStream[StartDownloadRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Downloader_StartDownloadServer = grpc.ServerStreamingServer[Job]
+
+func _Downloader_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloaderServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Downloader_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloaderServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Downloader_ServiceDesc is the grpc.ServiceDesc for Downloader service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Downloader_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wiiudownloader.Downloader",
+	HandlerType: (*DownloaderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTitles",
+			Handler:    _Downloader_ListTitles_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _Downloader_Cancel_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StartDownload",
+			Handler:       _Downloader_StartDownload_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "downloader.proto",
+}
@@ -0,0 +1,5 @@
+// Package api is the gRPC API of the server package, generated from
+// downloader.proto with protoc-gen-go and protoc-gen-go-grpc.
+package api
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative downloader.proto
@@ -0,0 +1,139 @@
+package server
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"time"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+//go:embed archive.html
+var archiveTemplateText string
+
+var archiveTemplate = template.Must(template.New("archive").Funcs(template.FuncMap{
+	"formatTime": func(t interface{}) string {
+		switch t := t.(type) {
+		case time.Time:
+			return t.Local().Format("2006-01-02 15:04")
+		case *time.Time:
+			return t.Local().Format("2006-01-02 15:04")
+		}
+		return ""
+	},
+	"statusClass": func(title wiiudownloader.ArchiveTitle) string {
+		if title.Status == wiiudownloader.ARCHIVE_STATUS_COMPLETE {
+			return "status-done"
+		}
+		if title.Status == wiiudownloader.ARCHIVE_STATUS_SLIMMED {
+			return ""
+		}
+		return "status-failed"
+	},
+	"verificationClass": func(title wiiudownloader.ArchiveTitle) string {
+		switch {
+		case title.Verified:
+			return "status-done"
+		case title.LastVerifiedAt != nil:
+			return "status-failed"
+		}
+		return ""
+	},
+}).Parse(archiveTemplateText))
+
+// ArchiveReport is the state of the titles of an archive folder when it was
+// scanned.
+type ArchiveReport struct {
+	ScannedAt time.Time                     `json:"scannedAt"`
+	Complete  int                           `json:"complete"`
+	Verified  int                           `json:"verified"`
+	Titles    []wiiudownloader.ArchiveTitle `json:"titles"`
+}
+
+// ArchiveServer serves a read-only report of the title folders below its root,
+// see wiiudownloader.ScanArchive. The folder is scanned again for every
+// request, so the report follows the downloads and verifications.
+//
+//	GET /             the report as an HTML page
+//	GET /api/archive  the report as JSON
+type ArchiveServer struct {
+	root  string
+	token string // required as a bearer token, or a token parameter for the page, when not empty
+	mux   *http.ServeMux
+}
+
+func NewArchiveServer(root, token string) *ArchiveServer {
+	s := &ArchiveServer{root: root, token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/api/archive", s.handleReport)
+	s.mux.HandleFunc("/", s.handlePage)
+	web, err := fs.Sub(webAssets, "web")
+	if err != nil {
+		panic(err)
+	}
+	s.mux.Handle("/style.css", http.FileServer(http.FS(web)))
+	return s
+}
+
+func (s *ArchiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The page lists the folders of the archive, it is protected too, with a
+	// token parameter as browsers can't send headers when opening it
+	if r.URL.Path != "/style.css" && !checkToken(r, s.token, r.URL.Path == "/") {
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Report scans the archive folder.
+func (s *ArchiveServer) Report() (*ArchiveReport, error) {
+	titles, err := wiiudownloader.ScanArchive(s.root)
+	if err != nil {
+		return nil, err
+	}
+	report := &ArchiveReport{ScannedAt: time.Now(), Titles: titles}
+	for _, title := range titles {
+		if title.Status == wiiudownloader.ARCHIVE_STATUS_COMPLETE {
+			report.Complete++
+		}
+		if title.Verified {
+			report.Verified++
+		}
+	}
+	return report, nil
+}
+
+func (s *ArchiveServer) handleReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Report()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *ArchiveServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	report, err := s.Report()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	archiveTemplate.Execute(w, map[string]interface{}{
+		"Root":   s.root,
+		"Report": report,
+		// The JSON report needs the bearer token then, a link can't send it
+		"JSONLink": s.token == "",
+	})
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/Xpl0itU/WiiUDownloader/server/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcService implements the gRPC API of api/downloader.proto over the jobs of
+// a Server.
+type grpcService struct {
+	api.UnimplementedDownloaderServer
+	server *Server
+}
+
+// NewGRPCServer returns a gRPC server with the Downloader service of the api
+// package, which drives the jobs of s like its JSON API. Clients must send the
+// token of s as "authorization: Bearer <token>" metadata.
+func (s *Server) NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := checkGRPCToken(ctx, s.token); err != nil {
+				return nil, err
+			}
+			return handler(ctx, request)
+		}),
+		grpc.StreamInterceptor(func(service any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkGRPCToken(stream.Context(), s.token); err != nil {
+				return err
+			}
+			return handler(service, stream)
+		}),
+	)
+	api.RegisterDownloaderServer(server, &grpcService{server: s})
+	return server
+}
+
+// checkGRPCToken is checkToken for the metadata of gRPC calls.
+func checkGRPCToken(ctx context.Context, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = strings.TrimPrefix(values[0], "Bearer ")
+		}
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+	return nil
+}
+
+func (g *grpcService) ListTitles(ctx context.Context, request *api.ListTitlesRequest) (*api.ListTitlesResponse, error) {
+	if request.MaxOsVersion > 0xFF {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max OS version: %d", request.MaxOsVersion)
+	}
+	limit := defaultSearchLimit
+	if request.Limit != 0 {
+		limit = int(request.Limit)
+	}
+	category := wiiudownloader.GetCategoryFromFormattedCategory(request.Category)
+	subcategory := wiiudownloader.GetGameSubcategoryFromFormattedGameSubcategory(request.Subcategory)
+	response := &api.ListTitlesResponse{}
+	for _, title := range searchTitles(request.Query, category, subcategory, uint8(request.MaxOsVersion), limit) {
+		response.Titles = append(response.Titles, &api.Title{
+			Name:        title.Name,
+			TitleId:     title.TitleID,
+			Region:      title.Region,
+			Kind:        title.Kind,
+			ProductCode: title.ProductCode,
+			OsVersion:   title.OSVersion,
+			Genre:       title.Genre,
+			Players:     uint32(title.Players),
+			Languages:   title.Languages,
+		})
+	}
+	return response, nil
+}
+
+func (g *grpcService) StartDownload(request *api.StartDownloadRequest, stream grpc.ServerStreamingServer[api.Job]) error {
+	job, err := g.server.Enqueue(request.TitleId)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = g.server.watchJob(stream.Context(), job.ID, func(job Job) error {
+		return stream.Send(newAPIJob(job))
+	})
+	switch {
+	case errors.Is(err, errJobNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case stream.Context().Err() != nil:
+		return status.FromContextError(stream.Context().Err()).Err()
+	}
+	return err
+}
+
+func (g *grpcService) Cancel(ctx context.Context, request *api.CancelRequest) (*api.Job, error) {
+	job, ok := g.server.Cancel(int(request.Id))
+	if !ok {
+		return nil, status.Error(codes.NotFound, errJobNotFound.Error())
+	}
+	return newAPIJob(job), nil
+}
+
+func newAPIJob(job Job) *api.Job {
+	return &api.Job{
+		Id:                 int64(job.ID),
+		TitleId:            job.TitleID,
+		Name:               job.Name,
+		Status:             job.Status,
+		Phase:              job.Phase,
+		Error:              job.Error,
+		ErrorKind:          job.ErrorKind,
+		FailedContents:     job.FailedContents,
+		Downloaded:         job.Downloaded,
+		Size:               job.Size,
+		DecryptionProgress: job.DecryptionProgress,
+		CreatedAt:          timestamppb.New(job.CreatedAt),
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+	"github.com/Xpl0itU/WiiUDownloader/server/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestGRPCClient serves the gRPC API of a new Server in memory.
+func newTestGRPCClient(t *testing.T, token string) api.DownloaderClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := New(t.TempDir(), token).NewGRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return api.NewDownloaderClient(conn)
+}
+
+func withTestToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPCToken(t *testing.T) {
+	client := newTestGRPCClient(t, "secret")
+	if _, err := client.ListTitles(withTestToken("wrong"), &api.ListTitlesRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListTitles with a wrong token: %v, want Unauthenticated", err)
+	}
+	stream, err := client.StartDownload(context.Background(), &api.StartDownloadRequest{TitleId: "0005000010145d00"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("StartDownload without a token: %v, want Unauthenticated", err)
+	}
+	if _, err := client.ListTitles(withTestToken("secret"), &api.ListTitlesRequest{}); err != nil {
+		t.Errorf("ListTitles with the token: %v", err)
+	}
+}
+
+func TestGRPCListTitles(t *testing.T) {
+	client := newTestGRPCClient(t, "")
+	response, err := client.ListTitles(context.Background(), &api.ListTitlesRequest{Query: "mario", Category: "Game"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := searchTitles("mario", wiiudownloader.TITLE_CATEGORY_GAME, wiiudownloader.GAME_SUBCATEGORY_ALL, 0, defaultSearchLimit)
+	if len(want) == 0 {
+		t.Fatal("no title matches mario in the title database")
+	}
+	if len(response.Titles) != len(want) {
+		t.Fatalf("got %d titles, want %d", len(response.Titles), len(want))
+	}
+	for i, title := range response.Titles {
+		if title.TitleId != want[i].TitleID || title.Name != want[i].Name {
+			t.Errorf("title %d = %s %s, want %s %s", i, title.TitleId, title.Name, want[i].TitleID, want[i].Name)
+		}
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	client := newTestGRPCClient(t, "")
+	stream, err := client.StartDownload(context.Background(), &api.StartDownloadRequest{TitleId: "not a title"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("StartDownload of an invalid title ID: %v, want InvalidArgument", err)
+	}
+	if _, err := client.Cancel(context.Background(), &api.CancelRequest{Id: 42}); status.Code(err) != codes.NotFound {
+		t.Errorf("Cancel of an unknown job: %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,597 @@
+// Package server exposes WiiUDownloader over a JSON HTTP API, to run it on a
+// NAS or a server and control it from a browser or scripts.
+//
+//	GET    /api/titles?q=&category=&limit=&maxOS=  search the title database, maxOS=10
+//	                                               leaves out the titles OSv10 can't install,
+//	                                               &subcategory= splits the games
+//	GET    /api/jobs                               list the download jobs
+//	POST   /api/jobs {"titleID": "..."}            queue a download, with ?stream=true the
+//	                                               job is streamed as JSON lines until it ends
+//	GET    /api/jobs/{id}                          progress of a job
+//	DELETE /api/jobs/{id}                          cancel a job
+//	GET    /api/events                             the jobs every time they change, as server-sent events
+//
+// Requests send the token as "Authorization: Bearer <token>", only
+// /api/events also takes it as ?token=<token> for browsers.
+//
+// A job is a JSON object:
+//
+//	{"id": 1, "titleID": "0005000010145d00", "name": "...", "status": "downloading",
+//	 "phase": "downloading", "downloaded": 1048576, "size": 2097152,
+//	 "decryptionProgress": 0, "createdAt": "2024-06-01T12:00:00Z"}
+//
+// status is one of the JOB_STATUS_* values and phase one of the
+// wiiudownloader.PROGRESS_PHASE_* ones. Failed jobs add "error", "errorKind",
+// one of the ERROR_KIND_* values, and for partial downloads "failedContents",
+// the IDs of the contents that failed.
+//
+// POST /api/jobs?stream=true answers with the application/x-ndjson content type
+// and writes the job as one JSON object per line, right away and every time it
+// changes, at most four times a second. The last line is the job once it is
+// done, failed or cancelled, then the response ends. Closing the connection
+// stops the stream but not the download, DELETE /api/jobs/{id} cancels it.
+// /api/events sends "event: jobs" events whose data is the JSON array of every
+// job, oldest first.
+//
+// NewGRPCServer serves the same operations over gRPC for the tools that prefer
+// it, with the Downloader service of api/downloader.proto: ListTitles,
+// StartDownload, which streams the job like ?stream=true, and Cancel. Its
+// clients send the token as "authorization: Bearer <token>" metadata.
+//
+// A small web frontend using the API is served at /. ArchiveServer serves a
+// read-only report of the titles of an archive folder instead.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	wiiudownloader "github.com/Xpl0itU/WiiUDownloader"
+)
+
+const (
+	JOB_STATUS_QUEUED      = "queued"
+	JOB_STATUS_DOWNLOADING = "downloading"
+	JOB_STATUS_DONE        = "done"
+	JOB_STATUS_FAILED      = "failed"
+	JOB_STATUS_CANCELLED   = "cancelled"
+)
+
+// Kinds of failures reported in the errorKind of failed jobs, so clients can
+// offer a way to recover from them
+const (
+	ERROR_KIND_CDN_STATUS         = "cdnStatus"
+	ERROR_KIND_TICKET_UNAVAILABLE = "ticketUnavailable"
+	ERROR_KIND_HASH_MISMATCH      = "hashMismatch"
+	ERROR_KIND_DISK_FULL          = "diskFull"
+	ERROR_KIND_PARTIAL_DOWNLOAD   = "partialDownload" // the failed contents are in failedContents
+	ERROR_KIND_NO_UPDATE          = "noUpdateAvailable"
+	ERROR_KIND_TIMEOUT            = "timeout"
+)
+
+const (
+	defaultSearchLimit = 100
+	eventsInterval     = 250 * time.Millisecond // sending jobs more often than this is wasted on a browser
+)
+
+//go:embed web
+var webAssets embed.FS
+
+var errJobNotFound = errors.New("job not found")
+
+type Job struct {
+	ID                 int       `json:"id"`
+	TitleID            string    `json:"titleID"`
+	Name               string    `json:"name"`
+	Status             string    `json:"status"`
+	Phase              string    `json:"phase,omitempty"`
+	Error              string    `json:"error,omitempty"`
+	ErrorKind          string    `json:"errorKind,omitempty"`
+	FailedContents     []string  `json:"failedContents,omitempty"`
+	Downloaded         int64     `json:"downloaded"`
+	Size               int64     `json:"size"`
+	DecryptionProgress float64   `json:"decryptionProgress"`
+	CreatedAt          time.Time `json:"createdAt"`
+	reporter           *wiiudownloader.EventReporter
+}
+
+// Server downloads the queued jobs one after the other to its output directory.
+type Server struct {
+	outputDirectory string
+	downloadOptions []wiiudownloader.DownloadTitleOption
+	token           string // required as a bearer token when not empty
+	mutex           sync.Mutex
+	jobs            []*Job
+	nextID          int
+	pending         chan *Job
+	subscribers     map[chan struct{}]struct{} // notified when a job changes
+	webhookClient   *http.Client
+	webhookURL      string
+	mux             *http.ServeMux
+}
+
+func New(outputDirectory, token string, downloadOptions ...wiiudownloader.DownloadTitleOption) *Server {
+	s := &Server{
+		outputDirectory: outputDirectory,
+		downloadOptions: downloadOptions,
+		token:           token,
+		jobs:            make([]*Job, 0),
+		nextID:          1,
+		pending:         make(chan *Job, 1024),
+		subscribers:     make(map[chan struct{}]struct{}),
+		mux:             http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/api/titles", s.handleTitles)
+	s.mux.HandleFunc("/api/jobs", s.handleJobs)
+	s.mux.HandleFunc("/api/jobs/", s.handleJob)
+	s.mux.HandleFunc("/api/events", s.handleEvents)
+	web, err := fs.Sub(webAssets, "web")
+	if err != nil {
+		panic(err)
+	}
+	s.mux.Handle("/", http.FileServer(http.FS(web)))
+	go s.worker()
+	return s
+}
+
+// SetWebhook makes the server post to webhookURL when a job starts, completes
+// or fails, see wiiudownloader.SendWebhook.
+func (s *Server) SetWebhook(client *http.Client, webhookURL string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.webhookClient = client
+	s.webhookURL = webhookURL
+}
+
+// sendWebhook must be called with the mutex held, the webhook is sent in the
+// background so a slow endpoint never holds up the downloads.
+func (s *Server) sendWebhook(event string, titleID string, err error) {
+	if s.webhookURL == "" {
+		return
+	}
+	tid, parseErr := strconv.ParseUint(titleID, 16, 64)
+	if parseErr != nil {
+		return
+	}
+	client, webhookURL := s.webhookClient, s.webhookURL
+	go func() {
+		if err := wiiudownloader.SendWebhook(client, webhookURL, wiiudownloader.NewWebhookEvent(event, tid, err)); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+// checkToken reports whether r carries the token, always true without one.
+// The token is only taken from the token parameter of the URL with
+// allowQuery, for the requests of browsers that can't send headers: URLs end
+// up in logs and in the history of the browser.
+func checkToken(r *http.Request, expected string, allowQuery bool) bool {
+	if expected == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" && allowQuery {
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// EventSource can't send headers
+	if strings.HasPrefix(r.URL.Path, "/api/") && !checkToken(r, s.token, r.URL.Path == "/api/events") {
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleTitles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	query := r.URL.Query().Get("q")
+	category := wiiudownloader.GetCategoryFromFormattedCategory(r.URL.Query().Get("category"))
+	subcategory := wiiudownloader.GetGameSubcategoryFromFormattedGameSubcategory(r.URL.Query().Get("subcategory"))
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %q", value))
+			return
+		}
+		limit = parsed
+	}
+	maxOSVersion := uint8(0)
+	if value := r.URL.Query().Get("maxOS"); value != "" {
+		parsed, err := strconv.ParseUint(strings.TrimPrefix(value, "OSv"), 10, 8)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid maxOS: %q", value))
+			return
+		}
+		maxOSVersion = uint8(parsed)
+	}
+	writeJSON(w, http.StatusOK, searchTitles(query, category, subcategory, maxOSVersion, limit))
+}
+
+// searchTitles returns up to limit titles of category matching query, leaving
+// out the ones maxOSVersion can't install when it isn't 0 and the games that
+// aren't in subcategory.
+func searchTitles(query string, category, subcategory, maxOSVersion uint8, limit int) []wiiudownloader.ExportedTitle {
+	titles := make([]wiiudownloader.ExportedTitle, 0)
+	for _, entry := range wiiudownloader.GetTitleEntries(category) {
+		if !wiiudownloader.TitleMatchesQuery(entry, query) {
+			continue
+		}
+		if maxOSVersion != 0 && !wiiudownloader.TitleRunsOnOSVersion(entry.TitleID, maxOSVersion) {
+			continue
+		}
+		if wiiudownloader.IsGame(entry.TitleID) && !wiiudownloader.IsInGameSubcategory(entry.TitleID, subcategory) {
+			continue
+		}
+		info, _ := wiiudownloader.GetTitleInfo(entry.TitleID)
+		titles = append(titles, wiiudownloader.ExportedTitle{
+			Name:        entry.Name,
+			TitleID:     fmt.Sprintf("%016x", entry.TitleID),
+			Region:      wiiudownloader.GetFormattedRegion(entry.Region),
+			Kind:        wiiudownloader.GetFormattedKind(entry.TitleID),
+			ProductCode: info.ProductCode,
+			OSVersion:   wiiudownloader.GetFormattedRequiredOSVersion(entry.TitleID),
+			Genre:       info.Genre,
+			Players:     info.Players,
+			Languages:   wiiudownloader.GetFormattedLanguages(info.Languages),
+		})
+		if len(titles) == limit {
+			break
+		}
+	}
+	return titles
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.Jobs())
+	case http.MethodPost:
+		request := struct {
+			TitleID string `json:"titleID"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		job, err := s.Enqueue(request.TitleID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if r.URL.Query().Get("stream") == "true" {
+			s.streamJob(w, r, job.ID)
+			return
+		}
+		writeJSON(w, http.StatusCreated, job)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/jobs/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, errJobNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		job, ok := s.Job(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, errJobNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case http.MethodDelete:
+		job, ok := s.Cancel(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, errJobNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// Enqueue queues the download of a title, the title ID can use any of the
+// notations accepted by wiiudownloader.ParseTitleID.
+func (s *Server) Enqueue(titleID string) (Job, error) {
+	tid, err := wiiudownloader.ParseTitleID(titleID)
+	if err != nil {
+		return Job{}, err
+	}
+	entry := wiiudownloader.GetTitleEntryFromTid(tid)
+	if entry.TitleID == 0 {
+		return Job{}, fmt.Errorf("title %016x is not in the title database", tid)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job := &Job{
+		ID:        s.nextID,
+		TitleID:   fmt.Sprintf("%016x", tid),
+		Name:      entry.Name,
+		Status:    JOB_STATUS_QUEUED,
+		CreatedAt: time.Now(),
+	}
+	s.nextID++
+	select {
+	case s.pending <- job:
+	default:
+		return Job{}, errors.New("too many queued jobs")
+	}
+	s.jobs = append(s.jobs, job)
+	s.notify()
+	return *job, nil
+}
+
+// Jobs returns a snapshot of every job, oldest first.
+func (s *Server) Jobs() []Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+func (s *Server) Job(id int) (Job, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+// Cancel cancels a queued or running job, finished jobs are left as they are.
+func (s *Server) Cancel(id int) (Job, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.jobs {
+		if job.ID != id {
+			continue
+		}
+		switch job.Status {
+		case JOB_STATUS_QUEUED:
+			job.Status = JOB_STATUS_CANCELLED
+		case JOB_STATUS_DOWNLOADING:
+			job.reporter.SetCancelled()
+		}
+		s.notify()
+		return *job, true
+	}
+	return Job{}, false
+}
+
+func (s *Server) worker() {
+	for job := range s.pending {
+		s.mutex.Lock()
+		if job.Status != JOB_STATUS_QUEUED {
+			s.mutex.Unlock()
+			continue
+		}
+		events := make(chan wiiudownloader.ProgressEvent, 64)
+		job.reporter = wiiudownloader.NewEventReporter(events)
+		job.Status = JOB_STATUS_DOWNLOADING
+		s.notify()
+		s.sendWebhook(wiiudownloader.WEBHOOK_EVENT_STARTED, job.TitleID, nil)
+		s.mutex.Unlock()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for event := range events {
+				s.updateJob(job, event)
+			}
+		}()
+		err := job.reporter.DownloadTitle(job.TitleID, s.outputDirectory, s.downloadOptions...)
+		close(events)
+		<-done
+
+		s.mutex.Lock()
+		switch {
+		case err != nil:
+			job.Status = JOB_STATUS_FAILED
+			job.Error = err.Error()
+			job.ErrorKind = getErrorKind(err)
+			var partialErr *wiiudownloader.PartialDownloadError
+			if errors.As(err, &partialErr) {
+				for _, contentErr := range partialErr.Failed {
+					job.FailedContents = append(job.FailedContents, fmt.Sprintf("%08X", contentErr.ContentID))
+				}
+			}
+			s.sendWebhook(wiiudownloader.WEBHOOK_EVENT_FAILED, job.TitleID, err)
+		case job.reporter.Cancelled():
+			job.Status = JOB_STATUS_CANCELLED
+		default:
+			job.Status = JOB_STATUS_DONE
+			s.sendWebhook(wiiudownloader.WEBHOOK_EVENT_COMPLETED, job.TitleID, nil)
+		}
+		s.notify()
+		s.mutex.Unlock()
+	}
+}
+
+func (s *Server) updateJob(job *Job, event wiiudownloader.ProgressEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job.Downloaded = event.TotalDownloaded
+	job.Size = event.TotalSize
+	job.Phase = string(event.Phase)
+	if event.Type == wiiudownloader.PROGRESS_EVENT_DECRYPTION_PROGRESS {
+		job.DecryptionProgress = event.DecryptionProgress
+	}
+	s.notify()
+}
+
+// notify must be called with the mutex held.
+func (s *Server) notify() {
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- struct{}{}:
+		default: // the subscriber has a notification pending already
+		}
+	}
+}
+
+// subscribe returns a channel notified when a job changes, it starts with a
+// notification pending so that subscribers send the current state right away.
+func (s *Server) subscribe() chan struct{} {
+	changed := make(chan struct{}, 1)
+	changed <- struct{}{}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.subscribers[changed] = struct{}{}
+	return changed
+}
+
+func (s *Server) unsubscribe(changed chan struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscribers, changed)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	changed := s.subscribe()
+	defer s.unsubscribe(changed)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	ticker := time.NewTicker(eventsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+		data, err := json.Marshal(s.Jobs())
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: jobs\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func getErrorKind(err error) string {
+	var partialErr *wiiudownloader.PartialDownloadError
+	switch {
+	case errors.As(err, &partialErr):
+		return ERROR_KIND_PARTIAL_DOWNLOAD
+	case errors.Is(err, wiiudownloader.ErrNoUpdateAvailable):
+		return ERROR_KIND_NO_UPDATE
+	case errors.Is(err, wiiudownloader.ErrDiskFull):
+		return ERROR_KIND_DISK_FULL
+	case errors.Is(err, wiiudownloader.ErrHashMismatch):
+		return ERROR_KIND_HASH_MISMATCH
+	case errors.Is(err, wiiudownloader.ErrTicketUnavailable):
+		return ERROR_KIND_TICKET_UNAVAILABLE
+	case errors.Is(err, wiiudownloader.ErrCDNStatus):
+		return ERROR_KIND_CDN_STATUS
+	case errors.Is(err, wiiudownloader.ErrTimeout):
+		return ERROR_KIND_TIMEOUT
+	}
+	return ""
+}
+
+func isFinished(status string) bool {
+	return status == JOB_STATUS_DONE || status == JOB_STATUS_FAILED || status == JOB_STATUS_CANCELLED
+}
+
+// streamJob writes the job as a JSON line every time it changes until it ends,
+// for tools driving the server that want to follow a single download.
+func (s *Server) streamJob(w http.ResponseWriter, r *http.Request, id int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	s.watchJob(r.Context(), id, func(job Job) error {
+		if err := encoder.Encode(job); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+// watchJob calls send with the job right away and every time it changes, at
+// most once per eventsInterval, until it ends, ctx is done or send fails.
+func (s *Server) watchJob(ctx context.Context, id int, send func(Job) error) error {
+	changed := s.subscribe()
+	defer s.unsubscribe(changed)
+
+	ticker := time.NewTicker(eventsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+		job, ok := s.Job(id)
+		if !ok {
+			return errJobNotFound
+		}
+		if err := send(job); err != nil {
+			return err
+		}
+		if isFinished(job.Status) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
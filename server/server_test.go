@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenParameter(t *testing.T) {
+	s := New(t.TempDir(), "secret")
+	archive := NewArchiveServer(t.TempDir(), "secret")
+	tests := []struct {
+		handler http.Handler
+		target  string
+		bearer  string
+		want    bool // authorized
+	}{
+		{s, "/api/jobs", "secret", true},
+		{s, "/api/jobs", "wrong", false},
+		{s, "/api/jobs?token=secret", "", false},
+		{s, "/api/events?token=wrong", "", false},
+		{archive, "/?token=secret", "", true},
+		{archive, "/api/archive?token=secret", "", false},
+		{archive, "/api/archive", "secret", true},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.target, nil)
+		if test.bearer != "" {
+			request.Header.Set("Authorization", "Bearer "+test.bearer)
+		}
+		recorder := httptest.NewRecorder()
+		test.handler.ServeHTTP(recorder, request)
+		if got := recorder.Code != http.StatusUnauthorized; got != test.want {
+			t.Errorf("%s with bearer %q: authorized = %v, want %v", test.target, test.bearer, got, test.want)
+		}
+	}
+}
+
+func TestTokenParameterEvents(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/api/events?token=secret", nil)
+	if !checkToken(request, "secret", true) {
+		t.Error("token parameter rejected where it is allowed")
+	}
+	if checkToken(request, "secret", false) {
+		t.Error("token parameter accepted where it isn't allowed")
+	}
+}
@@ -0,0 +1,142 @@
+"use strict";
+
+// The token is kept in the browser once entered, the API rejects requests
+// without it when the server was started with --token.
+let token = localStorage.getItem("token") || "";
+
+async function api(method, path, body) {
+	const response = await fetch(path, {
+		method: method,
+		headers: {
+			"Authorization": "Bearer " + token,
+			"Content-Type": "application/json",
+		},
+		body: body === undefined ? undefined : JSON.stringify(body),
+	});
+	if (response.status === 401) {
+		token = prompt("Token of the WiiUDownloader server") || "";
+		localStorage.setItem("token", token);
+		return api(method, path, body);
+	}
+	const data = await response.json();
+	if (!response.ok) {
+		throw new Error(data.error);
+	}
+	return data;
+}
+
+function cell(row, text, className) {
+	const td = document.createElement("td");
+	td.textContent = text;
+	if (className) {
+		td.className = className;
+	}
+	row.appendChild(td);
+	return td;
+}
+
+async function search() {
+	const query = document.getElementById("query").value;
+	const category = document.getElementById("category").value;
+	const titles = await api("GET", "/api/titles?q=" + encodeURIComponent(query) + "&category=" + encodeURIComponent(category));
+	const tbody = document.getElementById("titles");
+	tbody.replaceChildren();
+	for (const title of titles) {
+		const row = document.createElement("tr");
+		cell(row, title.name);
+		cell(row, title.titleID, "tid");
+		cell(row, title.region);
+		cell(row, title.kind);
+		const button = document.createElement("button");
+		button.textContent = "Download";
+		button.addEventListener("click", () => {
+			api("POST", "/api/jobs", { titleID: title.titleID }).catch(alert);
+		});
+		cell(row, "").appendChild(button);
+		tbody.appendChild(row);
+	}
+}
+
+function formatBytes(bytes) {
+	const units = ["B", "kB", "MB", "GB", "TB"];
+	let unit = 0;
+	while (bytes >= 1000 && unit < units.length - 1) {
+		bytes /= 1000;
+		unit++;
+	}
+	return bytes.toFixed(unit === 0 ? 0 : 1) + " " + units[unit];
+}
+
+function renderJobs(jobs) {
+	const list = document.getElementById("jobs");
+	list.replaceChildren();
+	for (const job of jobs.slice().reverse()) {
+		const item = document.createElement("li");
+		const title = document.createElement("div");
+		title.textContent = job.name + " ";
+		const status = document.createElement("span");
+		status.className = "status-" + job.status;
+		status.textContent = job.error ? job.status + ": " + job.error : job.status;
+		title.appendChild(status);
+		item.appendChild(title);
+
+		if (job.status === "downloading" && job.phase === "metadata") {
+			const phase = document.createElement("div");
+			phase.textContent = "Fetching metadata...";
+			item.appendChild(phase);
+		} else if (job.status === "downloading") {
+			const progress = document.createElement("progress");
+			progress.max = job.size || 1;
+			progress.value = job.downloaded;
+			item.appendChild(progress);
+			const size = document.createElement("div");
+			size.textContent = formatBytes(job.downloaded) + " / " + formatBytes(job.size);
+			if (job.decryptionProgress > 0) {
+				size.textContent += ", decrypting " + Math.round(job.decryptionProgress * 100) + "%";
+			}
+			item.appendChild(size);
+		}
+		if (job.status === "queued" || job.status === "downloading") {
+			const cancel = document.createElement("button");
+			cancel.textContent = "Cancel";
+			cancel.addEventListener("click", () => {
+				api("DELETE", "/api/jobs/" + job.id).catch(alert);
+			});
+			item.appendChild(cancel);
+		}
+		list.appendChild(item);
+	}
+}
+
+function listenForJobs() {
+	const connection = document.getElementById("connection");
+	const events = new EventSource("/api/events?token=" + encodeURIComponent(token));
+	events.addEventListener("open", () => {
+		connection.textContent = "Connected";
+		connection.className = "connected";
+	});
+	events.addEventListener("jobs", (event) => {
+		renderJobs(JSON.parse(event.data));
+	});
+	events.addEventListener("error", () => {
+		connection.textContent = "Disconnected";
+		connection.className = "disconnected";
+		// EventSource reconnects on its own, unless the token was rejected
+		if (events.readyState === EventSource.CLOSED) {
+			setTimeout(listenForJobs, 5000);
+		}
+	});
+}
+
+let searchTimeout;
+document.getElementById("query").addEventListener("input", () => {
+	clearTimeout(searchTimeout);
+	searchTimeout = setTimeout(() => search().catch(alert), 250);
+});
+document.getElementById("category").addEventListener("change", () => search().catch(alert));
+document.getElementById("search").addEventListener("submit", (event) => {
+	event.preventDefault();
+	search().catch(alert);
+});
+
+search().then(listenForJobs).catch(alert);
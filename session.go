@@ -0,0 +1,312 @@
+package wiiudownloader
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	sessionFilename     = "wiiudownloader.session"
+	sessionSaveInterval = time.Second
+)
+
+// ByteRange is a half-open [Start, End) range of bytes written to a content file.
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+type contentSession struct {
+	Ranges   []ByteRange `json:"ranges"`
+	Done     bool        `json:"done"`
+	Verified bool        `json:"verified,omitempty"` // checked against its hash after it was written
+	Size     int64       `json:"size,omitempty"`
+
+	// synced are the Ranges known to be on the disk, the only ones saved: the
+	// journal must never claim bytes a power loss could take back
+	synced   []ByteRange
+	lastSync time.Time
+}
+
+func (c *contentSession) MarshalJSON() ([]byte, error) {
+	type savedContentSession contentSession
+	saved := savedContentSession(*c)
+	saved.Ranges = c.synced
+	if saved.Ranges == nil {
+		saved.Ranges = make([]ByteRange, 0)
+	}
+	return json.Marshal(saved)
+}
+
+// downloadSession is the journal of a title folder: it persists the progress of
+// the parallel content downloads, and which contents are complete and verified,
+// so that a run interrupted by a crash or a power loss resumes every content from
+// the bytes it already has without hashing the finished ones again.
+type downloadSession struct {
+	mutex        sync.Mutex
+	path         string
+	syncFolder   bool                       // flush the folder too when a content is done
+	TitleVersion uint16                     `json:"titleVersion"`
+	Contents     map[string]*contentSession `json:"contents"`
+}
+
+func loadDownloadSession(outputDir string, titleVersion uint16) *downloadSession {
+	session := &downloadSession{
+		path:         filepath.Join(outputDir, sessionFilename),
+		TitleVersion: titleVersion,
+		Contents:     make(map[string]*contentSession),
+	}
+
+	data, err := os.ReadFile(session.path)
+	if err != nil {
+		return session
+	}
+	saved := downloadSession{}
+	if err := json.Unmarshal(data, &saved); err != nil || saved.TitleVersion != titleVersion || saved.Contents == nil {
+		return session
+	}
+	for _, content := range saved.Contents {
+		content.synced = append([]ByteRange(nil), content.Ranges...)
+	}
+	session.Contents = saved.Contents
+	return session
+}
+
+func (s *downloadSession) getContent(filename string) *contentSession {
+	content, ok := s.Contents[filename]
+	if !ok {
+		content = &contentSession{Ranges: make([]ByteRange, 0)}
+		s.Contents[filename] = content
+	}
+	return content
+}
+
+// completedFileSize reports whether a content was fully downloaded in a previous
+// run and is still on disk with the same size.
+func (s *downloadSession) completedFileSize(dstPath string) (int64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, ok := s.Contents[filepath.Base(dstPath)]
+	if !ok || !content.Done {
+		return 0, false
+	}
+	info, err := os.Stat(dstPath)
+	if err != nil || info.Size() != content.Size {
+		return 0, false
+	}
+	return content.Size, true
+}
+
+// resumeOffset returns how many bytes from the start of a content are known to be
+// written, capped at the size of the file on disk.
+func (s *downloadSession) resumeOffset(dstPath string) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, ok := s.Contents[filepath.Base(dstPath)]
+	if !ok || len(content.Ranges) == 0 || content.Ranges[0].Start != 0 {
+		return 0
+	}
+	info, err := os.Stat(dstPath)
+	if err != nil {
+		return 0
+	}
+	if info.Size() < content.Ranges[0].End {
+		return info.Size()
+	}
+	return content.Ranges[0].End
+}
+
+// missingRanges returns the parts of a content of size bytes that aren't known
+// to be written, like resumeOffset the bytes past the end of the file on disk
+// are missing.
+func (s *downloadSession) missingRanges(dstPath string, size int64) []ByteRange {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var diskSize int64
+	if info, err := os.Stat(dstPath); err == nil {
+		diskSize = info.Size()
+	}
+	missing := make([]ByteRange, 0)
+	var next int64
+	if content, ok := s.Contents[filepath.Base(dstPath)]; ok {
+		for _, written := range content.Ranges {
+			end := written.End
+			if end > size {
+				end = size
+			}
+			if end > diskSize {
+				end = diskSize
+			}
+			if written.Start >= end {
+				continue
+			}
+			if written.Start > next {
+				missing = append(missing, ByteRange{Start: next, End: written.Start})
+			}
+			next = max(next, end)
+		}
+	}
+	if next < size {
+		missing = append(missing, ByteRange{Start: next, End: size})
+	}
+	return missing
+}
+
+// addRange records bytes written to the content file, and saves them to the
+// journal at most once every sessionSaveInterval, after syncing the file.
+func (s *downloadSession) addRange(filename string, file *os.File, start, end int64) {
+	s.mutex.Lock()
+	content := s.getContent(filename)
+	content.Ranges = mergeByteRanges(append(content.Ranges, ByteRange{Start: start, End: end}))
+	if time.Since(content.lastSync) < sessionSaveInterval {
+		s.mutex.Unlock()
+		return
+	}
+	content.lastSync = time.Now()
+	written := append([]ByteRange(nil), content.Ranges...)
+	s.mutex.Unlock()
+
+	// Synced without the mutex, the other contents keep being written
+	if err := file.Sync(); err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Contents[filename] != content || content.Done {
+		// Reset or completed while syncing
+		return
+	}
+	content.synced = written
+	s.save()
+}
+
+// markDone must only be called once the content is synced to disk, otherwise a
+// power loss could leave a content marked as complete that isn't.
+func (s *downloadSession) markDone(filename string, size int64, verified bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content := s.getContent(filename)
+	content.Ranges = []ByteRange{{Start: 0, End: size}}
+	content.synced = append([]ByteRange(nil), content.Ranges...)
+	content.Done = true
+	content.Verified = verified
+	content.Size = size
+	s.save()
+	if s.syncFolder {
+		// The entries of the content and of the session are durable too
+		syncDirectory(filepath.Dir(s.path))
+	}
+}
+
+func (s *downloadSession) markVerified(filename string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if content, ok := s.Contents[filename]; ok && content.Done {
+		content.Verified = true
+		s.save()
+	}
+}
+
+func (s *downloadSession) isVerified(filename string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, ok := s.Contents[filename]
+	return ok && content.Done && content.Verified
+}
+
+func (s *downloadSession) resetContent(filename string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.Contents, filename)
+	s.save()
+}
+
+// save must be called with the mutex held. Only the synced ranges of the
+// contents are saved. The session is written and synced to a temporary file
+// first so a crash or a power loss while saving never leaves a truncated
+// session behind.
+func (s *downloadSession) save() {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	tmpPath := s.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	os.Rename(tmpPath, s.path)
+}
+
+func (s *downloadSession) remove() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func mergeByteRanges(ranges []ByteRange) []ByteRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+	merged := make([]ByteRange, 0, len(ranges))
+	for _, r := range ranges {
+		if len(merged) > 0 && r.Start <= merged[len(merged)-1].End {
+			if r.End > merged[len(merged)-1].End {
+				merged[len(merged)-1].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// sessionWriter records every write to a content file in the download session,
+// and in its piece map if it has one. writer writes to file, which is synced
+// before the session saves the writes.
+type sessionWriter struct {
+	writer   io.Writer
+	file     *os.File
+	session  *downloadSession
+	pieces   *pieceTracker
+	filename string
+	offset   int64
+}
+
+func (w *sessionWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	if n > 0 {
+		w.session.addRange(w.filename, w.file, w.offset, w.offset+int64(n))
+		w.pieces.addRange(w.offset, w.offset+int64(n))
+		w.offset += int64(n)
+	}
+	return n, err
+}
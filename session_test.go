@@ -0,0 +1,42 @@
+package wiiudownloader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownloadSessionSavesSyncedRanges(t *testing.T) {
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "00000001.app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	session := loadDownloadSession(dir, 16)
+	session.addRange("00000001.app", file, 0, 100)
+	want := []ByteRange{{Start: 0, End: 100}}
+	if got := loadDownloadSession(dir, 16).Contents["00000001.app"].Ranges; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved ranges = %v, want %v", got, want)
+	}
+
+	// Written since the last sync, the journal is saved for another content
+	session.addRange("00000001.app", file, 100, 200)
+	session.markDone("00000002.app", 50, false)
+	if got := loadDownloadSession(dir, 16).Contents["00000001.app"].Ranges; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved ranges = %v, want only the synced %v", got, want)
+	}
+	if got, want := session.Contents["00000001.app"].Ranges, []ByteRange{{Start: 0, End: 200}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranges in memory = %v, want %v", got, want)
+	}
+
+	session.Contents["00000001.app"].lastSync = time.Now().Add(-sessionSaveInterval)
+	session.addRange("00000001.app", file, 200, 300)
+	want = []ByteRange{{Start: 0, End: 300}}
+	if got := loadDownloadSession(dir, 16).Contents["00000001.app"].Ranges; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved ranges = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,249 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+	"unicode/utf16"
+)
+
+// Property IDs of the headers of 7z archives, see 7zFormat.txt of the 7-Zip
+// sources.
+const (
+	sevenZipEnd              = 0x00
+	sevenZipHeader           = 0x01
+	sevenZipMainStreamsInfo  = 0x04
+	sevenZipFilesInfo        = 0x05
+	sevenZipPackInfo         = 0x06
+	sevenZipUnpackInfo       = 0x07
+	sevenZipSubStreamsInfo   = 0x08
+	sevenZipSize             = 0x09
+	sevenZipCRC              = 0x0A
+	sevenZipFolder           = 0x0B
+	sevenZipCodersUnpackSize = 0x0C
+	sevenZipNumUnpackStream  = 0x0D
+	sevenZipEmptyStream      = 0x0E
+	sevenZipEmptyFile        = 0x0F
+	sevenZipName             = 0x11
+	sevenZipMTime            = 0x14
+	sevenZipWinAttributes    = 0x15
+)
+
+const (
+	sevenZipSignatureHeaderSize = 32
+	// FILETIME of the Unix epoch, in 100 ns intervals since 1601
+	sevenZipUnixEpoch     = 116444736000000000
+	windowsAttributeDir   = 0x10
+	windowsAttributeFile  = 0x20
+	sevenZipCopyCoderFlag = 0x01 // a simple coder with a one byte ID
+	sevenZipCopyCoderID   = 0x00
+)
+
+var sevenZipSignature = []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0x00, 0x04}
+
+type sevenZipEntry struct {
+	name    string
+	dir     bool
+	size    uint64
+	crc     uint32
+	modTime time.Time
+}
+
+// sevenZipWriter writes 7z archives whose files are stored without
+// compression, in a single folder with the Copy coder. The data of the files
+// is written as they are added, the header listing them once they all were,
+// and the start header pointing to it last.
+type sevenZipWriter struct {
+	file     *os.File
+	entries  []sevenZipEntry
+	packSize uint64
+}
+
+func newSevenZipWriter(file *os.File) (*sevenZipWriter, error) {
+	// The start header is only known once the archive is complete
+	if _, err := file.Write(make([]byte, sevenZipSignatureHeaderSize)); err != nil {
+		return nil, err
+	}
+	return &sevenZipWriter{file: file}, nil
+}
+
+func (w *sevenZipWriter) addDir(name string, info fs.FileInfo) error {
+	w.entries = append(w.entries, sevenZipEntry{name: name, dir: true, modTime: info.ModTime()})
+	return nil
+}
+
+func (w *sevenZipWriter) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	hash := crc32.NewIEEE()
+	written, err := io.Copy(io.MultiWriter(w.file, hash), r)
+	if err != nil {
+		return err
+	}
+	w.packSize += uint64(written)
+	w.entries = append(w.entries, sevenZipEntry{name: name, size: uint64(written), crc: hash.Sum32(), modTime: info.ModTime()})
+	return nil
+}
+
+func (w *sevenZipWriter) close() error {
+	header := w.header()
+	if _, err := w.file.Write(header); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	startHeader := make([]byte, 20)
+	binary.LittleEndian.PutUint64(startHeader[0:], w.packSize)
+	binary.LittleEndian.PutUint64(startHeader[8:], uint64(len(header)))
+	binary.LittleEndian.PutUint32(startHeader[16:], crc32.ChecksumIEEE(header))
+	signatureHeader := make([]byte, 0, sevenZipSignatureHeaderSize)
+	signatureHeader = append(signatureHeader, sevenZipSignature...)
+	signatureHeader = binary.LittleEndian.AppendUint32(signatureHeader, crc32.ChecksumIEEE(startHeader))
+	signatureHeader = append(signatureHeader, startHeader...)
+	if _, err := w.file.WriteAt(signatureHeader, 0); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// header returns the header of the archive, listing its files.
+func (w *sevenZipWriter) header() []byte {
+	var header bytes.Buffer
+	header.WriteByte(sevenZipHeader)
+
+	streams := make([]sevenZipEntry, 0, len(w.entries))
+	for _, entry := range w.entries {
+		if entry.size > 0 {
+			streams = append(streams, entry)
+		}
+	}
+	if len(streams) > 0 {
+		header.WriteByte(sevenZipMainStreamsInfo)
+
+		header.WriteByte(sevenZipPackInfo)
+		writeSevenZipNumber(&header, 0) // the data starts right after the signature header
+		writeSevenZipNumber(&header, 1)
+		header.WriteByte(sevenZipSize)
+		writeSevenZipNumber(&header, w.packSize)
+		header.WriteByte(sevenZipEnd)
+
+		header.WriteByte(sevenZipUnpackInfo)
+		header.WriteByte(sevenZipFolder)
+		writeSevenZipNumber(&header, 1)
+		header.WriteByte(0) // not external
+		writeSevenZipNumber(&header, 1)
+		header.WriteByte(sevenZipCopyCoderFlag)
+		header.WriteByte(sevenZipCopyCoderID)
+		header.WriteByte(sevenZipCodersUnpackSize)
+		writeSevenZipNumber(&header, w.packSize)
+		header.WriteByte(sevenZipEnd)
+
+		header.WriteByte(sevenZipSubStreamsInfo)
+		header.WriteByte(sevenZipNumUnpackStream)
+		writeSevenZipNumber(&header, uint64(len(streams)))
+		if len(streams) > 1 {
+			// The size of the last stream is what is left of the folder
+			header.WriteByte(sevenZipSize)
+			for _, stream := range streams[:len(streams)-1] {
+				writeSevenZipNumber(&header, stream.size)
+			}
+		}
+		header.WriteByte(sevenZipCRC)
+		header.WriteByte(1) // every CRC is defined
+		for _, stream := range streams {
+			header.Write(binary.LittleEndian.AppendUint32(nil, stream.crc))
+		}
+		header.WriteByte(sevenZipEnd)
+
+		header.WriteByte(sevenZipEnd)
+	}
+
+	header.WriteByte(sevenZipFilesInfo)
+	writeSevenZipNumber(&header, uint64(len(w.entries)))
+	if len(streams) != len(w.entries) {
+		emptyStreams := make([]bool, len(w.entries))
+		emptyFiles := make([]bool, 0, len(w.entries)-len(streams))
+		for i, entry := range w.entries {
+			if entry.size == 0 {
+				emptyStreams[i] = true
+				emptyFiles = append(emptyFiles, !entry.dir)
+			}
+		}
+		writeSevenZipProperty(&header, sevenZipEmptyStream, sevenZipBitVector(emptyStreams))
+		writeSevenZipProperty(&header, sevenZipEmptyFile, sevenZipBitVector(emptyFiles))
+	}
+
+	var names bytes.Buffer
+	names.WriteByte(0) // not external
+	for _, entry := range w.entries {
+		for _, unit := range utf16.Encode([]rune(entry.name)) {
+			names.Write(binary.LittleEndian.AppendUint16(nil, unit))
+		}
+		names.Write([]byte{0, 0})
+	}
+	writeSevenZipProperty(&header, sevenZipName, names.Bytes())
+
+	var times bytes.Buffer
+	times.Write([]byte{1, 0}) // every time is defined, not external
+	for _, entry := range w.entries {
+		times.Write(binary.LittleEndian.AppendUint64(nil, uint64(entry.modTime.UnixNano()/100+sevenZipUnixEpoch)))
+	}
+	writeSevenZipProperty(&header, sevenZipMTime, times.Bytes())
+
+	var attributes bytes.Buffer
+	attributes.Write([]byte{1, 0}) // every attribute is defined, not external
+	for _, entry := range w.entries {
+		attribute := uint32(windowsAttributeFile)
+		if entry.dir {
+			attribute = windowsAttributeDir
+		}
+		attributes.Write(binary.LittleEndian.AppendUint32(nil, attribute))
+	}
+	writeSevenZipProperty(&header, sevenZipWinAttributes, attributes.Bytes())
+
+	header.WriteByte(sevenZipEnd)
+	header.WriteByte(sevenZipEnd)
+	return header.Bytes()
+}
+
+// writeSevenZipNumber writes value in the variable length encoding of 7z: the
+// number of leading 1 bits of the first byte is the number of bytes that
+// follow, little-endian, the rest of the first byte holds the highest bits.
+func writeSevenZipNumber(buffer *bytes.Buffer, value uint64) {
+	for extraBytes := 0; extraBytes < 8; extraBytes++ {
+		if value < 1<<(7*(extraBytes+1)) {
+			buffer.WriteByte(byte(uint(0xFF00)>>extraBytes) | byte(value>>(8*extraBytes)))
+			for i := 0; i < extraBytes; i++ {
+				buffer.WriteByte(byte(value >> (8 * i)))
+			}
+			return
+		}
+	}
+	buffer.WriteByte(0xFF)
+	buffer.Write(binary.LittleEndian.AppendUint64(nil, value))
+}
+
+func writeSevenZipProperty(buffer *bytes.Buffer, id byte, data []byte) {
+	buffer.WriteByte(id)
+	writeSevenZipNumber(buffer, uint64(len(data)))
+	buffer.Write(data)
+}
+
+// sevenZipBitVector packs bits, the first one being the highest bit of the
+// first byte.
+func sevenZipBitVector(bits []bool) []byte {
+	vector := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			vector[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return vector
+}
@@ -0,0 +1,81 @@
+package wiiudownloader
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/Xpl0itU/WiiUDownloader/tmd"
+)
+
+const (
+	SIGNATURE_STATUS_VALID   = "valid"
+	SIGNATURE_STATUS_INVALID = "invalid"
+	// SIGNATURE_STATUS_UNCHECKED is used when the file or the certificate
+	// that signs it is missing
+	SIGNATURE_STATUS_UNCHECKED = "unchecked"
+)
+
+// SignatureCheckResult tells whether the TMD and ticket of a title folder are
+// the ones signed by Nintendo. Generated tickets are never validly signed.
+type SignatureCheckResult struct {
+	TMD       string // one of the SIGNATURE_STATUS_* values
+	TMDErr    error
+	Ticket    string
+	TicketErr error
+}
+
+func signatureStatus(err error) string {
+	switch {
+	case err == nil:
+		return SIGNATURE_STATUS_VALID
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, tmd.ErrCertificateNotFound):
+		return SIGNATURE_STATUS_UNCHECKED
+	default:
+		return SIGNATURE_STATUS_INVALID
+	}
+}
+
+// CheckTitleSignatures checks the signatures of the title.tmd and title.tik of
+// a title folder with the certificates of title.cert and the ones appended to
+// them. The certificates are checked up to the CA, the root key isn't known.
+func CheckTitleSignatures(path string) SignatureCheckResult {
+	var tmdFile *tmd.TMD
+	var ticket *tmd.Ticket
+	var certificates []tmd.Certificate
+	tmdData, tmdErr := os.ReadFile(filepath.Join(path, "title.tmd"))
+	if tmdErr == nil {
+		if tmdFile, tmdErr = tmd.Unmarshal(tmdData); tmdErr == nil {
+			tmdCertificates, _ := tmd.UnmarshalCertificates(tmdFile.Certificates)
+			certificates = append(certificates, tmdCertificates...)
+		}
+	}
+	ticketData, ticketErr := os.ReadFile(filepath.Join(path, "title.tik"))
+	if ticketErr == nil {
+		if ticket, ticketErr = tmd.UnmarshalTicket(ticketData); ticketErr == nil {
+			ticketCertificates, _ := tmd.UnmarshalCertificates(ticket.Certificates)
+			certificates = append(certificates, ticketCertificates...)
+		}
+	}
+	if certData, err := os.ReadFile(filepath.Join(path, "title.cert")); err == nil {
+		titleCertificates, _ := tmd.UnmarshalCertificates(certData)
+		certificates = append(certificates, titleCertificates...)
+	}
+
+	if err := tmd.VerifyCertificates(certificates); err != nil {
+		tmdErr, ticketErr = errors.Join(tmdErr, err), errors.Join(ticketErr, err)
+	}
+	if tmdFile != nil && tmdErr == nil {
+		tmdErr = tmdFile.VerifySignature(certificates)
+	}
+	if ticket != nil && ticketErr == nil {
+		ticketErr = ticket.VerifySignature(certificates)
+	}
+	return SignatureCheckResult{
+		TMD:       signatureStatus(tmdErr),
+		TMDErr:    tmdErr,
+		Ticket:    signatureStatus(ticketErr),
+		TicketErr: ticketErr,
+	}
+}
@@ -0,0 +1,31 @@
+package wiiudownloader
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// syncFile flushes a file that was already written and closed to the disk.
+func syncFile(path string) error {
+	// Windows only flushes files opened for writing
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// syncTitleFiles flushes the files of a title folder besides its contents,
+// which are synced as they complete, and the folder itself.
+func syncTitleFiles(path string) error {
+	for _, name := range []string{"title.tmd", "title.tik", "title.cert", manifestFilename} {
+		if err := syncFile(filepath.Join(path, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return syncDirectory(path)
+}
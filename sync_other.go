@@ -0,0 +1,19 @@
+//go:build !windows
+
+package wiiudownloader
+
+import "os"
+
+// syncDirectory flushes the entries of a folder to the disk, so the files
+// created or renamed in it are still there after a power loss.
+func syncDirectory(path string) error {
+	directory, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = directory.Sync()
+	if closeErr := directory.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
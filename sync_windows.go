@@ -0,0 +1,7 @@
+package wiiudownloader
+
+// syncDirectory does nothing, Windows can't flush a folder and NTFS journals
+// its entries on its own.
+func syncDirectory(path string) error {
+	return nil
+}
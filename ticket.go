@@ -2,8 +2,16 @@ package wiiudownloader
 
 import (
 	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
 	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"time"
 )
 
 func GenerateTicket(path string, titleID uint64, titleKey []byte, titleVersion uint16) error {
@@ -26,6 +34,8 @@ func GenerateTicket(path string, titleID uint64, titleKey []byte, titleVersion u
 	binary.LittleEndian.PutUint16(versionBytes, titleVersion)
 	copy(ticketData[486:], versionBytes)
 
+	ticketData[497] = CommonKeyIndexForTitle(titleID)
+
 	_, err = ticketFile.Write(ticketData)
 	if err != nil {
 		return err
@@ -33,3 +43,62 @@ func GenerateTicket(path string, titleID uint64, titleKey []byte, titleVersion u
 
 	return nil
 }
+
+// fstMagic starts the first content of every title once decrypted.
+var fstMagic = []byte{'F', 'S', 'T', 0x00}
+
+// checkTitleKey downloads the start of the first content of a title and
+// decrypts it with titleKey, so a wrong ticket is found before downloading
+// contents that can't be decrypted. Network errors are left to the content
+// downloads, only a key that is known to be wrong is reported. ctx and
+// requestTimeout abort the download like the files of the title.
+func checkTitleKey(ctx context.Context, client *http.Client, baseURL string, tmd *TMD, titleKey cipher.Block, requestTimeout time.Duration, paused func() bool) error {
+	// The contents of the Wii mode titles don't start with an FST
+	if len(tmd.Contents) == 0 || !isWiiUTitle(tmd.TitleID) {
+		return nil
+	}
+	content := tmd.Contents[0]
+	hasHashTree := content.Type&0x2 != 0
+	probeSize := aes.BlockSize
+	if hasHashTree {
+		probeSize = BLOCK_SIZE_HASHED
+	}
+
+	requestCtx, watchdog := newRequestWatchdog(ctx, requestTimeout, 0, paused)
+	defer watchdog.stop()
+	req, err := http.NewRequestWithContext(requestCtx, "GET", fmt.Sprintf("%s/%08X", baseURL, content.ID), nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", "WiiUDownloader")
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", probeSize-1))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil
+	}
+	data := make([]byte, probeSize)
+	if _, err := io.ReadFull(watchdog.watch(resp.Body), data); err != nil {
+		return nil
+	}
+
+	if hasHashTree {
+		hashes := data[:HASHES_SIZE]
+		cipher.NewCBCDecrypter(titleKey, make([]byte, aes.BlockSize)).CryptBlocks(hashes, hashes)
+		h0Hash := hashes[:sha1.Size]
+		block := data[HASHES_SIZE:]
+		cipher.NewCBCDecrypter(titleKey, h0Hash[:aes.BlockSize]).CryptBlocks(block, block)
+		if hash := sha1.Sum(block); bytes.Equal(hash[:], h0Hash) {
+			return nil
+		}
+	} else {
+		cipher.NewCBCDecrypter(titleKey, append(bytes.Clone(content.Index), make([]byte, 14)...)).CryptBlocks(data, data)
+		if bytes.HasPrefix(data, fstMagic) {
+			return nil
+		}
+	}
+	return wrapKind(ErrTicketUnavailable, fmt.Errorf(Localize("the title key of %016x can't decrypt its contents, its ticket is wrong or for another region"), tmd.TitleID))
+}
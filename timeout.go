@@ -0,0 +1,144 @@
+package wiiudownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// requestWatchdog cancels a request once it received nothing for its timeout,
+// while waiting for the answer of the CDN as well as in the middle of the
+// data. Once data arrives, the stall timeout is used instead when it is set.
+// The time spent paused doesn't count.
+type requestWatchdog struct {
+	timeout      time.Duration
+	stallTimeout time.Duration
+	cancel       context.CancelFunc
+	paused       func() bool
+	lastActivity atomic.Int64 // in nanoseconds since the Unix epoch
+	receiving    atomic.Bool  // data arrived, the transfer is under way
+	timedOut     atomic.Bool
+	stalled      atomic.Bool
+	timer        *time.Timer
+}
+
+// newRequestWatchdog returns the context to send a request with and its
+// watchdog, which never fires when both timeouts are 0. paused may be nil for
+// requests that can't be paused. stop must be called once the request is done.
+func newRequestWatchdog(ctx context.Context, timeout, stallTimeout time.Duration, paused func() bool) (context.Context, *requestWatchdog) {
+	ctx, cancel := context.WithCancel(ctx)
+	watchdog := &requestWatchdog{timeout: timeout, stallTimeout: stallTimeout, cancel: cancel, paused: paused}
+	if timeout > 0 || stallTimeout > 0 {
+		// Check at the earliest either can fire, check reschedules itself
+		firstCheck := timeout
+		if firstCheck == 0 || (stallTimeout > 0 && stallTimeout < firstCheck) {
+			firstCheck = stallTimeout
+		}
+		watchdog.touch()
+		watchdog.timer = time.AfterFunc(firstCheck, watchdog.check)
+	}
+	return ctx, watchdog
+}
+
+func (w *requestWatchdog) touch() {
+	w.lastActivity.Store(time.Now().UnixNano())
+}
+
+// limit returns how long the request may receive nothing for now, 0 for as
+// long as it takes.
+func (w *requestWatchdog) limit() time.Duration {
+	if w.stallTimeout > 0 && w.receiving.Load() {
+		return w.stallTimeout
+	}
+	return w.timeout
+}
+
+func (w *requestWatchdog) check() {
+	if w.paused != nil && w.paused() {
+		w.touch()
+	}
+	limit := w.limit()
+	if limit == 0 {
+		// Only the stall timeout is set, wait for the data to arrive
+		w.timer.Reset(w.stallTimeout)
+		return
+	}
+	idle := time.Since(time.Unix(0, w.lastActivity.Load()))
+	if idle < limit {
+		w.timer.Reset(limit - idle)
+		return
+	}
+	if w.stallTimeout > 0 && w.receiving.Load() {
+		w.stalled.Store(true)
+	} else {
+		w.timedOut.Store(true)
+	}
+	w.cancel()
+}
+
+func (w *requestWatchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.cancel()
+}
+
+// watch returns reader that keeps the watchdog from firing while data arrives.
+func (w *requestWatchdog) watch(reader io.Reader) io.Reader {
+	return &watchedReader{reader: reader, watchdog: w}
+}
+
+// hasStalled reports whether the watchdog cancelled the request because the
+// data stopped arriving in the middle of the transfer.
+func (w *requestWatchdog) hasStalled() bool {
+	return w.stalled.Load()
+}
+
+// err returns the error of a request, ErrTimeout when the watchdog cancelled it.
+func (w *requestWatchdog) err(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case w.timedOut.Load():
+		return wrapKind(ErrTimeout, fmt.Errorf(Localize("no data received for %s"), w.timeout))
+	case w.stalled.Load():
+		return wrapKind(ErrTimeout, fmt.Errorf(Localize("the download stalled for %s"), w.stallTimeout))
+	}
+	return err
+}
+
+type watchedReader struct {
+	reader   io.Reader
+	watchdog *requestWatchdog
+}
+
+func (r *watchedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.watchdog.touch()
+		r.watchdog.receiving.Store(true)
+	}
+	return n, err
+}
+
+// sleepContext waits for duration unless ctx is done first.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkTitleTimeout turns the title context running out into ErrTimeout.
+func checkTitleTimeout(ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	return wrapKind(ErrTimeout, fmt.Errorf(Localize("the title was not downloaded within %s"), timeout))
+}
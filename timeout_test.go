@@ -0,0 +1,74 @@
+package wiiudownloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// hangingTransport never answers, until the request is cancelled.
+type hangingTransport struct{}
+
+func (hangingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestFetchTMDVersionTimeout(t *testing.T) {
+	client := &http.Client{Transport: hangingTransport{}}
+	done := make(chan error, 1)
+	go func() {
+		_, err := fetchTMDVersion(context.Background(), client, "0005000010145d00", 16, 50*time.Millisecond, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrTimeout) {
+			t.Errorf("error = %v, want ErrTimeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request timeout didn't abort the TMD download")
+	}
+}
+
+func TestFetchTMDVersionCancelled(t *testing.T) {
+	client := &http.Client{Transport: hangingTransport{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := fetchTMDVersion(ctx, client, "0005000010145d00", 16, 0, nil)
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelling the title didn't abort the TMD download")
+	}
+}
+
+func TestCheckTitleKeyCancelled(t *testing.T) {
+	client := &http.Client{Transport: hangingTransport{}}
+	tmd := &TMD{TitleID: 0x0005000010145d00, Contents: []Content{{ID: 0, Index: []byte{0, 0}}}}
+	titleKey := newTestTitleKey(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- checkTitleKey(ctx, client, "http://ccs.cdn.c.shop.nintendowifi.net/ccs/download/0005000010145d00", tmd, titleKey, 0, nil)
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		// Network errors are left to the content downloads
+		if err != nil {
+			t.Errorf("error = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelling the title didn't abort the title key check")
+	}
+}
@@ -0,0 +1,233 @@
+package wiiudownloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Formats of the archives titles can be packed into once downloaded.
+const (
+	ARCHIVE_FORMAT_NONE = ""
+	ARCHIVE_FORMAT_ZIP  = "zip"
+	ARCHIVE_FORMAT_7Z   = "7z" // stored without compression
+)
+
+// ParseArchiveFormat checks that value is one of the ARCHIVE_FORMAT_* values.
+func ParseArchiveFormat(value string) (string, error) {
+	switch format := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "."); format {
+	case ARCHIVE_FORMAT_NONE, ARCHIVE_FORMAT_ZIP, ARCHIVE_FORMAT_7Z:
+		return format, nil
+	default:
+		return "", fmt.Errorf(Localize("unknown archive format %q, expected zip or 7z"), value)
+	}
+}
+
+// TitleArchiveName returns the name of the archive of format a title folder
+// described by manifest is packed into, like "Name [titleID] (v16).zip".
+func TitleArchiveName(manifest *Manifest, format string) string {
+	name := fmt.Sprintf("[%s] (v%d).%s", manifest.TitleID, manifest.Version, format)
+	if manifest.Name != "" {
+		name = manifest.Name + " " + name
+	}
+	return SanitizeFilename(name)
+}
+
+// titleArchiveWriter writes the files of a title folder to an archive, in the
+// order they are added.
+type titleArchiveWriter interface {
+	addDir(name string, info fs.FileInfo) error
+	addFile(name string, info fs.FileInfo, r io.Reader) error
+	close() error // writes the index of the archive and syncs it
+}
+
+// ArchiveTitleFolder packs the title folder at path into an archive of format
+// next to it, named by TitleArchiveName, and returns its path. The manifest of
+// the folder, or one made from its title.tmd, is the first file of the
+// archive. With removeFolder the folder is removed once the archive is
+// complete and synced to the disk: an archive cut short has no index, so the
+// files are kept until then, and packing needs room for a second copy of the
+// title.
+func ArchiveTitleFolder(path, format string, removeFolder bool) (string, error) {
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		tmd, tmdErr := readTMDFromDir(path)
+		if tmdErr != nil {
+			return "", tmdErr
+		}
+		manifest = newManifest(tmd)
+	}
+	return archiveTitleWithManifest(path, manifest, format, removeFolder)
+}
+
+// archiveTitleWithManifest is ArchiveTitleFolder with the manifest embedded in
+// the archive, for the folders of decrypted files which have none.
+func archiveTitleWithManifest(path string, manifest *Manifest, format string, removeFolder bool) (string, error) {
+	format, err := ParseArchiveFormat(format)
+	if err != nil {
+		return "", err
+	}
+	if format == ARCHIVE_FORMAT_NONE {
+		return "", nil
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path = filepath.Clean(path)
+	archivePath := filepath.Join(filepath.Dir(path), TitleArchiveName(manifest, format))
+	partPath := archivePath + ".part"
+	if err := writeTitleArchive(longPath(path), longPath(partPath), format, manifestData); err != nil {
+		os.Remove(longPath(partPath))
+		return "", checkDiskFull(err)
+	}
+	if err := os.Rename(longPath(partPath), longPath(archivePath)); err != nil {
+		return "", err
+	}
+	if removeFolder {
+		// The archive must outlive a crash before its files go
+		if err := syncDirectory(longPath(filepath.Dir(path))); err != nil {
+			return "", err
+		}
+		if err := os.RemoveAll(longPath(path)); err != nil {
+			return "", err
+		}
+	}
+	return archivePath, nil
+}
+
+// writeTitleArchive writes the manifest and the files of the folder at path to
+// the archive at archivePath.
+func writeTitleArchive(path, archivePath, format string, manifestData []byte) error {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	var writer titleArchiveWriter
+	if format == ARCHIVE_FORMAT_7Z {
+		writer, err = newSevenZipWriter(file)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	} else {
+		writer = newZipTitleWriter(file)
+	}
+
+	manifestInfo := &archiveFileInfo{name: manifestFilename, size: int64(len(manifestData)), modTime: time.Now()}
+	if err := writer.addFile(manifestFilename, manifestInfo, bytes.NewReader(manifestData)); err != nil {
+		file.Close()
+		return err
+	}
+
+	err = filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == path {
+			return nil
+		}
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return writer.addDir(name, info)
+		}
+		if !info.Mode().IsRegular() || name == manifestFilename {
+			return nil
+		}
+		return addFileToArchive(writer, filePath, name, info)
+	})
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return writer.close()
+}
+
+func addFileToArchive(writer titleArchiveWriter, path, name string, info fs.FileInfo) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return writer.addFile(name, info, file)
+}
+
+// archiveFileInfo describes a file that is only in memory, like the manifest.
+type archiveFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *archiveFileInfo) Name() string       { return i.name }
+func (i *archiveFileInfo) Size() int64        { return i.size }
+func (i *archiveFileInfo) Mode() fs.FileMode  { return 0644 }
+func (i *archiveFileInfo) ModTime() time.Time { return i.modTime }
+func (i *archiveFileInfo) IsDir() bool        { return false }
+func (i *archiveFileInfo) Sys() any           { return nil }
+
+// zipTitleWriter writes title archives as zip files. Encrypted contents are
+// stored, they don't compress, everything else is deflated.
+type zipTitleWriter struct {
+	file   *os.File
+	writer *zip.Writer
+}
+
+func newZipTitleWriter(file *os.File) *zipTitleWriter {
+	return &zipTitleWriter{file: file, writer: zip.NewWriter(file)}
+}
+
+func (w *zipTitleWriter) addDir(name string, info fs.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name + "/"
+	_, err = w.writer.CreateHeader(header)
+	return err
+}
+
+func (w *zipTitleWriter) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	if ext := strings.ToLower(filepath.Ext(name)); ext == ".app" || ext == ".h3" {
+		header.Method = zip.Store
+	}
+	fileWriter, err := w.writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fileWriter, r)
+	return err
+}
+
+func (w *zipTitleWriter) close() error {
+	if err := w.writer.Close(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
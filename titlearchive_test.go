@@ -0,0 +1,189 @@
+package wiiudownloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bodgit/sevenzip"
+)
+
+// writeTestTitleFolder fills a title folder with files of the sizes that
+// matter to the archive writers: empty, small, and larger than a copy buffer.
+func writeTestTitleFolder(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	large := make([]byte, 3*1024*1024+17)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"title.tmd":             bytes.Repeat([]byte{0xAB}, 0xB04),
+		"00000000.app":          large,
+		"00000000.h3":           bytes.Repeat([]byte{0x01, 0x02}, 10),
+		"empty.bin":             {},
+		"meta/meta.xml":         []byte("<menu></menu>"),
+		"content/Músiqué/é.txt": []byte("non-ASCII name"),
+	}
+	for name, data := range files {
+		filePath := filepath.Join(path, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(path, "code", "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestArchiveTitleRoundTrip(t *testing.T) {
+	manifest := &Manifest{TitleID: "0005000010145d00", Name: "Super Mario 3D World", Version: 16}
+	for _, format := range []string{ARCHIVE_FORMAT_ZIP, ARCHIVE_FORMAT_7Z} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "title")
+			files := writeTestTitleFolder(t, path)
+
+			archivePath, err := archiveTitleWithManifest(path, manifest, format, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, "Super Mario 3D World [0005000010145d00] (v16)."+format); archivePath != want {
+				t.Errorf("archive path = %q, want %q", archivePath, want)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("title folder still there after packing: %v", err)
+			}
+			if _, err := os.Stat(archivePath + ".part"); !os.IsNotExist(err) {
+				t.Errorf("partial archive left behind: %v", err)
+			}
+
+			var got map[string][]byte
+			var dirs []string
+			var first string
+			if format == ARCHIVE_FORMAT_ZIP {
+				got, dirs, first = readTestZip(t, archivePath)
+			} else {
+				got, dirs, first = readTestSevenZip(t, archivePath)
+			}
+			if first != manifestFilename {
+				t.Errorf("first file = %q, want %q", first, manifestFilename)
+			}
+			if _, ok := got[manifestFilename]; !ok {
+				t.Errorf("%s missing from the archive", manifestFilename)
+			}
+			delete(got, manifestFilename)
+			if len(got) != len(files) {
+				t.Errorf("archive has %d files, want %d", len(got), len(files))
+			}
+			for name, data := range files {
+				if !bytes.Equal(got[name], data) {
+					t.Errorf("%s: got %d bytes, want %d", name, len(got[name]), len(data))
+				}
+			}
+			found := false
+			for _, name := range dirs {
+				found = found || name == "code/empty"
+			}
+			if !found {
+				t.Errorf("empty folder missing from the archive, folders: %q", dirs)
+			}
+		})
+	}
+}
+
+func TestArchiveTitleKeepsFolder(t *testing.T) {
+	manifest := &Manifest{TitleID: "0005000010145d00", Version: 16}
+	path := filepath.Join(t.TempDir(), "title")
+	files := writeTestTitleFolder(t, path)
+	if _, err := archiveTitleWithManifest(path, manifest, ARCHIVE_FORMAT_7Z, false); err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(path, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s removed without removeFolder: %v", name, err)
+		}
+	}
+}
+
+func readTestZip(t *testing.T, path string) (map[string][]byte, []string, string) {
+	t.Helper()
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	files := make(map[string][]byte)
+	dirs := make([]string, 0)
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			dirs = append(dirs, strings.TrimSuffix(file.Name, "/"))
+			continue
+		}
+		files[file.Name] = readTestArchiveFile(t, file.Open)
+	}
+	return files, dirs, reader.File[0].Name
+}
+
+func readTestSevenZip(t *testing.T, path string) (map[string][]byte, []string, string) {
+	t.Helper()
+	reader, err := sevenzip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	files := make(map[string][]byte)
+	dirs := make([]string, 0)
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			dirs = append(dirs, strings.TrimSuffix(file.Name, "/"))
+			continue
+		}
+		files[file.Name] = readTestArchiveFile(t, file.Open)
+	}
+	return files, dirs, reader.File[0].Name
+}
+
+func readTestArchiveFile(t *testing.T, open func() (io.ReadCloser, error)) []byte {
+	t.Helper()
+	file, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWriteSevenZipNumber(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7F, []byte{0x7F}},
+		{0x80, []byte{0x80, 0x80}},
+		{0x3FFF, []byte{0xBF, 0xFF}},
+		{0x4000, []byte{0xC0, 0x00, 0x40}},
+		{0x1234567, []byte{0xE1, 0x67, 0x45, 0x23}},
+		{1 << 56, []byte{0xFF, 0, 0, 0, 0, 0, 0, 0, 0x01}},
+	}
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		writeSevenZipNumber(&buffer, test.value)
+		if !bytes.Equal(buffer.Bytes(), test.want) {
+			t.Errorf("writeSevenZipNumber(%#x) = % x, want % x", test.value, buffer.Bytes(), test.want)
+		}
+	}
+}
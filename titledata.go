@@ -0,0 +1,76 @@
+package wiiudownloader
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+)
+
+// titleDataJSON is what grabTitles.py gathers of the titles besides the title
+// database: their product code from the title database of WiiUBrew, and the
+// genre, number of players and languages of the games on GameTDB.
+//
+//go:embed titledata.json
+var titleDataJSON []byte
+
+type shippedTitleData struct {
+	ProductCode string   `json:"productCode"`
+	Genre       string   `json:"genre"`
+	Players     uint8    `json:"players"`
+	Languages   []string `json:"languages"` // codes of languageNames
+}
+
+// shippedTitleInfos is the embedded title data by title ID, parsed once by
+// loadTitleInfos.
+var shippedTitleInfos map[uint64]TitleInfo
+
+// loadShippedTitleInfos parses the embedded title data, titleInfosMutex must
+// be held.
+func loadShippedTitleInfos() map[uint64]TitleInfo {
+	if shippedTitleInfos != nil {
+		return shippedTitleInfos
+	}
+	shippedTitleInfos = make(map[uint64]TitleInfo)
+	shipped := make(map[string]shippedTitleData)
+	if err := json.Unmarshal(titleDataJSON, &shipped); err != nil {
+		return shippedTitleInfos
+	}
+	for value, data := range shipped {
+		titleID, err := ParseTitleID(value)
+		if err != nil {
+			continue
+		}
+		info := TitleInfo{ProductCode: data.ProductCode, Genre: data.Genre, Players: data.Players}
+		for _, code := range data.Languages {
+			for _, language := range languageNames {
+				if strings.EqualFold(language.code, code) {
+					info.Languages |= language.language
+				}
+			}
+		}
+		shippedTitleInfos[titleID] = info
+	}
+	return shippedTitleInfos
+}
+
+// mergeTitleInfo returns the shipped info of a title with what was learned of
+// it on top: what was read from the title itself or a newer title database
+// wins.
+func mergeTitleInfo(shipped, learned TitleInfo) TitleInfo {
+	if learned.ProductCode != "" {
+		shipped.ProductCode = learned.ProductCode
+	}
+	if learned.OSVersion != 0 {
+		shipped.OSVersion = learned.OSVersion
+	}
+	if learned.Genre != "" {
+		shipped.Genre = learned.Genre
+	}
+	if learned.Players != 0 {
+		shipped.Players = learned.Players
+	}
+	if learned.Languages != 0 {
+		shipped.Languages = learned.Languages
+	}
+	return shipped
+}
@@ -0,0 +1,175 @@
+package wiiudownloader
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTestTitleData replaces the embedded title data and the cache for the
+// length of a test.
+func useTestTitleData(t *testing.T, titleData string, cache map[string]TitleInfo) {
+	t.Helper()
+	cacheDirectory := t.TempDir()
+	if cache != nil {
+		data, err := json.Marshal(cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(cacheDirectory, titleInfoFilename), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	embedded := titleDataJSON
+	SetCacheDirectory(cacheDirectory)
+	titleInfosMutex.Lock()
+	titleDataJSON, shippedTitleInfos, titleInfos = []byte(titleData), nil, nil
+	titleInfosMutex.Unlock()
+	t.Cleanup(func() {
+		SetCacheDirectory("")
+		titleInfosMutex.Lock()
+		titleDataJSON, shippedTitleInfos, titleInfos = embedded, nil, nil
+		titleInfosMutex.Unlock()
+	})
+}
+
+const testTitleData = `{
+ "0005000010145d00": {"productCode": "WUP-P-ARDE", "genre": "Platformer", "players": 4, "languages": ["EN", "FR", "ES"]},
+ "0005000010199c00": {"productCode": "WUP-N-FAAE"},
+ "000500001010ec00": {"productCode": "WUP-P-AMKE", "genre": "Racing", "players": 12, "languages": ["EN", "ZHT", "XX"]}
+}`
+
+func TestShippedTitleInfo(t *testing.T) {
+	useTestTitleData(t, testTitleData, nil)
+	info, ok := GetTitleInfo(0x0005000010145D00)
+	want := TitleInfo{ProductCode: "WUP-P-ARDE", Genre: "Platformer", Players: 4, Languages: LANGUAGE_ENGLISH | LANGUAGE_FRENCH | LANGUAGE_SPANISH}
+	if !ok || info != want {
+		t.Errorf("GetTitleInfo = %+v, %v, want %+v", info, ok, want)
+	}
+	// Updates get the data of their game
+	if info, _ := GetTitleInfo(0x0005000E10145D00); info != want {
+		t.Errorf("GetTitleInfo(update) = %+v, want %+v", info, want)
+	}
+	// Unknown language codes are left out
+	if info, _ := GetTitleInfo(0x000500001010EC00); info.Languages != LANGUAGE_ENGLISH|LANGUAGE_CHINESE_TRADITIONAL {
+		t.Errorf("languages = %s", GetFormattedLanguages(info.Languages))
+	}
+	if _, ok := GetTitleInfo(0x0005000010101C00); ok {
+		t.Error("title missing from the title data has info")
+	}
+	if genres := GetKnownGenres(); len(genres) != 2 || genres[0] != "Platformer" || genres[1] != "Racing" {
+		t.Errorf("GetKnownGenres = %q", genres)
+	}
+}
+
+func TestShippedTitleInfoWithCache(t *testing.T) {
+	useTestTitleData(t, testTitleData, map[string]TitleInfo{
+		"0005000010145d00": {ProductCode: "WUP-P-ARDP", OSVersion: 0x000500101000400A},
+		"0005000010101c00": {ProductCode: "WUP-P-AHCE"},
+	})
+	// What was learned of a title replaces the embedded data, field by field
+	info, _ := GetTitleInfo(0x0005000010145D00)
+	want := TitleInfo{ProductCode: "WUP-P-ARDP", OSVersion: 0x000500101000400A, Genre: "Platformer", Players: 4, Languages: LANGUAGE_ENGLISH | LANGUAGE_FRENCH | LANGUAGE_SPANISH}
+	if info != want {
+		t.Errorf("GetTitleInfo = %+v, want %+v", info, want)
+	}
+	if code := GetProductCode(0x0005000010101C00); code != "WUP-P-AHCE" {
+		t.Errorf("product code of a title only in the cache = %q", code)
+	}
+
+	// Only what differs from the embedded data is written to the cache
+	updateTitleInfo(0x000500001010EC00, func(info *TitleInfo) {
+		info.OSVersion = 0x0005001010004009
+	})
+	cachePath, err := getTitleInfoCachePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := make(map[string]TitleInfo)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved["0005000010199c00"]; ok || len(saved) != 3 {
+		t.Errorf("cache has %d titles, want the 3 that were learned: %v", len(saved), saved)
+	}
+}
+
+func TestShippedTitleInfoInvalid(t *testing.T) {
+	useTestTitleData(t, "not json", nil)
+	if _, ok := GetTitleInfo(0x0005000010145D00); ok {
+		t.Error("invalid title data has info")
+	}
+}
+
+func TestTitleMatchesQueryProductCode(t *testing.T) {
+	useTestTitleData(t, testTitleData, nil)
+	game := TitleEntry{Name: "Super Mario 3D World", TitleID: 0x0005000010145D00}
+	update := TitleEntry{Name: "Super Mario 3D World", TitleID: 0x0005000E10145D00}
+	unknown := TitleEntry{Name: "Wii Sports Club", TitleID: 0x0005000010144F00}
+	tests := []struct {
+		entry TitleEntry
+		query string
+		want  bool
+	}{
+		{game, "WUP-P-ARDE", true},
+		{game, "arde", true},
+		{update, "ARDE", true},
+		{game, "AMKE", false},
+		{unknown, "WUP-", false},
+		{unknown, "sports", true},
+		{game, "10145d00", true},
+		{game, "", true},
+	}
+	for _, test := range tests {
+		if got := TitleMatchesQuery(test.entry, test.query); got != test.want {
+			t.Errorf("TitleMatchesQuery(%016x, %q) = %v, want %v", test.entry.TitleID, test.query, got, test.want)
+		}
+	}
+}
+
+func TestGameSubcategory(t *testing.T) {
+	useTestTitleData(t, `{
+ "0005000010145d00": {"productCode": "WUP-P-ARDE"},
+ "0005000010100000": {"productCode": "WUP-N-AB3E"},
+ "0005000010100100": {"productCode": "WUP-N-FAAE"},
+ "0005000010100200": {"productCode": "WUP-N-JAAE"},
+ "0005000010100300": {"productCode": "WUP-N-NAAE"},
+ "0005000010100400": {"productCode": "WUP-N-PAAE"},
+ "0005000010100500": {"productCode": "wup-n-daae"},
+ "0005000010100600": {"productCode": "WUP-X-AAAE"},
+ "0005000010100700": {"productCode": "WUP-N-"}
+}`, nil)
+	tests := []struct {
+		titleID     uint64
+		subcategory uint8
+	}{
+		{0x0005000010145D00, GAME_SUBCATEGORY_RETAIL},
+		{0x0005000E10145D00, GAME_SUBCATEGORY_RETAIL},
+		{0x0005000010100000, GAME_SUBCATEGORY_ESHOP},
+		{0x0005000010100100, GAME_SUBCATEGORY_VC_NES},
+		{0x0005000010100200, GAME_SUBCATEGORY_VC_SNES},
+		{0x0005000010100300, GAME_SUBCATEGORY_VC_N64},
+		{0x0005000010100400, GAME_SUBCATEGORY_VC_GBA},
+		{0x0005000010100500, GAME_SUBCATEGORY_VC_DS},
+		{0x0005000010100600, GAME_SUBCATEGORY_ALL},
+		{0x0005000010100700, GAME_SUBCATEGORY_ALL},
+		{0x0005000010199999, GAME_SUBCATEGORY_ALL},
+	}
+	for _, test := range tests {
+		if got := GetGameSubcategory(test.titleID); got != test.subcategory {
+			t.Errorf("GetGameSubcategory(%016x) = %s, want %s", test.titleID, GetFormattedGameSubcategory(got), GetFormattedGameSubcategory(test.subcategory))
+		}
+	}
+
+	if !IsInGameSubcategory(0x0005000010100300, GAME_SUBCATEGORY_VC) || IsInGameSubcategory(0x0005000010100000, GAME_SUBCATEGORY_VC) {
+		t.Error("GAME_SUBCATEGORY_VC doesn't hold exactly the Virtual Console games")
+	}
+	if !IsInGameSubcategory(0x0005000010199999, GAME_SUBCATEGORY_ALL) || IsInGameSubcategory(0x0005000010199999, GAME_SUBCATEGORY_RETAIL) {
+		t.Error("a game without a product code isn't only in GAME_SUBCATEGORY_ALL")
+	}
+}
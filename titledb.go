@@ -0,0 +1,354 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const titleDatabaseURL = "https://napi.v10lator.de/db?t=go"
+
+// titleDatabaseCacheFilename is the title database UpdateTitleDatabase last
+// downloaded, in the cache folder, see LoadCachedTitleDatabase.
+const titleDatabaseCacheFilename = "titledb.go"
+
+var titleEntriesMutex sync.RWMutex
+
+var titleDatabaseConstants = map[string]uint64{
+	"MCP_REGION_JAPAN":      MCP_REGION_JAPAN,
+	"MCP_REGION_USA":        MCP_REGION_USA,
+	"MCP_REGION_EUROPE":     MCP_REGION_EUROPE,
+	"MCP_REGION_CHINA":      MCP_REGION_CHINA,
+	"MCP_REGION_KOREA":      MCP_REGION_KOREA,
+	"MCP_REGION_TAIWAN":     MCP_REGION_TAIWAN,
+	"TITLE_KEY_mypass":      TITLE_KEY_mypass,
+	"TITLE_KEY_nintendo":    TITLE_KEY_nintendo,
+	"TITLE_KEY_test":        TITLE_KEY_test,
+	"TITLE_KEY_1234567890":  TITLE_KEY_1234567890,
+	"TITLE_KEY_Lucy131211":  TITLE_KEY_Lucy131211,
+	"TITLE_KEY_fbf10":       TITLE_KEY_fbf10,
+	"TITLE_KEY_5678":        TITLE_KEY_5678,
+	"TITLE_KEY_1234":        TITLE_KEY_1234,
+	"TITLE_KEY_":            TITLE_KEY_,
+	"TITLE_KEY_MAGIC":       TITLE_KEY_MAGIC,
+	"TITLE_CATEGORY_GAME":   TITLE_CATEGORY_GAME,
+	"TITLE_CATEGORY_UPDATE": TITLE_CATEGORY_UPDATE,
+	"TITLE_CATEGORY_DLC":    TITLE_CATEGORY_DLC,
+	"TITLE_CATEGORY_DEMO":   TITLE_CATEGORY_DEMO,
+	"TITLE_CATEGORY_ALL":    TITLE_CATEGORY_ALL,
+	"TITLE_CATEGORY_DISC":   TITLE_CATEGORY_DISC,
+
+	// Languages of the entries that have them
+	"LANGUAGE_JAPANESE":            uint64(LANGUAGE_JAPANESE),
+	"LANGUAGE_ENGLISH":             uint64(LANGUAGE_ENGLISH),
+	"LANGUAGE_FRENCH":              uint64(LANGUAGE_FRENCH),
+	"LANGUAGE_GERMAN":              uint64(LANGUAGE_GERMAN),
+	"LANGUAGE_ITALIAN":             uint64(LANGUAGE_ITALIAN),
+	"LANGUAGE_SPANISH":             uint64(LANGUAGE_SPANISH),
+	"LANGUAGE_CHINESE_SIMPLIFIED":  uint64(LANGUAGE_CHINESE_SIMPLIFIED),
+	"LANGUAGE_KOREAN":              uint64(LANGUAGE_KOREAN),
+	"LANGUAGE_DUTCH":               uint64(LANGUAGE_DUTCH),
+	"LANGUAGE_PORTUGUESE":          uint64(LANGUAGE_PORTUGUESE),
+	"LANGUAGE_RUSSIAN":             uint64(LANGUAGE_RUSSIAN),
+	"LANGUAGE_CHINESE_TRADITIONAL": uint64(LANGUAGE_CHINESE_TRADITIONAL),
+}
+
+// titleDatabaseRow is an entry of the title database: the fields of
+// TitleEntry, then the genre, number of players and languages of the title,
+// which not every entry has. Those are kept with the rest of the TitleInfo.
+type titleDatabaseRow struct {
+	Name      string
+	TitleID   uint64
+	Region    uint8
+	Key       uint8
+	Category  uint8
+	Genre     string
+	Players   uint8  // most players at once
+	Languages uint16 // LANGUAGE_* flags
+}
+
+func (row *titleDatabaseRow) entry() TitleEntry {
+	return TitleEntry{Name: row.Name, TitleID: row.TitleID, Region: row.Region, Key: row.Key, Category: row.Category}
+}
+
+type TitleDatabaseUpdateResult struct {
+	Added   int
+	Changed int
+	Total   int
+}
+
+// UpdateTitleDatabase downloads the latest title database and swaps it in for the
+// embedded one. Readers of GetTitleEntries keep working on their own copy while this runs.
+// The database is kept in the cache folder, LoadCachedTitleDatabase loads it on
+// the next runs.
+func UpdateTitleDatabase(progressReporter ProgressReporter, client *http.Client) (TitleDatabaseUpdateResult, error) {
+	req, err := http.NewRequest("GET", titleDatabaseURL, nil)
+	if err != nil {
+		return TitleDatabaseUpdateResult{}, err
+	}
+	req.Header.Set("User-Agent", "NUSspliBuilder/2.1")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return TitleDatabaseUpdateResult{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return TitleDatabaseUpdateResult{}, wrapKind(ErrCDNStatus, fmt.Errorf(Localize("title database download error, status code: %d"), resp.StatusCode))
+	}
+
+	progressReporter.ResetTotals()
+	if resp.ContentLength > 0 {
+		progressReporter.SetDownloadSize(resp.ContentLength)
+	}
+	progressReporter.SetStartTime(time.Now())
+
+	var buf bytes.Buffer
+	writerProgress := newWriterProgress(&buf, progressReporter, "db.go")
+	_, err = io.Copy(writerProgress, resp.Body)
+	writerProgress.Close()
+	if err != nil {
+		if progressReporter.Cancelled() {
+			return TitleDatabaseUpdateResult{}, errCancel
+		}
+		return TitleDatabaseUpdateResult{}, err
+	}
+
+	rows, err := parseTitleDatabase(buf.Bytes())
+	if err != nil {
+		return TitleDatabaseUpdateResult{}, err
+	}
+
+	entries := make([]TitleEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, row.entry())
+	}
+	learnTitleDatabaseInfo(rows)
+	if err := saveTitleDatabaseCache(buf.Bytes()); err != nil {
+		log.Printf("unable to keep the title database: %v", err)
+	}
+	return replaceTitleEntries(entries), nil
+}
+
+func getTitleDatabaseCachePath() (string, error) {
+	cacheDirectory, err := GetCacheDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDirectory, titleDatabaseCacheFilename), nil
+}
+
+// saveTitleDatabaseCache writes the source of a title database to the cache,
+// through a temporary file so a crash never leaves half of it.
+func saveTitleDatabaseCache(src []byte) error {
+	cachePath, err := getTitleDatabaseCachePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(cachePath+".tmp", src, 0644); err != nil {
+		os.Remove(cachePath + ".tmp")
+		return err
+	}
+	return os.Rename(cachePath+".tmp", cachePath)
+}
+
+// LoadCachedTitleDatabase swaps in the title database UpdateTitleDatabase
+// downloaded on an earlier run, if there is one. The titles of the embedded
+// database it doesn't have are kept, as a newer release can ship a newer
+// database than the one in the cache. It must be called once at startup, after
+// SetCacheDirectory.
+func LoadCachedTitleDatabase() error {
+	cachePath, err := getTitleDatabaseCachePath()
+	if err != nil {
+		return err
+	}
+	src, err := os.ReadFile(cachePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rows, err := parseTitleDatabase(src)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]TitleEntry, 0, len(rows))
+	cached := make(map[uint64]bool, len(rows))
+	for _, row := range rows {
+		entries = append(entries, row.entry())
+		cached[row.TitleID] = true
+	}
+	titleEntriesMutex.RLock()
+	for _, entry := range titleEntry {
+		if !cached[entry.TitleID] {
+			entries = append(entries, entry)
+		}
+	}
+	titleEntriesMutex.RUnlock()
+	replaceTitleEntries(entries)
+	return nil
+}
+
+func replaceTitleEntries(entries []TitleEntry) TitleDatabaseUpdateResult {
+	titleEntriesMutex.Lock()
+	defer titleEntriesMutex.Unlock()
+
+	current := make(map[uint64]TitleEntry, len(titleEntry))
+	for _, entry := range titleEntry {
+		current[entry.TitleID] = entry
+	}
+
+	result := TitleDatabaseUpdateResult{Total: len(entries)}
+	for _, entry := range entries {
+		old, ok := current[entry.TitleID]
+		if !ok {
+			result.Added++
+		} else if old != entry {
+			result.Changed++
+		}
+	}
+
+	titleEntry = entries
+	return result
+}
+
+func parseTitleDatabase(src []byte) ([]titleDatabaseRow, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "db.go", src, 0)
+	if err != nil {
+		return nil, fmt.Errorf(Localize("failed to parse title database: %w"), err)
+	}
+
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for _, value := range valueSpec.Values {
+				list, ok := value.(*ast.CompositeLit)
+				if !ok {
+					continue
+				}
+				if _, ok := list.Type.(*ast.ArrayType); !ok {
+					continue
+				}
+				return parseTitleDatabaseEntries(list)
+			}
+		}
+	}
+
+	return nil, errors.New(Localize("title database does not contain any entries"))
+}
+
+func parseTitleDatabaseEntries(list *ast.CompositeLit) ([]titleDatabaseRow, error) {
+	entries := make([]titleDatabaseRow, 0, len(list.Elts))
+	for _, elt := range list.Elts {
+		lit, ok := elt.(*ast.CompositeLit)
+		if !ok {
+			return nil, fmt.Errorf(Localize("unexpected title database element: %T"), elt)
+		}
+
+		entry := titleDatabaseRow{}
+		entryValue := reflect.ValueOf(&entry).Elem()
+		for i, fieldExpr := range lit.Elts {
+			field := reflect.Value{}
+			if kv, ok := fieldExpr.(*ast.KeyValueExpr); ok {
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok {
+					return nil, fmt.Errorf(Localize("unexpected title database key: %T"), kv.Key)
+				}
+				field = entryValue.FieldByName(key.Name)
+				fieldExpr = kv.Value
+			} else if i < entryValue.NumField() {
+				field = entryValue.Field(i)
+			}
+			if !field.IsValid() {
+				continue
+			}
+			if err := setTitleDatabaseField(field, fieldExpr); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func setTitleDatabaseField(field reflect.Value, expr ast.Expr) error {
+	if field.Kind() == reflect.String {
+		lit, ok := expr.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return fmt.Errorf(Localize("expected string in title database, got %T"), expr)
+		}
+		str, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return err
+		}
+		field.SetString(str)
+		return nil
+	}
+
+	value, err := evalTitleDatabaseExpr(expr)
+	if err != nil {
+		return err
+	}
+	if field.OverflowUint(value) {
+		return fmt.Errorf(Localize("title database value 0x%X overflows %s"), value, field.Type())
+	}
+	field.SetUint(value)
+	return nil
+}
+
+func evalTitleDatabaseExpr(expr ast.Expr) (uint64, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT {
+			return 0, fmt.Errorf(Localize("unexpected literal in title database: %s"), e.Value)
+		}
+		return strconv.ParseUint(e.Value, 0, 64)
+	case *ast.Ident:
+		value, ok := titleDatabaseConstants[e.Name]
+		if !ok {
+			return 0, fmt.Errorf(Localize("unknown constant in title database: %s"), e.Name)
+		}
+		return value, nil
+	case *ast.ParenExpr:
+		return evalTitleDatabaseExpr(e.X)
+	case *ast.BinaryExpr:
+		x, err := evalTitleDatabaseExpr(e.X)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalTitleDatabaseExpr(e.Y)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.OR:
+			return x | y, nil
+		case token.ADD:
+			return x + y, nil
+		}
+		return 0, fmt.Errorf(Localize("unsupported operator in title database: %s"), e.Op)
+	}
+	return 0, fmt.Errorf(Localize("unsupported expression in title database: %T"), expr)
+}
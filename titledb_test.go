@@ -0,0 +1,58 @@
+package wiiudownloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCachedTitleDatabase(t *testing.T) {
+	cacheDirectory := t.TempDir()
+	SetCacheDirectory(cacheDirectory)
+	titleEntriesMutex.RLock()
+	embedded := titleEntry
+	titleEntriesMutex.RUnlock()
+	t.Cleanup(func() {
+		SetCacheDirectory("")
+		titleEntriesMutex.Lock()
+		titleEntry = embedded
+		titleEntriesMutex.Unlock()
+	})
+	titleEntriesMutex.Lock()
+	titleEntry = []TitleEntry{
+		{"Super Mario 3D World", 0x0005000010145d00, MCP_REGION_USA, TITLE_KEY_mypass, TITLE_CATEGORY_GAME},
+		{"Only Embedded", 0x0005000010100000, MCP_REGION_EUROPE, TITLE_KEY_mypass, TITLE_CATEGORY_GAME},
+	}
+	titleEntriesMutex.Unlock()
+
+	// Nothing cached yet
+	if err := LoadCachedTitleDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	src := `package wiiudownloader
+
+var titleEntry = []TitleEntry{
+	{"Super Mario 3D World (Renamed)", 0x0005000010145d00, MCP_REGION_USA, TITLE_KEY_mypass, TITLE_CATEGORY_GAME},
+	{"Only Cached", 0x0005000010200000, MCP_REGION_JAPAN, TITLE_KEY_mypass, TITLE_CATEGORY_GAME},
+}
+`
+	if err := saveTitleDatabaseCache([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDirectory, titleDatabaseCacheFilename)); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadCachedTitleDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	for tid, want := range map[uint64]string{
+		0x0005000010145d00: "Super Mario 3D World (Renamed)",
+		0x0005000010100000: "Only Embedded",
+		0x0005000010200000: "Only Cached",
+	} {
+		if got := GetTitleEntryFromTid(tid).Name; got != want {
+			t.Errorf("name of %016x = %q, want %q", tid, got, want)
+		}
+	}
+}
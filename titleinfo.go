@@ -0,0 +1,524 @@
+package wiiudownloader
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const titleInfoFilename = "titleinfo.json"
+
+// Subcategories the games are split in, told apart by their product code:
+// WUP-P-ARDP is sold on a disc, WUP-N-... only on the eShop and the first
+// letter of the game code of those tells the platform of Virtual Console games,
+// as on the Wii. The product codes come with the embedded title data, games
+// that aren't in it and were never decrypted are only in GAME_SUBCATEGORY_ALL.
+const (
+	GAME_SUBCATEGORY_ALL uint8 = iota
+	GAME_SUBCATEGORY_RETAIL
+	GAME_SUBCATEGORY_ESHOP // only sold on the eShop, besides Virtual Console games
+	GAME_SUBCATEGORY_VC    // Virtual Console games of every platform
+	GAME_SUBCATEGORY_VC_NES
+	GAME_SUBCATEGORY_VC_SNES
+	GAME_SUBCATEGORY_VC_N64
+	GAME_SUBCATEGORY_VC_GBA
+	GAME_SUBCATEGORY_VC_DS
+)
+
+var gameSubcategoryNames = []string{
+	GAME_SUBCATEGORY_ALL:     "All games",
+	GAME_SUBCATEGORY_RETAIL:  "Retail",
+	GAME_SUBCATEGORY_ESHOP:   "eShop only",
+	GAME_SUBCATEGORY_VC:      "Virtual Console",
+	GAME_SUBCATEGORY_VC_NES:  "Virtual Console NES",
+	GAME_SUBCATEGORY_VC_SNES: "Virtual Console SNES",
+	GAME_SUBCATEGORY_VC_N64:  "Virtual Console N64",
+	GAME_SUBCATEGORY_VC_GBA:  "Virtual Console GBA",
+	GAME_SUBCATEGORY_VC_DS:   "Virtual Console DS",
+}
+
+// virtualConsolePlatforms are the Virtual Console subcategories by the first
+// letter of the game code.
+var virtualConsolePlatforms = map[byte]uint8{
+	'F': GAME_SUBCATEGORY_VC_NES,
+	'J': GAME_SUBCATEGORY_VC_SNES,
+	'N': GAME_SUBCATEGORY_VC_N64,
+	'P': GAME_SUBCATEGORY_VC_GBA,
+	'D': GAME_SUBCATEGORY_VC_DS,
+}
+
+// osVersionTIDBase is the title ID of the IOSU of the Wii U without the number
+// of its version, OSv10 is 000500101000400A.
+const osVersionTIDBase = 0x0005001010004000
+
+// TitleInfo is what is known of a title besides its title database entry. The
+// product code, genre, number of players and languages come with the embedded
+// title data, see titleDataJSON. The OS version is read from the TMD of the
+// titles that were downloaded, and what the meta.xml of those that were
+// decrypted or a downloaded title database tell replaces the embedded data.
+// What was learned is kept in the cache for the next runs.
+type TitleInfo struct {
+	ProductCode string `json:"productCode,omitempty"` // WUP-P-ARDP, as printed on the disc
+	OSVersion   uint64 `json:"osVersion,omitempty"`   // title ID of the IOSU the title needs
+	Genre       string `json:"genre,omitempty"`
+	Players     uint8  `json:"players,omitempty"`   // most players at once
+	Languages   uint16 `json:"languages,omitempty"` // LANGUAGE_* flags
+}
+
+var languageNames = []struct {
+	language uint16
+	name     string
+	code     string // of the longname_* field of meta.xml
+}{
+	{LANGUAGE_JAPANESE, "Japanese", "JA"},
+	{LANGUAGE_ENGLISH, "English", "EN"},
+	{LANGUAGE_FRENCH, "French", "FR"},
+	{LANGUAGE_GERMAN, "German", "DE"},
+	{LANGUAGE_ITALIAN, "Italian", "IT"},
+	{LANGUAGE_SPANISH, "Spanish", "ES"},
+	{LANGUAGE_CHINESE_SIMPLIFIED, "Chinese (Simplified)", "ZHS"},
+	{LANGUAGE_KOREAN, "Korean", "KO"},
+	{LANGUAGE_DUTCH, "Dutch", "NL"},
+	{LANGUAGE_PORTUGUESE, "Portuguese", "PT"},
+	{LANGUAGE_RUSSIAN, "Russian", "RU"},
+	{LANGUAGE_CHINESE_TRADITIONAL, "Chinese (Traditional)", "ZHT"},
+}
+
+var (
+	titleInfos      map[uint64]TitleInfo
+	titleInfosMutex sync.Mutex
+)
+
+func getTitleInfoCachePath() (string, error) {
+	cacheDirectory, err := GetCacheDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDirectory, titleInfoFilename), nil
+}
+
+// loadTitleInfos reads the embedded title data and the cache the first time,
+// titleInfosMutex must be held.
+func loadTitleInfos() {
+	if titleInfos != nil {
+		return
+	}
+	titleInfos = make(map[uint64]TitleInfo)
+	for titleID, info := range loadShippedTitleInfos() {
+		titleInfos[titleID] = info
+	}
+	cachePath, err := getTitleInfoCachePath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return
+	}
+	saved := make(map[string]TitleInfo)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return
+	}
+	for value, info := range saved {
+		if titleID, err := ParseTitleID(value); err == nil {
+			titleInfos[titleID] = mergeTitleInfo(titleInfos[titleID], info)
+		}
+	}
+}
+
+// saveTitleInfos writes the cache, titleInfosMutex must be held. Nothing is
+// lost if it can't be written, the info is read again on the next decryption.
+func saveTitleInfos() {
+	cachePath, err := getTitleInfoCachePath()
+	if err != nil {
+		return
+	}
+	shipped := loadShippedTitleInfos()
+	saved := make(map[string]TitleInfo)
+	for titleID, info := range titleInfos {
+		// The embedded data is there on the next runs
+		if known, ok := shipped[titleID]; !ok || info != known {
+			saved[fmt.Sprintf("%016x", titleID)] = info
+		}
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		os.WriteFile(cachePath, data, 0644)
+	}
+}
+
+// GetTitleInfo returns what is known of a title. Updates and DLC that weren't
+// decrypted yet get the info of their game.
+func GetTitleInfo(titleID uint64) (TitleInfo, bool) {
+	titleInfosMutex.Lock()
+	defer titleInfosMutex.Unlock()
+	loadTitleInfos()
+	if info, ok := titleInfos[titleID]; ok {
+		return info, true
+	}
+	info, ok := titleInfos[ToBaseTID(titleID)]
+	return info, ok
+}
+
+// SetTitleInfo records what is known of a title, replacing what was known.
+func SetTitleInfo(titleID uint64, info TitleInfo) {
+	updateTitleInfo(titleID, func(known *TitleInfo) {
+		*known = info
+	})
+}
+
+// updateTitleInfo changes what is known of a title with update.
+func updateTitleInfo(titleID uint64, update func(info *TitleInfo)) {
+	titleInfosMutex.Lock()
+	defer titleInfosMutex.Unlock()
+	loadTitleInfos()
+	info := titleInfos[titleID]
+	update(&info)
+	if titleInfos[titleID] == info {
+		return
+	}
+	titleInfos[titleID] = info
+	saveTitleInfos()
+}
+
+// GetProductCode returns the product code of a title, empty when it isn't known.
+func GetProductCode(titleID uint64) string {
+	info, _ := GetTitleInfo(titleID)
+	return info.ProductCode
+}
+
+// GetGameSubcategory returns the subcategory of a game from its product code,
+// GAME_SUBCATEGORY_ALL when it isn't known.
+func GetGameSubcategory(titleID uint64) uint8 {
+	kind, gameCode, found := strings.Cut(strings.TrimPrefix(strings.ToUpper(GetProductCode(titleID)), "WUP-"), "-")
+	if !found || gameCode == "" {
+		return GAME_SUBCATEGORY_ALL
+	}
+	switch kind {
+	case "P":
+		return GAME_SUBCATEGORY_RETAIL
+	case "N":
+		if platform, ok := virtualConsolePlatforms[gameCode[0]]; ok {
+			return platform
+		}
+		return GAME_SUBCATEGORY_ESHOP
+	default:
+		return GAME_SUBCATEGORY_ALL
+	}
+}
+
+// IsInGameSubcategory reports whether a game is in subcategory, every game is
+// in GAME_SUBCATEGORY_ALL.
+func IsInGameSubcategory(titleID uint64, subcategory uint8) bool {
+	if subcategory == GAME_SUBCATEGORY_ALL {
+		return true
+	}
+	actual := GetGameSubcategory(titleID)
+	if subcategory == GAME_SUBCATEGORY_VC {
+		return actual >= GAME_SUBCATEGORY_VC_NES
+	}
+	return actual == subcategory
+}
+
+// GetGameSubcategories returns every game subcategory, in the order they are
+// listed.
+func GetGameSubcategories() []uint8 {
+	subcategories := make([]uint8, len(gameSubcategoryNames))
+	for i := range subcategories {
+		subcategories[i] = uint8(i)
+	}
+	return subcategories
+}
+
+func GetFormattedGameSubcategory(subcategory uint8) string {
+	if int(subcategory) >= len(gameSubcategoryNames) {
+		return "Unknown"
+	}
+	return gameSubcategoryNames[subcategory]
+}
+
+func GetGameSubcategoryFromFormattedGameSubcategory(formattedSubcategory string) uint8 {
+	for subcategory, name := range gameSubcategoryNames {
+		if strings.EqualFold(name, formattedSubcategory) {
+			return uint8(subcategory)
+		}
+	}
+	return GAME_SUBCATEGORY_ALL
+}
+
+// osVersionNumber returns the number of the version of the IOSU with the title
+// ID osVersion, false when it isn't one.
+func osVersionNumber(osVersion uint64) (uint8, bool) {
+	if osVersion&^0xFF != osVersionTIDBase {
+		return 0, false
+	}
+	return uint8(osVersion), true
+}
+
+// GetRequiredOSVersion returns the number of the OS version a title needs, 10
+// for OSv10, false when it isn't known. Unlike the product code it isn't taken
+// from the game for its update and DLC, they can need a newer one.
+func GetRequiredOSVersion(titleID uint64) (uint8, bool) {
+	titleInfosMutex.Lock()
+	defer titleInfosMutex.Unlock()
+	loadTitleInfos()
+	return osVersionNumber(titleInfos[titleID].OSVersion)
+}
+
+// FormatOSVersion returns the name of an OS version, OSv10 for 10.
+func FormatOSVersion(number uint8) string {
+	return fmt.Sprintf("OSv%d", number)
+}
+
+// GetFormattedRequiredOSVersion returns the name of the OS version a title
+// needs, empty when it isn't known.
+func GetFormattedRequiredOSVersion(titleID uint64) string {
+	number, ok := GetRequiredOSVersion(titleID)
+	if !ok {
+		return ""
+	}
+	return FormatOSVersion(number)
+}
+
+// TitleRunsOnOSVersion reports whether a title can be installed on a console
+// with the OS version number. Titles whose OS version isn't known yet are
+// reported as installable, nothing tells otherwise.
+func TitleRunsOnOSVersion(titleID uint64, number uint8) bool {
+	required, ok := GetRequiredOSVersion(titleID)
+	return !ok || required <= number
+}
+
+// GetKnownOSVersions returns the numbers of the OS versions the known titles
+// need, in ascending order.
+func GetKnownOSVersions() []uint8 {
+	titleInfosMutex.Lock()
+	defer titleInfosMutex.Unlock()
+	loadTitleInfos()
+	numbers := make([]uint8, 0)
+	for _, info := range titleInfos {
+		if number, ok := osVersionNumber(info.OSVersion); ok && !slices.Contains(numbers, number) {
+			numbers = append(numbers, number)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+// GetFormattedPlayers returns how many players a title is for, 1-4 for up to
+// four players, empty when it isn't known.
+func GetFormattedPlayers(players uint8) string {
+	switch players {
+	case 0:
+		return ""
+	case 1:
+		return "1"
+	default:
+		return fmt.Sprintf("1-%d", players)
+	}
+}
+
+// GetLanguages returns every LANGUAGE_* flag, in the order they are listed.
+func GetLanguages() []uint16 {
+	languages := make([]uint16, 0, len(languageNames))
+	for _, language := range languageNames {
+		languages = append(languages, language.language)
+	}
+	return languages
+}
+
+// GetFormattedLanguage returns the name of a LANGUAGE_* flag.
+func GetFormattedLanguage(language uint16) string {
+	for _, known := range languageNames {
+		if known.language == language {
+			return known.name
+		}
+	}
+	return "Unknown"
+}
+
+// GetFormattedLanguages returns the codes of the languages of a title, like
+// "EN, FR, ES", empty when they aren't known.
+func GetFormattedLanguages(languages uint16) string {
+	codes := make([]string, 0)
+	for _, language := range languageNames {
+		if languages&language.language != 0 {
+			codes = append(codes, language.code)
+		}
+	}
+	return strings.Join(codes, ", ")
+}
+
+// GetKnownGenres returns the genres of the known titles, sorted.
+func GetKnownGenres() []string {
+	titleInfosMutex.Lock()
+	defer titleInfosMutex.Unlock()
+	loadTitleInfos()
+	genres := make([]string, 0)
+	for _, info := range titleInfos {
+		if info.Genre != "" && !slices.Contains(genres, info.Genre) {
+			genres = append(genres, info.Genre)
+		}
+	}
+	slices.Sort(genres)
+	return genres
+}
+
+// GetKnownPlayers returns the numbers of players of the known titles, in
+// ascending order.
+func GetKnownPlayers() []uint8 {
+	titleInfosMutex.Lock()
+	defer titleInfosMutex.Unlock()
+	loadTitleInfos()
+	players := make([]uint8, 0)
+	for _, info := range titleInfos {
+		if info.Players != 0 && !slices.Contains(players, info.Players) {
+			players = append(players, info.Players)
+		}
+	}
+	slices.Sort(players)
+	return players
+}
+
+// GetKnownLanguages returns the languages of the known titles, in the order
+// of GetLanguages.
+func GetKnownLanguages() []uint16 {
+	titleInfosMutex.Lock()
+	defer titleInfosMutex.Unlock()
+	loadTitleInfos()
+	var known uint16
+	for _, info := range titleInfos {
+		known |= info.Languages
+	}
+	languages := make([]uint16, 0)
+	for _, language := range languageNames {
+		if known&language.language != 0 {
+			languages = append(languages, language.language)
+		}
+	}
+	return languages
+}
+
+// TitleHasGenre reports whether a title is of genre, ignoring case. Every
+// title has the empty genre, titles whose genre isn't known have no other.
+func TitleHasGenre(titleID uint64, genre string) bool {
+	if genre == "" {
+		return true
+	}
+	info, _ := GetTitleInfo(titleID)
+	return strings.EqualFold(info.Genre, genre)
+}
+
+// TitleSupportsPlayers reports whether a title can be played by that many
+// players at once, titles whose number of players isn't known only by 0.
+func TitleSupportsPlayers(titleID uint64, players uint8) bool {
+	if players == 0 {
+		return true
+	}
+	info, _ := GetTitleInfo(titleID)
+	return info.Players >= players
+}
+
+// TitleSupportsLanguage reports whether a title can be played in language,
+// every title supports 0 and titles whose languages aren't known no other.
+func TitleSupportsLanguage(titleID uint64, language uint16) bool {
+	if language == 0 {
+		return true
+	}
+	info, _ := GetTitleInfo(titleID)
+	return info.Languages&language != 0
+}
+
+// TitleMatchesQuery reports whether a title matches a search: the query is
+// looked for, ignoring case, in its name, title ID and product code.
+func TitleMatchesQuery(entry TitleEntry, query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" || strings.Contains(strings.ToLower(entry.Name), query) || strings.Contains(fmt.Sprintf("%016x", entry.TitleID), query) {
+		return true
+	}
+	productCode := GetProductCode(entry.TitleID)
+	return productCode != "" && strings.Contains(strings.ToLower(productCode), query)
+}
+
+type metaXML struct {
+	ProductCode string `xml:"product_code"`
+	OSVersion   string `xml:"os_version"`
+}
+
+// readMetaXML returns the info of the meta.xml of a decrypted title folder.
+func readMetaXML(path string) (TitleInfo, error) {
+	data, err := os.ReadFile(filepath.Join(path, "meta", "meta.xml"))
+	if err != nil {
+		return TitleInfo{}, err
+	}
+	meta := metaXML{}
+	if err := xml.Unmarshal(data, &meta); err != nil {
+		return TitleInfo{}, err
+	}
+	info := TitleInfo{ProductCode: strings.TrimSpace(meta.ProductCode)}
+	if osVersion, err := strconv.ParseUint(strings.TrimSpace(meta.OSVersion), 16, 64); err == nil {
+		info.OSVersion = osVersion
+	}
+	return info, nil
+}
+
+// learnTitleInfo records the info of the meta.xml of a title once it was
+// decrypted to path. Titles without one are left alone.
+func learnTitleInfo(titleID uint64, path string) {
+	meta, err := readMetaXML(path)
+	if err != nil {
+		return
+	}
+	updateTitleInfo(titleID, func(info *TitleInfo) {
+		if meta.ProductCode != "" {
+			info.ProductCode = meta.ProductCode
+		}
+		if meta.OSVersion != 0 {
+			info.OSVersion = meta.OSVersion
+		}
+	})
+}
+
+// learnTMDInfo records the OS version a title needs from its TMD, for the
+// titles that are downloaded but never decrypted.
+func learnTMDInfo(tmd *TMD) {
+	if _, ok := osVersionNumber(tmd.SystemVersion); !ok {
+		return
+	}
+	updateTitleInfo(tmd.TitleID, func(info *TitleInfo) {
+		info.OSVersion = tmd.SystemVersion
+	})
+}
+
+// learnTitleDatabaseInfo records the genre, number of players and languages of
+// the entries of a downloaded title database that have them, so they are still
+// known on the next runs, which start from the embedded title database.
+func learnTitleDatabaseInfo(rows []titleDatabaseRow) {
+	titleInfosMutex.Lock()
+	defer titleInfosMutex.Unlock()
+	loadTitleInfos()
+	changed := false
+	for _, row := range rows {
+		if row.Genre == "" && row.Players == 0 && row.Languages == 0 {
+			continue
+		}
+		info := titleInfos[row.TitleID]
+		known := info
+		info.Genre, info.Players, info.Languages = row.Genre, row.Players, row.Languages
+		if info != known {
+			titleInfos[row.TitleID] = info
+			changed = true
+		}
+	}
+	if changed {
+		saveTitleInfos()
+	}
+}
@@ -0,0 +1,174 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ImportedTitleKeys are the title keys read by ImportTitleKeysFromFile.
+type ImportedTitleKeys struct {
+	Keys    map[uint64][]byte // encrypted title keys, as stored in tickets
+	Invalid []string          // entries without a valid title ID or title key
+}
+
+type titleKeyEntry struct {
+	TitleID  string `json:"titleID"`
+	TitleKey string `json:"titleKey"`
+}
+
+var (
+	titleKeysMutex sync.RWMutex
+	titleKeys      = make(map[uint64][]byte)
+)
+
+// ImportTitleKeysFromFile reads the title keys of titles from a JSON or CSV
+// file, in the format of the title key sites. JSON files hold an array of
+// objects with "titleID" and "titleKey" fields, or an object mapping title
+// IDs to title keys. CSV files have "titleID" and "titleKey" columns, or the
+// title IDs and keys in their first two columns. The keys are the encrypted
+// ones found in tickets, 32 hexadecimal digits.
+func ImportTitleKeysFromFile(path string) (*ImportedTitleKeys, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf(Localize("could not read the title keys file %s: %w"), path, err)
+	}
+	defer file.Close()
+
+	var entries []titleKeyEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		entries, err = readTitleKeysJSON(file)
+	case ".csv":
+		entries, err = readTitleKeysCSV(file)
+	default:
+		return nil, fmt.Errorf(Localize("unsupported title keys file %s, expected a JSON or CSV file"), path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	imported := &ImportedTitleKeys{Keys: make(map[uint64][]byte, len(entries))}
+	for _, entry := range entries {
+		tid, err := ParseTitleID(entry.TitleID)
+		if err != nil {
+			imported.Invalid = append(imported.Invalid, entry.TitleID)
+			continue
+		}
+		titleKey, err := hex.DecodeString(strings.TrimSpace(entry.TitleKey))
+		if err != nil || len(titleKey) != aes.BlockSize {
+			imported.Invalid = append(imported.Invalid, entry.TitleID)
+			continue
+		}
+		imported.Keys[tid] = titleKey
+	}
+	return imported, nil
+}
+
+func readTitleKeysJSON(r io.Reader) ([]titleKeyEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []titleKeyEntry
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var keysByTID map[string]string
+		if err := json.Unmarshal(data, &keysByTID); err != nil {
+			return nil, err
+		}
+		for tid, titleKey := range keysByTID {
+			entries = append(entries, titleKeyEntry{TitleID: tid, TitleKey: titleKey})
+		}
+		return entries, nil
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func readTitleKeysCSV(r io.Reader) ([]titleKeyEntry, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	tidColumn, keyColumn := 0, 1
+	hasHeader := false
+	for i, header := range records[0] {
+		switch {
+		case strings.EqualFold(strings.TrimSpace(header), "titleID"):
+			tidColumn, hasHeader = i, true
+		case strings.EqualFold(strings.TrimSpace(header), "titleKey"):
+			keyColumn, hasHeader = i, true
+		}
+	}
+	if hasHeader {
+		records = records[1:]
+	}
+
+	entries := make([]titleKeyEntry, 0, len(records))
+	for _, record := range records {
+		entry := titleKeyEntry{}
+		if tidColumn < len(record) {
+			entry.TitleID = record[tidColumn]
+		}
+		if keyColumn < len(record) {
+			entry.TitleKey = record[keyColumn]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// SetTitleKeys makes the generated tickets use the given title keys instead of
+// derived ones, for the titles they have a key for.
+func SetTitleKeys(keys map[uint64][]byte) {
+	titleKeysMutex.Lock()
+	defer titleKeysMutex.Unlock()
+	titleKeys = make(map[uint64][]byte, len(keys))
+	for tid, titleKey := range keys {
+		titleKeys[tid] = bytes.Clone(titleKey)
+	}
+}
+
+// LoadTitleKeys imports the title keys of path, see ImportTitleKeysFromFile,
+// and makes the generated tickets use them. The entries that are not valid
+// are returned along with them, they are left out. A file without a single
+// valid title key is an error.
+func LoadTitleKeys(path string) (*ImportedTitleKeys, error) {
+	imported, err := ImportTitleKeysFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(imported.Keys) == 0 {
+		return nil, fmt.Errorf(Localize("the title keys file %s has no valid title key"), path)
+	}
+	SetTitleKeys(imported.Keys)
+	return imported, nil
+}
+
+// GetTicketTitleKey returns the encrypted title key to generate the ticket of
+// titleID with: the imported one when there is one, a derived one otherwise.
+func GetTicketTitleKey(titleID uint64) ([]byte, error) {
+	titleKeysMutex.RLock()
+	titleKey, ok := titleKeys[titleID]
+	titleKeysMutex.RUnlock()
+	if ok {
+		return bytes.Clone(titleKey), nil
+	}
+	return GenerateKey(fmt.Sprintf("%016x", titleID))
+}
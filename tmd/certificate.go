@@ -0,0 +1,243 @@
+package tmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+const (
+	KEY_TYPE_RSA_4096 = 0x00
+	KEY_TYPE_RSA_2048 = 0x01
+	KEY_TYPE_ECC      = 0x02
+)
+
+// publicKeySizes are the sizes of the public keys of certificates, with their
+// exponent and padding.
+var publicKeySizes = map[uint32]int{
+	KEY_TYPE_RSA_4096: 0x200 + 4 + 0x34,
+	KEY_TYPE_RSA_2048: 0x100 + 4 + 0x34,
+	KEY_TYPE_ECC:      0x3C + 0x3C,
+}
+
+// ROOT_ISSUER issues the CA certificates, its key isn't part of any chain.
+const ROOT_ISSUER = "Root"
+
+var (
+	ErrCertificateNotFound  = errors.New("no certificate for the issuer")
+	ErrUnsupportedSignature = errors.New("unsupported signature type")
+	ErrInvalidSignature     = errors.New("invalid signature")
+)
+
+type CertificateHeader struct {
+	Issuer  [0x40]byte
+	KeyType uint32 // one of the KEY_TYPE_* values
+	Name    [0x40]byte
+	ID      uint32
+}
+
+// Certificate holds the public key that signs TMDs, tickets or other
+// certificates. Its full name, the issuer of what it signs, is
+// "<issuer>-<name>", for example Root-CA00000003-CP0000000b.
+type Certificate struct {
+	Signature Signature
+	Header    CertificateHeader
+	PublicKey []byte // as stored, with its exponent and padding
+}
+
+func cString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+func (c *Certificate) Issuer() string {
+	return cString(c.Header.Issuer[:])
+}
+
+func (c *Certificate) Name() string {
+	return cString(c.Header.Name[:])
+}
+
+func (c *Certificate) signedData() []byte {
+	buffer := bytes.Buffer{}
+	binary.Write(&buffer, binary.BigEndian, c.Header)
+	buffer.Write(c.PublicKey)
+	return buffer.Bytes()
+}
+
+func (c *Certificate) rsaPublicKey() (*rsa.PublicKey, error) {
+	var modulusSize int
+	switch c.Header.KeyType {
+	case KEY_TYPE_RSA_4096:
+		modulusSize = 0x200
+	case KEY_TYPE_RSA_2048:
+		modulusSize = 0x100
+	default:
+		return nil, fmt.Errorf("%w: the key of %s is not an RSA key", ErrUnsupportedSignature, c.Name())
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(c.PublicKey[:modulusSize]),
+		E: int(binary.BigEndian.Uint32(c.PublicKey[modulusSize : modulusSize+4])),
+	}, nil
+}
+
+// Marshal encodes the certificate.
+func (c *Certificate) Marshal() ([]byte, error) {
+	buffer := bytes.Buffer{}
+	if err := writeSignature(&buffer, c.Signature); err != nil {
+		return nil, err
+	}
+	buffer.Write(c.signedData())
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalCertificates parses a certificate chain, such as the title.cert of a
+// title folder or the Certificates of a TMD or ticket.
+func UnmarshalCertificates(data []byte) ([]Certificate, error) {
+	reader := bytes.NewReader(data)
+	certificates := make([]Certificate, 0, 3)
+	for reader.Len() > 0 {
+		signature, err := readSignature(reader)
+		if err != nil {
+			return nil, err
+		}
+		certificate := Certificate{Signature: signature}
+		if err := binary.Read(reader, binary.BigEndian, &certificate.Header); err != nil {
+			return nil, err
+		}
+		keySize, ok := publicKeySizes[certificate.Header.KeyType]
+		if !ok {
+			return nil, fmt.Errorf("unknown key type of certificate %s: %d", certificate.Name(), certificate.Header.KeyType)
+		}
+		certificate.PublicKey = make([]byte, keySize)
+		if _, err := io.ReadFull(reader, certificate.PublicKey); err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+// verifySignature checks signature over signedData with the key of the
+// certificate of issuer.
+func verifySignature(signature Signature, signedData []byte, issuer string, certificates []Certificate) error {
+	separator := strings.LastIndexByte(issuer, '-')
+	var signer *Certificate
+	for i := range certificates {
+		if separator >= 0 && certificates[i].Issuer() == issuer[:separator] && certificates[i].Name() == issuer[separator+1:] {
+			signer = &certificates[i]
+			break
+		}
+	}
+	if signer == nil {
+		return fmt.Errorf("%w %s", ErrCertificateNotFound, issuer)
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	switch signature.Type {
+	case SIGNATURE_RSA_2048_SHA1, SIGNATURE_RSA_4096_SHA1:
+		sum := sha1.Sum(signedData)
+		hash, digest = crypto.SHA1, sum[:]
+	case SIGNATURE_RSA_2048_SHA256, SIGNATURE_RSA_4096_SHA256:
+		sum := sha256.Sum256(signedData)
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return fmt.Errorf("%w 0x%X", ErrUnsupportedSignature, signature.Type)
+	}
+	key, err := signer.rsaPublicKey()
+	if err != nil {
+		return err
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, signature.Data); err != nil {
+		return fmt.Errorf("%w by %s", ErrInvalidSignature, issuer)
+	}
+	return nil
+}
+
+// VerifyCertificates checks the signature of every certificate signed by
+// another one of the chain. The CA certificates, signed by the root key, can't
+// be checked as the root key isn't part of the chain.
+func VerifyCertificates(certificates []Certificate) error {
+	for i := range certificates {
+		certificate := &certificates[i]
+		if certificate.Issuer() == ROOT_ISSUER {
+			continue
+		}
+		if err := verifySignature(certificate.Signature, certificate.signedData(), certificate.Issuer(), certificates); err != nil {
+			return fmt.Errorf("certificate %s: %w", certificate.Name(), err)
+		}
+	}
+	return nil
+}
+
+// VerifySignature checks the signature of the TMD with the certificate of its
+// issuer, and that the content records match the hashes the signature covers.
+func (tmd *TMD) VerifySignature(certificates []Certificate) error {
+	data, err := tmd.Marshal()
+	if err != nil {
+		return err
+	}
+	signedSize := binary.Size(tmd.Header)
+	switch tmd.Header.Version {
+	case TMD_VERSION_WII:
+		// The signature covers the content records
+		signedSize += binary.Size(wiiContentRecord{}) * len(tmd.Contents)
+	case TMD_VERSION_WIIU:
+		// The signature covers the hash of the content info records, which
+		// hash the content records
+		signedSize += len(tmd.ContentInfoHash)
+		if err := tmd.verifyContentInfos(); err != nil {
+			return err
+		}
+	}
+	start := tmd.Signature.Size()
+	return verifySignature(tmd.Signature, data[start:start+signedSize], cString(tmd.Header.Issuer[:]), certificates)
+}
+
+func (tmd *TMD) verifyContentInfos() error {
+	contentInfos := make([]ContentInfo, CONTENT_INFO_COUNT)
+	copy(contentInfos, tmd.ContentInfos)
+	buffer := bytes.Buffer{}
+	binary.Write(&buffer, binary.BigEndian, contentInfos)
+	if sha256.Sum256(buffer.Bytes()) != tmd.ContentInfoHash {
+		return fmt.Errorf("%w: the content info records don't match their hash", ErrInvalidSignature)
+	}
+	for _, contentInfo := range contentInfos {
+		if contentInfo.CommandCount == 0 {
+			continue
+		}
+		end := int(contentInfo.IndexOffset) + int(contentInfo.CommandCount)
+		if end > len(tmd.Contents) {
+			return fmt.Errorf("%w: a content info record covers %d contents, the TMD has %d", ErrInvalidSignature, end, len(tmd.Contents))
+		}
+		buffer.Reset()
+		binary.Write(&buffer, binary.BigEndian, tmd.Contents[contentInfo.IndexOffset:end])
+		if sha256.Sum256(buffer.Bytes()) != contentInfo.Hash {
+			return fmt.Errorf("%w: the content records don't match their hash", ErrInvalidSignature)
+		}
+	}
+	return nil
+}
+
+// VerifySignature checks the signature of the ticket with the certificate of
+// its issuer.
+func (ticket *Ticket) VerifySignature(certificates []Certificate) error {
+	data, err := ticket.Marshal()
+	if err != nil {
+		return err
+	}
+	start := ticket.Signature.Size()
+	end := len(data) - len(ticket.Certificates)
+	return verifySignature(ticket.Signature, data[start:end], cString(ticket.Header.Issuer[:]), certificates)
+}
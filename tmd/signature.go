@@ -0,0 +1,92 @@
+// Package tmd reads and writes the title metadata (TMD) and tickets of Wii and
+// Wii U titles, as found on the CDN and in title folders.
+package tmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	SIGNATURE_RSA_4096_SHA1   = 0x10000
+	SIGNATURE_RSA_2048_SHA1   = 0x10001
+	SIGNATURE_ECC_SHA1        = 0x10002
+	SIGNATURE_RSA_4096_SHA256 = 0x10003
+	SIGNATURE_RSA_2048_SHA256 = 0x10004
+	SIGNATURE_ECC_SHA256      = 0x10005
+)
+
+var ErrUnknownSignatureType = errors.New("unknown signature type")
+
+// VersionError is returned for TMDs and tickets of a version that can't be parsed.
+type VersionError struct {
+	Kind    string // "TMD" or "ticket"
+	Version uint8
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("unknown %s version: %d", e.Kind, e.Version)
+}
+
+// signatureSizes are the sizes of the signature and of the padding after it,
+// the signed data starts right after the padding.
+var signatureSizes = map[uint32][2]int{
+	SIGNATURE_RSA_4096_SHA1:   {0x200, 0x3C},
+	SIGNATURE_RSA_2048_SHA1:   {0x100, 0x3C},
+	SIGNATURE_ECC_SHA1:        {0x3C, 0x40},
+	SIGNATURE_RSA_4096_SHA256: {0x200, 0x3C},
+	SIGNATURE_RSA_2048_SHA256: {0x100, 0x3C},
+	SIGNATURE_ECC_SHA256:      {0x3C, 0x40},
+}
+
+// Signature starts TMDs, tickets and certificates, it signs the data after it.
+type Signature struct {
+	Type uint32
+	Data []byte
+}
+
+// Size is the size of the signature with its type and padding, the offset of
+// the signed data.
+func (s *Signature) Size() int {
+	sizes := signatureSizes[s.Type]
+	return 4 + sizes[0] + sizes[1]
+}
+
+func readSignature(reader io.Reader) (Signature, error) {
+	signature := Signature{}
+	if err := binary.Read(reader, binary.BigEndian, &signature.Type); err != nil {
+		return signature, err
+	}
+	sizes, ok := signatureSizes[signature.Type]
+	if !ok {
+		return signature, fmt.Errorf("%w 0x%X", ErrUnknownSignatureType, signature.Type)
+	}
+	signature.Data = make([]byte, sizes[0])
+	if _, err := io.ReadFull(reader, signature.Data); err != nil {
+		return signature, err
+	}
+	if _, err := io.ReadFull(reader, make([]byte, sizes[1])); err != nil {
+		return signature, err
+	}
+	return signature, nil
+}
+
+func writeSignature(writer io.Writer, signature Signature) error {
+	sizes, ok := signatureSizes[signature.Type]
+	if !ok {
+		return fmt.Errorf("%w 0x%X", ErrUnknownSignatureType, signature.Type)
+	}
+	if len(signature.Data) != sizes[0] {
+		return fmt.Errorf("signature of type 0x%X must be %d bytes long, got %d", signature.Type, sizes[0], len(signature.Data))
+	}
+	if err := binary.Write(writer, binary.BigEndian, signature.Type); err != nil {
+		return err
+	}
+	if _, err := writer.Write(signature.Data); err != nil {
+		return err
+	}
+	_, err := writer.Write(make([]byte, sizes[1]))
+	return err
+}
@@ -0,0 +1,105 @@
+package tmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	TICKET_VERSION_0 = 0x00
+	TICKET_VERSION_1 = 0x01 // Wii U tickets, with the v1 section after the header
+)
+
+// TicketHeader is the part of a ticket after the signature.
+type TicketHeader struct {
+	Issuer         [0x40]byte
+	ECDHData       [0x3C]byte
+	FormatVersion  uint8 // one of the TICKET_VERSION_* values
+	Reserved1      [2]byte
+	TitleKey       [0x10]byte // encrypted with the common key and the title ID as IV
+	Reserved2      uint8
+	TicketID       uint64
+	ConsoleID      uint32
+	TitleID        uint64
+	Reserved3      uint16
+	TitleVersion   uint16
+	Reserved4      [8]byte
+	LicenseType    uint8
+	CommonKeyIndex uint8
+	Reserved5      [0x2A]byte
+	AccountID      uint32
+	Reserved6      uint8
+	Audit          uint8
+	Reserved7      [0x42]byte
+	Limits         [0x40]byte
+}
+
+// ticketV1SectionHeader starts the v1 section of version 1 tickets.
+type ticketV1SectionHeader struct {
+	Version    uint16
+	HeaderSize uint16
+	TotalSize  uint32 // of the whole v1 section
+}
+
+type Ticket struct {
+	Signature Signature
+	Header    TicketHeader
+	V1Section []byte // the v1 section of version 1 tickets, kept as is
+	// Certificates is the certificate chain the CDN appends to the ticket,
+	// empty when there is none
+	Certificates []byte
+}
+
+// UnmarshalTicket parses a Wii or Wii U ticket, such as a cetk from the CDN or
+// the title.tik of a title folder.
+func UnmarshalTicket(data []byte) (*Ticket, error) {
+	reader := bytes.NewReader(data)
+	signature, err := readSignature(reader)
+	if err != nil {
+		return nil, err
+	}
+	ticket := &Ticket{Signature: signature}
+	if err := binary.Read(reader, binary.BigEndian, &ticket.Header); err != nil {
+		return nil, err
+	}
+
+	switch ticket.Header.FormatVersion {
+	case TICKET_VERSION_0:
+	case TICKET_VERSION_1:
+		sectionHeader := ticketV1SectionHeader{}
+		if err := binary.Read(io.NewSectionReader(reader, reader.Size()-int64(reader.Len()), 8), binary.BigEndian, &sectionHeader); err != nil {
+			return nil, err
+		}
+		if int64(sectionHeader.TotalSize) > int64(reader.Len()) {
+			return nil, fmt.Errorf("the v1 section of the ticket is %d bytes long, only %d are left", sectionHeader.TotalSize, reader.Len())
+		}
+		ticket.V1Section = make([]byte, sectionHeader.TotalSize)
+		if _, err := io.ReadFull(reader, ticket.V1Section); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &VersionError{Kind: "ticket", Version: ticket.Header.FormatVersion}
+	}
+
+	ticket.Certificates = make([]byte, reader.Len())
+	if _, err := io.ReadFull(reader, ticket.Certificates); err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// Marshal encodes the ticket.
+func (ticket *Ticket) Marshal() ([]byte, error) {
+	buffer := bytes.Buffer{}
+	if err := writeSignature(&buffer, ticket.Signature); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buffer, binary.BigEndian, ticket.Header); err != nil {
+		return nil, err
+	}
+	buffer.Write(ticket.V1Section)
+	buffer.Write(ticket.Certificates)
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,164 @@
+package tmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	TMD_VERSION_WII  = 0x00
+	TMD_VERSION_WIIU = 0x01
+)
+
+// CONTENT_INFO_COUNT is the number of content info records of Wii U TMDs, the
+// unused ones are zeroed.
+const CONTENT_INFO_COUNT = 64
+
+const (
+	CONTENT_TYPE_ENCRYPTED = 0x0001
+	CONTENT_TYPE_HASHED    = 0x0002 // the content has a hash tree and an .h3 file
+	CONTENT_TYPE_OPTIONAL  = 0x4000
+)
+
+// TMDHeader is the part of a TMD after the signature that describes the title.
+type TMDHeader struct {
+	Issuer           [0x40]byte
+	Version          uint8 // one of the TMD_VERSION_* values
+	CACRLVersion     uint8
+	SignerCRLVersion uint8
+	Reserved1        uint8
+	SystemVersion    uint64 // title ID of the IOS/IOSU the title needs
+	TitleID          uint64
+	TitleType        uint32
+	GroupID          uint16
+	Reserved2        [0x3E]byte // region, ratings and IPC mask, kept as is
+	AccessRights     uint32
+	TitleVersion     uint16
+	ContentCount     uint16
+	BootIndex        uint16
+	Reserved3        uint16
+}
+
+// ContentInfo is a Wii U content info record, it hashes CommandCount content
+// records starting at IndexOffset.
+type ContentInfo struct {
+	IndexOffset  uint16
+	CommandCount uint16
+	Hash         [0x20]byte
+}
+
+// ContentRecord describes a content of the title.
+type ContentRecord struct {
+	ID    uint32
+	Index uint16
+	Type  uint16 // CONTENT_TYPE_* flags
+	Size  uint64
+	// Hash is the SHA-1 of the decrypted content for contents without a hash
+	// tree, or of its .h3 file. Wii U TMDs pad it with zeros.
+	Hash [0x20]byte
+}
+
+// wiiContentRecord is a content record of a Wii TMD, they only have room for
+// the SHA-1.
+type wiiContentRecord struct {
+	ID    uint32
+	Index uint16
+	Type  uint16
+	Size  uint64
+	Hash  [0x14]byte
+}
+
+type TMD struct {
+	Signature       Signature
+	Header          TMDHeader
+	ContentInfoHash [0x20]byte    // SHA-256 of ContentInfos, Wii U only
+	ContentInfos    []ContentInfo // Wii U only
+	Contents        []ContentRecord
+	// Certificates is the certificate chain the CDN appends to the TMD, empty
+	// when there is none
+	Certificates []byte
+}
+
+// Unmarshal parses a Wii or Wii U TMD.
+func Unmarshal(data []byte) (*TMD, error) {
+	reader := bytes.NewReader(data)
+	signature, err := readSignature(reader)
+	if err != nil {
+		return nil, err
+	}
+	tmd := &TMD{Signature: signature}
+	if err := binary.Read(reader, binary.BigEndian, &tmd.Header); err != nil {
+		return nil, err
+	}
+
+	tmd.Contents = make([]ContentRecord, tmd.Header.ContentCount)
+	switch tmd.Header.Version {
+	case TMD_VERSION_WII:
+		for i := range tmd.Contents {
+			record := wiiContentRecord{}
+			if err := binary.Read(reader, binary.BigEndian, &record); err != nil {
+				return nil, err
+			}
+			tmd.Contents[i] = ContentRecord{ID: record.ID, Index: record.Index, Type: record.Type, Size: record.Size}
+			copy(tmd.Contents[i].Hash[:], record.Hash[:])
+		}
+	case TMD_VERSION_WIIU:
+		if _, err := io.ReadFull(reader, tmd.ContentInfoHash[:]); err != nil {
+			return nil, err
+		}
+		tmd.ContentInfos = make([]ContentInfo, CONTENT_INFO_COUNT)
+		if err := binary.Read(reader, binary.BigEndian, tmd.ContentInfos); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(reader, binary.BigEndian, tmd.Contents); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &VersionError{Kind: "TMD", Version: tmd.Header.Version}
+	}
+
+	tmd.Certificates = make([]byte, reader.Len())
+	if _, err := io.ReadFull(reader, tmd.Certificates); err != nil {
+		return nil, err
+	}
+	return tmd, nil
+}
+
+// Marshal encodes the TMD, Header.ContentCount is set from Contents.
+func (tmd *TMD) Marshal() ([]byte, error) {
+	tmd.Header.ContentCount = uint16(len(tmd.Contents))
+	buffer := bytes.Buffer{}
+	if err := writeSignature(&buffer, tmd.Signature); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buffer, binary.BigEndian, tmd.Header); err != nil {
+		return nil, err
+	}
+
+	switch tmd.Header.Version {
+	case TMD_VERSION_WII:
+		for _, content := range tmd.Contents {
+			record := wiiContentRecord{ID: content.ID, Index: content.Index, Type: content.Type, Size: content.Size}
+			copy(record.Hash[:], content.Hash[:])
+			if err := binary.Write(&buffer, binary.BigEndian, record); err != nil {
+				return nil, err
+			}
+		}
+	case TMD_VERSION_WIIU:
+		buffer.Write(tmd.ContentInfoHash[:])
+		contentInfos := make([]ContentInfo, CONTENT_INFO_COUNT)
+		copy(contentInfos, tmd.ContentInfos)
+		if err := binary.Write(&buffer, binary.BigEndian, contentInfos); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(&buffer, binary.BigEndian, tmd.Contents); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &VersionError{Kind: "TMD", Version: tmd.Header.Version}
+	}
+
+	buffer.Write(tmd.Certificates)
+	return buffer.Bytes(), nil
+}
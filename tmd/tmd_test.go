@@ -0,0 +1,364 @@
+package tmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// testChain is a certificate chain shaped like the one of the CDN, with keys
+// made for the tests: a CA certificate, and the CP and XS certificates that
+// sign TMDs and tickets.
+type testChain struct {
+	caKey, cpKey, xsKey *rsa.PrivateKey
+	certificates        []Certificate
+}
+
+const (
+	testCPIssuer = "Root-CA00000003-CP0000000b"
+	testXSIssuer = "Root-CA00000003-XS0000000c"
+)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signTestData signs data with key the way the signatures of the chain are
+// made.
+func signTestData(t *testing.T, key *rsa.PrivateKey, data []byte) Signature {
+	t.Helper()
+	digest := sha256.Sum256(data)
+	signatureData, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Signature{Type: SIGNATURE_RSA_2048_SHA256, Data: signatureData}
+}
+
+func newTestCertificate(t *testing.T, issuer, name string, key, signer *rsa.PrivateKey) Certificate {
+	t.Helper()
+	certificate := Certificate{PublicKey: make([]byte, publicKeySizes[KEY_TYPE_RSA_2048])}
+	copy(certificate.Header.Issuer[:], issuer)
+	copy(certificate.Header.Name[:], name)
+	certificate.Header.KeyType = KEY_TYPE_RSA_2048
+	key.N.FillBytes(certificate.PublicKey[:0x100])
+	binary.BigEndian.PutUint32(certificate.PublicKey[0x100:], uint32(key.E))
+	certificate.Signature = signTestData(t, signer, certificate.signedData())
+	return certificate
+}
+
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+	chain := &testChain{caKey: newTestKey(t), cpKey: newTestKey(t), xsKey: newTestKey(t)}
+	// The root key never leaves the tests, only the CA certificate needs it
+	rootKey := newTestKey(t)
+	chain.certificates = []Certificate{
+		newTestCertificate(t, ROOT_ISSUER, "CA00000003", chain.caKey, rootKey),
+		newTestCertificate(t, "Root-CA00000003", "CP0000000b", chain.cpKey, chain.caKey),
+		newTestCertificate(t, "Root-CA00000003", "XS0000000c", chain.xsKey, chain.caKey),
+	}
+	return chain
+}
+
+func (c *testChain) marshal(t *testing.T) []byte {
+	t.Helper()
+	data := make([]byte, 0)
+	for i := range c.certificates {
+		certificateData, err := c.certificates[i].Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, certificateData...)
+	}
+	return data
+}
+
+// newTestTMD returns a TMD of version with two contents, its content info
+// records filled in, signed by the CP key of chain.
+func newTestTMD(t *testing.T, chain *testChain, version uint8) *TMD {
+	t.Helper()
+	tmd := &TMD{
+		Signature: Signature{Type: SIGNATURE_RSA_2048_SHA256, Data: make([]byte, 0x100)},
+		Contents: []ContentRecord{
+			{ID: 0, Index: 0, Type: CONTENT_TYPE_ENCRYPTED, Size: 0x8000, Hash: [0x20]byte{0x01, 0x02}},
+			{ID: 1, Index: 1, Type: CONTENT_TYPE_ENCRYPTED | CONTENT_TYPE_HASHED, Size: 0x1234567, Hash: [0x20]byte{0x03, 0x04}},
+		},
+	}
+	copy(tmd.Header.Issuer[:], testCPIssuer)
+	tmd.Header.Version = version
+	tmd.Header.SystemVersion = 0x000500101000400A
+	tmd.Header.TitleID = 0x0005000010145D00
+	tmd.Header.TitleType = 0x100
+	tmd.Header.TitleVersion = 16
+	signedSize := binary.Size(tmd.Header)
+	if version == TMD_VERSION_WIIU {
+		buffer := bytes.Buffer{}
+		binary.Write(&buffer, binary.BigEndian, tmd.Contents)
+		tmd.ContentInfos = make([]ContentInfo, CONTENT_INFO_COUNT)
+		tmd.ContentInfos[0] = ContentInfo{IndexOffset: 0, CommandCount: 2, Hash: sha256.Sum256(buffer.Bytes())}
+		buffer.Reset()
+		binary.Write(&buffer, binary.BigEndian, tmd.ContentInfos)
+		tmd.ContentInfoHash = sha256.Sum256(buffer.Bytes())
+		signedSize += len(tmd.ContentInfoHash)
+	} else {
+		signedSize += binary.Size(wiiContentRecord{}) * len(tmd.Contents)
+	}
+
+	data, err := tmd.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := tmd.Signature.Size()
+	tmd.Signature = signTestData(t, chain.cpKey, data[start:start+signedSize])
+	return tmd
+}
+
+func newTestTicket(t *testing.T, chain *testChain, version uint8) *Ticket {
+	t.Helper()
+	ticket := &Ticket{Signature: Signature{Type: SIGNATURE_RSA_2048_SHA256, Data: make([]byte, 0x100)}}
+	copy(ticket.Header.Issuer[:], testXSIssuer)
+	ticket.Header.FormatVersion = version
+	ticket.Header.TitleKey = [0x10]byte{0xDE, 0xAD, 0xBE, 0xEF}
+	ticket.Header.TicketID = 0x0005000010145D00
+	ticket.Header.TitleID = 0x0005000010145D00
+	ticket.Header.TitleVersion = 16
+	if version == TICKET_VERSION_1 {
+		ticket.V1Section = make([]byte, 0x14+8)
+		binary.BigEndian.PutUint16(ticket.V1Section[0:], 1)
+		binary.BigEndian.PutUint16(ticket.V1Section[2:], 0x14)
+		binary.BigEndian.PutUint32(ticket.V1Section[4:], uint32(len(ticket.V1Section)))
+		copy(ticket.V1Section[0x14:], "sections")
+	}
+
+	data, err := ticket.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket.Signature = signTestData(t, chain.xsKey, data[ticket.Signature.Size():])
+	// The CDN appends the chain after the signed data
+	ticket.Certificates = chain.marshal(t)
+	return ticket
+}
+
+func TestTMDRoundTrip(t *testing.T) {
+	chain := newTestChain(t)
+	for _, version := range []uint8{TMD_VERSION_WII, TMD_VERSION_WIIU} {
+		tmd := newTestTMD(t, chain, version)
+		tmd.Certificates = chain.marshal(t)
+		data, err := tmd.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if parsed.Header != tmd.Header {
+			t.Errorf("version %d: header = %+v, want %+v", version, parsed.Header, tmd.Header)
+		}
+		if len(parsed.Contents) != len(tmd.Contents) {
+			t.Fatalf("version %d: %d contents, want %d", version, len(parsed.Contents), len(tmd.Contents))
+		}
+		for i := range tmd.Contents {
+			if parsed.Contents[i] != tmd.Contents[i] {
+				t.Errorf("version %d: content %d = %+v, want %+v", version, i, parsed.Contents[i], tmd.Contents[i])
+			}
+		}
+		if !bytes.Equal(parsed.Certificates, tmd.Certificates) {
+			t.Errorf("version %d: certificates not kept", version)
+		}
+		remarshaled, err := parsed.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(remarshaled, data) {
+			t.Errorf("version %d: Marshal(Unmarshal(data)) differs from data", version)
+		}
+	}
+}
+
+func TestUnmarshalTMDErrors(t *testing.T) {
+	tmd := newTestTMD(t, newTestChain(t), TMD_VERSION_WIIU)
+	data, err := tmd.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Unmarshal(data[:len(data)-1]); err == nil {
+		t.Error("truncated TMD parsed")
+	}
+	versionData := bytes.Clone(data)
+	versionData[tmd.Signature.Size()+0x40] = 2
+	var versionErr *VersionError
+	if _, err := Unmarshal(versionData); !errors.As(err, &versionErr) || versionErr.Version != 2 {
+		t.Errorf("TMD of version 2: got %v, want a VersionError", err)
+	}
+	signatureData := bytes.Clone(data)
+	binary.BigEndian.PutUint32(signatureData, 0x12345)
+	if _, err := Unmarshal(signatureData); !errors.Is(err, ErrUnknownSignatureType) {
+		t.Errorf("TMD with an unknown signature: got %v, want ErrUnknownSignatureType", err)
+	}
+}
+
+func TestTicketRoundTrip(t *testing.T) {
+	chain := newTestChain(t)
+	for _, version := range []uint8{TICKET_VERSION_0, TICKET_VERSION_1} {
+		ticket := newTestTicket(t, chain, version)
+		data, err := ticket.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := UnmarshalTicket(data)
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if parsed.Header != ticket.Header {
+			t.Errorf("version %d: header = %+v, want %+v", version, parsed.Header, ticket.Header)
+		}
+		if !bytes.Equal(parsed.V1Section, ticket.V1Section) {
+			t.Errorf("version %d: v1 section = % x, want % x", version, parsed.V1Section, ticket.V1Section)
+		}
+		if !bytes.Equal(parsed.Certificates, ticket.Certificates) {
+			t.Errorf("version %d: certificates not kept", version)
+		}
+		remarshaled, err := parsed.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(remarshaled, data) {
+			t.Errorf("version %d: Marshal(Unmarshal(data)) differs from data", version)
+		}
+	}
+}
+
+func TestUnmarshalTicketV1SectionTooLong(t *testing.T) {
+	ticket := newTestTicket(t, newTestChain(t), TICKET_VERSION_1)
+	ticket.Certificates = nil
+	binary.BigEndian.PutUint32(ticket.V1Section[4:], 0x1000)
+	data, err := ticket.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalTicket(data); err == nil {
+		t.Error("ticket with a v1 section longer than the ticket parsed")
+	}
+}
+
+func TestCertificatesRoundTrip(t *testing.T) {
+	chain := newTestChain(t)
+	data := chain.marshal(t)
+	certificates, err := UnmarshalCertificates(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certificates) != len(chain.certificates) {
+		t.Fatalf("%d certificates, want %d", len(certificates), len(chain.certificates))
+	}
+	for i, certificate := range certificates {
+		want := chain.certificates[i]
+		if certificate.Issuer() != want.Issuer() || certificate.Name() != want.Name() {
+			t.Errorf("certificate %d = %s-%s, want %s-%s", i, certificate.Issuer(), certificate.Name(), want.Issuer(), want.Name())
+		}
+		if certificate.Header != want.Header || !bytes.Equal(certificate.PublicKey, want.PublicKey) {
+			t.Errorf("certificate %s not kept", want.Name())
+		}
+	}
+	remarshaled := (&testChain{certificates: certificates}).marshal(t)
+	if !bytes.Equal(remarshaled, data) {
+		t.Error("Marshal(UnmarshalCertificates(data)) differs from data")
+	}
+
+	if _, err := UnmarshalCertificates(data[:len(data)-1]); err == nil {
+		t.Error("truncated chain parsed")
+	}
+}
+
+func TestVerifyCertificates(t *testing.T) {
+	chain := newTestChain(t)
+	if err := VerifyCertificates(chain.certificates); err != nil {
+		t.Fatal(err)
+	}
+
+	// The CP certificate signed by another CA key
+	chain.certificates[1] = newTestCertificate(t, "Root-CA00000003", "CP0000000b", chain.cpKey, newTestKey(t))
+	if err := VerifyCertificates(chain.certificates); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("forged certificate: got %v, want ErrInvalidSignature", err)
+	}
+	if err := VerifyCertificates(chain.certificates[1:]); !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("chain without its CA: got %v, want ErrCertificateNotFound", err)
+	}
+}
+
+func TestTMDVerifySignature(t *testing.T) {
+	chain := newTestChain(t)
+	for _, version := range []uint8{TMD_VERSION_WII, TMD_VERSION_WIIU} {
+		if err := newTestTMD(t, chain, version).VerifySignature(chain.certificates); err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+
+		tmd := newTestTMD(t, chain, version)
+		tmd.Header.TitleVersion++
+		if err := tmd.VerifySignature(chain.certificates); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("version %d, changed header: got %v, want ErrInvalidSignature", version, err)
+		}
+		// Wii U TMDs sign the contents through the content info records
+		tmd = newTestTMD(t, chain, version)
+		tmd.Contents[1].Size++
+		if err := tmd.VerifySignature(chain.certificates); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("version %d, changed content: got %v, want ErrInvalidSignature", version, err)
+		}
+		tmd = newTestTMD(t, chain, version)
+		if err := tmd.VerifySignature(chain.certificates[2:]); !errors.Is(err, ErrCertificateNotFound) {
+			t.Errorf("version %d, without the CP certificate: got %v, want ErrCertificateNotFound", version, err)
+		}
+	}
+
+	tmd := newTestTMD(t, chain, TMD_VERSION_WIIU)
+	tmd.ContentInfos[0].CommandCount = 3
+	if err := tmd.VerifySignature(chain.certificates); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("changed content info: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestTicketVerifySignature(t *testing.T) {
+	chain := newTestChain(t)
+	for _, version := range []uint8{TICKET_VERSION_0, TICKET_VERSION_1} {
+		ticket := newTestTicket(t, chain, version)
+		// The chain appended to the ticket is enough to check it
+		certificates, err := UnmarshalCertificates(ticket.Certificates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ticket.VerifySignature(certificates); err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+
+		ticket.Header.TitleKey[0] ^= 0xFF
+		if err := ticket.VerifySignature(certificates); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("version %d, changed title key: got %v, want ErrInvalidSignature", version, err)
+		}
+		ticket.Header.TitleKey[0] ^= 0xFF
+		if err := ticket.VerifySignature(certificates[:2]); !errors.Is(err, ErrCertificateNotFound) {
+			t.Errorf("version %d, without the XS certificate: got %v, want ErrCertificateNotFound", version, err)
+		}
+	}
+
+	ticket := newTestTicket(t, chain, TICKET_VERSION_0)
+	ticket.Signature.Type = SIGNATURE_ECC_SHA256
+	ticket.Signature.Data = make([]byte, 0x3C)
+	if err := ticket.VerifySignature(chain.certificates); !errors.Is(err, ErrUnsupportedSignature) {
+		t.Errorf("ECC signature: got %v, want ErrUnsupportedSignature", err)
+	}
+}
@@ -22,7 +22,7 @@ func doDeleteEncryptedContents(path string) error {
 		if err != nil {
 			return err
 		}
-		if info.Mode().IsRegular() && !isThisDecryptedFile(filePath) {
+		if info.Mode().IsRegular() && !isThisDecryptedFile(filePath) && info.Name() != manifestFilename {
 			if err := os.Remove(filePath); err != nil {
 				return err
 			}
@@ -0,0 +1,376 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	VERIFICATION_LAYER_NETWORK = "network"
+	VERIFICATION_LAYER_DISK    = "disk"
+)
+
+type VerificationError struct {
+	Path  string
+	Layer string
+}
+
+func (e *VerificationError) Error() string {
+	switch e.Layer {
+	case VERIFICATION_LAYER_DISK:
+		return fmt.Sprintf(Localize("verification of %s failed: the data read back from disk differs from the data received, check your disk and RAM"), e.Path)
+	default:
+		return fmt.Sprintf(Localize("verification of %s failed: the data received from the CDN does not match the TMD"), e.Path)
+	}
+}
+
+func (e *VerificationError) Unwrap() error {
+	return ErrHashMismatch
+}
+
+// HashTreeError reports the 64 KiB block of a content that doesn't match the
+// hash tree of the content: its data (H0) or one of the hash levels above it.
+type HashTreeError struct {
+	ContentID string
+	Block     uint64 // index of the block in the content
+	Level     string // H0, H1, H2 or H3
+	Path      string // decrypted file being written, empty when only verifying
+}
+
+func (e *HashTreeError) Error() string {
+	return fmt.Sprintf(Localize("block %d (offset 0x%X) of content %s failed the %s hash check"), e.Block, e.Block*BLOCK_SIZE_HASHED, e.ContentID, e.Level)
+}
+
+func (e *HashTreeError) Unwrap() error {
+	return ErrHashMismatch
+}
+
+// contentHasher decrypts a content while it is being written and hashes the
+// decrypted data, so that contents without a hash tree are checked against the
+// TMD without reading them back from disk.
+type contentHasher struct {
+	content   Content
+	cbc       cipher.BlockMode
+	hash      hash.Hash
+	pending   []byte // bytes that don't form a whole AES block yet
+	decrypted []byte
+	left      uint64 // decrypted bytes that are still part of the content, the rest is padding
+}
+
+func newContentHasher(titleKey cipher.Block, content Content) *contentHasher {
+	return &contentHasher{
+		content: content,
+		cbc:     cipher.NewCBCDecrypter(titleKey, append(bytes.Clone(content.Index), make([]byte, 14)...)),
+		hash:    sha1.New(),
+		left:    content.Size,
+	}
+}
+
+func (h *contentHasher) Write(p []byte) (int, error) {
+	h.pending = append(h.pending, p...)
+	blocks := len(h.pending) - len(h.pending)%aes.BlockSize
+	if blocks == 0 {
+		return len(p), nil
+	}
+	if cap(h.decrypted) < blocks {
+		h.decrypted = make([]byte, blocks)
+	}
+	decrypted := h.decrypted[:blocks]
+	h.cbc.CryptBlocks(decrypted, h.pending[:blocks])
+	toHash := min(uint64(blocks), h.left)
+	h.hash.Write(decrypted[:toHash])
+	h.left -= toHash
+	h.pending = append(h.pending[:0], h.pending[blocks:]...)
+	return len(p), nil
+}
+
+func (h *contentHasher) verify(path string) error {
+	if h.left != 0 || !bytes.Equal(h.hash.Sum(nil), h.content.Hash[:sha1.Size]) {
+		return &VerificationError{Path: path, Layer: VERIFICATION_LAYER_NETWORK}
+	}
+	return nil
+}
+
+func hashFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// verifyWrittenFile re-reads a file from disk and compares it to the hash of the
+// bytes that were received while downloading it.
+func verifyWrittenFile(path string, receivedHash []byte) error {
+	diskHash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(diskHash, receivedHash) {
+		return &VerificationError{Path: path, Layer: VERIFICATION_LAYER_DISK}
+	}
+	return nil
+}
+
+// verifyWrittenRange re-reads length bytes of file from offset and compares
+// them to the hash of the bytes that were received for them.
+func verifyWrittenRange(file *os.File, offset, length int64, receivedHash []byte) error {
+	hash := sha1.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, offset, length)); err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Sum(nil), receivedHash) {
+		return &VerificationError{Path: file.Name(), Layer: VERIFICATION_LAYER_DISK}
+	}
+	return nil
+}
+
+func verifyH3File(path string, content Content) error {
+	h3Hash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(h3Hash, content.Hash[:sha1.Size]) {
+		return &VerificationError{Path: path, Layer: VERIFICATION_LAYER_NETWORK}
+	}
+	return nil
+}
+
+type ContentVerificationResult struct {
+	ContentID    string
+	Path         string
+	Size         int64
+	ExpectedSize uint64
+	Err          error // nil when the content passed
+}
+
+type TitleVerificationResult struct {
+	TitleID    uint64
+	Version    uint16
+	Slimmed    bool // the folder was slimmed down on purpose, there are no contents to check
+	Quick      bool // only the presence and sizes of the contents were checked, see QuickVerifyTitle
+	Contents   []ContentVerificationResult
+	Signatures SignatureCheckResult // doesn't make the verification fail, generated tickets are never signed
+}
+
+func (r *TitleVerificationResult) Passed() bool {
+	for _, content := range r.Contents {
+		if content.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func findContentFile(path string, contentID uint32) (string, bool) {
+	for _, name := range []string{fmt.Sprintf("%08X", contentID), fmt.Sprintf("%08x", contentID)} {
+		if _, err := os.Stat(filepath.Join(path, name+".app")); err == nil {
+			return name, true
+		}
+	}
+	return fmt.Sprintf("%08X", contentID), false
+}
+
+func checkContentSize(size int64, content Content) error {
+	if content.Type&0x2 == 2 {
+		if uint64(size) != content.Size {
+			return fmt.Errorf(Localize("size mismatch, expected %d bytes"), content.Size)
+		}
+		return nil
+	}
+	// contents without a hash tree are padded to the AES block size
+	if uint64(size) < content.Size || uint64(size) > (content.Size+0xF)&^0xF {
+		return fmt.Errorf(Localize("size mismatch, expected %d bytes"), content.Size)
+	}
+	return nil
+}
+
+func verifyContent(path string, content Content, cipherHashTree cipher.Block) ContentVerificationResult {
+	name, found := findContentFile(path, content.ID)
+	content.CIDStr = name
+	result := ContentVerificationResult{
+		ContentID:    name,
+		Path:         filepath.Join(path, name+".app"),
+		ExpectedSize: content.Size,
+	}
+	if !found {
+		result.Err = errors.New(Localize("missing"))
+		return result
+	}
+
+	file, err := os.Open(result.Path)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Size = info.Size()
+	if err := checkContentSize(result.Size, content); err != nil {
+		result.Err = err
+		return result
+	}
+
+	// Decrypting checks the H3 file against the TMD and every block against the
+	// hash tree, or the SHA-1 of the whole content for contents without one.
+	if err := decryptContentToBuffer(file, io.Discard, cipherHashTree, content); err != nil {
+		result.Err = err
+	}
+	return result
+}
+
+// quickVerifyContent only checks that content and its .h3 file are there, and
+// that the content has the size of the TMD.
+func quickVerifyContent(path string, content Content) ContentVerificationResult {
+	name, found := findContentFile(path, content.ID)
+	result := ContentVerificationResult{
+		ContentID:    name,
+		Path:         filepath.Join(path, name+".app"),
+		ExpectedSize: content.Size,
+	}
+	if !found {
+		result.Err = errors.New(Localize("missing"))
+		return result
+	}
+	info, err := os.Stat(result.Path)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Size = info.Size()
+	if err := checkContentSize(result.Size, content); err != nil {
+		result.Err = err
+		return result
+	}
+	if content.Type&0x2 == 2 {
+		if _, err := os.Stat(filepath.Join(path, name+".h3")); err != nil {
+			result.Err = errors.New(Localize("missing .h3 file"))
+		}
+	}
+	return result
+}
+
+// IsTitleDownloaded reports whether path already holds a complete download of
+// the title in the given version: its TMD matches and every content is on disk
+// with the expected size, unless the manifest records that they were decrypted
+// and deleted. Nothing is hashed, VerifyTitle does that.
+func IsTitleDownloaded(path string, titleID uint64, version uint16) bool {
+	tmd, err := readTMDFromDir(path)
+	if err != nil || tmd.TitleID != titleID || tmd.TitleVersion != version {
+		return false
+	}
+	// The session is only removed once every content was downloaded
+	if _, err := os.Stat(filepath.Join(path, sessionFilename)); err == nil {
+		return false
+	}
+	if manifest, err := ReadManifest(path); err == nil {
+		if manifest.Slimmed || manifest.Partial {
+			return false
+		}
+		if manifest.Decrypted && manifest.EncryptedContentsDeleted {
+			return true
+		}
+	}
+	for _, content := range tmd.Contents {
+		name, found := findContentFile(path, content.ID)
+		if !found {
+			return false
+		}
+		info, err := os.Stat(filepath.Join(path, name+".app"))
+		if err != nil || checkContentSize(info.Size(), content) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyTitle checks the size and hashes of every content of an encrypted title
+// folder against its title.tmd, without downloading anything.
+func VerifyTitle(path string, progressReporter ProgressReporter) (*TitleVerificationResult, error) {
+	return verifyTitle(path, progressReporter, false)
+}
+
+// QuickVerifyTitle only checks that every content of an encrypted title folder
+// is there with the size of its title.tmd. Nothing is hashed, so it is much
+// faster than VerifyTitle on slow disks but doesn't find corrupted contents.
+func QuickVerifyTitle(path string, progressReporter ProgressReporter) (*TitleVerificationResult, error) {
+	return verifyTitle(path, progressReporter, true)
+}
+
+func verifyTitle(path string, progressReporter ProgressReporter, quick bool) (*TitleVerificationResult, error) {
+	tmd, err := readTMDFromDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TitleVerificationResult{
+		TitleID:    tmd.TitleID,
+		Version:    tmd.TitleVersion,
+		Quick:      quick,
+		Contents:   make([]ContentVerificationResult, 0, len(tmd.Contents)),
+		Signatures: CheckTitleSignatures(path),
+	}
+	if manifest, err := ReadManifest(path); err == nil && manifest.Slimmed {
+		result.Slimmed = true
+		return result, nil
+	}
+
+	var cipherHashTree cipher.Block
+	if !quick {
+		if cipherHashTree, err = loadTitleKey(path, tmd.TitleID); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, content := range tmd.Contents {
+		if progressReporter != nil {
+			if progressReporter.Cancelled() {
+				break
+			}
+			progressReporter.UpdateDecryptionProgress(float64(i) / float64(len(tmd.Contents)))
+		}
+		if quick {
+			result.Contents = append(result.Contents, quickVerifyContent(path, content))
+		} else {
+			result.Contents = append(result.Contents, verifyContent(path, content, cipherHashTree))
+		}
+	}
+	if !quick && len(result.Contents) == len(tmd.Contents) {
+		recordVerification(path, result)
+	}
+	return result, nil
+}
+
+// recordVerification keeps when the contents of a title folder were last
+// hashed and whether they passed in its manifest, for the archive reports.
+// Folders without a manifest are left alone.
+func recordVerification(path string, result *TitleVerificationResult) {
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		return
+	}
+	verifiedAt := time.Now()
+	manifest.LastVerifiedAt = &verifiedAt
+	manifest.LastVerificationFailed = !result.Passed()
+	WriteManifest(path, manifest)
+}
@@ -0,0 +1,64 @@
+package wiiudownloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// TitleVersionChange is a new version of a watched title published on the CDN.
+type TitleVersionChange struct {
+	TitleID         uint64
+	Name            string
+	PreviousVersion uint16
+	Version         uint16
+}
+
+// watchedTID returns the title whose TMD tells when a title gets updated, games
+// are updated through their update title.
+func watchedTID(titleID uint64) uint64 {
+	if IsGame(titleID) {
+		return ToUpdateTID(titleID)
+	}
+	return titleID
+}
+
+// CheckTitleVersions fetches the latest version of the given titles and returns
+// the ones newer than the versions in known, which is updated in place. Titles
+// not in known yet are recorded without being reported. Titles that can't be
+// checked are skipped and their errors returned along with the changes. Games
+// without any update yet are recorded as version 0, so their first update is
+// reported.
+func CheckTitleVersions(client *http.Client, titleIDs []uint64, known map[uint64]uint16) ([]TitleVersionChange, error) {
+	changes := make([]TitleVersionChange, 0)
+	errs := make([]error, 0)
+	for _, titleID := range titleIDs {
+		tid := watchedTID(titleID)
+		version, err := FetchTitleVersion(client, tid)
+		if errors.Is(err, ErrNoUpdateAvailable) {
+			if _, ok := known[tid]; !ok {
+				known[tid] = 0
+			}
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%016x: %w", tid, err))
+			continue
+		}
+		previous, ok := known[tid]
+		known[tid] = version
+		if ok && version > previous {
+			name := GetTitleEntryFromTid(tid).Name
+			if name == "" {
+				name = GetTitleEntryFromTid(titleID).Name
+			}
+			changes = append(changes, TitleVersionChange{
+				TitleID:         tid,
+				Name:            name,
+				PreviousVersion: previous,
+				Version:         version,
+			})
+		}
+	}
+	return changes, errors.Join(errs...)
+}
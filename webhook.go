@@ -0,0 +1,109 @@
+package wiiudownloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	WEBHOOK_EVENT_STARTED   = "started"
+	WEBHOOK_EVENT_COMPLETED = "completed"
+	WEBHOOK_EVENT_FAILED    = "failed"
+	WEBHOOK_EVENT_UPDATED   = "updated" // a watched title got a new version
+)
+
+// WebhookEvent is the JSON payload posted to generic webhooks when a download
+// starts, completes or fails, and when a watched title gets a new version.
+type WebhookEvent struct {
+	Event   string `json:"event"`
+	TitleID string `json:"titleID"`
+	Name    string `json:"name"`
+	Error   string `json:"error,omitempty"`
+	// PreviousVersion and Version are only set for WEBHOOK_EVENT_UPDATED
+	PreviousVersion *uint16   `json:"previousVersion,omitempty"`
+	Version         *uint16   `json:"version,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+func NewWebhookEvent(event string, titleID uint64, err error) WebhookEvent {
+	webhookEvent := WebhookEvent{
+		Event:   event,
+		TitleID: fmt.Sprintf("%016x", titleID),
+		Name:    GetTitleEntryFromTid(titleID).Name,
+		Time:    time.Now(),
+	}
+	if err != nil {
+		webhookEvent.Error = err.Error()
+	}
+	return webhookEvent
+}
+
+// NewTitleUpdateWebhookEvent returns the WEBHOOK_EVENT_UPDATED event of a
+// change found by CheckTitleVersions.
+func NewTitleUpdateWebhookEvent(change TitleVersionChange) WebhookEvent {
+	return WebhookEvent{
+		Event:           WEBHOOK_EVENT_UPDATED,
+		TitleID:         fmt.Sprintf("%016x", change.TitleID),
+		Name:            change.Name,
+		PreviousVersion: &change.PreviousVersion,
+		Version:         &change.Version,
+		Time:            time.Now(),
+	}
+}
+
+// Message describes the event in a sentence, for chat webhooks.
+func (e WebhookEvent) Message() string {
+	switch e.Event {
+	case WEBHOOK_EVENT_STARTED:
+		return fmt.Sprintf(Localize("Started downloading %s (%s)"), e.Name, e.TitleID)
+	case WEBHOOK_EVENT_COMPLETED:
+		return fmt.Sprintf(Localize("Finished downloading %s (%s)"), e.Name, e.TitleID)
+	case WEBHOOK_EVENT_UPDATED:
+		if e.PreviousVersion != nil && e.Version != nil {
+			return fmt.Sprintf(Localize("%s (%s) was updated from v%d to v%d"), e.Name, e.TitleID, *e.PreviousVersion, *e.Version)
+		}
+		return fmt.Sprintf(Localize("%s (%s) was updated"), e.Name, e.TitleID)
+	default:
+		return fmt.Sprintf(Localize("Failed to download %s (%s): %s"), e.Name, e.TitleID, e.Error)
+	}
+}
+
+// webhookPayload returns what to post to webhookURL, Discord and Slack webhooks
+// only accept their own message format.
+func webhookPayload(webhookURL string, event WebhookEvent) interface{} {
+	parsedURL, err := url.Parse(webhookURL)
+	if err != nil {
+		return event
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+	switch {
+	case (host == "discord.com" || host == "discordapp.com" || strings.HasSuffix(host, ".discord.com")) && strings.HasPrefix(parsedURL.Path, "/api/webhooks/"):
+		return map[string]string{"content": event.Message()}
+	case host == "hooks.slack.com":
+		return map[string]string{"text": event.Message()}
+	}
+	return event
+}
+
+// SendWebhook posts an event to a webhook, as a chat message for Discord and
+// Slack webhooks and as a WebhookEvent for any other URL.
+func SendWebhook(client *http.Client, webhookURL string, event WebhookEvent) error {
+	data, err := json.Marshal(webhookPayload(webhookURL, event))
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf(Localize("webhook answered with status code %d"), resp.StatusCode)
+	}
+	return nil
+}
@@ -11,6 +11,9 @@ type WriterProgress struct {
 	updateProgressTicker *time.Ticker
 	downloadToReport     int64 // Number of bytes to report to the progressReporter since the last update
 	filename             string
+	limiter              *BandwidthLimiter
+	sharedLimiter        *BandwidthLimiter
+	hash                 io.Writer // fed with every byte written, so the data can be checked without reading it back
 }
 
 func newWriterProgress(writer io.Writer, progressReporter ProgressReporter, filename string) *WriterProgress {
@@ -24,6 +27,9 @@ func (r *WriterProgress) Write(p []byte) (n int, err error) {
 		r.downloadToReport = 0
 	default:
 	}
+	for r.progressReporter.Paused() && !r.progressReporter.Cancelled() {
+		time.Sleep(pausePollInterval)
+	}
 	if r.progressReporter.Cancelled() {
 		return 0, nil
 	}
@@ -32,6 +38,11 @@ func (r *WriterProgress) Write(p []byte) (n int, err error) {
 		return n, err
 	}
 	r.downloadToReport += int64(n)
+	if r.hash != nil {
+		r.hash.Write(p[:n])
+	}
+	r.limiter.wait(n)
+	r.sharedLimiter.wait(n)
 	return n, err
 }
 